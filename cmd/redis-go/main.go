@@ -5,37 +5,77 @@ import (
 	"fmt"
 
 	"os"
+	"strings"
 
 	"github.com/Viet-ph/redis-go/config"
 	"github.com/Viet-ph/redis-go/internal/connection"
 	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/logger"
 	"github.com/Viet-ph/redis-go/server"
 )
 
+// The defaults of the flags are the initial values of the variables they
+// set, which are also the defaults CONFIG REWRITE compares against
 func setupFlags() {
-	flag.StringVar(&config.Host, "host", "0.0.0.0", "host for the redis server")
-	flag.StringVar(&info.Master, "replicaof", "", "master instance at <MASTER_HOST> <MASTER_PORT>")
-	flag.IntVar(&config.Port, "port", 6379, "port for the redis server")
-	flag.StringVar(&config.RdbDir, "dir", "./tmp/redis-files", "rdb file directory")
-	flag.StringVar(&config.RdbFileName, "dbfilename", "dump", "rdb file directory")
-	flag.Parse()
+	flag.StringVar(&config.Host, "host", config.Host, "host for the redis server")
+	flag.StringVar(&config.Host, "bind", config.Host, "host for the redis server, same as --host")
+	flag.StringVar(&info.Master, "replicaof", info.Master, "master instance at <MASTER_HOST> <MASTER_PORT>")
+	flag.IntVar(&config.Port, "port", config.Port, "port for the redis server")
+	flag.StringVar(&config.RdbDir, "dir", config.RdbDir, "rdb file directory")
+	flag.StringVar(&config.RdbFileName, "dbfilename", config.RdbFileName, "rdb file directory")
+	flag.StringVar(&config.RequirePass, "requirepass", config.RequirePass, "password clients must authenticate with")
+	flag.StringVar(&config.MasterAuth, "masterauth", config.MasterAuth, "password to authenticate with the master")
+	flag.Func("maxmemory", "memory limit like 100mb, not enforced", func(value string) (err error) {
+		config.MaxMemory, err = config.ParseMemory(value)
+		return err
+	})
+	flag.IntVar(&config.MaximumClients, "maxclients", config.MaximumClients, "maximum number of connected clients")
+	flag.IntVar(&config.Timeout, "timeout", config.Timeout, "close clients idle for this many seconds, 0 to never close them")
+	flag.Func("loglevel", "debug, verbose, notice, warning or nothing (default notice)", logger.SetLevel)
+	flag.Func("save", `rdb save points as "<seconds> <changes> ...", "" disables saving (default "`+config.FormatSavePoints(config.SavePoints)+`")`, func(value string) error {
+		savePoints, err := config.ParseSavePoints(value)
+		if err == nil {
+			config.SavePoints = savePoints
+		}
+		return err
+	})
+	flag.BoolVar(&config.RdbChecksum, "rdbchecksum", config.RdbChecksum, "write and verify the CRC64 checksum of rdb files")
+	flag.BoolVar(&config.AppendOnly, "appendonly", config.AppendOnly, "log every write command to the append only file")
+	flag.StringVar(&config.AppendFilename, "appendfilename", config.AppendFilename, "base name of the append only files")
+	flag.StringVar(&config.AppendDirname, "appenddirname", config.AppendDirname, "directory of the append only files, in the rdb file directory")
+	flag.StringVar(&config.AppendFsync, "appendfsync", config.AppendFsync, "append only file fsync policy: always, everysec or no")
+	flag.BoolVar(&config.AofLoadTruncated, "aof-load-truncated", config.AofLoadTruncated, "load an append only file ending with an incomplete command by dropping it")
+	flag.IntVar(&config.AutoAofRewritePercentage, "auto-aof-rewrite-percentage", config.AutoAofRewritePercentage, "rewrite the append only file once it grew by this percentage, 0 to disable")
+	flag.Int64Var(&config.AutoAofRewriteMinSize, "auto-aof-rewrite-min-size", config.AutoAofRewriteMinSize, "minimum append only file size in bytes for automatic rewrites")
+
+	// Like redis-server, a configuration file can be given before the
+	// flags, which override its directives
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if err := config.LoadFile(args[0]); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		args = args[1:]
+	}
+	flag.CommandLine.Parse(args)
 }
 
 func main() {
 	setupFlags()
 	flag.PrintDefaults()
 
-	fmt.Println("Setting up master/slave ...")
+	logger.Notice("Setting up master/slave ...")
 	masterNetConn, datastore, err := connection.SetupMasterSlave()
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
-	fmt.Println("Master/slave setup done.")
+	logger.Notice("Master/slave setup done.")
 
 	var srv *server.AsyncServer
 	if masterNetConn != nil {
-		fmt.Println("Starting slave server ...")
+		logger.Notice("Starting slave server ...")
 		var masterConn *connection.Conn
 		masterConn, err = connection.NetConnToConn(masterNetConn)
 		if err != nil {
@@ -44,7 +84,7 @@ func main() {
 		}
 		srv, err = server.NewAsyncServer(masterConn, datastore)
 	} else {
-		fmt.Println("Starting master server ...")
+		logger.Notice("Starting master server ...")
 		srv, err = server.NewAsyncServer(nil, nil)
 	}
 	if err != nil {
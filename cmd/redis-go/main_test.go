@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Viet-ph/redis-go/config"
+)
+
+// The flags apply their defaults before the config file is read, CONFIG
+// REWRITE must not see them as changes
+func TestRewriteAfterFlagDefaults(t *testing.T) {
+	defer func(args []string) { os.Args = args }(os.Args)
+
+	content := "# Port\nport 6000\n"
+	path := filepath.Join(t.TempDir(), "redis.conf")
+	os.WriteFile(path, []byte(content), 0640)
+	os.Args = []string{"redis-go", path}
+	setupFlags()
+
+	if err := config.Rewrite(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if rewritten, _ := os.ReadFile(path); string(rewritten) != content {
+		t.Errorf("Expected %q to be left as is but got %q", content, rewritten)
+	}
+}
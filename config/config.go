@@ -1,31 +1,98 @@
 package config
 
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
 var (
 	Host string = "0.0.0.0"
 	Port int    = 6379
 
 	RedisVer = "6.0.16"
-	RdbVer   = "0006"
+	RdbVer   = "0011"
 
 	DefaultMessageSize = 1024
 	MaximumClients     = 100
 	MaximumReplicas    = 100
 
-	RdbDir      string
-	RdbFileName string
+	// Seconds after which idle clients are closed, 0 to never close them
+	Timeout = 0
+
+	// Clients sending more than this without completing a command are
+	// closed
+	QueryBufferLimit int64 = 1024 * 1024 * 1024
+
+	// Not enforced, 0 means no limit
+	MaxMemory int64
+
+	// Password clients authenticate with through AUTH, none if empty, and
+	// the one a replica uses to authenticate with its master
+	RequirePass string
+	MasterAuth  string
 
-	//Persistence
-	NumKeyChanges = 1
-	Interval      = 30 //seconds
+	RdbDir      = "./tmp/redis-files"
+	RdbFileName = "dump"
+	RdbChecksum = true
+
+	//Persistence, save the RDB file when any of the save points is reached
+	SavePoints = []SavePoint{{3600, 1}, {300, 100}, {60, 10000}}
+
+	//Append only file, split in files kept in AppendDirname inside RdbDir
+	AppendOnly       = false
+	AppendFilename   = "appendonly.aof"
+	AppendDirname    = "appendonlydir"
+	AppendFsync      = "everysec"
+	AofLoadTruncated = true
+
+	// Rewrite the append only file once it grew by this percentage since
+	// the last rewrite and is at least min size bytes, 0 disables it
+	AutoAofRewritePercentage       = 100
+	AutoAofRewriteMinSize    int64 = 64 * 1024 * 1024
 )
 
-func GetConfigValue(cfgName string) (any, bool) {
-	switch cfgName {
-	case "dir":
-		return RdbDir, true
-	case "dbfilename":
-		return RdbFileName, true
-	default:
-		return nil, false
+// SavePoint triggers a save once Changes keys were modified and Seconds
+// elapsed since the last save
+type SavePoint struct {
+	Seconds int
+	Changes int
+}
+
+// ParseSavePoints parses save points written as pairs of seconds and
+// changes, like "3600 1 300 100". An empty string disables saving.
+func ParseSavePoints(s string) ([]SavePoint, error) {
+	fields := strings.Fields(s)
+	if len(fields)%2 != 0 {
+		return nil, errors.New("invalid save parameters")
+	}
+
+	savePoints := make([]SavePoint, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err := strconv.Atoi(fields[i])
+		if err != nil || seconds < 1 {
+			return nil, errors.New("invalid save parameters")
+		}
+		changes, err := strconv.Atoi(fields[i+1])
+		if err != nil || changes < 0 {
+			return nil, errors.New("invalid save parameters")
+		}
+		savePoints = append(savePoints, SavePoint{seconds, changes})
+	}
+	return savePoints, nil
+}
+
+func FormatSavePoints(savePoints []SavePoint) string {
+	fields := make([]string, 0, 2*len(savePoints))
+	for _, savePoint := range savePoints {
+		fields = append(fields, strconv.Itoa(savePoint.Seconds), strconv.Itoa(savePoint.Changes))
+	}
+	return strings.Join(fields, " ")
+}
+
+func yesNo(enabled bool) string {
+	if enabled {
+		return "yes"
 	}
+	return "no"
 }
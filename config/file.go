@@ -0,0 +1,155 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+// Includes nested deeper than this are most likely a loop
+const maxIncludeDepth = 16
+
+// Path of the configuration file the server was started with, if any
+var ConfigFile string
+
+// LoadFile applies the directives of a redis.conf style file: one
+// directive per line followed by its arguments, which can be quoted, and
+// comments starting with #. Other files can be loaded with include.
+func LoadFile(path string) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	loader := &fileLoader{}
+	if err := loader.load(path, 0); err != nil {
+		return err
+	}
+	ConfigFile = absPath
+	return nil
+}
+
+type fileLoader struct {
+	savePointsSet bool
+}
+
+func (loader *fileLoader) load(path string, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("too many nested includes loading %s", path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		args, err := proto.SplitArgs(line)
+		if err == nil && len(args) > 0 {
+			directive := strings.ToLower(args[0])
+			if directive == "include" && len(args) == 2 {
+				err = loader.load(args[1], depth+1)
+			} else {
+				err = loader.apply(directive, args[1:])
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("error in config file %s at line %d: '%s': %w", path, lineNumber, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+var errBadDirective = errors.New("bad directive or wrong number of arguments")
+
+func (loader *fileLoader) apply(directive string, args []string) error {
+	p := lookupParam(directive)
+	if p == nil || len(args) == 0 || (!p.multiArg && len(args) != 1) {
+		return errBadDirective
+	}
+
+	// The first save directive replaces the default save points, the
+	// following ones add to it
+	if p.name == "save" {
+		savePoints, err := ParseSavePoints(strings.Join(args, " "))
+		if err != nil {
+			return err
+		}
+		if !loader.savePointsSet {
+			SavePoints = nil
+			loader.savePointsSet = true
+		}
+		SavePoints = append(SavePoints, savePoints...)
+		return nil
+	}
+
+	return p.set(strings.Join(args, " "))
+}
+
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, errors.New("invalid port")
+	}
+	return port, nil
+}
+
+func parseYesNo(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	default:
+		return false, errors.New("argument must be 'yes' or 'no'")
+	}
+}
+
+func parseFsync(value string) (string, error) {
+	value = strings.ToLower(value)
+	switch value {
+	case "always", "everysec", "no":
+		return value, nil
+	default:
+		return "", errors.New("argument must be 'always', 'everysec' or 'no'")
+	}
+}
+
+// ParseMemory parses a number of bytes with an optional unit like Redis
+// does: k, m and g are powers of 1000, kb, mb and gb powers of 1024.
+func ParseMemory(value string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	}
+
+	number, multiplier := strings.ToLower(value), int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSuffix(number, unit.suffix), unit.multiplier
+			break
+		}
+	}
+	n, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)/multiplier {
+		return 0, errors.New("argument must be a memory value")
+	}
+	return n * multiplier, nil
+}
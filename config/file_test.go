@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Viet-ph/redis-go/internal/info"
+)
+
+func TestParseMemory(t *testing.T) {
+	for value, expected := range map[string]int64{"100": 100, "1k": 1000, "1kb": 1024, "2MB": 2 << 20, "1g": 1e9} {
+		if n, err := ParseMemory(value); err != nil || n != expected {
+			t.Errorf("Expected %d for %s but got %d, %v", expected, value, n, err)
+		}
+	}
+	for _, value := range []string{"", "mb", "-1", "1tb"} {
+		if _, err := ParseMemory(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	defer func(port int, dir, dbFilename string, savePoints []SavePoint, appendOnly bool, requirePass, master, configFile string) {
+		Port, RdbDir, RdbFileName, SavePoints, AppendOnly, RequirePass, info.Master, ConfigFile = port, dir, dbFilename, savePoints, appendOnly, requirePass, master, configFile
+	}(Port, RdbDir, RdbFileName, SavePoints, AppendOnly, RequirePass, info.Master, ConfigFile)
+
+	dir := t.TempDir()
+	included := filepath.Join(dir, "included.conf")
+	path := filepath.Join(dir, "redis.conf")
+	os.WriteFile(included, []byte("port 7000\nsave 60 10000\n"), 0666)
+	os.WriteFile(path, []byte(strings.Join([]string{
+		"# Comment",
+		"port 6000",
+		"dir /data",
+		"dbfilename dump.rdb",
+		"save 900 1",
+		"include " + included,
+		"appendonly yes",
+		`requirepass "secret pass"`,
+		"replicaof 127.0.0.1 6380",
+	}, "\n")), 0666)
+
+	if err := LoadFile(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if Port != 7000 || RdbDir != "/data" || RdbFileName != "dump" || !AppendOnly || RequirePass != "secret pass" {
+		t.Errorf("Unexpected configuration port %d dir %s dbfilename %s appendonly %t requirepass %s", Port, RdbDir, RdbFileName, AppendOnly, RequirePass)
+	}
+	if expected := []SavePoint{{900, 1}, {60, 10000}}; !reflect.DeepEqual(SavePoints, expected) {
+		t.Errorf("Expected save points %v but got %v", expected, SavePoints)
+	}
+	if info.Master != "127.0.0.1 6380" || ConfigFile != path {
+		t.Errorf("Unexpected master %q or config file %q", info.Master, ConfigFile)
+	}
+
+	for _, content := range []string{"port", "port abc", "unknown yes", "appendonly maybe", "include " + path} {
+		os.WriteFile(path, []byte(content), 0666)
+		if err := LoadFile(path); err == nil {
+			t.Errorf("Expected an error loading %q", content)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/logger"
+)
+
+// A configuration parameter, read from the config file and through
+// CONFIG GET and CONFIG SET
+type param struct {
+	name  string
+	alias string
+	get   func() string
+	// Validates value and applies it
+	set func(value string) error
+	// Only set when starting, CONFIG SET refuses to change it
+	immutable bool
+	// The directive takes several arguments, seen as a single value with
+	// the arguments separated by spaces
+	multiArg bool
+	// Value before the config file and the flags were applied
+	defaultValue string
+}
+
+var params = []*param{
+	{
+		name:      "bind",
+		get:       func() string { return Host },
+		set:       setBind,
+		immutable: true,
+		multiArg:  true,
+	},
+	intParam("port", &Port, 0, 65535, true),
+	intParam("maxclients", &MaximumClients, 1, 1<<31-1, false),
+	memoryParam("maxmemory", &MaxMemory),
+	intParam("timeout", &Timeout, 0, 1<<31-1, false),
+	memoryParam("client-query-buffer-limit", &QueryBufferLimit),
+	{
+		name: "loglevel",
+		get:  logger.Level,
+		set:  logger.SetLevel,
+	},
+	stringParam("requirepass", &RequirePass, false),
+	stringParam("masterauth", &MasterAuth, false),
+	{
+		name:      "replicaof",
+		alias:     "slaveof",
+		get:       func() string { return info.Master },
+		set:       setReplicaOf,
+		immutable: true,
+		multiArg:  true,
+	},
+	stringParam("dir", &RdbDir, false),
+	{
+		name: "dbfilename",
+		get:  func() string { return RdbFileName },
+		set: func(value string) error {
+			if value == "" || strings.ContainsRune(value, '/') {
+				return errors.New("dbfilename can't be a path, just a filename")
+			}
+			// The RDB extension is added when opening the file
+			RdbFileName = strings.TrimSuffix(value, ".rdb")
+			return nil
+		},
+	},
+	{
+		name: "save",
+		get:  func() string { return FormatSavePoints(SavePoints) },
+		set: func(value string) error {
+			savePoints, err := ParseSavePoints(value)
+			if err == nil {
+				SavePoints = savePoints
+			}
+			return err
+		},
+		multiArg: true,
+	},
+	boolParam("rdbchecksum", &RdbChecksum, false),
+	boolParam("appendonly", &AppendOnly, true),
+	stringParam("appendfilename", &AppendFilename, true),
+	stringParam("appenddirname", &AppendDirname, true),
+	{
+		name: "appendfsync",
+		get:  func() string { return AppendFsync },
+		set: func(value string) (err error) {
+			AppendFsync, err = parseFsync(value)
+			return err
+		},
+		immutable: true,
+	},
+	boolParam("aof-load-truncated", &AofLoadTruncated, false),
+	intParam("auto-aof-rewrite-percentage", &AutoAofRewritePercentage, 0, 1<<31-1, false),
+	memoryParam("auto-aof-rewrite-min-size", &AutoAofRewriteMinSize),
+}
+
+func init() {
+	for _, p := range params {
+		p.defaultValue = p.get()
+	}
+}
+
+func lookupParam(name string) *param {
+	name = strings.ToLower(name)
+	for _, p := range params {
+		if p.name == name || p.alias == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// ParamNames returns the names of the configuration parameters, sorted
+func ParamNames() []string {
+	names := make([]string, len(params))
+	for i, p := range params {
+		names[i] = p.name
+	}
+	slices.Sort(names)
+	return names
+}
+
+// GetConfigValue returns the value of the parameter called cfgName
+func GetConfigValue(cfgName string) (string, bool) {
+	p := lookupParam(cfgName)
+	if p == nil {
+		return "", false
+	}
+	return p.get(), true
+}
+
+// SetConfigValues changes the parameters given as name value pairs at
+// runtime. Either all of them are changed or none if any fails.
+func SetConfigValues(pairs [][2]string) error {
+	toSet := make([]*param, len(pairs))
+	for i, pair := range pairs {
+		p := lookupParam(pair[0])
+		if p == nil {
+			return fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", pair[0])
+		}
+		if p.immutable {
+			return setFailed(pair[0], errors.New("can't set immutable config"))
+		}
+		if slices.Contains(toSet[:i], p) {
+			return setFailed(pair[0], errors.New("duplicate parameter"))
+		}
+		toSet[i] = p
+	}
+
+	previous := make([]string, 0, len(pairs))
+	for i, p := range toSet {
+		value := p.get()
+		if err := p.set(pairs[i][1]); err != nil {
+			// Put back the ones already changed
+			for j, value := range previous {
+				toSet[j].set(value)
+			}
+			return setFailed(pairs[i][0], err)
+		}
+		previous = append(previous, value)
+	}
+	return nil
+}
+
+// SetConfigValue changes a single parameter, see SetConfigValues
+func SetConfigValue(cfgName, value string) error {
+	return SetConfigValues([][2]string{{cfgName, value}})
+}
+
+func setFailed(name string, err error) error {
+	return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %w", name, err)
+}
+
+func stringParam(name string, value *string, immutable bool) *param {
+	return &param{
+		name: name,
+		get:  func() string { return *value },
+		set: func(s string) error {
+			*value = s
+			return nil
+		},
+		immutable: immutable,
+	}
+}
+
+func boolParam(name string, value *bool, immutable bool) *param {
+	return &param{
+		name: name,
+		get:  func() string { return yesNo(*value) },
+		set: func(s string) (err error) {
+			*value, err = parseYesNo(s)
+			return err
+		},
+		immutable: immutable,
+	}
+}
+
+func intParam(name string, value *int, min, max int, immutable bool) *param {
+	return &param{
+		name: name,
+		get:  func() string { return strconv.Itoa(*value) },
+		set: func(s string) error {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < min || n > max {
+				return fmt.Errorf("argument must be between %d and %d inclusive", min, max)
+			}
+			*value = n
+			return nil
+		},
+		immutable: immutable,
+	}
+}
+
+func memoryParam(name string, value *int64) *param {
+	return &param{
+		name: name,
+		get:  func() string { return strconv.FormatInt(*value, 10) },
+		set: func(s string) error {
+			n, err := ParseMemory(s)
+			if err == nil {
+				*value = n
+			}
+			return err
+		},
+	}
+}
+
+// Redis binds every address given, only the first one is used
+func setBind(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return errors.New("bind needs an address")
+	}
+	Host = fields[0]
+	return nil
+}
+
+func setReplicaOf(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || (len(fields) == 2 && strings.EqualFold(fields[0], "no") && strings.EqualFold(fields[1], "one")) {
+		info.Master = ""
+		return nil
+	}
+	if len(fields) != 2 {
+		return errors.New("replicaof needs a host and a port")
+	}
+	if _, err := parsePort(fields[1]); err != nil {
+		return errors.New("invalid master port")
+	}
+	info.Master = fields[0] + " " + fields[1]
+	return nil
+}
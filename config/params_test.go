@@ -0,0 +1,107 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetConfigValues(t *testing.T) {
+	defer func(maxClients, timeout int, savePoints []SavePoint) {
+		MaximumClients, Timeout, SavePoints = maxClients, timeout, savePoints
+	}(MaximumClients, Timeout, SavePoints)
+	MaximumClients, Timeout = 100, 0
+
+	if err := SetConfigValues([][2]string{{"MaxClients", "10"}, {"save", "60 1"}}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if value, _ := GetConfigValue("maxclients"); value != "10" || !reflect.DeepEqual(SavePoints, []SavePoint{{60, 1}}) {
+		t.Errorf("Expected maxclients 10 and save 60 1 but got %s and %v", value, SavePoints)
+	}
+
+	// Nothing is changed when any value is invalid
+	err := SetConfigValues([][2]string{{"timeout", "5"}, {"maxclients", "0"}})
+	if err == nil || !strings.Contains(err.Error(), "'maxclients'") || Timeout != 0 || MaximumClients != 10 {
+		t.Errorf("Expected an error and no change but got %v, timeout %d", err, Timeout)
+	}
+
+	for pairs, expected := range map[[2]string]string{
+		{"port", "7000"}:      "immutable",
+		{"nope", "1"}:         "Unknown option",
+		{"loglevel", "loud"}:  "argument must be one of",
+		{"appendonly", "yes"}: "immutable",
+	} {
+		if err := SetConfigValue(pairs[0], pairs[1]); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected an error containing %q setting %s but got %v", expected, pairs[0], err)
+		}
+	}
+	if err := SetConfigValues([][2]string{{"timeout", "1"}, {"TIMEOUT", "2"}}); err == nil {
+		t.Errorf("Expected an error setting a parameter twice")
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	defer func(port, timeout int, requirePass string, savePoints []SavePoint, configFile string) {
+		Port, Timeout, RequirePass, SavePoints, ConfigFile = port, timeout, requirePass, savePoints, configFile
+	}(Port, Timeout, RequirePass, SavePoints, ConfigFile)
+
+	ConfigFile = ""
+	if err := Rewrite(); err != ErrNoConfigFile {
+		t.Errorf("Expected %v but got %v", ErrNoConfigFile, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "redis.conf")
+	os.WriteFile(path, []byte("# Port\nport 6000\nsave 900 1\nsave 300 10\n\n# End\n"), 0640)
+	if err := LoadFile(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	Timeout = 30
+	RequirePass = `pass "word"`
+	SavePoints = nil
+
+	if err := Rewrite(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	expected := "# Port\nport 6000\nsave \"\"\n\n# End\n" + rewriteSignature + "\ntimeout 30\nrequirepass \"pass \\\"word\\\"\"\n"
+	if string(content) != expected {
+		t.Errorf("Expected %q but got %q", expected, content)
+	}
+	if stat, _ := os.Stat(path); stat.Mode().Perm() != 0640 {
+		t.Errorf("Expected the file mode to be kept but got %v", stat.Mode())
+	}
+
+	// What's written is read back the same
+	Timeout, RequirePass = 0, ""
+	if err := LoadFile(path); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if Timeout != 30 || RequirePass != `pass "word"` || len(SavePoints) != 0 {
+		t.Errorf("Expected the rewritten values back but got timeout %d requirepass %q save %v", Timeout, RequirePass, SavePoints)
+	}
+}
+
+// Rewriting a config nothing was changed in must leave it as it is, with
+// no directive added for parameters left to their default
+func TestRewriteUntouched(t *testing.T) {
+	defer func(port int, savePoints []SavePoint, configFile string) {
+		Port, SavePoints, ConfigFile = port, savePoints, configFile
+	}(Port, SavePoints, ConfigFile)
+
+	for _, content := range []string{"# Nothing set\n", "# Port\nport 6000\n\nsave 900 1\n"} {
+		path := filepath.Join(t.TempDir(), "redis.conf")
+		os.WriteFile(path, []byte(content), 0640)
+		if err := LoadFile(path); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if err := Rewrite(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if rewritten, _ := os.ReadFile(path); string(rewritten) != content {
+			t.Errorf("Expected %q to be left as is but got %q", content, rewritten)
+		}
+	}
+}
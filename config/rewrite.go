@@ -0,0 +1,144 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+const rewriteSignature = "# Generated by CONFIG REWRITE"
+
+var ErrNoConfigFile = errors.New("The server is running without a config file")
+
+// Rewrite writes the current configuration back to the file the server
+// was started with. Lines of parameters are updated in place, keeping
+// comments and the rest of the file as is, and parameters the file didn't
+// set are appended if they differ from their default.
+func Rewrite() error {
+	if ConfigFile == "" {
+		return ErrNoConfigFile
+	}
+
+	content, err := os.ReadFile(ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	var (
+		lines   []string
+		written = make(map[*param]bool)
+	)
+	for _, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		// Appended by a previous rewrite, added again below if needed
+		if trimmed == rewriteSignature {
+			continue
+		}
+		args, err := proto.SplitArgs(trimmed)
+		if err != nil || len(args) == 0 || strings.HasPrefix(trimmed, "#") {
+			lines = append(lines, line)
+			continue
+		}
+		p := lookupParam(args[0])
+		if p == nil {
+			lines = append(lines, line)
+			continue
+		}
+
+		// Only the first line of a parameter is kept
+		if !written[p] {
+			lines = append(lines, p.configLine())
+			written[p] = true
+		}
+	}
+
+	var appended []string
+	for _, p := range params {
+		if !written[p] && p.get() != p.defaultValue {
+			appended = append(appended, p.configLine())
+		}
+	}
+	if len(appended) > 0 {
+		lines = append(lines, rewriteSignature)
+		lines = append(lines, appended...)
+	}
+
+	return writeConfigFile(ConfigFile, []byte(strings.Join(lines, "\n")+"\n"))
+}
+
+func (p *param) configLine() string {
+	value := p.get()
+	if p.multiArg && value != "" {
+		return p.name + " " + value
+	}
+	return p.name + " " + quoteArg(value)
+}
+
+// Quotes s if needed so it's read back as is by proto.SplitArgs
+func quoteArg(s string) string {
+	needsQuotes := s == ""
+	for i := 0; i < len(s) && !needsQuotes; i++ {
+		c := s[i]
+		needsQuotes = c <= ' ' || c > '~' || c == '"' || c == '\'' || c == '\\'
+	}
+	if !needsQuotes {
+		return s
+	}
+
+	var builder strings.Builder
+	builder.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			builder.WriteByte('\\')
+			builder.WriteByte(c)
+		case '\n':
+			builder.WriteString(`\n`)
+		case '\r':
+			builder.WriteString(`\r`)
+		case '\t':
+			builder.WriteString(`\t`)
+		default:
+			if c < ' ' || c > '~' {
+				fmt.Fprintf(&builder, `\x%02x`, c)
+			} else {
+				builder.WriteByte(c)
+			}
+		}
+	}
+	builder.WriteByte('"')
+	return builder.String()
+}
+
+// Replaces the file at path with data through a temp file, so it's never
+// left half written
+func writeConfigFile(path string, data []byte) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "temp-*.conf")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Chmod(stat.Mode().Perm())
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	err = errors.Join(err, file.Close())
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
@@ -0,0 +1,429 @@
+package aof
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Viet-ph/redis-go/config"
+	"github.com/Viet-ph/redis-go/internal/logger"
+)
+
+// Policies for flushing the append only file to disk
+const (
+	FsyncAlways   = "always"   // fsync after every write, before replying
+	FsyncEverysec = "everysec" // fsync once per second in the background
+	FsyncNo       = "no"       // let the OS flush whenever it wants
+)
+
+var ErrRewriteInProgress = errors.New("ERR Background append only file rewriting already in progress")
+
+// Aof appends write commands, RESP encoded exactly like they are
+// propagated to replicas, to the current incremental file of the append
+// only file.
+type Aof struct {
+	dir   string
+	name  string
+	fsync string
+
+	mu       sync.Mutex
+	manifest *manifest
+	file     *os.File
+	// Size of the current incremental file, and of the files before it
+	size        int64
+	historySize int64
+	// Size of the whole append only file after the last rewrite or load,
+	// the growth since is what triggers automatic rewrites
+	baseSize int64
+
+	rewriting         bool
+	lastRewriteStatus error
+	lastWriteStatus   error
+
+	// Set when there are writes not fsynced yet, everysec only
+	dirty atomic.Bool
+	done  chan struct{}
+}
+
+// Open opens the append only file called name in dir for appending,
+// creating the directory and an incremental file if needed, and starts the
+// background fsync for the everysec policy.
+func Open(dir, name, fsync string) (*Aof, error) {
+	if fsync != FsyncAlways && fsync != FsyncEverysec && fsync != FsyncNo {
+		return nil, fmt.Errorf("invalid appendfsync policy '%s'", fsync)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	m, err := loadManifest(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	aof := &Aof{
+		dir:      dir,
+		name:     name,
+		fsync:    fsync,
+		manifest: m,
+		done:     make(chan struct{}),
+	}
+	aof.deleteHistory()
+
+	for _, info := range m.files() {
+		stat, err := os.Stat(aof.path(info))
+		if err != nil {
+			return nil, err
+		}
+		aof.historySize += stat.Size()
+	}
+
+	// Keep appending to the last incremental file
+	if len(m.incrs) > 0 {
+		last := m.incrs[len(m.incrs)-1]
+		aof.file, err = os.OpenFile(aof.path(last), os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, err
+		}
+		stat, err := aof.file.Stat()
+		if err != nil {
+			aof.file.Close()
+			return nil, err
+		}
+		aof.size = stat.Size()
+		aof.historySize -= aof.size
+	} else if err := aof.openNewIncr(); err != nil {
+		return nil, err
+	}
+	aof.baseSize = aof.historySize + aof.size
+
+	if fsync == FsyncEverysec {
+		go aof.fsyncEverySecond()
+	}
+
+	return aof, nil
+}
+
+func (aof *Aof) path(info aofInfo) string {
+	return filepath.Join(aof.dir, info.name)
+}
+
+// Switches writes to a new incremental file and lists it in the manifest.
+// Called with the lock held, or before the Aof is shared.
+func (aof *Aof) openNewIncr() error {
+	info := aof.manifest.nextIncr(aof.name)
+	file, err := os.OpenFile(aof.path(info), os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	aof.manifest.incrs = append(aof.manifest.incrs, info)
+	if err := aof.manifest.persist(aof.dir, aof.name); err != nil {
+		aof.manifest.incrs = aof.manifest.incrs[:len(aof.manifest.incrs)-1]
+		file.Close()
+		os.Remove(aof.path(info))
+		return err
+	}
+
+	if aof.file != nil {
+		// Whatever the policy, the previous file is complete from now on
+		if err := aof.file.Sync(); err != nil {
+			logger.Warning("Error syncing AOF: " + err.Error())
+		}
+		aof.file.Close()
+	}
+	aof.file = file
+	aof.historySize += aof.size
+	aof.size = 0
+
+	return nil
+}
+
+// Write appends cmds to the current incremental file. On failure the file
+// is truncated back so it never ends with a partially written command.
+func (aof *Aof) Write(cmds []byte) error {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	n, err := aof.file.Write(cmds)
+	aof.lastWriteStatus = err
+	if err != nil {
+		if n > 0 {
+			if truncErr := aof.file.Truncate(aof.size); truncErr != nil {
+				// Loading with aof-load-truncated can still deal with it
+				logger.Warning("Error removing partial AOF write: " + truncErr.Error())
+			}
+		}
+		return err
+	}
+	aof.size += int64(n)
+
+	switch aof.fsync {
+	case FsyncAlways:
+		aof.lastWriteStatus = aof.file.Sync()
+		return aof.lastWriteStatus
+	case FsyncEverysec:
+		aof.dirty.Store(true)
+	}
+	return nil
+}
+
+// Rewrite compacts the append only file, base returns the RDB encoded
+// dataset at this point. Writes from now on go to a new incremental file
+// while base is called and its result written as the new base in the
+// background. Once done, the new base and the incremental files since
+// replace the old ones.
+func (aof *Aof) Rewrite(base func() ([]byte, error)) error {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	if aof.rewriting {
+		return ErrRewriteInProgress
+	}
+	if err := aof.openNewIncr(); err != nil {
+		return err
+	}
+	aof.rewriting = true
+
+	go aof.writeBase(base, aof.manifest.incrs[len(aof.manifest.incrs)-1].seq)
+
+	return nil
+}
+
+// Writes the new base and switches the manifest over to it. firstIncr is
+// the sequence of the incremental file opened when the rewrite started.
+func (aof *Aof) writeBase(base func() ([]byte, error), firstIncr int) {
+	tempPath := filepath.Join(aof.dir, tempPrefix+"rewriteaof-bg-"+strconv.Itoa(os.Getpid())+".aof")
+	snapshot, err := base()
+	if err == nil {
+		err = writeFile(tempPath, snapshot)
+	}
+
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	aof.rewriting = false
+	aof.lastRewriteStatus = err
+	if err != nil {
+		logger.Warning("Error rewriting AOF: " + err.Error())
+		os.Remove(tempPath)
+		return
+	}
+
+	newBase := aof.manifest.nextBase(aof.name)
+	if err := os.Rename(tempPath, aof.path(newBase)); err != nil {
+		logger.Warning("Error rewriting AOF: " + err.Error())
+		aof.lastRewriteStatus = err
+		os.Remove(tempPath)
+		return
+	}
+
+	// Everything before the first incremental file of the rewrite is now
+	// part of the base. Keep it listed as history until deleted, so a crash
+	// in between doesn't leave files nobody knows about.
+	m := &manifest{base: &newBase}
+	if aof.manifest.base != nil {
+		m.history = append(m.history, aofInfo{aof.manifest.base.name, aof.manifest.base.seq, historyType})
+	}
+	for _, info := range aof.manifest.incrs {
+		if info.seq < firstIncr {
+			m.history = append(m.history, aofInfo{info.name, info.seq, historyType})
+		} else {
+			m.incrs = append(m.incrs, info)
+		}
+	}
+	// The incremental files kept, except the one being written
+	var historySize int64
+	for _, info := range m.incrs[:len(m.incrs)-1] {
+		if stat, err := os.Stat(aof.path(info)); err == nil {
+			historySize += stat.Size()
+		}
+	}
+	if err := m.persist(aof.dir, aof.name); err != nil {
+		logger.Warning("Error rewriting AOF: " + err.Error())
+		aof.lastRewriteStatus = err
+		os.Remove(aof.path(newBase))
+		return
+	}
+
+	aof.manifest = m
+	aof.historySize = int64(len(snapshot)) + historySize
+	aof.baseSize = aof.historySize + aof.size
+	aof.deleteHistory()
+	logger.Notice("Background AOF rewrite finished successfully")
+}
+
+// Deletes the files left over by a rewrite. Called with the lock held, or
+// before the Aof is shared.
+func (aof *Aof) deleteHistory() {
+	if len(aof.manifest.history) == 0 {
+		return
+	}
+
+	for _, info := range aof.manifest.history {
+		if err := os.Remove(aof.path(info)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warning("Error deleting AOF history file: " + err.Error())
+			return
+		}
+	}
+	aof.manifest.history = nil
+	if err := aof.manifest.persist(aof.dir, aof.name); err != nil {
+		logger.Warning("Error persisting AOF manifest: " + err.Error())
+	}
+}
+
+// RewriteNeeded reports whether the append only file grew enough since the
+// last rewrite to trigger an automatic one, per the auto-aof-rewrite
+// percentage and min size settings.
+func (aof *Aof) RewriteNeeded() bool {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+
+	if aof.rewriting || config.AutoAofRewritePercentage <= 0 {
+		return false
+	}
+	size := aof.historySize + aof.size
+	if size < config.AutoAofRewriteMinSize {
+		return false
+	}
+	base := max(aof.baseSize, 1)
+	return (size-base)*100/base >= int64(config.AutoAofRewritePercentage)
+}
+
+// HasBase reports whether the append only file starts with a base file
+func (aof *Aof) HasBase() bool {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	return aof.manifest.base != nil
+}
+
+// RewriteInProgress reports whether a rewrite is running in the background
+func (aof *Aof) RewriteInProgress() bool {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	return aof.rewriting
+}
+
+// BaseSize returns the size of the append only file after the last rewrite
+// or when it was opened
+func (aof *Aof) BaseSize() int64 {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	return aof.baseSize
+}
+
+// LastRewriteStatus returns the error of the last rewrite, nil if it
+// succeeded
+func (aof *Aof) LastRewriteStatus() error {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	return aof.lastRewriteStatus
+}
+
+// LastWriteStatus returns the error of the last write, nil if it succeeded
+func (aof *Aof) LastWriteStatus() error {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	return aof.lastWriteStatus
+}
+
+// Size returns the size of all the files of the append only file in bytes
+func (aof *Aof) Size() int64 {
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	return aof.historySize + aof.size
+}
+
+// Close flushes the file to disk and closes it
+func (aof *Aof) Close() error {
+	close(aof.done)
+
+	aof.mu.Lock()
+	defer aof.mu.Unlock()
+	err := aof.file.Sync()
+	return errors.Join(err, aof.file.Close())
+}
+
+func (aof *Aof) fsyncEverySecond() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-aof.done:
+			return
+		case <-ticker.C:
+			if !aof.dirty.Swap(false) {
+				continue
+			}
+			// Don't hold the lock while syncing, it would block writes
+			aof.mu.Lock()
+			file := aof.file
+			aof.mu.Unlock()
+			// The file may be switched and closed in between, it's synced then
+			if err := file.Sync(); err != nil && !errors.Is(err, os.ErrClosed) {
+				logger.Warning("Error syncing AOF: " + err.Error())
+			}
+		}
+	}
+}
+
+func writeFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	return errors.Join(err, file.Close())
+}
+
+// Exists reports whether there's an append only file called name in dir
+func Exists(dir, name string) bool {
+	_, err := os.Stat(manifestPath(dir, name))
+	return !errors.Is(err, os.ErrNotExist)
+}
+
+// CreateBase starts a new append only file called name in dir, made of a
+// base holding the RDB encoded snapshot only
+func CreateBase(dir, name string, snapshot []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	m := &manifest{}
+	base := m.nextBase(name)
+	if err := writeFileAtomic(dir, filepath.Join(dir, base.name), snapshot); err != nil {
+		return err
+	}
+	m.base = &base
+	return m.persist(dir, name)
+}
+
+// UpgradeLegacyFile turns an append only file written before the multi
+// part layout, at path, into the base of a multi part one called name in
+// dir. Does nothing if there's no such file or dir already has a manifest.
+func UpgradeLegacyFile(path, dir, name string) error {
+	if Exists(dir, name) || !fileExists(path) {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	base := aofInfo{name: name, seq: 1, fileType: baseType}
+	if err := os.Rename(path, filepath.Join(dir, base.name)); err != nil {
+		return err
+	}
+	m := &manifest{base: &base}
+	return m.persist(dir, name)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
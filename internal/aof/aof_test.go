@@ -0,0 +1,230 @@
+package aof
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Viet-ph/redis-go/config"
+)
+
+const (
+	setCmd   = "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$5\r\nva\r\nl\r\n"
+	multiCmd = "*1\r\n$5\r\nMULTI\r\n"
+	incrCmd  = "*2\r\n$4\r\nINCR\r\n$1\r\nn\r\n"
+	execCmd  = "*1\r\n$4\r\nEXEC\r\n"
+)
+
+func writeAof(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	if err := os.WriteFile(path, []byte(content), 0666); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func loadAll(path string, loadTruncated bool) ([][]string, error) {
+	var replayed [][]string
+	_, err := loadFile(path, loadTruncated, func(args []string) error {
+		replayed = append(replayed, args)
+		return nil
+	})
+	return replayed, err
+}
+
+func loadDir(t *testing.T, dir string) ([]byte, [][]string) {
+	var (
+		base     []byte
+		replayed [][]string
+	)
+	_, err := Load(dir, "appendonly.aof", false, func(rdb []byte) error {
+		base = rdb
+		return nil
+	}, func(args []string) error {
+		replayed = append(replayed, args)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return base, replayed
+}
+
+func TestWriteAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	for _, fsync := range []string{FsyncAlways, FsyncEverysec, FsyncNo} {
+		aof, err := Open(dir, "appendonly.aof", fsync)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := aof.Write([]byte(setCmd)); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if err := aof.Close(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	// Reopening appends to the last incremental file
+	base, replayed := loadDir(t, dir)
+	expected := []string{"SET", "k", "va\r\nl"}
+	if base != nil || len(replayed) != 3 || !reflect.DeepEqual(replayed[2], expected) {
+		t.Errorf("Expected 3 times %q but got %q", expected, replayed)
+	}
+	manifest, _ := os.ReadFile(filepath.Join(dir, "appendonly.aof.manifest"))
+	if string(manifest) != "file appendonly.aof.1.incr.aof seq 1 type i\n" {
+		t.Errorf("Unexpected manifest %q", manifest)
+	}
+
+	if _, err := Open(dir, "appendonly.aof", "sometimes"); err == nil {
+		t.Errorf("Expected an error for an invalid fsync policy")
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	dir := t.TempDir()
+	legacyPath := filepath.Join(dir, "appendonly.aof")
+	aofDir := filepath.Join(dir, "appendonlydir")
+	if err := os.WriteFile(legacyPath, []byte(setCmd), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// A single file AOF becomes the base of a multi part one
+	if err := UpgradeLegacyFile(legacyPath, aofDir, "appendonly.aof"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if base, replayed := loadDir(t, aofDir); base != nil || len(replayed) != 1 {
+		t.Errorf("Expected the legacy file to be replayed but got %q", replayed)
+	}
+
+	aof, err := Open(aofDir, "appendonly.aof", FsyncNo)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer aof.Close()
+	aof.Write([]byte(multiCmd + incrCmd + execCmd))
+
+	snapshot := []byte("REDIS0011 snapshot")
+	if err := aof.Rewrite(func() ([]byte, error) { return snapshot, nil }); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Written while the base is, ends up after it
+	aof.Write([]byte(incrCmd))
+	for aof.RewriteInProgress() {
+		time.Sleep(time.Millisecond)
+	}
+	aof.Write([]byte(incrCmd))
+
+	base, replayed := loadDir(t, aofDir)
+	if !bytes.Equal(base, snapshot) {
+		t.Errorf("Expected base %q but got %q", snapshot, base)
+	}
+	if len(replayed) != 2 || replayed[0][0] != "INCR" {
+		t.Errorf("Expected the 2 INCR written after the rewrite started but got %q", replayed)
+	}
+	if size := int64(len(snapshot) + 2*len(incrCmd)); aof.Size() != size {
+		t.Errorf("Expected size %d but got %d", size, aof.Size())
+	}
+
+	entries, _ := os.ReadDir(aofDir)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	expected := []string{"appendonly.aof.2.base.rdb", "appendonly.aof.2.incr.aof", "appendonly.aof.manifest"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected files %q but got %q", expected, names)
+	}
+}
+
+func TestRewriteNeeded(t *testing.T) {
+	defer func(percentage int, minSize int64) {
+		config.AutoAofRewritePercentage = percentage
+		config.AutoAofRewriteMinSize = minSize
+	}(config.AutoAofRewritePercentage, config.AutoAofRewriteMinSize)
+	config.AutoAofRewritePercentage = 100
+	config.AutoAofRewriteMinSize = int64(3 * len(setCmd))
+
+	dir := t.TempDir()
+	aof, err := Open(dir, "appendonly.aof", FsyncNo)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	aof.Write([]byte(setCmd))
+	aof.Close()
+
+	// Grown from 1 to 3 commands, but not yet at the min size
+	aof, err = Open(dir, "appendonly.aof", FsyncNo)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer aof.Close()
+	aof.Write([]byte(setCmd))
+	if aof.RewriteNeeded() {
+		t.Errorf("Expected no rewrite below the min size")
+	}
+	aof.Write([]byte(setCmd))
+	if !aof.RewriteNeeded() {
+		t.Errorf("Expected a rewrite after growing by 200%%")
+	}
+
+	config.AutoAofRewritePercentage = 0
+	if aof.RewriteNeeded() {
+		t.Errorf("Expected no rewrite when disabled")
+	}
+}
+
+func TestLoadTruncated(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		valid    string
+		replayed int
+	}{
+		{"Truncated bulk string", setCmd + setCmd[:20], setCmd, 1},
+		{"Missing final CRLF", setCmd + setCmd[:len(setCmd)-1], setCmd, 1},
+		{"Truncated array length", setCmd + "*3", setCmd, 1},
+		{"MULTI without EXEC", setCmd + multiCmd + incrCmd, setCmd, 3},
+		{"Truncated inside MULTI", setCmd + multiCmd + incrCmd[:5], setCmd, 2},
+		{"Complete transaction", multiCmd + incrCmd + execCmd + setCmd[:3], multiCmd + incrCmd + execCmd, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeAof(t, tt.content)
+			if _, err := loadAll(path, false); err == nil || !strings.Contains(err.Error(), "unexpected end") {
+				t.Errorf("Expected an unexpected end error but got %v", err)
+			}
+
+			replayed, err := loadAll(path, true)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(replayed) != tt.replayed {
+				t.Errorf("Expected %d commands replayed but got %d", tt.replayed, len(replayed))
+			}
+			content, _ := os.ReadFile(path)
+			if string(content) != tt.valid {
+				t.Errorf("Expected file truncated to %q but got %q", tt.valid, content)
+			}
+		})
+	}
+}
+
+func TestLoadBadFormat(t *testing.T) {
+	for _, content := range []string{
+		"SET k v\r\n",
+		"*1\r\n+OK\r\n",
+		"*1\r\n$2\r\nabc\r\n",
+		"*0\r\n",
+	} {
+		path := writeAof(t, setCmd+content)
+		if _, err := loadAll(path, true); err == nil || !strings.Contains(err.Error(), "bad file format") {
+			t.Errorf("Expected a bad format error for %q but got %v", content, err)
+		}
+	}
+}
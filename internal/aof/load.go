@@ -0,0 +1,179 @@
+package aof
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/internal/logger"
+)
+
+// Same limit as Redis' proto-max-bulk-len, keeps a corrupted length from
+// allocating gigabytes
+const maxBulkLen = 512 * 1024 * 1024
+
+// Base files starting with this are RDB snapshots
+const rdbPrefix = "REDIS"
+
+var errBadFormat = errors.New("bad file format")
+
+// Load loads the append only file called name in dir and returns how many
+// commands were replayed. loadBase is called first with the RDB snapshot
+// of the base file, or nil if the base holds commands or there's none, then
+// the commands of the files are replayed in order through replay.
+func Load(dir, name string, loadTruncated bool, loadBase func(rdb []byte) error, replay func(args []string) error) (int, error) {
+	m, err := loadManifest(dir, name)
+	if err != nil {
+		return 0, err
+	}
+
+	files := m.files()
+	if m.base != nil {
+		data, err := os.ReadFile(filepath.Join(dir, m.base.name))
+		if err != nil {
+			return 0, err
+		}
+		if bytes.HasPrefix(data, []byte(rdbPrefix)) {
+			files = files[1:]
+		} else {
+			data = nil
+		}
+		if err := loadBase(data); err != nil {
+			return 0, fmt.Errorf("error loading the append only file base %s: %w", m.base.name, err)
+		}
+	} else if err := loadBase(nil); err != nil {
+		return 0, err
+	}
+
+	var loaded int
+	for i, info := range files {
+		// Only the last file can end with an incomplete command, the others
+		// were complete by the time the next one was opened
+		n, err := loadFile(filepath.Join(dir, info.name), loadTruncated && i == len(files)-1, replay)
+		loaded += n
+		if err != nil {
+			return loaded, fmt.Errorf("%s: %w", info.name, err)
+		}
+	}
+
+	return loaded, nil
+}
+
+// Replays the commands of the file at path through replay and returns how
+// many were loaded. A file ending in the middle of a command, usually from
+// a crash while writing, is an error unless loadTruncated is set. In that
+// case the incomplete tail is cut off the file, together with a MULTI never
+// followed by its EXEC.
+func loadFile(path string, loadTruncated bool, replay func(args []string) error) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var (
+		loaded int
+		// Offset right after the last complete command
+		valid int64
+		// Offset of the MULTI of a transaction still being read, -1 outside
+		multiStart int64 = -1
+	)
+	for {
+		args, n, err := readCommand(reader)
+		if err == io.EOF && multiStart < 0 {
+			return loaded, nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if multiStart >= 0 {
+				valid = multiStart
+			}
+			if !loadTruncated {
+				return loaded, fmt.Errorf("unexpected end of the append only file at offset %d, start with --aof-load-truncated to drop the incomplete tail", valid)
+			}
+			logger.Warningf("AOF ends with an incomplete command, truncating it at offset %d\n", valid)
+			return loaded, os.Truncate(path, valid)
+		}
+		if err != nil {
+			return loaded, fmt.Errorf("%w reading the append only file at offset %d", err, valid)
+		}
+
+		switch strings.ToUpper(args[0]) {
+		case "MULTI":
+			multiStart = valid
+		case "EXEC":
+			multiStart = -1
+		}
+
+		if err := replay(args); err != nil {
+			return loaded, fmt.Errorf("error replaying the append only file at offset %d: %w", valid, err)
+		}
+		valid += n
+		loaded++
+	}
+}
+
+// Reads a command written as a RESP array of bulk strings. Returns the
+// arguments and the number of bytes read, io.EOF if there's nothing left
+// and io.ErrUnexpectedEOF if the file ends in the middle of the command.
+func readCommand(reader *bufio.Reader) ([]string, int64, error) {
+	var read int64
+	readNumber := func(prefix byte) (int, error) {
+		line, err := reader.ReadString('\n')
+		read += int64(len(line))
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, err
+		}
+		if len(line) < 4 || line[0] != prefix || line[len(line)-2] != '\r' {
+			return 0, errBadFormat
+		}
+		n, err := strconv.Atoi(line[1 : len(line)-2])
+		if err != nil || n < 0 || n > maxBulkLen {
+			return 0, errBadFormat
+		}
+		return n, nil
+	}
+
+	if _, err := reader.Peek(1); err == io.EOF {
+		return nil, 0, io.EOF
+	}
+	argc, err := readNumber('*')
+	if err != nil {
+		return nil, read, err
+	}
+	if argc == 0 {
+		return nil, read, errBadFormat
+	}
+
+	args := make([]string, 0, min(argc, 1024))
+	for range argc {
+		length, err := readNumber('$')
+		if err != nil {
+			return nil, read, err
+		}
+		arg := make([]byte, length+2)
+		n, err := io.ReadFull(reader, arg)
+		read += int64(n)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, read, err
+		}
+		if arg[length] != '\r' || arg[length+1] != '\n' {
+			return nil, read, errBadFormat
+		}
+		args = append(args, string(arg[:length]))
+	}
+
+	return args, read, nil
+}
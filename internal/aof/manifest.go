@@ -0,0 +1,202 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The append only file is split in several files listed by a manifest, in
+// the same layout as Redis 7: a base file holding an RDB snapshot, or the
+// commands of a pre multi part AOF, followed by incremental files with the
+// commands written since. Each line of the manifest describes one file:
+//
+//	file appendonly.aof.1.base.rdb seq 1 type b
+//	file appendonly.aof.1.incr.aof seq 1 type i
+const (
+	baseType    = "b"
+	historyType = "h" // Left over by a rewrite, only deleted
+	incrType    = "i"
+
+	manifestSuffix = ".manifest"
+	baseSuffix     = ".base.rdb"
+	incrSuffix     = ".incr.aof"
+	tempPrefix     = "temp-"
+)
+
+var errInvalidManifest = errors.New("invalid append only file manifest")
+
+type aofInfo struct {
+	name     string
+	seq      int
+	fileType string
+}
+
+type manifest struct {
+	base    *aofInfo
+	incrs   []aofInfo
+	history []aofInfo
+}
+
+func manifestPath(dir, name string) string {
+	return filepath.Join(dir, name+manifestSuffix)
+}
+
+// Reads the manifest of the append only file called name in dir. Returns
+// an empty manifest if there's none yet.
+func loadManifest(dir, name string) (*manifest, error) {
+	file, err := os.Open(manifestPath(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return &manifest{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	m := &manifest{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Key value pairs, unknown keys are ignored like Redis does
+		fields := strings.Fields(line)
+		if len(fields)%2 != 0 {
+			return nil, errInvalidManifest
+		}
+		var info aofInfo
+		for i := 0; i < len(fields); i += 2 {
+			switch fields[i] {
+			case "file":
+				info.name = fields[i+1]
+			case "seq":
+				info.seq, err = strconv.Atoi(fields[i+1])
+				if err != nil {
+					return nil, errInvalidManifest
+				}
+			case "type":
+				info.fileType = fields[i+1]
+			}
+		}
+		if info.name == "" || info.seq <= 0 {
+			return nil, errInvalidManifest
+		}
+
+		switch info.fileType {
+		case baseType:
+			if m.base != nil {
+				return nil, fmt.Errorf("%w: more than one base file", errInvalidManifest)
+			}
+			m.base = &info
+		case incrType:
+			if len(m.incrs) > 0 && m.incrs[len(m.incrs)-1].seq >= info.seq {
+				return nil, fmt.Errorf("%w: incremental files out of order", errInvalidManifest)
+			}
+			m.incrs = append(m.incrs, info)
+		case historyType:
+			m.history = append(m.history, info)
+		default:
+			return nil, errInvalidManifest
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *manifest) String() string {
+	var builder strings.Builder
+	writeInfo := func(info aofInfo) {
+		fmt.Fprintf(&builder, "file %s seq %d type %s\n", info.name, info.seq, info.fileType)
+	}
+	if m.base != nil {
+		writeInfo(*m.base)
+	}
+	for _, info := range m.history {
+		writeInfo(info)
+	}
+	for _, info := range m.incrs {
+		writeInfo(info)
+	}
+	return builder.String()
+}
+
+// Atomically replaces the manifest on disk
+func (m *manifest) persist(dir, name string) error {
+	return writeFileAtomic(dir, manifestPath(dir, name), []byte(m.String()))
+}
+
+// Files listed in loading order, base first
+func (m *manifest) files() []aofInfo {
+	var files []aofInfo
+	if m.base != nil {
+		files = append(files, *m.base)
+	}
+	return append(files, m.incrs...)
+}
+
+func (m *manifest) nextIncr(name string) aofInfo {
+	seq := 1
+	if len(m.incrs) > 0 {
+		seq = m.incrs[len(m.incrs)-1].seq + 1
+	}
+	return aofInfo{
+		name:     name + "." + strconv.Itoa(seq) + incrSuffix,
+		seq:      seq,
+		fileType: incrType,
+	}
+}
+
+func (m *manifest) nextBase(name string) aofInfo {
+	seq := 1
+	if m.base != nil {
+		seq = m.base.seq + 1
+	}
+	return aofInfo{
+		name:     name + "." + strconv.Itoa(seq) + baseSuffix,
+		seq:      seq,
+		fileType: baseType,
+	}
+}
+
+// Writes data to a temp file next to path, fsyncs it and renames it over
+// path. The directory is fsynced too so the rename survives a crash.
+func writeFileAtomic(dir, path string, data []byte) error {
+	tempPath := filepath.Join(dir, tempPrefix+filepath.Base(path))
+	file, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	err = errors.Join(err, file.Close())
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return file.Sync()
+}
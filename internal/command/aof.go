@@ -0,0 +1,51 @@
+package command
+
+import (
+	"errors"
+
+	"github.com/Viet-ph/redis-go/internal/aof"
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/proto"
+	"github.com/Viet-ph/redis-go/internal/rdb"
+)
+
+var errAofDisabled = errors.New("ERR Append only file is not enabled")
+
+// SetAppendOnlyFile gives the handler the append only file the server
+// writes to, nil when it's disabled.
+func (handler *Handler) SetAppendOnlyFile(appendOnly *aof.Aof) {
+	handler.aof = appendOnly
+}
+
+// RewriteAppendOnlyFile starts rewriting the append only file in the
+// background, from a snapshot of the store taken right away and marshalled
+// while writes go on.
+func (handler *Handler) RewriteAppendOnlyFile(store *datastore.Datastore) error {
+	if handler.aof == nil {
+		return errAofDisabled
+	}
+	if handler.aof.RewriteInProgress() {
+		return aof.ErrRewriteInProgress
+	}
+
+	snapshot := store.Snapshot()
+	err := handler.aof.Rewrite(func() ([]byte, error) {
+		defer snapshot.Release()
+		return rdb.MarshallSnapshot(snapshot, true)
+	})
+	if err != nil {
+		snapshot.Release()
+	}
+	return err
+}
+
+func (handler *Handler) BgRewriteAof(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 0 {
+		return errors.New("ERR wrong number of arguments for 'bgrewriteaof' command"), true
+	}
+
+	if err := handler.RewriteAppendOnlyFile(store); err != nil {
+		return err, true
+	}
+	return proto.Status("Background append only file rewriting started"), true
+}
@@ -0,0 +1,57 @@
+package command
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"github.com/Viet-ph/redis-go/config"
+	"github.com/Viet-ph/redis-go/internal/connection"
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+var (
+	errNoPassword = errors.New("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	errWrongPass  = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+)
+
+// Only the default user exists
+const defaultUsername = "default"
+
+// Authenticated reports whether conn may run commands, always true when
+// no password is required
+func (handler *Handler) Authenticated(conn *connection.Conn) bool {
+	return config.RequirePass == "" || handler.authenticated[conn]
+}
+
+func (handler *Handler) Auth(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 && len(args) != 2 {
+		return errWrongArgs("auth"), true
+	}
+
+	username, password := defaultUsername, args[len(args)-1]
+	if len(args) == 2 {
+		username = args[0]
+	}
+	if config.RequirePass == "" && len(args) == 1 {
+		return errNoPassword, true
+	}
+	if err := handler.authenticate(handler.currClient, username, password); err != nil {
+		return err, true
+	}
+
+	return proto.Status("OK"), true
+}
+
+// Checks the credentials given by conn, through AUTH or HELLO. Without a
+// password configured the default user takes any password.
+func (handler *Handler) authenticate(conn *connection.Conn, username, password string) error {
+	if username != defaultUsername ||
+		(config.RequirePass != "" && subtle.ConstantTimeCompare([]byte(password), []byte(config.RequirePass)) != 1) {
+		delete(handler.authenticated, conn)
+		return errWrongPass
+	}
+
+	handler.authenticated[conn] = true
+	return nil
+}
@@ -0,0 +1,384 @@
+package command
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Viet-ph/redis-go/internal/connection"
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/proto"
+	"github.com/Viet-ph/redis-go/internal/queue"
+)
+
+// A client parked by a blocking command (BLPOP, BLMOVE, XREAD...) until
+// one of its keys can serve it or its timeout fires.
+type blockedClient struct {
+	conn *connection.Conn
+	keys []string
+
+	// Tries to serve the client from key once it has been signaled as
+	// ready. Returns false when there's still nothing for the client, in
+	// which case it stays blocked.
+	serve func(key string, store *datastore.Datastore) (reply any, served bool)
+
+	timer *time.Timer
+}
+
+// Registry of blocked clients. Only accessed from the event loop, timeouts
+// are delivered back to the loop through the task queue.
+type blockingState struct {
+	// Clients waiting on each key, in the order they blocked
+	byKey  map[string][]*blockedClient
+	byConn map[*connection.Conn]*blockedClient
+
+	// Keys that received elements since the last time blocked clients
+	// were served, in signal order
+	readyKeys []string
+}
+
+func newBlockingState() *blockingState {
+	return &blockingState{
+		byKey:  make(map[string][]*blockedClient),
+		byConn: make(map[*connection.Conn]*blockedClient),
+	}
+}
+
+func parseBlockingTimeout(arg string) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, errors.New("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, errors.New("ERR timeout is negative")
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func parseListSide(arg string) (bool, error) {
+	switch strings.ToUpper(arg) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	default:
+		return false, custom_err.ErrorSyntax
+	}
+}
+
+func sideName(left bool) string {
+	if left {
+		return "LEFT"
+	}
+	return "RIGHT"
+}
+
+// Pops an element from src and pushes it to dst. Returns false if src
+// doesn't exist. The type of dst is checked before anything is popped.
+func moveElement(store *datastore.Datastore, src, dst string, fromLeft, toLeft bool) (string, bool, error) {
+	srcList, err := getTyped[*datastore.List](store, src)
+	if err != nil || srcList == nil {
+		return "", false, err
+	}
+	if _, err := getTyped[*datastore.List](store, dst); err != nil {
+		return "", false, err
+	}
+
+	var value string
+	if fromLeft {
+		value, _ = srcList.LPop()
+	} else {
+		value, _ = srcList.RPop()
+	}
+	removeIfEmpty(store, src, srcList)
+
+	dstList, created, err := getOrCreateTyped(store, dst, datastore.NewList)
+	if err != nil {
+		return "", false, err
+	}
+	if toLeft {
+		dstList.LPush(value)
+	} else {
+		dstList.RPush(value)
+	}
+	if err := saveTyped(store, dst, dstList, created); err != nil {
+		return "", false, err
+	}
+
+	return value, true, nil
+}
+
+// LMOVE Handler
+func (handler *Handler) LMove(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 4 {
+		return errWrongArgs("lmove"), true
+	}
+
+	fromLeft, err := parseListSide(args[2])
+	if err != nil {
+		return err, true
+	}
+	toLeft, err := parseListSide(args[3])
+	if err != nil {
+		return err, true
+	}
+
+	value, moved, err := moveElement(store, args[0], args[1], fromLeft, toLeft)
+	if err != nil {
+		return err, true
+	}
+	if !moved {
+		return custom_err.ErrorKeyNotExists, true
+	}
+	handler.signalKeyAsReady(args[1])
+
+	return value, true
+}
+
+// BLPOP BRPOP BLMOVE Handlers
+func (handler *Handler) BLPop(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.blockingPop(args, store, "blpop", true)
+}
+
+func (handler *Handler) BRPop(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.blockingPop(args, store, "brpop", false)
+}
+
+func (handler *Handler) blockingPop(args []string, store *datastore.Datastore, cmdName string, left bool) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs(cmdName), true
+	}
+	if info.Role == "slave" {
+		return custom_err.ErrorReadOnly, true
+	}
+
+	keys := args[:len(args)-1]
+	timeout, err := parseBlockingTimeout(args[len(args)-1])
+	if err != nil {
+		return err, true
+	}
+
+	// Serve right away if any of the keys, in the given order, holds elements
+	for _, key := range keys {
+		list, err := getTyped[*datastore.List](store, key)
+		if err != nil {
+			return err, true
+		}
+		if list != nil {
+			return handler.popBlocked(store, key, list, left), true
+		}
+	}
+
+	return handler.blockClient(&blockedClient{
+		conn: handler.currClient,
+		keys: slices.Clone(keys),
+		serve: func(key string, store *datastore.Datastore) (any, bool) {
+			list, err := getTyped[*datastore.List](store, key)
+			if err != nil || list == nil {
+				return nil, false
+			}
+			return handler.popBlocked(store, key, list, left), true
+		},
+	}, timeout)
+}
+
+// Pops on behalf of BLPOP or BRPOP, replicated as a plain LPOP or RPOP
+func (handler *Handler) popBlocked(store *datastore.Datastore, key string, list *datastore.List, left bool) []string {
+	var value string
+	if left {
+		value, _ = list.LPop()
+		handler.alsoPropagate("LPOP", key)
+	} else {
+		value, _ = list.RPop()
+		handler.alsoPropagate("RPOP", key)
+	}
+	removeIfEmpty(store, key, list)
+
+	return []string{key, value}
+}
+
+func (handler *Handler) BLMove(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 5 {
+		return errWrongArgs("blmove"), true
+	}
+	if info.Role == "slave" {
+		return custom_err.ErrorReadOnly, true
+	}
+
+	fromLeft, err := parseListSide(args[2])
+	if err != nil {
+		return err, true
+	}
+	toLeft, err := parseListSide(args[3])
+	if err != nil {
+		return err, true
+	}
+	timeout, err := parseBlockingTimeout(args[4])
+	if err != nil {
+		return err, true
+	}
+
+	src, dst := args[0], args[1]
+	value, moved, err := handler.moveBlocked(store, src, dst, fromLeft, toLeft)
+	if err != nil {
+		return err, true
+	}
+	if moved {
+		return value, true
+	}
+
+	return handler.blockClient(&blockedClient{
+		conn: handler.currClient,
+		keys: []string{src},
+		serve: func(key string, store *datastore.Datastore) (any, bool) {
+			value, moved, err := handler.moveBlocked(store, src, dst, fromLeft, toLeft)
+			if err != nil {
+				return err, true
+			}
+			return value, moved
+		},
+	}, timeout)
+}
+
+// Moves on behalf of BLMOVE, replicated as a plain LMOVE
+func (handler *Handler) moveBlocked(store *datastore.Datastore, src, dst string, fromLeft, toLeft bool) (string, bool, error) {
+	value, moved, err := moveElement(store, src, dst, fromLeft, toLeft)
+	if err != nil || !moved {
+		return "", false, err
+	}
+
+	handler.alsoPropagate("LMOVE", src, dst, sideName(fromLeft), sideName(toLeft))
+	handler.signalKeyAsReady(dst)
+	return value, true, nil
+}
+
+// Parks the client on all of its keys. A zero timeout blocks forever.
+// Inside a transaction the client can't block, it gets the timeout
+// reply right away instead.
+func (handler *Handler) blockClient(client *blockedClient, timeout time.Duration) (any, bool) {
+	if handler.inExec {
+		return custom_err.ErrorNullArray, true
+	}
+
+	state := handler.blocking
+	for _, key := range client.keys {
+		// The same key can be given more than once, only queue it once
+		if slices.Contains(state.byKey[key], client) {
+			continue
+		}
+		state.byKey[key] = append(state.byKey[key], client)
+	}
+	state.byConn[client.conn] = client
+
+	if timeout > 0 {
+		// The timer fires on its own goroutine, hand the timeout
+		// over to the event loop instead of touching the registry here.
+		client.timer = time.AfterFunc(timeout, func() {
+			task := queue.NewTask(handler.timeoutBlockedClient, client)
+			handler.taskQueue.Add(*task)
+		})
+	}
+
+	return nil, false
+}
+
+// Removes the client from every key it's waiting on
+func (handler *Handler) unblockClient(client *blockedClient) {
+	state := handler.blocking
+	if client.timer != nil {
+		client.timer.Stop()
+	}
+
+	for _, key := range client.keys {
+		waiting := slices.DeleteFunc(state.byKey[key], func(c *blockedClient) bool {
+			return c == client
+		})
+		if len(waiting) == 0 {
+			delete(state.byKey, key)
+		} else {
+			state.byKey[key] = waiting
+		}
+	}
+	delete(state.byConn, client.conn)
+}
+
+func (handler *Handler) timeoutBlockedClient(client *blockedClient) error {
+	// Client might have been served or disconnected before the timer fired
+	if handler.blocking.byConn[client.conn] != client {
+		return nil
+	}
+
+	handler.unblockClient(client)
+	return respondBlockedClient(client.conn, custom_err.ErrorNullArray)
+}
+
+// Marks key as having received new elements. Only keys with clients
+// waiting on them are worth serving.
+func (handler *Handler) signalKeyAsReady(key string) {
+	state := handler.blocking
+	if _, waiting := state.byKey[key]; !waiting {
+		return
+	}
+	if !slices.Contains(state.readyKeys, key) {
+		state.readyKeys = append(state.readyKeys, key)
+	}
+}
+
+// ServeBlockedClients hands the content of keys signaled as ready to the
+// clients blocked on them, first come first served. Must be called from
+// the event loop after a command has been executed.
+func (handler *Handler) ServeBlockedClients(store *datastore.Datastore) {
+	state := handler.blocking
+
+	// Serving a BLMOVE pushes to another key which may signal new ready keys
+	for len(state.readyKeys) > 0 {
+		readyKeys := state.readyKeys
+		state.readyKeys = nil
+
+		for _, key := range readyKeys {
+			// Serving unblocks clients, walk over a snapshot of the waiting ones
+			for _, client := range slices.Clone(state.byKey[key]) {
+				// Already served through another key
+				if state.byConn[client.conn] != client {
+					continue
+				}
+
+				reply, served := client.serve(key, store)
+				if !served {
+					continue
+				}
+
+				handler.unblockClient(client)
+				task := queue.NewTask(respondBlockedClient, client.conn, reply)
+				handler.taskQueue.Add(*task)
+			}
+		}
+	}
+}
+
+func respondBlockedClient(conn *connection.Conn, reply any) error {
+	if conn.IsClosed {
+		return nil
+	}
+
+	encoder := proto.NewEncoder()
+	encoder.SetProtocol(conn.Protocol)
+	err := encoder.Encode(reply, false)
+	if err != nil {
+		return err
+	}
+
+	return conn.QueueDatas(encoder.GetBufValue())
+}
+
+// IsBlocked reports whether conn is waiting on a blocking command
+func (handler *Handler) IsBlocked(conn *connection.Conn) bool {
+	_, blocked := handler.blocking.byConn[conn]
+	return blocked
+}
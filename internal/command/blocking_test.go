@@ -0,0 +1,176 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Viet-ph/redis-go/internal/connection"
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/queue"
+	"golang.org/x/sys/unix"
+)
+
+// A client connected through a socket pair, replies are read from the
+// other end
+type testClient struct {
+	conn *connection.Conn
+	peer int
+}
+
+func newTestClient(t *testing.T) *testClient {
+	t.Helper()
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := unix.SetNonblock(fds[1], true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	conn, err := connection.NewConn(fds[0], &unix.SockaddrInet4{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		unix.Close(fds[1])
+	})
+	return &testClient{conn: conn, peer: fds[1]}
+}
+
+// Returns everything the client was sent so far
+func (client *testClient) replies() string {
+	buf := make([]byte, 4096)
+	n, err := unix.Read(client.peer, buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+func newTestHandler() (*Handler, *queue.TaskQueue, *datastore.Datastore) {
+	taskQueue := queue.NewTaskQueue()
+	return NewCmdHandler(taskQueue), taskQueue, datastore.NewDatastore(nil, nil)
+}
+
+// Runs a command on behalf of client and fails unless it blocked
+func mustBlock(t *testing.T, handler *Handler, client *testClient, run func() (any, bool)) {
+	t.Helper()
+	handler.SetCurrentConn(client.conn)
+	if reply, ready := run(); ready {
+		t.Fatalf("Expected the client to block, got %v", reply)
+	}
+	if !handler.IsBlocked(client.conn) {
+		t.Fatal("Expected the client to be registered as blocked")
+	}
+}
+
+func TestBlockedClientsServedInOrder(t *testing.T) {
+	handler, taskQueue, store := newTestHandler()
+	clients := []*testClient{newTestClient(t), newTestClient(t), newTestClient(t)}
+	for _, client := range clients {
+		mustBlock(t, handler, client, func() (any, bool) { return handler.BLPop([]string{"l", "0"}, store) })
+	}
+
+	// Two elements for three clients, the first two to block get them
+	handler.RPush([]string{"l", "a", "b"}, store)
+	handler.ServeBlockedClients(store)
+	taskQueue.DrainQueue()
+
+	expected := []string{
+		"*2\r\n$1\r\nl\r\n$1\r\na\r\n",
+		"*2\r\n$1\r\nl\r\n$1\r\nb\r\n",
+		"",
+	}
+	for i, client := range clients {
+		if replies := client.replies(); replies != expected[i] {
+			t.Errorf("Client %d: expected %q, got %q", i, expected[i], replies)
+		}
+	}
+	if handler.IsBlocked(clients[0].conn) || handler.IsBlocked(clients[1].conn) || !handler.IsBlocked(clients[2].conn) {
+		t.Error("Expected only the last client to be left blocked")
+	}
+	if store.Exists("l") {
+		t.Error("Expected the emptied list to be deleted")
+	}
+}
+
+func TestBlockedClientTimeout(t *testing.T) {
+	handler, taskQueue, store := newTestHandler()
+	client := newTestClient(t)
+	mustBlock(t, handler, client, func() (any, bool) { return handler.BLPop([]string{"l", "0.01"}, store) })
+
+	// The timer only queues the timeout, the client stays blocked until
+	// the event loop drains the task queue
+	time.Sleep(50 * time.Millisecond)
+	if !handler.IsBlocked(client.conn) {
+		t.Fatal("Expected the timeout to wait for the task queue")
+	}
+	taskQueue.DrainQueue()
+
+	if handler.IsBlocked(client.conn) {
+		t.Error("Expected the client to be unblocked")
+	}
+	if replies := client.replies(); replies != "*-1\r\n" {
+		t.Errorf("Expected a null array, got %q", replies)
+	}
+
+	// Nobody waits on the key anymore
+	handler.RPush([]string{"l", "a"}, store)
+	handler.ServeBlockedClients(store)
+	taskQueue.DrainQueue()
+	if list, _ := getTyped[*datastore.List](store, "l"); list == nil || list.Len() != 1 {
+		t.Error("Expected the pushed element to stay in the list")
+	}
+}
+
+// BLMOVE pushing into a key another client waits on serves that client
+// in the same round
+func TestBLMoveIntoKeyWithBlockedClient(t *testing.T) {
+	handler, taskQueue, store := newTestHandler()
+	popper, mover := newTestClient(t), newTestClient(t)
+	mustBlock(t, handler, popper, func() (any, bool) { return handler.BLPop([]string{"dst", "0"}, store) })
+	mustBlock(t, handler, mover, func() (any, bool) {
+		return handler.BLMove([]string{"src", "dst", "LEFT", "RIGHT", "0"}, store)
+	})
+
+	handler.RPush([]string{"src", "v"}, store)
+	handler.ServeBlockedClients(store)
+	taskQueue.DrainQueue()
+
+	if replies := mover.replies(); replies != "$1\r\nv\r\n" {
+		t.Errorf("Expected BLMOVE to reply the moved element, got %q", replies)
+	}
+	if replies := popper.replies(); replies != "*2\r\n$3\r\ndst\r\n$1\r\nv\r\n" {
+		t.Errorf("Expected BLPOP to get the moved element, got %q", replies)
+	}
+	if store.Exists("src") || store.Exists("dst") {
+		t.Error("Expected both lists to end up empty and deleted")
+	}
+}
+
+func TestDisconnectWhileBlocked(t *testing.T) {
+	handler, taskQueue, store := newTestHandler()
+	gone, waiting := newTestClient(t), newTestClient(t)
+	mustBlock(t, handler, gone, func() (any, bool) { return handler.BLPop([]string{"l", "0.01"}, store) })
+	mustBlock(t, handler, waiting, func() (any, bool) { return handler.BLPop([]string{"l", "0"}, store) })
+
+	handler.ReleaseClient(gone.conn, store)
+	if handler.IsBlocked(gone.conn) {
+		t.Fatal("Expected the released client not to be blocked anymore")
+	}
+
+	// The element goes to the client still connected, and the timer of
+	// the released one doesn't reply anything
+	time.Sleep(50 * time.Millisecond)
+	handler.RPush([]string{"l", "a"}, store)
+	handler.ServeBlockedClients(store)
+	taskQueue.DrainQueue()
+
+	if replies := waiting.replies(); replies != "*2\r\n$1\r\nl\r\n$1\r\na\r\n" {
+		t.Errorf("Expected the connected client to be served, got %q", replies)
+	}
+	if replies := gone.replies(); replies != "" {
+		t.Errorf("Expected nothing for the released client, got %q", replies)
+	}
+}
@@ -9,25 +9,46 @@ import (
 	"time"
 
 	"github.com/Viet-ph/redis-go/config"
+	"github.com/Viet-ph/redis-go/internal/aof"
 	"github.com/Viet-ph/redis-go/internal/connection"
 	"github.com/Viet-ph/redis-go/internal/datastore"
 	custom_err "github.com/Viet-ph/redis-go/internal/error"
 	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/logger"
+	"github.com/Viet-ph/redis-go/internal/proto"
 	"github.com/Viet-ph/redis-go/internal/queue"
 	"github.com/Viet-ph/redis-go/internal/rdb"
 )
 
-type hmap map[string]string
-
 type Handler struct {
 	taskQueue  *queue.TaskQueue
 	currClient *connection.Conn
 	currRep    *connection.Conn
+	blocking   *blockingState
+
+	// Transactions and watched keys of each client, and whether EXEC is
+	// running the commands of one
+	transactions map[*connection.Conn]*transaction
+	inExec       bool
+
+	// Extra commands to propagate to replicas after the current one
+	propagation          [][]string
+	propagationPrevented bool
+
+	// Append only file, nil when disabled
+	aof *aof.Aof
+
+	// Clients which authenticated with AUTH
+	authenticated map[*connection.Conn]bool
 }
 
 func NewCmdHandler(taskQueue *queue.TaskQueue) *Handler {
 	return &Handler{
 		taskQueue: taskQueue,
+		blocking:  newBlockingState(),
+
+		transactions:  make(map[*connection.Conn]*transaction),
+		authenticated: make(map[*connection.Conn]bool),
 	}
 }
 
@@ -44,133 +65,125 @@ func (handler *Handler) SetCurrentConn(conn *connection.Conn) error {
 	return nil
 }
 
+// ReleaseClient drops everything the handler keeps for conn, used when
+// the connection goes away.
+func (handler *Handler) ReleaseClient(conn *connection.Conn, store *datastore.Datastore) {
+	if client, blocked := handler.blocking.byConn[conn]; blocked {
+		handler.unblockClient(client)
+	}
+	handler.discardTransaction(conn, store)
+	delete(handler.authenticated, conn)
+}
+
 func (handler *Handler) Ping(args []string, store *datastore.Datastore) (any, bool) {
 	if len(args) > 1 {
 		return "wrong number of arguments for 'ping' command", true
 	}
 
 	if len(args) == 0 {
-		return "PONG", true
+		return proto.Status("PONG"), true
 	} else {
 		return args[0], true
 	}
 }
 
-// SET GET Handlers
-func (handler *Handler) Set(args []string, store *datastore.Datastore) (any, bool) {
-	if len(args) < 2 {
-		return errors.New("ERR wrong number of arguments for 'set'command"), true
-	}
-
-	key := args[0]
-	value := args[1]
-	options := args[2:]
-
-	err := store.Set(key, value, options)
-	if err != nil {
-		return err, true
+func (handler *Handler) Info(args []string, store *datastore.Datastore) (any, bool) {
+	sections := []struct {
+		name  string
+		lines func() []string
+	}{
+		{"clients", handler.clientsInfo},
+		{"persistence", func() []string { return handler.persistenceInfo(store) }},
+		{"stats", statsInfo},
+		{"replication", replicationInfo},
+	}
+
+	// All sections unless some are asked for
+	wanted := make(map[string]bool)
+	for _, arg := range args {
+		wanted[strings.ToLower(arg)] = true
+	}
+	all := len(args) == 0 || wanted["all"] || wanted["default"] || wanted["everything"]
+
+	var info []string
+	for _, section := range sections {
+		if all || wanted[section.name] {
+			info = append(info, section.lines()...)
+			info = append(info, "")
+		}
 	}
 
-	return "OK", true
+	return proto.VerbatimString{Format: "txt", Text: strings.Join(info, "\r\n")}, true
 }
 
-func (handler *Handler) Get(args []string, store *datastore.Datastore) (any, bool) {
-	if len(args) != 1 {
-		return errors.New("ERR wrong number of arguments for 'get' command"), true
-	}
-
-	data, exists := store.Get(args[0])
-	if !exists {
-		return custom_err.ErrorKeyNotExists, true
-	}
-
-	stringData, ok := data.(string)
-	if !ok {
-		return errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"), true
+func (handler *Handler) clientsInfo() []string {
+	return []string{
+		"# Clients",
+		"connected_clients:" + strconv.Itoa(len(connection.ConnectedClients)),
+		"maxclients:" + strconv.Itoa(config.MaximumClients),
+		"blocked_clients:" + strconv.Itoa(len(handler.blocking.byConn)),
 	}
-
-	return stringData, true
 }
 
-// HSET HGET HGETALL Handlers
-func (handler *Handler) Hset(args []string, store *datastore.Datastore) (any, bool) {
-	if len(args[1:])%2 != 0 {
-		return errors.New("ERR wrong number of arguments for 'hset' command"), true
+func statsInfo() []string {
+	return []string{
+		"# Stats",
+		"total_connections_received:" + strconv.Itoa(info.TotalConnectionsReceived),
+		"total_commands_processed:" + strconv.Itoa(info.TotalCommandsProcessed),
+		"rejected_connections:" + strconv.Itoa(info.RejectedConnections),
+		"expired_keys:" + strconv.Itoa(info.ExpiredKeys),
+		"expired_stale_perc:" + strconv.FormatFloat(info.ExpiredStalePerc, 'f', 2, 64),
+		"expired_time_cap_reached_count:" + strconv.Itoa(info.ExpiredTimeCapReachedCount),
+		"expire_cycle_cpu_milliseconds:" + strconv.FormatInt(info.ExpireCycleTime.Milliseconds(), 10),
 	}
-
-	hmap := make(hmap)
-	key := args[0]
-
-	for i := 1; i < len(args); i += 2 {
-		hmap[args[i]] = args[i+1]
-	}
-
-	err := store.Set(key, hmap, nil)
-	if err != nil {
-		return err, true
-	}
-
-	return "OK", true
 }
 
-func (handler *Handler) HGet(args []string, store *datastore.Datastore) (any, bool) {
-	if len(args) != 2 {
-		return errors.New("ERR wrong number of arguments for 'hget' command"), true
-	}
-
-	data, exists := store.Get(args[0])
-	if !exists {
-		return custom_err.ErrorKeyNotExists, true
-	}
-
-	hmap, ok := data.(hmap)
-	if !ok {
-		return errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"), true
-	}
-
-	hmapValue, exists := hmap[args[1]]
-	if !exists {
-		return custom_err.ErrorKeyNotExists, true
+func replicationInfo() []string {
+	return []string{
+		"# Replication",
+		"role:" + info.Role,
+		"master_replid:" + strings.Replace(info.ReplicationId.String(), "-", "", -1),
+		"master_repl_offset:" + strconv.Itoa(info.ReplicationOffset),
 	}
-
-	return hmapValue, true
 }
 
-func (handler *Handler) HGetAll(args []string, store *datastore.Datastore) (any, bool) {
-	if len(args) != 1 {
-		return errors.New("ERR wrong number of arguments for 'hgetall' command"), true
-	}
-
-	data, exists := store.Get(args[0])
-	if !exists {
-		return custom_err.ErrorKeyNotExists, true
-	}
-
-	hmap, ok := data.(hmap)
-	if !ok {
-		return errors.New("WRONGTYPE Operation against a key holding the wrong kind of value"), true
-	}
+func (handler *Handler) persistenceInfo(store *datastore.Datastore) []string {
+	saveInfo := rdb.LastSaveInfo()
+	lines := []string{
+		"# Persistence",
+		"loading:0",
+		"rdb_changes_since_last_save:" + strconv.FormatInt(store.Dirty(), 10),
+		"rdb_bgsave_in_progress:" + strconv.Itoa(btoi(rdb.BgSaveInProgress())),
+		"rdb_last_save_time:" + strconv.FormatInt(saveInfo.LastSave.Unix(), 10),
+		"rdb_last_bgsave_status:" + statusString(saveInfo.LastStatus),
+		"rdb_last_bgsave_time_sec:" + strconv.Itoa(int(saveInfo.LastDuration.Seconds())),
+	}
+
+	if handler.aof == nil {
+		return append(lines, "aof_enabled:0")
+	}
+	return append(lines,
+		"aof_enabled:1",
+		"aof_rewrite_in_progress:"+strconv.Itoa(btoi(handler.aof.RewriteInProgress())),
+		"aof_last_bgrewrite_status:"+statusString(handler.aof.LastRewriteStatus()),
+		"aof_last_write_status:"+statusString(handler.aof.LastWriteStatus()),
+		"aof_current_size:"+strconv.FormatInt(handler.aof.Size(), 10),
+		"aof_base_size:"+strconv.FormatInt(handler.aof.BaseSize(), 10),
+	)
+}
 
-	hmapKV := make([]string, 0, len(hmap)*2)
-	for key, value := range hmap {
-		hmapKV = append(hmapKV, key, value)
+func statusString(err error) string {
+	if err != nil {
+		return "err"
 	}
-
-	fmt.Println(hmapKV)
-	return hmapKV, true
+	return "ok"
 }
 
-func (handler *Handler) Info(args []string, store *datastore.Datastore) (any, bool) {
-	role := "role:" + info.Role
-	info := []string{
-		"# Replication",
-		role,
-		"master_replid:" + strings.Replace(info.ReplicationId.String(), "-", "", -1),
-		"master_repl_offset:" + strconv.Itoa(info.ReplicationOffset),
-		"",
+func btoi(b bool) int {
+	if b {
+		return 1
 	}
-
-	return info, true
+	return 0
 }
 
 // REPLICATION CONFIGURATION
@@ -185,7 +198,7 @@ func (handler *Handler) ReplConf(args []string, store *datastore.Datastore) (any
 		// The channel will remain opened and exists if timeout is not occured.
 		// The wait command still blocking to receive acks from other replicas
 		if offsTracker, ok := OffsTracking[handler.currClient]; ok {
-			fmt.Println("Sending offset to channel...")
+			logger.Debug("Sending offset to channel...")
 			offsTracker.AckCh <- repOffset
 		}
 
@@ -193,12 +206,12 @@ func (handler *Handler) ReplConf(args []string, store *datastore.Datastore) (any
 		return nil, false
 	}
 
-	return "OK", true
+	return proto.Status("OK"), true
 }
 
 // REPLICATION SYNC
 func (handler *Handler) Psync(args []string, store *datastore.Datastore) (any, bool) {
-	result := fmt.Sprintf("FULLRESYNC %s %d", info.ReplicationId, info.ReplicationOffset)
+	result := proto.Status(fmt.Sprintf("FULLRESYNC %s %d", info.ReplicationId, info.ReplicationOffset))
 
 	return result, true
 }
@@ -214,6 +227,18 @@ func (handler *Handler) Wait(args []string, store *datastore.Datastore) (any, bo
 		return errors.New("WRONGTYPE Operation against 'wait' command holding the wrong kind of value"), true
 	}
 
+	// A transaction can't wait, report the replicas that already
+	// acknowledged the client's writes instead
+	if handler.inExec {
+		numAcks := 0
+		for _, replica := range connection.GetReplicas() {
+			if replica.GetOffset() >= OffsTracking[handler.currClient].CapturedOffs {
+				numAcks++
+			}
+		}
+		return numAcks, true
+	}
+
 	// Close, delete the old and create new entry in acks map. This entry contains a channel to reiceive
 	// offsets from others replicas. The key is the connection that made the wait cmd.
 	offsTracker := OffsTracking[handler.currClient]
@@ -241,36 +266,31 @@ func (handler *Handler) Wait(args []string, store *datastore.Datastore) (any, bo
 	return nil, false
 }
 
-func (handler *Handler) Config(args []string, store *datastore.Datastore) (any, bool) {
-	cmd := strings.ToUpper(args[0])
-	switch cmd {
-	case "GET":
-		if value, exist := config.GetConfigValue(args[1]); exist {
-			return []string{args[1], value.(string)}, true
-		}
-		return errors.New("configuration parameter not found"), true
-	default:
-		return errors.New("config subcommand not found"), true
-	}
-}
-
 func (handler *Handler) Save(args []string, store *datastore.Datastore) (any, bool) {
-	rdbMarshalled, err := rdb.RdbMarshall(store)
-	if err != nil {
-		fmt.Println(err.Error())
+	if rdb.BgSaveInProgress() {
+		return rdb.ErrBgSaveInProgress, true
 	}
-	err = rdb.WriteRdbFile(rdbMarshalled)
+
+	err := rdb.SaveRdb(store)
 	if err != nil {
-		fmt.Println(err.Error())
+		logger.Warning(err.Error())
+		return errors.New("ERR " + err.Error()), true
 	}
-	return "OK", true
+	return proto.Status("OK"), true
 }
 
 func (handler *Handler) BgSave(args []string, store *datastore.Datastore) (any, bool) {
-	go func() {
-		handler.Save(args, store)
-	}()
-	return "OK", true
+	if err := rdb.BgSave(store); err != nil {
+		return err, true
+	}
+	return proto.Status("Background saving started"), true
+}
+
+func (handler *Handler) LastSave(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 0 {
+		return errors.New("ERR wrong number of arguments for 'lastsave' command"), true
+	}
+	return rdb.LastSaveInfo().LastSave.Unix(), true
 }
 
 func (handler *Handler) Command(args []string, store *datastore.Datastore) (any, bool) {
@@ -3,6 +3,7 @@ package command
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"slices"
 	"strings"
 
@@ -20,6 +21,10 @@ type CmdMetaData struct {
 	name        string
 	description string
 
+	//arity is the number of arguments, the command name included. A
+	//negative arity -N means at least N arguments.
+	arity int
+
 	//handler will return with value and true if the result is ready,
 	//otherwise returns nil value and false (result needs to be sent later on)
 	handler func([]string, *datastore.Datastore) (any, bool)
@@ -30,73 +35,319 @@ var commands map[string]CmdMetaData
 func SetupCommands(handler *Handler) {
 	commands = map[string]CmdMetaData{
 		"PING": {
-			name: "PING",
+			name:  "PING",
+			arity: -1,
 			description: `PING returns with an encoded "PONG" If any message is 
 						added with the ping command,the message will be returned.`,
 			handler: handler.Ping,
 		},
 		"SET": {
-			name: "SET",
-			description: `SET key value [EX seconds | PX milliseconds].
+			name:  "SET",
+			arity: -3,
+			description: `SET key value [NX | XX] [GET] [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | KEEPTTL].
 						Set key to hold the string value. If key already holds a value,
 						it is overwritten, regardless of its type. Any previous time to 
 						live associated with the key is discarded on successful SET operation.
 
 						The SET command supports a set of options that modify its behavior:.
 						- EX seconds -- Set the specified expire time, in seconds (a positive integer).
-						- PX milliseconds -- Set the specified expire time, in milliseconds (a positive integer).`,
+						- PX milliseconds -- Set the specified expire time, in milliseconds (a positive integer).
+						- EXAT, PXAT -- Set the specified unix time at which the key will expire, in seconds or milliseconds.
+						- KEEPTTL -- Retain the time to live associated with the key.
+						- NX -- Only set the key if it does not already exist.
+						- XX -- Only set the key if it already exists.
+						- GET -- Return the old string stored at key, or nil if key did not exist.`,
 			handler: handler.Set,
 		},
 		"GET": {
-			name: "GET",
+			name:  "GET",
+			arity: 2,
 			description: `GET key.
 						Get the value of key. If the key does not exist the special value nil is returned. 
 						An error is returned if the value stored at key is not a string, because GET only handles string values.`,
 			handler: handler.Get,
 		},
+		"SETNX": {
+			name:  "SETNX",
+			arity: 3,
+			description: `SETNX key value.
+						Sets key to value only if it doesn't exist. Returns 1 if it was set.`,
+			handler: handler.SetNX,
+		},
+		"SETEX": {
+			name:  "SETEX",
+			arity: 4,
+			description: `SETEX key seconds value.
+						Sets key to value, expiring in the given number of seconds.`,
+			handler: handler.SetEx,
+		},
+		"PSETEX": {
+			name:  "PSETEX",
+			arity: 4,
+			description: `PSETEX key milliseconds value.
+						Like SETEX, with the expiry in milliseconds.`,
+			handler: handler.PSetEx,
+		},
+		"GETSET": {
+			name:  "GETSET",
+			arity: 3,
+			description: `GETSET key value.
+						Sets key to value and returns the string it held, nil if it didn't exist.`,
+			handler: handler.GetSet,
+		},
+		"GETDEL": {
+			name:  "GETDEL",
+			arity: 2,
+			description: `GETDEL key.
+						Returns the string stored at key and deletes it.`,
+			handler: handler.GetDel,
+		},
+		"GETEX": {
+			name:  "GETEX",
+			arity: -2,
+			description: `GETEX key [EX seconds | PX milliseconds | EXAT unix-time-seconds | PXAT unix-time-milliseconds | PERSIST].
+						Returns the string stored at key, optionally setting or removing its expiry.`,
+			handler: handler.GetEx,
+		},
+		"MSET": {
+			name:  "MSET",
+			arity: -3,
+			description: `MSET key value [key value ...].
+						Sets the given keys to their respective values.`,
+			handler: handler.MSet,
+		},
+		"MSETNX": {
+			name:  "MSETNX",
+			arity: -3,
+			description: `MSETNX key value [key value ...].
+						Sets the given keys to their respective values only if none of them exist.
+						Returns 1 if they were set.`,
+			handler: handler.MSetNX,
+		},
+		"MGET": {
+			name:  "MGET",
+			arity: -2,
+			description: `MGET key [key ...].
+						Returns the values of the given keys, nil for keys which don't exist or
+						don't hold a string.`,
+			handler: handler.MGet,
+		},
+		"APPEND": {
+			name:  "APPEND",
+			arity: 3,
+			description: `APPEND key value.
+						Appends value to the string stored at key, created empty if it doesn't exist.
+						Returns the length of the string.`,
+			handler: handler.Append,
+		},
+		"STRLEN": {
+			name:  "STRLEN",
+			arity: 2,
+			description: `STRLEN key.
+						Returns the length of the string stored at key, 0 if it doesn't exist.`,
+			handler: handler.StrLen,
+		},
+		"GETRANGE": {
+			name:  "GETRANGE",
+			arity: 4,
+			description: `GETRANGE key start end.
+						Returns the substring of the string stored at key between the offsets start
+						and end, both inclusive. Negative offsets count from the end of the string.`,
+			handler: handler.GetRange,
+		},
+		"SETRANGE": {
+			name:  "SETRANGE",
+			arity: 4,
+			description: `SETRANGE key offset value.
+						Overwrites the string stored at key from offset on with value, padding it
+						with zero bytes if needed. Returns the length of the string.`,
+			handler: handler.SetRange,
+		},
+		"INCR": {
+			name:  "INCR",
+			arity: 2,
+			description: `INCR key.
+						Increments the integer stored at key by one, set to 0 first if key doesn't exist.`,
+			handler: handler.Incr,
+		},
+		"DECR": {
+			name:  "DECR",
+			arity: 2,
+			description: `DECR key.
+						Decrements the integer stored at key by one, set to 0 first if key doesn't exist.`,
+			handler: handler.Decr,
+		},
+		"INCRBY": {
+			name:  "INCRBY",
+			arity: 3,
+			description: `INCRBY key increment.
+						Increments the integer stored at key by increment.`,
+			handler: handler.IncrBy,
+		},
+		"DECRBY": {
+			name:  "DECRBY",
+			arity: 3,
+			description: `DECRBY key decrement.
+						Decrements the integer stored at key by decrement.`,
+			handler: handler.DecrBy,
+		},
+		"INCRBYFLOAT": {
+			name:  "INCRBYFLOAT",
+			arity: 3,
+			description: `INCRBYFLOAT key increment.
+						Increments the floating point number stored at key by increment.`,
+			handler: handler.IncrByFloat,
+		},
+		"LCS": {
+			name:  "LCS",
+			arity: -3,
+			description: `LCS key1 key2 [LEN] [IDX] [MINMATCHLEN min-match-len] [WITHMATCHLEN].
+						Returns the longest common subsequence of the strings stored at key1 and key2.
+						LEN returns its length instead, and IDX the ranges matching in both strings,
+						along with their length with WITHMATCHLEN, only those at least
+						MINMATCHLEN long.`,
+			handler: handler.LCS,
+		},
 		"HSET": {
-			name: "HSET",
+			name:  "HSET",
+			arity: -4,
 			description: `
 						HSET key field value [field value ...].
 						Sets the specified fields to their respective values in the hash stored at key.
 						This command overwrites the values of specified fields that exist in the hash. 
-						If key doesn't exist, a new key holding a hash is created.`,
-			handler: handler.Hset,
+						If key doesn't exist, a new key holding a hash is created.
+						Returns the number of fields that were added.`,
+			handler: handler.HSet,
 		},
 		"HGET": {
-			name: "HGET",
+			name:  "HGET",
+			arity: 3,
 			description: `HGET key field.
 						Returns the value associated with field in the hash stored at key.`,
 			handler: handler.HGet,
 		},
 		"HGETALL": {
-			name: "HGETALL",
+			name:  "HGETALL",
+			arity: 2,
 			description: `HGETALL key.
 						Returns all fields and values of the hash stored at key. 
 						In the returned value, every field name is followed by its value, 
 						so the length of the reply is twice the size of the hash.`,
 			handler: handler.HGetAll,
 		},
+		"HSETNX": {
+			name:  "HSETNX",
+			arity: 4,
+			description: `HSETNX key field value.
+						Sets field in the hash stored at key to value, only if field does not yet exist.`,
+			handler: handler.HSetNX,
+		},
+		"HMGET": {
+			name:  "HMGET",
+			arity: -3,
+			description: `HMGET key field [field ...].
+						Returns the values associated with the specified fields in the hash stored at key.
+						A nil value is returned for every field that does not exist.`,
+			handler: handler.HMGet,
+		},
+		"HDEL": {
+			name:  "HDEL",
+			arity: -3,
+			description: `HDEL key field [field ...].
+						Removes the specified fields from the hash stored at key. 
+						Returns the number of fields that were removed.`,
+			handler: handler.HDel,
+		},
+		"HEXISTS": {
+			name:  "HEXISTS",
+			arity: 3,
+			description: `HEXISTS key field.
+						Returns if field is an existing field in the hash stored at key.`,
+			handler: handler.HExists,
+		},
+		"HLEN": {
+			name:  "HLEN",
+			arity: 2,
+			description: `HLEN key.
+						Returns the number of fields contained in the hash stored at key.`,
+			handler: handler.HLen,
+		},
+		"HSTRLEN": {
+			name:  "HSTRLEN",
+			arity: 3,
+			description: `HSTRLEN key field.
+						Returns the string length of the value associated with field in the hash stored at key.`,
+			handler: handler.HStrLen,
+		},
+		"HKEYS": {
+			name:  "HKEYS",
+			arity: 2,
+			description: `HKEYS key.
+						Returns all field names in the hash stored at key.`,
+			handler: handler.HKeys,
+		},
+		"HVALS": {
+			name:  "HVALS",
+			arity: 2,
+			description: `HVALS key.
+						Returns all values in the hash stored at key.`,
+			handler: handler.HVals,
+		},
+		"HINCRBY": {
+			name:  "HINCRBY",
+			arity: 4,
+			description: `HINCRBY key field increment.
+						Increments the number stored at field in the hash stored at key by increment. 
+						If field does not exist the value is set to 0 before the operation is performed.`,
+			handler: handler.HIncrBy,
+		},
+		"HINCRBYFLOAT": {
+			name:  "HINCRBYFLOAT",
+			arity: 4,
+			description: `HINCRBYFLOAT key field increment.
+						Increment the specified field of a hash stored at key, and representing 
+						a floating point number, by the specified increment.`,
+			handler: handler.HIncrByFloat,
+		},
+		"HRANDFIELD": {
+			name:  "HRANDFIELD",
+			arity: -2,
+			description: `HRANDFIELD key [count [WITHVALUES]].
+						Returns random fields from the hash stored at key. A negative count 
+						allows the same field to be returned multiple times.`,
+			handler: handler.HRandField,
+		},
+		"HSCAN": {
+			name:  "HSCAN",
+			arity: -3,
+			description: `HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES].
+						Incrementally iterates over the fields and values of the hash stored at key.`,
+			handler: handler.HScan,
+		},
 		"INFO": {
-			name: "INFO",
+			name:  "INFO",
+			arity: -1,
 			description: `The INFO command returns information and statistics about the server 
 						in a format that is simple to parse by computers and easy to read by humans.`,
 			handler: handler.Info,
 		},
 		"REPLCONF": {
-			name: "REPLCONF",
+			name:  "REPLCONF",
+			arity: -1,
 			description: `The REPLCONF command is an internal command. 
 						It is used by a Redis master to configure a connected replica.`,
 			handler: handler.ReplConf,
 		},
 		"PSYNC": {
-			name: "PSYNC",
+			name:  "PSYNC",
+			arity: -3,
 			description: `Initiates a replication stream from the master.
 						The PSYNC command is called by Redis replicas for initiating a replication stream from the master.`,
 			handler: handler.Psync,
 		},
 		"WAIT": {
-			name: "WAIT",
+			name:  "WAIT",
+			arity: 3,
 			description: `WAIT numreplicas timeout. 
 						This command blocks the current client until all the previous write commands
 						are successfully transferred and acknowledged by at least the number of replicas
@@ -107,23 +358,772 @@ func SetupCommands(handler *Handler) {
 		},
 		"CONFIG": {
 			name:        "CONFIG",
+			arity:       -2,
 			description: `This is a container command for runtime configuration commands.`,
 			handler:     handler.Config,
 		},
 		"SAVE": {
-			name: "SAVE",
+			name:  "SAVE",
+			arity: 1,
 			description: `The SAVE commands performs a synchronous save of the dataset producing a point 
 						in time snapshot of all the data inside the Redis instance, in the form of an RDB file.`,
 			handler: handler.Save,
 		},
 		"BGSAVE": {
-			name: "BGSAVE",
+			name:  "BGSAVE",
+			arity: -1,
 			description: `Save the DB in background. Normally the OK code is immediately returned. 
 						Redis forks, the parent continues to serve the clients, the child saves the DB on disk then exits.`,
 			handler: handler.BgSave,
 		},
+		"LASTSAVE": {
+			name:  "LASTSAVE",
+			arity: 1,
+			description: `Return the UNIX TIME of the last DB save executed with success.
+						A client may check if a BGSAVE command succeeded reading the LASTSAVE value,
+						then issuing a BGSAVE command and checking at regular intervals every N seconds if LASTSAVE changed.`,
+			handler: handler.LastSave,
+		},
+		"BGREWRITEAOF": {
+			name:  "BGREWRITEAOF",
+			arity: 1,
+			description: `Instruct Redis to start an Append Only File rewrite process.
+						The rewrite will create a small optimized version of the current Append Only File.
+						Writes keep going to a new incremental file while the dataset is written as the new base.`,
+			handler: handler.BgRewriteAof,
+		},
+		"LPUSH": {
+			name:  "LPUSH",
+			arity: -3,
+			description: `LPUSH key element [element ...].
+						Insert all the specified values at the head of the list stored at key.
+						If key does not exist, it is created as empty list before performing the push operations.
+						Returns the length of the list after the push operations.`,
+			handler: handler.LPush,
+		},
+		"RPUSH": {
+			name:  "RPUSH",
+			arity: -3,
+			description: `RPUSH key element [element ...].
+						Insert all the specified values at the tail of the list stored at key.
+						If key does not exist, it is created as empty list before performing the push operation.
+						Returns the length of the list after the push operations.`,
+			handler: handler.RPush,
+		},
+		"LPUSHX": {
+			name:  "LPUSHX",
+			arity: -3,
+			description: `LPUSHX key element [element ...].
+						Inserts specified values at the head of the list stored at key, 
+						only if key already exists and holds a list.`,
+			handler: handler.LPushX,
+		},
+		"RPUSHX": {
+			name:  "RPUSHX",
+			arity: -3,
+			description: `RPUSHX key element [element ...].
+						Inserts specified values at the tail of the list stored at key, 
+						only if key already exists and holds a list.`,
+			handler: handler.RPushX,
+		},
+		"LPOP": {
+			name:  "LPOP",
+			arity: -2,
+			description: `LPOP key [count].
+						Removes and returns the first elements of the list stored at key.
+						By default, the command pops a single element from the beginning of the list.
+						When provided with the optional count argument, the reply will consist of up to count elements.`,
+			handler: handler.LPop,
+		},
+		"RPOP": {
+			name:  "RPOP",
+			arity: -2,
+			description: `RPOP key [count].
+						Removes and returns the last elements of the list stored at key.
+						By default, the command pops a single element from the end of the list.
+						When provided with the optional count argument, the reply will consist of up to count elements.`,
+			handler: handler.RPop,
+		},
+		"LLEN": {
+			name:  "LLEN",
+			arity: 2,
+			description: `LLEN key.
+						Returns the length of the list stored at key. If key does not exist, 
+						it is interpreted as an empty list and 0 is returned.`,
+			handler: handler.LLen,
+		},
+		"LINDEX": {
+			name:  "LINDEX",
+			arity: 3,
+			description: `LINDEX key index.
+						Returns the element at index index in the list stored at key. 
+						Negative indices can be used to designate elements starting at the tail of the list.`,
+			handler: handler.LIndex,
+		},
+		"LSET": {
+			name:  "LSET",
+			arity: 4,
+			description: `LSET key index element.
+						Sets the list element at index to element. 
+						An error is returned for out of range indexes.`,
+			handler: handler.LSet,
+		},
+		"LRANGE": {
+			name:  "LRANGE",
+			arity: 4,
+			description: `LRANGE key start stop.
+						Returns the specified elements of the list stored at key. 
+						The offsets start and stop are zero-based indexes and can also be negative numbers
+						indicating offsets starting at the end of the list.`,
+			handler: handler.LRange,
+		},
+		"LTRIM": {
+			name:  "LTRIM",
+			arity: 4,
+			description: `LTRIM key start stop.
+						Trim an existing list so that it will contain only the specified range of elements specified.`,
+			handler: handler.LTrim,
+		},
+		"LREM": {
+			name:  "LREM",
+			arity: 4,
+			description: `LREM key count element.
+						Removes the first count occurrences of elements equal to element from the list stored at key.
+						A positive count removes from head to tail, a negative count from tail to head 
+						and 0 removes all elements equal to element.`,
+			handler: handler.LRem,
+		},
+		"LINSERT": {
+			name:  "LINSERT",
+			arity: 5,
+			description: `LINSERT key BEFORE | AFTER pivot element.
+						Inserts element in the list stored at key either before or after the reference value pivot.
+						Returns -1 when the pivot wasn't found.`,
+			handler: handler.LInsert,
+		},
+		"LMOVE": {
+			name:  "LMOVE",
+			arity: 5,
+			description: `LMOVE source destination LEFT | RIGHT LEFT | RIGHT.
+						Atomically returns and removes the first/last element of the list stored at source, 
+						and pushes the element at the first/last element of the list stored at destination.`,
+			handler: handler.LMove,
+		},
+		"BLPOP": {
+			name:  "BLPOP",
+			arity: -3,
+			description: `BLPOP key [key ...] timeout.
+						BLPOP is a blocking list pop primitive. It is the blocking version of LPOP because it
+						blocks the connection when there are no elements to pop from any of the given lists.
+						An element is popped from the head of the first list that is non-empty, 
+						with the given keys being checked in the order that they are given.
+						A timeout of zero can be used to block indefinitely.`,
+			handler: handler.BLPop,
+		},
+		"BRPOP": {
+			name:  "BRPOP",
+			arity: -3,
+			description: `BRPOP key [key ...] timeout.
+						BRPOP is a blocking list pop primitive. It is the blocking version of RPOP because it
+						blocks the connection when there are no elements to pop from any of the given lists.
+						An element is popped from the tail of the first list that is non-empty, 
+						with the given keys being checked in the order that they are given.
+						A timeout of zero can be used to block indefinitely.`,
+			handler: handler.BRPop,
+		},
+		"BLMOVE": {
+			name:  "BLMOVE",
+			arity: 6,
+			description: `BLMOVE source destination LEFT | RIGHT LEFT | RIGHT timeout.
+						BLMOVE is the blocking variant of LMOVE. When source contains elements, 
+						this command behaves exactly like LMOVE. When source is empty, 
+						Redis will block the connection until another client pushes to it or until timeout is reached.`,
+			handler: handler.BLMove,
+		},
+		"SADD": {
+			name:  "SADD",
+			arity: -3,
+			description: `SADD key member [member ...].
+						Add the specified members to the set stored at key. 
+						Specified members that are already a member of this set are ignored.
+						If key does not exist, a new set is created before adding the specified members.
+						Returns the number of elements that were added to the set.`,
+			handler: handler.SAdd,
+		},
+		"SREM": {
+			name:  "SREM",
+			arity: -3,
+			description: `SREM key member [member ...].
+						Remove the specified members from the set stored at key. 
+						Specified members that are not a member of this set are ignored.
+						Returns the number of members that were removed from the set.`,
+			handler: handler.SRem,
+		},
+		"SMEMBERS": {
+			name:  "SMEMBERS",
+			arity: 2,
+			description: `SMEMBERS key.
+						Returns all the members of the set value stored at key.`,
+			handler: handler.SMembers,
+		},
+		"SISMEMBER": {
+			name:  "SISMEMBER",
+			arity: 3,
+			description: `SISMEMBER key member.
+						Returns if member is a member of the set stored at key.`,
+			handler: handler.SIsMember,
+		},
+		"SCARD": {
+			name:  "SCARD",
+			arity: 2,
+			description: `SCARD key.
+						Returns the set cardinality (number of elements) of the set stored at key.`,
+			handler: handler.SCard,
+		},
+		"SINTER": {
+			name:  "SINTER",
+			arity: -2,
+			description: `SINTER key [key ...].
+						Returns the members of the set resulting from the intersection of all the given sets.
+						Keys that do not exist are considered to be empty sets.`,
+			handler: handler.SInter,
+		},
+		"SUNION": {
+			name:  "SUNION",
+			arity: -2,
+			description: `SUNION key [key ...].
+						Returns the members of the set resulting from the union of all the given sets.`,
+			handler: handler.SUnion,
+		},
+		"SDIFF": {
+			name:  "SDIFF",
+			arity: -2,
+			description: `SDIFF key [key ...].
+						Returns the members of the set resulting from the difference between 
+						the first set and all the successive sets.`,
+			handler: handler.SDiff,
+		},
+		"SINTERSTORE": {
+			name:  "SINTERSTORE",
+			arity: -3,
+			description: `SINTERSTORE destination key [key ...].
+						This command is equal to SINTER, but instead of returning the resulting set, it is stored in destination.
+						If destination already exists, it is overwritten.`,
+			handler: handler.SInterStore,
+		},
+		"SUNIONSTORE": {
+			name:  "SUNIONSTORE",
+			arity: -3,
+			description: `SUNIONSTORE destination key [key ...].
+						This command is equal to SUNION, but instead of returning the resulting set, it is stored in destination.
+						If destination already exists, it is overwritten.`,
+			handler: handler.SUnionStore,
+		},
+		"SDIFFSTORE": {
+			name:  "SDIFFSTORE",
+			arity: -3,
+			description: `SDIFFSTORE destination key [key ...].
+						This command is equal to SDIFF, but instead of returning the resulting set, it is stored in destination.
+						If destination already exists, it is overwritten.`,
+			handler: handler.SDiffStore,
+		},
+		"SRANDMEMBER": {
+			name:  "SRANDMEMBER",
+			arity: -2,
+			description: `SRANDMEMBER key [count].
+						When called with just the key argument, return a random element from the set value stored at key.
+						If the provided count argument is positive, return an array of distinct elements.
+						If called with a negative count, the behavior changes and the command is allowed 
+						to return the same element multiple times.`,
+			handler: handler.SRandMember,
+		},
+		"SPOP": {
+			name:  "SPOP",
+			arity: -2,
+			description: `SPOP key [count].
+						Removes and returns one or more random members from the set value store at key.`,
+			handler: handler.SPop,
+		},
+		"ZADD": {
+			name:  "ZADD",
+			arity: -4,
+			description: `ZADD key [NX | XX] [GT | LT] [CH] [INCR] score member [score member ...].
+						Adds all the specified members with the specified scores to the sorted set stored at key.
+						If a specified member is already a member of the sorted set, the score is updated 
+						and the element reinserted at the right position to ensure the correct ordering.
+						- NX -- Only add new elements. Don't update already existing elements.
+						- XX -- Only update elements that already exist. Don't add new elements.
+						- GT -- Only update existing elements if the new score is greater than the current score.
+						- LT -- Only update existing elements if the new score is less than the current score.
+						- CH -- Return the number of elements changed instead of the number of new elements added.
+						- INCR -- When this option is specified ZADD acts like ZINCRBY.`,
+			handler: handler.ZAdd,
+		},
+		"ZINCRBY": {
+			name:  "ZINCRBY",
+			arity: 4,
+			description: `ZINCRBY key increment member.
+						Increments the score of member in the sorted set stored at key by increment.
+						If member does not exist in the sorted set, it is added with increment as its score.`,
+			handler: handler.ZIncrBy,
+		},
+		"ZREM": {
+			name:  "ZREM",
+			arity: -3,
+			description: `ZREM key member [member ...].
+						Removes the specified members from the sorted set stored at key. Non existing members are ignored.`,
+			handler: handler.ZRem,
+		},
+		"ZCARD": {
+			name:  "ZCARD",
+			arity: 2,
+			description: `ZCARD key.
+						Returns the sorted set cardinality (number of elements) of the sorted set stored at key.`,
+			handler: handler.ZCard,
+		},
+		"ZSCORE": {
+			name:  "ZSCORE",
+			arity: 3,
+			description: `ZSCORE key member.
+						Returns the score of member in the sorted set at key.`,
+			handler: handler.ZScore,
+		},
+		"ZCOUNT": {
+			name:  "ZCOUNT",
+			arity: 4,
+			description: `ZCOUNT key min max.
+						Returns the number of elements in the sorted set at key with a score between min and max.`,
+			handler: handler.ZCount,
+		},
+		"ZRANK": {
+			name:  "ZRANK",
+			arity: -3,
+			description: `ZRANK key member [WITHSCORE].
+						Returns the rank of member in the sorted set stored at key, 
+						with the scores ordered from low to high. The rank is 0-based.`,
+			handler: handler.ZRank,
+		},
+		"ZREVRANK": {
+			name:  "ZREVRANK",
+			arity: -3,
+			description: `ZREVRANK key member [WITHSCORE].
+						Returns the rank of member in the sorted set stored at key, 
+						with the scores ordered from high to low. The rank is 0-based.`,
+			handler: handler.ZRevRank,
+		},
+		"ZRANGE": {
+			name:  "ZRANGE",
+			arity: -4,
+			description: `ZRANGE key start stop [BYSCORE | BYLEX] [REV] [LIMIT offset count] [WITHSCORES].
+						Returns the specified range of elements in the sorted set stored at key.
+						ZRANGE can perform different types of range queries: by index (rank), 
+						by the score, or by lexicographical order.`,
+			handler: handler.ZRange,
+		},
+		"ZREVRANGE": {
+			name:  "ZREVRANGE",
+			arity: -4,
+			description: `ZREVRANGE key start stop [WITHSCORES].
+						Returns the specified range of elements in the sorted set stored at key, 
+						ordered from the highest to the lowest score.`,
+			handler: handler.ZRevRange,
+		},
+		"ZRANGEBYSCORE": {
+			name:  "ZRANGEBYSCORE",
+			arity: -4,
+			description: `ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count].
+						Returns all the elements in the sorted set at key with a score between min and max.`,
+			handler: handler.ZRangeByScore,
+		},
+		"ZREVRANGEBYSCORE": {
+			name:  "ZREVRANGEBYSCORE",
+			arity: -4,
+			description: `ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count].
+						Returns all the elements in the sorted set at key with a score between max and min, 
+						ordered from high to low scores.`,
+			handler: handler.ZRevRangeByScore,
+		},
+		"ZRANGEBYLEX": {
+			name:  "ZRANGEBYLEX",
+			arity: -4,
+			description: `ZRANGEBYLEX key min max [LIMIT offset count].
+						When all the elements in a sorted set are inserted with the same score, 
+						this command returns all the elements with a value between min and max.`,
+			handler: handler.ZRangeByLex,
+		},
+		"ZREVRANGEBYLEX": {
+			name:  "ZREVRANGEBYLEX",
+			arity: -4,
+			description: `ZREVRANGEBYLEX key max min [LIMIT offset count].
+						When all the elements in a sorted set are inserted with the same score, 
+						this command returns all the elements with a value between max and min, in reverse order.`,
+			handler: handler.ZRevRangeByLex,
+		},
+		"ZPOPMIN": {
+			name:  "ZPOPMIN",
+			arity: -2,
+			description: `ZPOPMIN key [count].
+						Removes and returns up to count members with the lowest scores in the sorted set stored at key.`,
+			handler: handler.ZPopMin,
+		},
+		"ZPOPMAX": {
+			name:  "ZPOPMAX",
+			arity: -2,
+			description: `ZPOPMAX key [count].
+						Removes and returns up to count members with the highest scores in the sorted set stored at key.`,
+			handler: handler.ZPopMax,
+		},
+		"ZUNIONSTORE": {
+			name:  "ZUNIONSTORE",
+			arity: -4,
+			description: `ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX].
+						Computes the union of numkeys sorted sets given by the specified keys, 
+						and stores the result in destination.`,
+			handler: handler.ZUnionStore,
+		},
+		"ZINTERSTORE": {
+			name:  "ZINTERSTORE",
+			arity: -4,
+			description: `ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX].
+						Computes the intersection of numkeys sorted sets given by the specified keys, 
+						and stores the result in destination.`,
+			handler: handler.ZInterStore,
+		},
+		"ZUNION": {
+			name:  "ZUNION",
+			arity: -3,
+			description: `ZUNION numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES].
+						This command is similar to ZUNIONSTORE, but instead of storing the resulting sorted set, 
+						it is returned to the client.`,
+			handler: handler.ZUnion,
+		},
+		"ZINTER": {
+			name:  "ZINTER",
+			arity: -3,
+			description: `ZINTER numkeys key [key ...] [WEIGHTS weight [weight ...]] [AGGREGATE SUM | MIN | MAX] [WITHSCORES].
+						This command is similar to ZINTERSTORE, but instead of storing the resulting sorted set, 
+						it is returned to the client.`,
+			handler: handler.ZInter,
+		},
+		"XADD": {
+			name:  "XADD",
+			arity: -5,
+			description: `XADD key [NOMKSTREAM] [MAXLEN | MINID [= | ~] threshold [LIMIT count]] * | id field value [field value ...].
+						Appends the specified stream entry to the stream at the specified key. 
+						If the key does not exist, the stream is created unless NOMKSTREAM is given.`,
+			handler: handler.XAdd,
+		},
+		"XRANGE": {
+			name:  "XRANGE",
+			arity: -4,
+			description: `XRANGE key start end [COUNT count].
+						Returns the stream entries matching a given range of IDs. 
+						The special IDs - and + mean the minimum and maximum possible ID.`,
+			handler: handler.XRange,
+		},
+		"XREVRANGE": {
+			name:  "XREVRANGE",
+			arity: -4,
+			description: `XREVRANGE key end start [COUNT count].
+						Same as XRANGE but returns the entries in reverse order.`,
+			handler: handler.XRevRange,
+		},
+		"XLEN": {
+			name:  "XLEN",
+			arity: 2,
+			description: `XLEN key.
+						Returns the number of entries inside a stream.`,
+			handler: handler.XLen,
+		},
+		"XDEL": {
+			name:  "XDEL",
+			arity: -3,
+			description: `XDEL key id [id ...].
+						Removes the specified entries from a stream, and returns the number of entries deleted.`,
+			handler: handler.XDel,
+		},
+		"XTRIM": {
+			name:  "XTRIM",
+			arity: -4,
+			description: `XTRIM key MAXLEN | MINID [= | ~] threshold [LIMIT count].
+						Trims the stream by evicting older entries, and returns the number of entries deleted.`,
+			handler: handler.XTrim,
+		},
+		"XREAD": {
+			name:  "XREAD",
+			arity: -4,
+			description: `XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...].
+						Read data from one or multiple streams, only returning entries with an ID greater 
+						than the last received ID reported by the caller. With BLOCK the client waits for new entries.`,
+			handler: handler.XRead,
+		},
+		"XGROUP": {
+			name:  "XGROUP",
+			arity: -2,
+			description: `XGROUP CREATE | SETID | DESTROY | CREATECONSUMER | DELCONSUMER key group [args].
+						Manages the consumer groups of a stream and their consumers.`,
+			handler: handler.XGroup,
+		},
+		"XREADGROUP": {
+			name:  "XREADGROUP",
+			arity: -7,
+			description: `XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...].
+						Special version of XREAD with support for consumer groups. The ID > reads entries never 
+						delivered to the group, any other ID reads the history of pending entries of the consumer.`,
+			handler: handler.XReadGroup,
+		},
+		"XACK": {
+			name:  "XACK",
+			arity: -4,
+			description: `XACK key group id [id ...].
+						Removes one or multiple entries from the pending entries list of a consumer group.`,
+			handler: handler.XAck,
+		},
+		"XPENDING": {
+			name:  "XPENDING",
+			arity: -3,
+			description: `XPENDING key group [[IDLE min-idle-time] start end count [consumer]].
+						Inspects the list of pending entries of a consumer group.`,
+			handler: handler.XPending,
+		},
+		"XCLAIM": {
+			name:  "XCLAIM",
+			arity: -6,
+			description: `XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds] 
+						[RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid].
+						Changes the ownership of pending entries idle for at least min-idle-time to the given consumer.`,
+			handler: handler.XClaim,
+		},
+		"XAUTOCLAIM": {
+			name:  "XAUTOCLAIM",
+			arity: -6,
+			description: `XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID].
+						Scans the pending entries list starting at start and claims entries idle for 
+						at least min-idle-time, like calling XPENDING then XCLAIM.`,
+			handler: handler.XAutoClaim,
+		},
+		"AUTH": {
+			name:  "AUTH",
+			arity: -2,
+			description: `AUTH [username] password.
+						Authenticates the current connection with the password set by requirepass.
+						Only the default user exists.`,
+			handler: handler.Auth,
+		},
+		"DEL": {
+			name:  "DEL",
+			arity: -2,
+			description: `DEL key [key ...].
+						Deletes the given keys. Returns the number of keys that existed.`,
+			handler: handler.Del,
+		},
+		"UNLINK": {
+			name:  "UNLINK",
+			arity: -2,
+			description: `UNLINK key [key ...].
+						Like DEL, the memory of the values is reclaimed in the background.`,
+			handler: handler.Unlink,
+		},
+		"EXISTS": {
+			name:  "EXISTS",
+			arity: -2,
+			description: `EXISTS key [key ...].
+						Returns how many of the given keys exist, a key given several times
+						is counted as many times.`,
+			handler: handler.Exists,
+		},
+		"TYPE": {
+			name:  "TYPE",
+			arity: 2,
+			description: `TYPE key.
+						Returns the type of the value stored at key: string, list, set, zset,
+						hash or stream, and none if key doesn't exist.`,
+			handler: handler.Type,
+		},
+		"KEYS": {
+			name:  "KEYS",
+			arity: 2,
+			description: `KEYS pattern.
+						Returns all keys matching the glob style pattern. Walks over the whole
+						keyspace at once, SCAN is better suited to large ones.`,
+			handler: handler.Keys,
+		},
+		"SCAN": {
+			name:  "SCAN",
+			arity: -2,
+			description: `SCAN cursor [MATCH pattern] [COUNT count] [TYPE type].
+						Incrementally iterates over the keys, starting with cursor 0 and going on
+						with the cursor returned by each call until it is 0 again. Keys stored
+						during the whole iteration are returned at least once.`,
+			handler: handler.Scan,
+		},
+		"RANDOMKEY": {
+			name:  "RANDOMKEY",
+			arity: 1,
+			description: `RANDOMKEY.
+						Returns a random key, nil when there are none.`,
+			handler: handler.RandomKey,
+		},
+		"DBSIZE": {
+			name:  "DBSIZE",
+			arity: 1,
+			description: `DBSIZE.
+						Returns the number of keys.`,
+			handler: handler.DBSize,
+		},
+		"RENAME": {
+			name:  "RENAME",
+			arity: 3,
+			description: `RENAME key newkey.
+						Renames key to newkey along with its expiry, replacing any value at newkey.`,
+			handler: handler.Rename,
+		},
+		"RENAMENX": {
+			name:  "RENAMENX",
+			arity: 3,
+			description: `RENAMENX key newkey.
+						Renames key to newkey only if newkey doesn't exist. Returns 1 if it was renamed.`,
+			handler: handler.RenameNX,
+		},
+		"COPY": {
+			name:  "COPY",
+			arity: -3,
+			description: `COPY source destination [DB destination-db] [REPLACE].
+						Copies the value and the expiry of source to destination, which must not
+						exist unless REPLACE is given. Returns 1 if it was copied.`,
+			handler: handler.Copy,
+		},
+		"FLUSHALL": {
+			name:  "FLUSHALL",
+			arity: -1,
+			description: `FLUSHALL [ASYNC | SYNC].
+						Deletes all keys. With ASYNC, their memory is reclaimed in the background.`,
+			handler: handler.FlushAll,
+		},
+		"FLUSHDB": {
+			name:  "FLUSHDB",
+			arity: -1,
+			description: `FLUSHDB [ASYNC | SYNC].
+						Same as FLUSHALL, there's a single database.`,
+			handler: handler.FlushDB,
+		},
+		"EXPIRE": {
+			name:  "EXPIRE",
+			arity: -3,
+			description: `EXPIRE key seconds [NX | XX | GT | LT].
+						Sets a timeout on key in seconds, after which the key is deleted.
+						NX only sets it when the key has no expiry, XX only when it has one,
+						GT and LT only when the new expiry is greater or less than the current one.`,
+			handler: handler.Expire,
+		},
+		"PEXPIRE": {
+			name:  "PEXPIRE",
+			arity: -3,
+			description: `PEXPIRE key milliseconds [NX | XX | GT | LT].
+						Like EXPIRE, with the timeout in milliseconds.`,
+			handler: handler.PExpire,
+		},
+		"EXPIREAT": {
+			name:  "EXPIREAT",
+			arity: -3,
+			description: `EXPIREAT key unix-time-seconds [NX | XX | GT | LT].
+						Like EXPIRE, with the expiry given as a unix timestamp in seconds.`,
+			handler: handler.ExpireAt,
+		},
+		"PEXPIREAT": {
+			name:  "PEXPIREAT",
+			arity: -3,
+			description: `PEXPIREAT key unix-time-milliseconds [NX | XX | GT | LT].
+						Like EXPIRE, with the expiry given as a unix timestamp in milliseconds.`,
+			handler: handler.PExpireAt,
+		},
+		"TTL": {
+			name:  "TTL",
+			arity: 2,
+			description: `TTL key.
+						Returns the remaining time to live of key in seconds,
+						-1 if it has no expiry and -2 if it doesn't exist.`,
+			handler: handler.TTL,
+		},
+		"PTTL": {
+			name:  "PTTL",
+			arity: 2,
+			description: `PTTL key.
+						Like TTL, in milliseconds.`,
+			handler: handler.PTTL,
+		},
+		"EXPIRETIME": {
+			name:  "EXPIRETIME",
+			arity: 2,
+			description: `EXPIRETIME key.
+						Returns the unix timestamp in seconds at which key expires,
+						-1 if it has no expiry and -2 if it doesn't exist.`,
+			handler: handler.ExpireTime,
+		},
+		"PEXPIRETIME": {
+			name:  "PEXPIRETIME",
+			arity: 2,
+			description: `PEXPIRETIME key.
+						Like EXPIRETIME, in milliseconds.`,
+			handler: handler.PExpireTime,
+		},
+		"PERSIST": {
+			name:  "PERSIST",
+			arity: 2,
+			description: `PERSIST key.
+						Removes the expiry of key. Returns 1 if it had one, 0 otherwise.`,
+			handler: handler.Persist,
+		},
+		"HELLO": {
+			name:  "HELLO",
+			arity: -1,
+			description: `HELLO [protover [AUTH username password] [SETNAME clientname]].
+						Switches the connection to RESP2 or RESP3, optionally authenticating
+						and naming it, and replies with details about the server.`,
+			handler: handler.Hello,
+		},
+		"MULTI": {
+			name:  "MULTI",
+			arity: 1,
+			description: `MULTI.
+						Marks the start of a transaction block. Subsequent commands will be 
+						queued for atomic execution using EXEC.`,
+			handler: handler.Multi,
+		},
+		"EXEC": {
+			name:  "EXEC",
+			arity: 1,
+			description: `EXEC.
+						Executes all previously queued commands in a transaction and restores 
+						the connection state to normal. When using WATCH, EXEC will execute 
+						commands only if the watched keys were not modified.`,
+			handler: handler.Exec,
+		},
+		"DISCARD": {
+			name:  "DISCARD",
+			arity: 1,
+			description: `DISCARD.
+						Flushes all previously queued commands in a transaction and restores 
+						the connection state to normal. Unwatches all keys.`,
+			handler: handler.Discard,
+		},
+		"WATCH": {
+			name:  "WATCH",
+			arity: -2,
+			description: `WATCH key [key ...].
+						Marks the given keys to be watched for conditional execution of a transaction.`,
+			handler: handler.Watch,
+		},
+		"UNWATCH": {
+			name:  "UNWATCH",
+			arity: 1,
+			description: `UNWATCH.
+						Flushes all the previously watched keys for a transaction.`,
+			handler: handler.Unwatch,
+		},
 		"COMMAND": {
-			name: "COMMAND",
+			name:  "COMMAND",
+			arity: -1,
 			description: `Return an array with details about every Redis command. 
 						Used with sub commands [list, docs, count]`,
 			handler: handler.Command,
@@ -136,33 +1136,56 @@ func GetCmdMetadata(cmdName string) (CmdMetaData, bool) {
 	return metaData, exist
 }
 
-func Parse(rawCmdBuf *bytes.Buffer) (Command, error) {
-	decoder := proto.NewDecoder(rawCmdBuf)
-	value, err := decoder.Decode()
+// Parse decodes the first command of buf and consumes it, returning the
+// command encoded in RESP as well. custom_err.ErrorIncompleteRESP means
+// buf only holds the beginning of a command.
+func Parse(buf *bytes.Buffer) (Command, []byte, error) {
+	value, rawCmd, err := proto.DecodeNext(buf)
 	if err != nil {
-		return Command{}, err
+		return Command{}, nil, err
 	}
 
-	interfaceArr := value.([]any)
+	interfaceArr, ok := value.([]any)
+	if !ok || len(interfaceArr) == 0 {
+		return Command{}, nil, errors.New("command must be a non empty array")
+	}
 	strArr := make([]string, 0, len(interfaceArr))
 
 	for _, elem := range interfaceArr {
-		strArr = append(strArr, elem.(string))
+		str, ok := elem.(string)
+		if !ok {
+			return Command{}, nil, errors.New("command arguments must be bulk strings")
+		}
+		strArr = append(strArr, str)
+	}
+
+	// Inline commands are propagated as RESP like any other
+	if rawCmd[0] != proto.ArrayPrefix {
+		encoder := proto.NewEncoder()
+		encoder.Encode(strArr, false)
+		rawCmd = encoder.GetBufValue()
 	}
 
 	return Command{
 		Cmd:  strings.ToUpper(strArr[0]),
 		Args: strArr[1:],
-	}, nil
+	}, rawCmd, nil
 }
 
-func ExecuteCmd(cmd Command, store *datastore.Datastore) (any, bool) {
+func (handler *Handler) ExecuteCmd(cmd Command, store *datastore.Datastore) (any, bool) {
 	var (
 		result any
 		ready  bool
 	)
-	if cmdMetaData, ok := GetCmdMetadata(cmd.Cmd); ok {
+	cmdMetaData, ok := GetCmdMetadata(cmd.Cmd)
+	if queuedResult, queued := handler.queueCommand(cmd, cmdMetaData, ok); queued {
+		result, ready = queuedResult, true
+	} else if ok {
+		// Values fetched by read only commands don't need to be copied
+		// while a snapshot of the store is being saved
+		store.SetReadOnly(IsReadOnlyCommand(cmd))
 		result, ready = cmdMetaData.handler(cmd.Args, store)
+		store.SetReadOnly(false)
 		//fmt.Printf("Result after executed: %v\n", result)
 	} else {
 		return errors.New("unknown command"), true
@@ -176,7 +1199,47 @@ func ExecuteCmd(cmd Command, store *datastore.Datastore) (any, bool) {
 	return result, ready
 }
 
+// Reports whether cmd is given a number of arguments the command accepts
+func (metaData CmdMetaData) arityMatches(cmd Command) bool {
+	argc := len(cmd.Args) + 1
+	if metaData.arity < 0 {
+		return argc >= -metaData.arity
+	}
+	return argc == metaData.arity
+}
+
+func errWrongArgs(cmdName string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", cmdName)
+}
+
 func IsWriteCommand(cmd Command) bool {
-	writeCommands := []string{"SET", "HSET"}
+	writeCommands := []string{
+		"SET", "SETNX", "SETEX", "PSETEX", "GETSET", "GETDEL", "GETEX", "MSET", "MSETNX", "APPEND", "SETRANGE",
+		"INCR", "DECR", "INCRBY", "DECRBY", "INCRBYFLOAT",
+		"DEL", "UNLINK", "RENAME", "RENAMENX", "COPY", "FLUSHALL", "FLUSHDB",
+		"EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT", "PERSIST",
+		"HSET", "HSETNX", "HDEL", "HINCRBY", "HINCRBYFLOAT",
+		"LPUSH", "RPUSH", "LPUSHX", "RPUSHX", "LPOP", "RPOP", "LSET", "LTRIM", "LREM", "LINSERT", "LMOVE",
+		"SADD", "SREM", "SINTERSTORE", "SUNIONSTORE", "SDIFFSTORE", "SPOP",
+		"ZADD", "ZINCRBY", "ZREM", "ZPOPMIN", "ZPOPMAX", "ZUNIONSTORE", "ZINTERSTORE",
+		"XADD", "XDEL", "XTRIM", "XGROUP", "XACK", "XCLAIM", "XAUTOCLAIM",
+		"MULTI", "EXEC",
+	}
 	return slices.Contains(writeCommands, cmd.Cmd)
 }
+
+// IsReadOnlyCommand reports whether cmd never modifies the values it reads
+func IsReadOnlyCommand(cmd Command) bool {
+	readOnlyCommands := []string{
+		"GET", "MGET", "STRLEN", "GETRANGE", "LCS",
+		"EXISTS", "TYPE", "KEYS", "SCAN", "RANDOMKEY", "DBSIZE",
+		"TTL", "PTTL", "EXPIRETIME", "PEXPIRETIME",
+		"HGET", "HGETALL", "HMGET", "HEXISTS", "HLEN", "HSTRLEN", "HKEYS", "HVALS", "HRANDFIELD", "HSCAN",
+		"LLEN", "LINDEX", "LRANGE",
+		"SMEMBERS", "SISMEMBER", "SCARD", "SINTER", "SUNION", "SDIFF", "SRANDMEMBER",
+		"ZCARD", "ZSCORE", "ZCOUNT", "ZRANK", "ZREVRANK", "ZRANGE", "ZREVRANGE", "ZRANGEBYSCORE",
+		"ZREVRANGEBYSCORE", "ZRANGEBYLEX", "ZREVRANGEBYLEX", "ZUNION", "ZINTER",
+		"XRANGE", "XREVRANGE", "XLEN", "XREAD", "XPENDING",
+	}
+	return slices.Contains(readOnlyCommands, cmd.Cmd)
+}
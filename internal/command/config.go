@@ -0,0 +1,88 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/config"
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+func (handler *Handler) Config(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) == 0 {
+		return errWrongArgs("config"), true
+	}
+
+	subcmd, args := args[0], args[1:]
+	switch strings.ToUpper(subcmd) {
+	case "GET":
+		if len(args) == 0 {
+			return errWrongArgs("config|get"), true
+		}
+		return configGet(args), true
+	case "SET":
+		if len(args) == 0 || len(args)%2 != 0 {
+			return errWrongArgs("config|set"), true
+		}
+		pairs := make([][2]string, 0, len(args)/2)
+		for i := 0; i < len(args); i += 2 {
+			pairs = append(pairs, [2]string{args[i], args[i+1]})
+		}
+		if err := config.SetConfigValues(pairs); err != nil {
+			return errors.New("ERR " + err.Error()), true
+		}
+		return proto.Status("OK"), true
+	case "RESETSTAT":
+		if len(args) != 0 {
+			return errWrongArgs("config|resetstat"), true
+		}
+		info.ResetStats()
+		return proto.Status("OK"), true
+	case "REWRITE":
+		if len(args) != 0 {
+			return errWrongArgs("config|rewrite"), true
+		}
+		if err := config.Rewrite(); err != nil {
+			return errors.New("ERR " + err.Error()), true
+		}
+		return proto.Status("OK"), true
+	default:
+		return fmt.Errorf("ERR unknown subcommand '%s'. Try CONFIG HELP.", subcmd), true
+	}
+}
+
+// Name value pairs of the parameters matching any of the glob patterns
+func configGet(patterns []string) proto.Map {
+	var (
+		reply   = proto.Map{}
+		matched []string
+	)
+	add := func(name string) {
+		if slices.Contains(matched, name) {
+			return
+		}
+		value, _ := config.GetConfigValue(name)
+		matched = append(matched, name)
+		reply = append(reply, name, value)
+	}
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		// Aliases are only returned when asked for by name
+		if _, exists := config.GetConfigValue(pattern); exists {
+			add(pattern)
+			continue
+		}
+		for _, name := range config.ParamNames() {
+			if globMatch(pattern, name) {
+				add(name)
+			}
+		}
+	}
+
+	return reply
+}
@@ -0,0 +1,199 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+)
+
+var (
+	errExpireNXAndOthers = errors.New("ERR NX and XX, GT or LT options at the same time are not compatible")
+	errExpireGTAndLT     = errors.New("ERR GT and LT options at the same time are not compatible")
+)
+
+// EXPIRE PEXPIRE EXPIREAT PEXPIREAT Handlers
+func (handler *Handler) Expire(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.expireGeneric(args, store, "expire", time.Second, false)
+}
+
+func (handler *Handler) PExpire(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.expireGeneric(args, store, "pexpire", time.Millisecond, false)
+}
+
+func (handler *Handler) ExpireAt(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.expireGeneric(args, store, "expireat", time.Second, true)
+}
+
+func (handler *Handler) PExpireAt(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.expireGeneric(args, store, "pexpireat", time.Millisecond, true)
+}
+
+// Sets the expiry of a key given in unit, either relative to now or as a
+// unix timestamp with absolute. Replicas get the expiry as an absolute
+// PEXPIREAT, so it doesn't depend on when they apply it.
+func (handler *Handler) expireGeneric(args []string, store *datastore.Datastore, cmdName string, unit time.Duration, absolute bool) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs(cmdName), true
+	}
+	// Only propagated as PEXPIREAT, and only when it did something
+	handler.preventPropagation()
+
+	value, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+	condition, err := parseExpireCondition(args[2:])
+	if err != nil {
+		return err, true
+	}
+
+	// Everything is kept in milliseconds since the epoch
+	errInvalidTime := fmt.Errorf("ERR invalid expire time in '%s' command", cmdName)
+	multiplier := int64(unit / time.Millisecond)
+	if value > math.MaxInt64/multiplier || value < math.MinInt64/multiplier {
+		return errInvalidTime, true
+	}
+	when := value * multiplier
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if when > math.MaxInt64-now {
+			return errInvalidTime, true
+		}
+		when += now
+	}
+
+	key := args[0]
+	if !store.Exists(key) {
+		return 0, true
+	}
+	if !expireConditionMet(store, key, condition, when) {
+		return 0, true
+	}
+
+	expireAt := time.UnixMilli(when)
+	if !expireAt.After(time.Now()) {
+		// Already expired, no need to keep it around
+		store.Del(key)
+		handler.alsoPropagate("DEL", key)
+		return 1, true
+	}
+
+	store.SetExpiry(key, expireAt)
+	handler.alsoPropagate("PEXPIREAT", key, strconv.FormatInt(when, 10))
+	return 1, true
+}
+
+// Parses the NX, XX, GT and LT options of EXPIRE like commands, returns
+// an empty string when none is given
+func parseExpireCondition(options []string) (string, error) {
+	given := make(map[string]bool)
+	for _, option := range options {
+		option = strings.ToUpper(option)
+		switch option {
+		case "NX", "XX", "GT", "LT":
+			given[option] = true
+		default:
+			return "", fmt.Errorf("ERR Unsupported option %s", option)
+		}
+	}
+
+	if given["NX"] && (given["XX"] || given["GT"] || given["LT"]) {
+		return "", errExpireNXAndOthers
+	}
+	if given["GT"] && given["LT"] {
+		return "", errExpireGTAndLT
+	}
+	for _, condition := range []string{"NX", "GT", "LT", "XX"} {
+		if given[condition] {
+			return condition, nil
+		}
+	}
+	return "", nil
+}
+
+// A key without an expiry is considered to never expire, so GT never
+// applies to it and LT always does
+func expireConditionMet(store *datastore.Datastore, key, condition string, when int64) bool {
+	expireAt, hasExpiry := store.GetExpiry(key)
+	switch condition {
+	case "NX":
+		return !hasExpiry
+	case "XX":
+		return hasExpiry
+	case "GT":
+		return hasExpiry && when > expireAt.UnixMilli()
+	case "LT":
+		return !hasExpiry || when < expireAt.UnixMilli()
+	default:
+		return true
+	}
+}
+
+// TTL PTTL EXPIRETIME PEXPIRETIME Handlers
+func (handler *Handler) TTL(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("ttl"), true
+	}
+	return ttlGeneric(store, args[0], func(expireAt time.Time) int64 {
+		// Rounded to the closest second
+		return (time.Until(expireAt).Milliseconds() + 500) / 1000
+	}), true
+}
+
+func (handler *Handler) PTTL(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("pttl"), true
+	}
+	return ttlGeneric(store, args[0], func(expireAt time.Time) int64 {
+		return time.Until(expireAt).Milliseconds()
+	}), true
+}
+
+func (handler *Handler) ExpireTime(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("expiretime"), true
+	}
+	return ttlGeneric(store, args[0], func(expireAt time.Time) int64 {
+		return expireAt.Unix()
+	}), true
+}
+
+func (handler *Handler) PExpireTime(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("pexpiretime"), true
+	}
+	return ttlGeneric(store, args[0], func(expireAt time.Time) int64 {
+		return expireAt.UnixMilli()
+	}), true
+}
+
+// Replies -2 if key doesn't exist, -1 if it has no expiry, or its expiry
+// formatted by format
+func ttlGeneric(store *datastore.Datastore, key string, format func(time.Time) int64) int64 {
+	if !store.Exists(key) {
+		return -2
+	}
+	expireAt, hasExpiry := store.GetExpiry(key)
+	if !hasExpiry {
+		return -1
+	}
+	return max(format(expireAt), 0)
+}
+
+// PERSIST Handler
+func (handler *Handler) Persist(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("persist"), true
+	}
+
+	if !store.Exists(args[0]) || !store.Persist(args[0]) {
+		return 0, true
+	}
+	return 1, true
+}
@@ -0,0 +1,98 @@
+package command
+
+// Reports whether s matches the glob style pattern, with the same rules as
+// Redis: * and ? wildcards, [abc], [^abc] and [a-z] classes, and \ to
+// escape the next character.
+func globMatch(pattern, s string) bool {
+	// Where to resume from after the last star seen, so a mismatch only
+	// makes that star swallow one more character instead of retrying
+	// every earlier star too
+	star, starS := -1, 0
+
+	p := 0
+	for i := 0; i < len(s); {
+		if p < len(pattern) && pattern[p] == '*' {
+			// Consecutive stars are the same as a single one
+			for p < len(pattern) && pattern[p] == '*' {
+				p++
+			}
+			star, starS = p, i
+			continue
+		}
+		if p < len(pattern) {
+			if matched, width := matchOne(pattern[p:], s[i]); matched {
+				p += width
+				i++
+				continue
+			}
+		}
+		if star < 0 {
+			return false
+		}
+		starS++
+		p, i = star, starS
+	}
+
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// Matches c against the element the pattern starts with, anything but a
+// star. Returns whether it matched and the length of the element.
+func matchOne(pattern string, c byte) (bool, int) {
+	switch pattern[0] {
+	case '?':
+		return true, 1
+	case '[':
+		matched, rest := matchClass(pattern[1:], c)
+		return matched, len(pattern) - len(rest)
+	case '\\':
+		if len(pattern) >= 2 {
+			return pattern[1] == c, 2
+		}
+	}
+	return pattern[0] == c, 1
+}
+
+// Matches c against the class starting right after a '['. Returns whether
+// it matched and the rest of the pattern after the closing ']'. An
+// unterminated class runs until the end of the pattern.
+func matchClass(pattern string, c byte) (bool, string) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) >= 2:
+			if pattern[1] == c {
+				matched = true
+			}
+			pattern = pattern[2:]
+		case len(pattern) >= 3 && pattern[1] == '-':
+			start, end := pattern[0], pattern[2]
+			if start > end {
+				start, end = end, start
+			}
+			if c >= start && c <= end {
+				matched = true
+			}
+			pattern = pattern[3:]
+		default:
+			if pattern[0] == c {
+				matched = true
+			}
+			pattern = pattern[1:]
+		}
+	}
+	if len(pattern) > 0 {
+		// Skip the closing bracket
+		pattern = pattern[1:]
+	}
+
+	return matched != negate, pattern
+}
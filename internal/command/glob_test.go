@@ -0,0 +1,71 @@
+package command
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		s       string
+		matched bool
+	}{
+		{pattern: "", s: "", matched: true},
+		{pattern: "", s: "a", matched: false},
+		{pattern: "abc", s: "abc", matched: true},
+		{pattern: "abc", s: "abcd", matched: false},
+		{pattern: "*", s: "", matched: true},
+		{pattern: "*", s: "anything", matched: true},
+		{pattern: "**", s: "anything", matched: true},
+		{pattern: "a*", s: "abc", matched: true},
+		{pattern: "*c", s: "abc", matched: true},
+		{pattern: "*b*", s: "abc", matched: true},
+		{pattern: "*b*", s: "ac", matched: false},
+		{pattern: "a*b*c", s: "aXbYbZc", matched: true},
+		{pattern: "a*b*c", s: "aXbYbZ", matched: false},
+		{pattern: "*ab", s: "aab", matched: true},
+		{pattern: "h?llo", s: "hello", matched: true},
+		{pattern: "h?llo", s: "hllo", matched: false},
+		{pattern: "h*?", s: "h", matched: false},
+		{pattern: "h[ae]llo", s: "hallo", matched: true},
+		{pattern: "h[ae]llo", s: "hillo", matched: false},
+		{pattern: "h[^e]llo", s: "hallo", matched: true},
+		{pattern: "h[^e]llo", s: "hello", matched: false},
+		{pattern: "h[a-b]llo", s: "hbllo", matched: true},
+		{pattern: "h[b-a]llo", s: "hallo", matched: true},
+		{pattern: "h[a-b]llo", s: "hcllo", matched: false},
+		{pattern: "[\\]]", s: "]", matched: true},
+		{pattern: "*[0-9]", s: "key:42", matched: true},
+		{pattern: "[abc", s: "b", matched: true},
+		{pattern: "h\\*llo", s: "h*llo", matched: true},
+		{pattern: "h\\*llo", s: "hello", matched: false},
+		{pattern: "h\\?llo", s: "hello", matched: false},
+		{pattern: "a\\", s: "a\\", matched: true},
+	}
+
+	for _, tc := range tests {
+		if matched := globMatch(tc.pattern, tc.s); matched != tc.matched {
+			t.Errorf("globMatch(%q, %q): expected %v but got %v", tc.pattern, tc.s, tc.matched, matched)
+		}
+	}
+}
+
+// Runs of stars must not make the matcher try every way of splitting s
+// between them
+func TestGlobMatchStarRuns(t *testing.T) {
+	pattern := strings.Repeat("a*", 30) + "b"
+	s := strings.Repeat("a", 100)
+
+	start := time.Now()
+	if globMatch(pattern, s) {
+		t.Errorf("Expected %q not to match", pattern)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the match to be linear, took %v", elapsed)
+	}
+	if !globMatch(pattern, s+"b") {
+		t.Errorf("Expected %q to match", pattern)
+	}
+}
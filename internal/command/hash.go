@@ -0,0 +1,474 @@
+package command
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+var (
+	errHashNotInteger = errors.New("ERR hash value is not an integer")
+	errHashNotFloat   = errors.New("ERR hash value is not a float")
+	errIncrOverflow   = errors.New("ERR increment or decrement would overflow")
+	errIncrNaNOrInf   = errors.New("ERR increment would produce NaN or Infinity")
+	errInvalidCursor  = errors.New("ERR invalid cursor")
+)
+
+// Looks up field in a hash that may not exist
+func hashField(hash *datastore.Hash, field string) (string, bool) {
+	if hash == nil {
+		return "", false
+	}
+	return hash.Get(field)
+}
+
+// Replies with field value pairs in a flat array, like HGETALL does
+func fieldValuePairs(hash *datastore.Hash, fields []string) []string {
+	pairs := make([]string, 0, len(fields)*2)
+	for _, field := range fields {
+		value, _ := hash.Get(field)
+		pairs = append(pairs, field, value)
+	}
+	return pairs
+}
+
+// HSET HSETNX Handlers
+func (handler *Handler) HSet(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 3 || len(args[1:])%2 != 0 {
+		return errWrongArgs("hset"), true
+	}
+
+	hash, created, err := getOrCreateTyped(store, args[0], datastore.NewHash)
+	if err != nil {
+		return err, true
+	}
+
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		if hash.Set(args[i], args[i+1]) {
+			added++
+		}
+	}
+	if err := saveTyped(store, args[0], hash, created); err != nil {
+		return err, true
+	}
+
+	return added, true
+}
+
+func (handler *Handler) HSetNX(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs("hsetnx"), true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if _, exists := hashField(hash, args[1]); exists {
+		return 0, true
+	}
+
+	hash, created, err := getOrCreateTyped(store, args[0], datastore.NewHash)
+	if err != nil {
+		return err, true
+	}
+	hash.Set(args[1], args[2])
+	if err := saveTyped(store, args[0], hash, created); err != nil {
+		return err, true
+	}
+
+	return 1, true
+}
+
+// HGET HMGET HGETALL Handlers
+func (handler *Handler) HGet(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("hget"), true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if hash == nil {
+		return custom_err.ErrorKeyNotExists, true
+	}
+
+	value, exists := hash.Get(args[1])
+	if !exists {
+		return custom_err.ErrorKeyNotExists, true
+	}
+
+	return value, true
+}
+
+func (handler *Handler) HMGet(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs("hmget"), true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+
+	// Missing fields are replied as nil bulk strings
+	values := make([]any, 0, len(args)-1)
+	for _, field := range args[1:] {
+		value, exists := hashField(hash, field)
+		if !exists {
+			values = append(values, custom_err.ErrorKeyNotExists)
+			continue
+		}
+		values = append(values, value)
+	}
+
+	return values, true
+}
+
+func (handler *Handler) HGetAll(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("hgetall"), true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if hash == nil {
+		return proto.Map{}, true
+	}
+
+	return proto.Map(proto.Strings(fieldValuePairs(hash, hash.Fields()))), true
+}
+
+// HDEL Handler
+func (handler *Handler) HDel(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs("hdel"), true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if hash == nil {
+		return 0, true
+	}
+
+	deleted := hash.Delete(args[1:]...)
+	if deleted > 0 {
+		removeIfEmpty(store, args[0], hash)
+	}
+
+	return deleted, true
+}
+
+// HEXISTS Handler
+func (handler *Handler) HExists(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("hexists"), true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if _, exists := hashField(hash, args[1]); exists {
+		return 1, true
+	}
+	return 0, true
+}
+
+// HLEN HSTRLEN Handlers
+func (handler *Handler) HLen(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("hlen"), true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if hash == nil {
+		return 0, true
+	}
+
+	return hash.Len(), true
+}
+
+func (handler *Handler) HStrLen(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("hstrlen"), true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	value, _ := hashField(hash, args[1])
+	return len(value), true
+}
+
+// HKEYS HVALS Handlers
+func (handler *Handler) HKeys(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("hkeys"), true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if hash == nil {
+		return []string{}, true
+	}
+
+	return hash.Fields(), true
+}
+
+func (handler *Handler) HVals(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("hvals"), true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if hash == nil {
+		return []string{}, true
+	}
+
+	values := make([]string, 0, hash.Len())
+	for _, field := range hash.Fields() {
+		value, _ := hash.Get(field)
+		values = append(values, value)
+	}
+
+	return values, true
+}
+
+// HINCRBY HINCRBYFLOAT Handlers
+func (handler *Handler) HIncrBy(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs("hincrby"), true
+	}
+
+	increment, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+
+	var current int64
+	if value, exists := hashField(hash, args[1]); exists {
+		current, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return errHashNotInteger, true
+		}
+	}
+	if (increment > 0 && current > math.MaxInt64-increment) ||
+		(increment < 0 && current < math.MinInt64-increment) {
+		return errIncrOverflow, true
+	}
+
+	hash, created, err := getOrCreateTyped(store, args[0], datastore.NewHash)
+	if err != nil {
+		return err, true
+	}
+	current += increment
+	hash.Set(args[1], strconv.FormatInt(current, 10))
+	if err := saveTyped(store, args[0], hash, created); err != nil {
+		return err, true
+	}
+
+	return current, true
+}
+
+func (handler *Handler) HIncrByFloat(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs("hincrbyfloat"), true
+	}
+
+	increment, err := strconv.ParseFloat(args[2], 64)
+	if err != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+		return errNotFloat, true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+
+	var current float64
+	if value, exists := hashField(hash, args[1]); exists {
+		current, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			return errHashNotFloat, true
+		}
+	}
+
+	current += increment
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return errIncrNaNOrInf, true
+	}
+
+	hash, created, err := getOrCreateTyped(store, args[0], datastore.NewHash)
+	if err != nil {
+		return err, true
+	}
+	value := strconv.FormatFloat(current, 'f', -1, 64)
+	hash.Set(args[1], value)
+	if err := saveTyped(store, args[0], hash, created); err != nil {
+		return err, true
+	}
+
+	// Replicas could compute a slightly different float, send them the result
+	handler.preventPropagation()
+	handler.alsoPropagate("HSET", args[0], args[1], value)
+
+	return value, true
+}
+
+// HRANDFIELD Handler
+func (handler *Handler) HRandField(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 1 || len(args) > 3 {
+		return errWrongArgs("hrandfield"), true
+	}
+
+	count := 0
+	if len(args) >= 2 {
+		var err error
+		count, err = strconv.Atoi(args[1])
+		if err != nil {
+			return custom_err.ErrorNotInteger, true
+		}
+	}
+	withValues := false
+	if len(args) == 3 {
+		if strings.ToUpper(args[2]) != "WITHVALUES" {
+			return custom_err.ErrorSyntax, true
+		}
+		withValues = true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+
+	// Without count argument, reply with a single bulk string
+	if len(args) == 1 {
+		if hash == nil {
+			return custom_err.ErrorKeyNotExists, true
+		}
+		return hash.RandomFields(1, true)[0], true
+	}
+
+	if hash == nil {
+		return []string{}, true
+	}
+
+	// A negative count allows the same field to be returned multiple times
+	var fields []string
+	if count < 0 {
+		fields = hash.RandomFields(-count, false)
+	} else {
+		fields = hash.RandomFields(count, true)
+	}
+
+	if withValues {
+		return fieldValuePairs(hash, fields), true
+	}
+	return fields, true
+}
+
+// Options shared by the SCAN family of commands
+type scanOptions struct {
+	match    string
+	count    int
+	noValues bool
+	typeName string
+}
+
+// Parses the cursor and the options following it. NOVALUES is only
+// accepted when allowNoValues is set, and TYPE when allowType is.
+func parseScanArgs(args []string, allowNoValues, allowType bool) (int, scanOptions, error) {
+	opts := scanOptions{count: 10}
+	cursor, err := strconv.ParseUint(args[0], 10, 63)
+	if err != nil {
+		return 0, opts, errInvalidCursor
+	}
+
+	for i := 1; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "MATCH" && i+1 < len(args):
+			opts.match = args[i+1]
+			i++
+		case option == "COUNT" && i+1 < len(args):
+			opts.count, err = strconv.Atoi(args[i+1])
+			if err != nil {
+				return 0, opts, custom_err.ErrorNotInteger
+			}
+			if opts.count < 1 {
+				return 0, opts, custom_err.ErrorSyntax
+			}
+			i++
+		case option == "NOVALUES" && allowNoValues:
+			opts.noValues = true
+		case option == "TYPE" && allowType && i+1 < len(args):
+			opts.typeName = strings.ToLower(args[i+1])
+			i++
+		default:
+			return 0, opts, custom_err.ErrorSyntax
+		}
+	}
+
+	return int(cursor), opts, nil
+}
+
+// HSCAN Handler
+func (handler *Handler) HScan(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs("hscan"), true
+	}
+
+	cursor, opts, err := parseScanArgs(args[1:], true, false)
+	if err != nil {
+		return err, true
+	}
+
+	hash, err := getTyped[*datastore.Hash](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if hash == nil {
+		return []any{"0", []string{}}, true
+	}
+
+	fields, next := hash.Scan(uint64(cursor), opts.count)
+	matched := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if opts.match == "" || globMatch(opts.match, field) {
+			matched = append(matched, field)
+		}
+	}
+
+	reply := matched
+	if !opts.noValues {
+		reply = fieldValuePairs(hash, matched)
+	}
+
+	return []any{strconv.FormatUint(next, 10), reply}, true
+}
@@ -0,0 +1,65 @@
+package command
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestHScan(t *testing.T) {
+	handler, _, store := newTestHandler()
+	for i := range 30 {
+		handler.HSet([]string{"h", "f" + strconv.Itoa(i), "v" + strconv.Itoa(i)}, store)
+	}
+
+	var matched []string
+	cursor := "0"
+	for {
+		reply, _ := handler.HScan([]string{"h", cursor, "MATCH", "f1*", "COUNT", "4"}, store)
+		result, ok := reply.([]any)
+		if !ok || len(result) != 2 {
+			t.Fatalf("Expected a cursor and the fields, got %v", reply)
+		}
+		pairs := result[1].([]string)
+		for i := 0; i < len(pairs); i += 2 {
+			if pairs[i+1] != "v"+pairs[i][1:] {
+				t.Errorf("Expected %s to come with its value, got %s", pairs[i], pairs[i+1])
+			}
+			matched = append(matched, pairs[i])
+		}
+		if cursor = result[0].(string); cursor == "0" {
+			break
+		}
+	}
+
+	slices.Sort(matched)
+	expected := []string{"f1", "f10", "f11", "f12", "f13", "f14", "f15", "f16", "f17", "f18", "f19"}
+	if !slices.Equal(matched, expected) {
+		t.Errorf("Expected %v, got %v", expected, matched)
+	}
+
+	reply, _ := handler.HScan([]string{"h", "0", "MATCH", "f7", "COUNT", "100", "NOVALUES"}, store)
+	if fields := reply.([]any)[1]; !slices.Equal(fields.([]string), []string{"f7"}) {
+		t.Errorf("Expected only the field with NOVALUES, got %v", fields)
+	}
+}
+
+func TestHSetCountsOneChange(t *testing.T) {
+	handler, _, store := newTestHandler()
+
+	steps := []struct {
+		run   func() (any, bool)
+		dirty int64
+	}{
+		{run: func() (any, bool) { return handler.HSet([]string{"h", "a", "1", "b", "2"}, store) }, dirty: 1},
+		{run: func() (any, bool) { return handler.HSet([]string{"h", "c", "3"}, store) }, dirty: 2},
+		{run: func() (any, bool) { return handler.HIncrBy([]string{"new", "n", "1"}, store) }, dirty: 3},
+		{run: func() (any, bool) { return handler.HSetNX([]string{"other", "f", "v"}, store) }, dirty: 4},
+	}
+	for i, step := range steps {
+		step.run()
+		if dirty := store.Dirty(); dirty != step.dirty {
+			t.Errorf("Step %d: expected %d changes, got %d", i, step.dirty, dirty)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/config"
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+var (
+	errNoProto     = errors.New("NOPROTO unsupported protocol version")
+	errHelloNoAuth = errors.New("NOAUTH HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	errClientName  = errors.New("ERR Client names cannot contain spaces, newlines or special characters.")
+)
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]] switches
+// the protocol of the connection and replies with details about the
+// server. It can authenticate at the same time, so clients can start with
+// HELLO even when a password is required.
+func (handler *Handler) Hello(args []string, store *datastore.Datastore) (any, bool) {
+	conn := handler.currClient
+	protocol := conn.Protocol
+	if len(args) > 0 {
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return errors.New("ERR Protocol version is not an integer or out of range"), true
+		}
+		if version != proto.Resp2 && version != proto.Resp3 {
+			return errNoProto, true
+		}
+		protocol = version
+	}
+
+	var (
+		credentials []string
+		name        string
+		setName     bool
+	)
+	for i := 1; i < len(args); i++ {
+		remaining := len(args) - i - 1
+		switch strings.ToUpper(args[i]) {
+		case "AUTH":
+			if remaining < 2 {
+				return fmt.Errorf("ERR Syntax error in HELLO option '%s'", args[i]), true
+			}
+			credentials = args[i+1 : i+3]
+			i += 2
+		case "SETNAME":
+			if remaining < 1 {
+				return fmt.Errorf("ERR Syntax error in HELLO option '%s'", args[i]), true
+			}
+			name, setName = args[i+1], true
+			i++
+		default:
+			return fmt.Errorf("ERR Syntax error in HELLO option '%s'", args[i]), true
+		}
+	}
+
+	if credentials != nil {
+		if err := handler.authenticate(conn, credentials[0], credentials[1]); err != nil {
+			return err, true
+		}
+	} else if !handler.Authenticated(conn) {
+		return errHelloNoAuth, true
+	}
+	if setName {
+		if !validClientName(name) {
+			return errClientName, true
+		}
+		conn.Name = name
+	}
+	conn.Protocol = protocol
+
+	role := "master"
+	if info.Role == "slave" {
+		role = "replica"
+	}
+	return proto.Map{
+		"server", "redis",
+		"version", config.RedisVer,
+		"proto", protocol,
+		"id", conn.Id,
+		"mode", "standalone",
+		"role", role,
+		"modules", []any{},
+	}, true
+}
+
+// Names are shown in lists of clients, they can't hold spaces or control
+// characters
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
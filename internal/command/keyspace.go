@@ -0,0 +1,223 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+var (
+	errSameObject   = errors.New("ERR source and destination objects are the same")
+	errDBOutOfRange = errors.New("ERR DB index is out of range")
+)
+
+// DEL Handler
+func (handler *Handler) Del(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) == 0 {
+		return errWrongArgs("del"), true
+	}
+
+	deleted := 0
+	for _, key := range args {
+		if store.Exists(key) {
+			store.Del(key)
+			deleted++
+		}
+	}
+	return deleted, true
+}
+
+// UNLINK Handler. Deleting a key only drops the reference to its value,
+// which the garbage collector frees in the background, so it's the same
+// as DEL.
+func (handler *Handler) Unlink(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) == 0 {
+		return errWrongArgs("unlink"), true
+	}
+	return handler.Del(args, store)
+}
+
+// EXISTS Handler, a key given several times is counted as many times
+func (handler *Handler) Exists(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) == 0 {
+		return errWrongArgs("exists"), true
+	}
+
+	count := 0
+	for _, key := range args {
+		if store.Exists(key) {
+			count++
+		}
+	}
+	return count, true
+}
+
+// TYPE Handler
+func (handler *Handler) Type(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("type"), true
+	}
+	return proto.Status(store.Type(args[0])), true
+}
+
+// KEYS Handler
+func (handler *Handler) Keys(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("keys"), true
+	}
+
+	pattern := args[0]
+	return store.Keys(func(key string) bool {
+		return globMatch(pattern, key)
+	}), true
+}
+
+// SCAN Handler
+func (handler *Handler) Scan(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 1 {
+		return errWrongArgs("scan"), true
+	}
+
+	cursor, opts, err := parseScanArgs(args, false, true)
+	if err != nil {
+		return err, true
+	}
+
+	// Like Redis, COUNT is how much of the keyspace is walked and the
+	// filters are applied to what was found
+	keys, next := store.Scan(uint64(cursor), opts.count)
+	matched := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if opts.match != "" && !globMatch(opts.match, key) {
+			continue
+		}
+		// Also skips expired keys
+		keyType := store.Type(key)
+		if keyType == "none" || (opts.typeName != "" && keyType != opts.typeName) {
+			continue
+		}
+		matched = append(matched, key)
+	}
+
+	return []any{strconv.FormatUint(next, 10), matched}, true
+}
+
+// RANDOMKEY Handler
+func (handler *Handler) RandomKey(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 0 {
+		return errWrongArgs("randomkey"), true
+	}
+
+	key, exists := store.RandomKey()
+	if !exists {
+		return custom_err.ErrorKeyNotExists, true
+	}
+	return key, true
+}
+
+// DBSIZE Handler
+func (handler *Handler) DBSize(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 0 {
+		return errWrongArgs("dbsize"), true
+	}
+	return store.Size(), true
+}
+
+// RENAME RENAMENX Handlers
+func (handler *Handler) Rename(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("rename"), true
+	}
+
+	_, err := store.Rename(args[0], args[1], false)
+	if err != nil {
+		return err, true
+	}
+	handler.signalKeyAsReady(args[1])
+	return proto.Status("OK"), true
+}
+
+func (handler *Handler) RenameNX(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("renamenx"), true
+	}
+
+	renamed, err := store.Rename(args[0], args[1], true)
+	if err != nil {
+		return err, true
+	}
+	if !renamed {
+		return 0, true
+	}
+	handler.signalKeyAsReady(args[1])
+	return 1, true
+}
+
+// COPY Handler. There's a single database, only DB 0 can be given.
+func (handler *Handler) Copy(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs("copy"), true
+	}
+
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "REPLACE":
+			replace = true
+		case option == "DB" && i+1 < len(args):
+			db, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return custom_err.ErrorNotInteger, true
+			}
+			if db != 0 {
+				return errDBOutOfRange, true
+			}
+			i++
+		default:
+			return custom_err.ErrorSyntax, true
+		}
+	}
+
+	src, dst := args[0], args[1]
+	if src == dst {
+		return errSameObject, true
+	}
+	if !store.Copy(src, dst, replace) {
+		return 0, true
+	}
+	handler.signalKeyAsReady(dst)
+	return 1, true
+}
+
+// FLUSHALL FLUSHDB Handlers, the same with a single database
+func (handler *Handler) FlushAll(args []string, store *datastore.Datastore) (any, bool) {
+	return flushGeneric(args, store, "flushall")
+}
+
+func (handler *Handler) FlushDB(args []string, store *datastore.Datastore) (any, bool) {
+	return flushGeneric(args, store, "flushdb")
+}
+
+func flushGeneric(args []string, store *datastore.Datastore, cmdName string) (any, bool) {
+	if len(args) > 1 {
+		return errWrongArgs(cmdName), true
+	}
+
+	async := false
+	if len(args) == 1 {
+		switch strings.ToUpper(args[0]) {
+		case "ASYNC":
+			async = true
+		case "SYNC":
+		default:
+			return custom_err.ErrorSyntax, true
+		}
+	}
+
+	store.Flush(async)
+	return proto.Status("OK"), true
+}
@@ -0,0 +1,303 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+// LPUSH RPUSH LPUSHX RPUSHX Handlers
+func (handler *Handler) LPush(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.push(args, store, "lpush", true, false)
+}
+
+func (handler *Handler) RPush(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.push(args, store, "rpush", false, false)
+}
+
+func (handler *Handler) LPushX(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.push(args, store, "lpushx", true, true)
+}
+
+func (handler *Handler) RPushX(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.push(args, store, "rpushx", false, true)
+}
+
+func (handler *Handler) push(args []string, store *datastore.Datastore, cmdName string, left, onlyExisting bool) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs(cmdName), true
+	}
+
+	key := args[0]
+	var (
+		list    *datastore.List
+		created bool
+		err     error
+	)
+	if onlyExisting {
+		list, err = getTyped[*datastore.List](store, key)
+		if list == nil && err == nil {
+			return 0, true
+		}
+	} else {
+		list, created, err = getOrCreateTyped(store, key, datastore.NewList)
+	}
+	if err != nil {
+		return err, true
+	}
+
+	var length int
+	if left {
+		length = list.LPush(args[1:]...)
+	} else {
+		length = list.RPush(args[1:]...)
+	}
+	if err := saveTyped(store, key, list, created); err != nil {
+		return err, true
+	}
+	handler.signalKeyAsReady(key)
+
+	return length, true
+}
+
+// LPOP RPOP Handlers
+func (handler *Handler) LPop(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.pop(args, store, "lpop", true)
+}
+
+func (handler *Handler) RPop(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.pop(args, store, "rpop", false)
+}
+
+func (handler *Handler) pop(args []string, store *datastore.Datastore, cmdName string, left bool) (any, bool) {
+	if len(args) != 1 && len(args) != 2 {
+		return errWrongArgs(cmdName), true
+	}
+
+	key := args[0]
+	count := -1
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.Atoi(args[1])
+		if err != nil || count < 0 {
+			return errors.New("ERR value is out of range, must be positive"), true
+		}
+	}
+
+	list, err := getTyped[*datastore.List](store, key)
+	if err != nil {
+		return err, true
+	}
+	if list == nil {
+		if count == -1 {
+			return custom_err.ErrorKeyNotExists, true
+		}
+		return custom_err.ErrorNullArray, true
+	}
+
+	popOne := list.RPop
+	if left {
+		popOne = list.LPop
+	}
+
+	// Without count argument, reply with a single bulk string
+	if count == -1 {
+		value, _ := popOne()
+		removeIfEmpty(store, key, list)
+		return value, true
+	}
+
+	popped := make([]string, 0, min(count, list.Len()))
+	for i := 0; i < count; i++ {
+		value, ok := popOne()
+		if !ok {
+			break
+		}
+		popped = append(popped, value)
+	}
+	removeIfEmpty(store, key, list)
+
+	return popped, true
+}
+
+// LLEN Handler
+func (handler *Handler) LLen(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("llen"), true
+	}
+
+	list, err := getTyped[*datastore.List](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if list == nil {
+		return 0, true
+	}
+
+	return list.Len(), true
+}
+
+// LINDEX LSET Handlers
+func (handler *Handler) LIndex(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("lindex"), true
+	}
+
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+
+	list, err := getTyped[*datastore.List](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if list == nil {
+		return custom_err.ErrorKeyNotExists, true
+	}
+
+	value, ok := list.Index(index)
+	if !ok {
+		return custom_err.ErrorKeyNotExists, true
+	}
+
+	return value, true
+}
+
+func (handler *Handler) LSet(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs("lset"), true
+	}
+
+	index, err := strconv.Atoi(args[1])
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+
+	list, err := getTyped[*datastore.List](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if list == nil {
+		return custom_err.ErrorNoSuchKey, true
+	}
+
+	if !list.Set(index, args[2]) {
+		return errors.New("ERR index out of range"), true
+	}
+	store.Touch(args[0])
+
+	return proto.Status("OK"), true
+}
+
+// LRANGE LTRIM Handlers
+func (handler *Handler) LRange(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs("lrange"), true
+	}
+
+	start, errStart := strconv.Atoi(args[1])
+	stop, errStop := strconv.Atoi(args[2])
+	if errStart != nil || errStop != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+
+	list, err := getTyped[*datastore.List](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if list == nil {
+		return []string{}, true
+	}
+
+	return list.Range(start, stop), true
+}
+
+func (handler *Handler) LTrim(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs("ltrim"), true
+	}
+
+	start, errStart := strconv.Atoi(args[1])
+	stop, errStop := strconv.Atoi(args[2])
+	if errStart != nil || errStop != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+
+	list, err := getTyped[*datastore.List](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if list == nil {
+		return proto.Status("OK"), true
+	}
+
+	list.Trim(start, stop)
+	removeIfEmpty(store, args[0], list)
+
+	return proto.Status("OK"), true
+}
+
+// LREM Handler
+func (handler *Handler) LRem(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs("lrem"), true
+	}
+
+	count, err := strconv.Atoi(args[1])
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+
+	list, err := getTyped[*datastore.List](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if list == nil {
+		return 0, true
+	}
+
+	removed := list.Rem(count, args[2])
+	if removed > 0 {
+		removeIfEmpty(store, args[0], list)
+	}
+
+	return removed, true
+}
+
+// LINSERT Handler
+func (handler *Handler) LInsert(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 4 {
+		return errWrongArgs("linsert"), true
+	}
+
+	var before bool
+	switch strings.ToUpper(args[1]) {
+	case "BEFORE":
+		before = true
+	case "AFTER":
+		before = false
+	default:
+		return custom_err.ErrorSyntax, true
+	}
+
+	list, err := getTyped[*datastore.List](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if list == nil {
+		return 0, true
+	}
+
+	length := list.Insert(args[2], args[3], before)
+	if length > 0 {
+		store.Touch(args[0])
+		handler.signalKeyAsReady(args[0])
+	}
+
+	return length, true
+}
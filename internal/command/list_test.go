@@ -0,0 +1,46 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/queue"
+)
+
+// Pushing to a new list counts as a single change, like pushing to an
+// existing one, so save points aren't reached early
+func TestPushCountsOneChange(t *testing.T) {
+	handler := NewCmdHandler(queue.NewTaskQueue())
+	store := datastore.NewDatastore(nil, nil)
+
+	steps := []struct {
+		name  string
+		run   func() (any, bool)
+		dirty int64
+	}{
+		{"RPUSH creating the list", func() (any, bool) { return handler.RPush([]string{"l", "a", "b"}, store) }, 1},
+		{"LPUSH to the list", func() (any, bool) { return handler.LPush([]string{"l", "c"}, store) }, 2},
+		{"LPUSHX to a missing list", func() (any, bool) { return handler.LPushX([]string{"missing", "c"}, store) }, 2},
+		{"LMOVE creating the destination", func() (any, bool) {
+			return handler.LMove([]string{"l", "dst", "LEFT", "RIGHT"}, store)
+		}, 4},
+	}
+
+	for _, step := range steps {
+		if reply, _ := step.run(); isError(reply) {
+			t.Fatalf("%s: unexpected error %v", step.name, reply)
+		}
+		if dirty := store.Dirty(); dirty != step.dirty {
+			t.Errorf("%s: expected %d changes, got %d", step.name, step.dirty, dirty)
+		}
+	}
+
+	if list, _ := getTyped[*datastore.List](store, "dst"); list == nil || list.Len() != 1 {
+		t.Errorf("Expected LMOVE to store the destination list")
+	}
+}
+
+func isError(reply any) bool {
+	_, ok := reply.(error)
+	return ok
+}
@@ -0,0 +1,239 @@
+package command
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/internal/connection"
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+var (
+	errNestedMulti  = errors.New("ERR MULTI calls can not be nested")
+	errExecNoMulti  = errors.New("ERR EXEC without MULTI")
+	errDiscNoMulti  = errors.New("ERR DISCARD without MULTI")
+	errWatchInMulti = errors.New("ERR WATCH inside MULTI is not allowed")
+	errExecAbort    = errors.New("EXECABORT Transaction discarded because of previous errors.")
+)
+
+// Commands executed right away even when the client is inside MULTI
+var transactionCommands = []string{"MULTI", "EXEC", "DISCARD", "WATCH"}
+
+// A key watched by a client, with what EXEC needs to tell if it changed
+type watchState struct {
+	version uint64
+	expired bool
+}
+
+// Transaction state of a connection, from its first MULTI or WATCH until
+// EXEC, DISCARD or the connection going away.
+type transaction struct {
+	// Set by MULTI, commands are queued instead of executed until EXEC
+	multi  bool
+	queued []Command
+
+	// A command couldn't be queued, EXEC will discard the transaction
+	failed bool
+
+	watched map[string]watchState
+}
+
+func (handler *Handler) getTransaction(conn *connection.Conn) *transaction {
+	tx, exists := handler.transactions[conn]
+	if !exists {
+		tx = &transaction{watched: make(map[string]watchState)}
+		handler.transactions[conn] = tx
+	}
+	return tx
+}
+
+// Queues cmd if the current client is inside MULTI. Returns false if the
+// command has to be executed right away. Commands that are unknown or
+// given a wrong number of arguments aren't queued and make EXEC fail.
+func (handler *Handler) queueCommand(cmd Command, metaData CmdMetaData, known bool) (any, bool) {
+	tx, exists := handler.transactions[handler.currClient]
+	if !exists || !tx.multi || slices.Contains(transactionCommands, cmd.Cmd) {
+		return nil, false
+	}
+
+	if !known {
+		tx.failed = true
+		return errors.New("unknown command"), true
+	}
+	if !metaData.arityMatches(cmd) {
+		tx.failed = true
+		return errWrongArgs(strings.ToLower(cmd.Cmd)), true
+	}
+	tx.queued = append(tx.queued, cmd)
+	// Only the whole transaction gets propagated, on EXEC
+	handler.preventPropagation()
+
+	return proto.Status("QUEUED"), true
+}
+
+// Ends the transaction of conn and releases the keys it watches
+func (handler *Handler) discardTransaction(conn *connection.Conn, store *datastore.Datastore) {
+	tx, exists := handler.transactions[conn]
+	if !exists {
+		return
+	}
+
+	for key := range tx.watched {
+		store.Unwatch(key)
+	}
+	delete(handler.transactions, conn)
+}
+
+// Reports whether any key watched by the transaction was modified, or
+// expired, since WATCH was called
+func watchedKeysModified(tx *transaction, store *datastore.Datastore) bool {
+	for key, watched := range tx.watched {
+		if store.KeyVersion(key) != watched.version {
+			return true
+		}
+		if !watched.expired && store.IsExpired(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// MULTI Handler
+func (handler *Handler) Multi(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 0 {
+		return errWrongArgs("multi"), true
+	}
+	handler.preventPropagation()
+
+	tx := handler.getTransaction(handler.currClient)
+	if tx.multi {
+		return errNestedMulti, true
+	}
+	tx.multi = true
+
+	return proto.Status("OK"), true
+}
+
+// EXEC Handler
+func (handler *Handler) Exec(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 0 {
+		return errWrongArgs("exec"), true
+	}
+	// The executed commands are propagated wrapped in their own MULTI/EXEC
+	defer handler.preventPropagation()
+
+	tx, exists := handler.transactions[handler.currClient]
+	if !exists || !tx.multi {
+		return errExecNoMulti, true
+	}
+	defer handler.discardTransaction(handler.currClient, store)
+
+	if tx.failed {
+		return errExecAbort, true
+	}
+	if watchedKeysModified(tx, store) {
+		return custom_err.ErrorNullArray, true
+	}
+
+	// Commands queued so far by EXEC's caller, which are sent before ours
+	propagation := handler.propagation
+	handler.propagation = nil
+
+	var executed [][]string
+	results := make([]any, 0, len(tx.queued))
+	handler.inExec = true
+	for _, cmd := range tx.queued {
+		result, propagated := handler.execQueued(cmd, store)
+		results = append(results, result)
+		executed = append(executed, propagated...)
+	}
+	handler.inExec = false
+
+	handler.propagation = propagation
+	if len(executed) > 0 {
+		handler.alsoPropagate("MULTI")
+		handler.propagation = append(handler.propagation, executed...)
+		handler.alsoPropagate("EXEC")
+	}
+
+	return results, true
+}
+
+// Executes a command queued by MULTI. Returns its result along with what
+// it needs to propagate to replicas.
+func (handler *Handler) execQueued(cmd Command, store *datastore.Datastore) (any, [][]string) {
+	handler.propagationPrevented = false
+	metaData, _ := GetCmdMetadata(cmd.Cmd)
+	result, ready := metaData.handler(cmd.Args, store)
+	if !ready {
+		// Blocking commands don't block inside a transaction, nothing
+		// else is expected to reply later
+		result = errors.New("ERR command can not be used inside a transaction")
+	}
+
+	var propagated [][]string
+	if IsWriteCommand(cmd) && !handler.propagationPrevented {
+		propagated = append(propagated, append([]string{cmd.Cmd}, cmd.Args...))
+	}
+	propagated = append(propagated, handler.propagation...)
+	handler.propagation = nil
+
+	return result, propagated
+}
+
+// DISCARD Handler
+func (handler *Handler) Discard(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 0 {
+		return errWrongArgs("discard"), true
+	}
+	handler.preventPropagation()
+
+	tx, exists := handler.transactions[handler.currClient]
+	if !exists || !tx.multi {
+		return errDiscNoMulti, true
+	}
+	handler.discardTransaction(handler.currClient, store)
+
+	return proto.Status("OK"), true
+}
+
+// WATCH Handler
+func (handler *Handler) Watch(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 1 {
+		return errWrongArgs("watch"), true
+	}
+
+	tx := handler.getTransaction(handler.currClient)
+	if tx.multi {
+		return errWatchInMulti, true
+	}
+
+	for _, key := range args {
+		if _, watching := tx.watched[key]; watching {
+			continue
+		}
+		tx.watched[key] = watchState{
+			version: store.Watch(key),
+			expired: store.IsExpired(key),
+		}
+	}
+
+	return proto.Status("OK"), true
+}
+
+// UNWATCH Handler
+func (handler *Handler) Unwatch(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 0 {
+		return errWrongArgs("unwatch"), true
+	}
+
+	tx, exists := handler.transactions[handler.currClient]
+	if exists && !tx.multi {
+		handler.discardTransaction(handler.currClient, store)
+	}
+
+	return proto.Status("OK"), true
+}
@@ -0,0 +1,147 @@
+package command
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+// Status replies of the transaction commands
+const (
+	statusOK     = proto.Status("OK")
+	statusQueued = proto.Status("QUEUED")
+)
+
+// Runs each command as the given client and returns the replies
+func execAll(handler *Handler, store *datastore.Datastore, client *testClient, cmds ...[]string) []any {
+	handler.SetCurrentConn(client.conn)
+	replies := make([]any, len(cmds))
+	for i, args := range cmds {
+		replies[i], _ = handler.ExecuteCmd(Command{Cmd: args[0], Args: args[1:]}, store)
+	}
+	return replies
+}
+
+func TestQueueTimeErrorsAbortExec(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  []string
+	}{
+		{name: "unknown command", cmd: []string{"NOSUCHCMD", "k"}},
+		{name: "too few arguments", cmd: []string{"GET"}},
+		{name: "too many arguments", cmd: []string{"GET", "k", "extra"}},
+		{name: "below the minimum", cmd: []string{"SET", "k"}},
+	}
+
+	for _, tc := range tests {
+		handler, _, store := newTestHandler()
+		SetupCommands(handler)
+		client := newTestClient(t)
+
+		replies := execAll(handler, store, client,
+			[]string{"MULTI"},
+			[]string{"SET", "k", "v"},
+			tc.cmd,
+			[]string{"INCR", "counter"},
+			[]string{"EXEC"},
+		)
+		if replies[1] != statusQueued || replies[3] != statusQueued {
+			t.Errorf("%s: expected valid commands to be queued, got %v and %v", tc.name, replies[1], replies[3])
+		}
+		if !isError(replies[2]) {
+			t.Errorf("%s: expected an error at queue time, got %v", tc.name, replies[2])
+		}
+		if replies[4] != errExecAbort {
+			t.Errorf("%s: expected EXEC to abort, got %v", tc.name, replies[4])
+		}
+		if store.Exists("k") || store.Exists("counter") {
+			t.Errorf("%s: expected none of the queued commands to be executed", tc.name)
+		}
+
+		// The aborted transaction is over
+		if reply := execAll(handler, store, client, []string{"EXEC"})[0]; reply != errExecNoMulti {
+			t.Errorf("%s: expected the transaction to be discarded, got %v", tc.name, reply)
+		}
+	}
+}
+
+func TestExecRunsQueuedCommands(t *testing.T) {
+	handler, _, store := newTestHandler()
+	SetupCommands(handler)
+	client := newTestClient(t)
+
+	replies := execAll(handler, store, client,
+		[]string{"MULTI"},
+		[]string{"SET", "k", "v"},
+		[]string{"RPUSH", "l", "a", "b"},
+		[]string{"EXEC"},
+	)
+	results, ok := replies[3].([]any)
+	if !ok || len(results) != 2 || results[0] != statusOK || results[1] != 2 {
+		t.Fatalf("Expected [OK 2] from EXEC, got %v", replies[3])
+	}
+	if value, _ := store.Get("k"); value != "v" {
+		t.Errorf("Expected k to be set, got %v", value)
+	}
+
+	// Commands failing when executed don't abort the others
+	replies = execAll(handler, store, client,
+		[]string{"MULTI"},
+		[]string{"INCR", "k"},
+		[]string{"SET", "k", "w"},
+		[]string{"EXEC"},
+	)
+	results, _ = replies[3].([]any)
+	if len(results) != 2 || !isError(results[0]) || results[1] != statusOK {
+		t.Errorf("Expected [error OK] from EXEC, got %v", replies[3])
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	handler, _, store := newTestHandler()
+	SetupCommands(handler)
+	client, other := newTestClient(t), newTestClient(t)
+
+	replies := execAll(handler, store, client,
+		[]string{"WATCH", "w"},
+		[]string{"MULTI"},
+		[]string{"SET", "k", "v"},
+		[]string{"DISCARD"},
+		[]string{"EXEC"},
+		[]string{"DISCARD"},
+	)
+	expected := []any{statusOK, statusOK, statusQueued, statusOK, errExecNoMulti, errDiscNoMulti}
+	if !slices.Equal(replies, expected) {
+		t.Errorf("Expected %v, got %v", expected, replies)
+	}
+	if store.Exists("k") {
+		t.Error("Expected the discarded command not to be executed")
+	}
+
+	// DISCARD released the watched keys, modifying them doesn't fail the
+	// next transaction
+	execAll(handler, store, other, []string{"SET", "w", "1"})
+	replies = execAll(handler, store, client,
+		[]string{"MULTI"},
+		[]string{"SET", "k", "v"},
+		[]string{"EXEC"},
+	)
+	if results, ok := replies[2].([]any); !ok || len(results) != 1 {
+		t.Errorf("Expected EXEC to run after DISCARD unwatched the keys, got %v", replies[2])
+	}
+
+	// A queue-time error is forgotten by DISCARD too
+	replies = execAll(handler, store, client,
+		[]string{"MULTI"},
+		[]string{"GET"},
+		[]string{"DISCARD"},
+		[]string{"MULTI"},
+		[]string{"GET", "k"},
+		[]string{"EXEC"},
+	)
+	if results, ok := replies[5].([]any); !ok || len(results) != 1 || results[0] != "v" {
+		t.Errorf("Expected the new transaction to run, got %v", replies[5])
+	}
+}
@@ -0,0 +1,35 @@
+package command
+
+import "github.com/Viet-ph/redis-go/internal/proto"
+
+// Queues a command to be propagated to replicas right after the one being
+// executed. Used when the effect of a command can't be replayed as is,
+// e.g. a served BLPOP is replicated as a plain LPOP.
+func (handler *Handler) alsoPropagate(args ...string) {
+	handler.propagation = append(handler.propagation, args)
+}
+
+// Stops the command being executed from being propagated as is. Handlers
+// call this when they propagate an equivalent command with alsoPropagate.
+func (handler *Handler) preventPropagation() {
+	handler.propagationPrevented = true
+}
+
+// PendingPropagation reports whether the command just executed should be
+// propagated as is, and returns the RESP encoded commands queued with
+// alsoPropagate to send after it. The queue is cleared on every call.
+func (handler *Handler) PendingPropagation() (bool, []byte) {
+	propagateCmd := !handler.propagationPrevented
+	handler.propagationPrevented = false
+	if len(handler.propagation) == 0 {
+		return propagateCmd, nil
+	}
+
+	encoder := proto.NewEncoder()
+	for _, args := range handler.propagation {
+		encoder.Encode(args, false)
+	}
+	handler.propagation = handler.propagation[:0]
+
+	return propagateCmd, encoder.GetBufValue()
+}
@@ -0,0 +1,277 @@
+package command
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+// Looks up all sets stored at keys, missing keys give nil sets.
+func getSets(store *datastore.Datastore, keys []string) ([]*datastore.Set, error) {
+	sets := make([]*datastore.Set, len(keys))
+	for i, key := range keys {
+		set, err := getTyped[*datastore.Set](store, key)
+		if err != nil {
+			return nil, err
+		}
+		sets[i] = set
+	}
+
+	return sets, nil
+}
+
+// Stores result at destination, replacing whatever was there. An empty
+// result deletes destination instead.
+func storeSetResult(store *datastore.Datastore, destination string, result *datastore.Set) (int, error) {
+	if result.Len() == 0 {
+		store.Del(destination)
+		return 0, nil
+	}
+
+	err := store.Set(destination, result, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.Len(), nil
+}
+
+// SADD SREM Handlers
+func (handler *Handler) SAdd(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs("sadd"), true
+	}
+
+	set, created, err := getOrCreateTyped(store, args[0], func() *datastore.Set { return datastore.NewSet() })
+	if err != nil {
+		return err, true
+	}
+
+	added := set.Add(args[1:]...)
+	if added > 0 {
+		if err := saveTyped(store, args[0], set, created); err != nil {
+			return err, true
+		}
+	}
+
+	return added, true
+}
+
+func (handler *Handler) SRem(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs("srem"), true
+	}
+
+	set, err := getTyped[*datastore.Set](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if set == nil {
+		return 0, true
+	}
+
+	removed := set.Remove(args[1:]...)
+	if removed > 0 {
+		removeIfEmpty(store, args[0], set)
+	}
+
+	return removed, true
+}
+
+// SMEMBERS SISMEMBER SCARD Handlers
+func (handler *Handler) SMembers(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("smembers"), true
+	}
+
+	set, err := getTyped[*datastore.Set](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if set == nil {
+		return proto.Set{}, true
+	}
+
+	return proto.Set(proto.Strings(set.Members())), true
+}
+
+func (handler *Handler) SIsMember(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("sismember"), true
+	}
+
+	set, err := getTyped[*datastore.Set](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if set == nil || !set.Contains(args[1]) {
+		return 0, true
+	}
+
+	return 1, true
+}
+
+func (handler *Handler) SCard(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("scard"), true
+	}
+
+	set, err := getTyped[*datastore.Set](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if set == nil {
+		return 0, true
+	}
+
+	return set.Len(), true
+}
+
+// SINTER SUNION SDIFF Handlers and their STORE variants
+func (handler *Handler) SInter(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.setAlgebra(args, store, "sinter", datastore.Intersect, false)
+}
+
+func (handler *Handler) SUnion(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.setAlgebra(args, store, "sunion", datastore.Union, false)
+}
+
+func (handler *Handler) SDiff(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.setAlgebra(args, store, "sdiff", diffSets, false)
+}
+
+func (handler *Handler) SInterStore(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.setAlgebra(args, store, "sinterstore", datastore.Intersect, true)
+}
+
+func (handler *Handler) SUnionStore(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.setAlgebra(args, store, "sunionstore", datastore.Union, true)
+}
+
+func (handler *Handler) SDiffStore(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.setAlgebra(args, store, "sdiffstore", diffSets, true)
+}
+
+func diffSets(sets ...*datastore.Set) *datastore.Set {
+	return datastore.Diff(sets[0], sets[1:]...)
+}
+
+// Applies operation on the sets stored at the given keys. With withStore,
+// the first argument is the destination key and the reply is the
+// cardinality of the stored result.
+func (handler *Handler) setAlgebra(args []string, store *datastore.Datastore, cmdName string, operation func(...*datastore.Set) *datastore.Set, withStore bool) (any, bool) {
+	minArgs := 1
+	if withStore {
+		minArgs = 2
+	}
+	if len(args) < minArgs {
+		return errWrongArgs(cmdName), true
+	}
+
+	keys := args
+	if withStore {
+		keys = args[1:]
+	}
+
+	sets, err := getSets(store, keys)
+	if err != nil {
+		return err, true
+	}
+	result := operation(sets...)
+
+	if !withStore {
+		return proto.Set(proto.Strings(result.Members())), true
+	}
+
+	cardinality, err := storeSetResult(store, args[0], result)
+	if err != nil {
+		return err, true
+	}
+	return cardinality, true
+}
+
+// SRANDMEMBER SPOP Handlers
+func (handler *Handler) SRandMember(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 && len(args) != 2 {
+		return errWrongArgs("srandmember"), true
+	}
+
+	count := 0
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.Atoi(args[1])
+		if err != nil {
+			return custom_err.ErrorNotInteger, true
+		}
+	}
+
+	set, err := getTyped[*datastore.Set](store, args[0])
+	if err != nil {
+		return err, true
+	}
+
+	// Without count argument, reply with a single bulk string
+	if len(args) == 1 {
+		if set == nil {
+			return custom_err.ErrorKeyNotExists, true
+		}
+		return set.RandomMembers(1, true)[0], true
+	}
+
+	if set == nil {
+		return []string{}, true
+	}
+
+	// A negative count allows the same member to be returned multiple times
+	if count < 0 {
+		return set.RandomMembers(-count, false), true
+	}
+	return set.RandomMembers(count, true), true
+}
+
+func (handler *Handler) SPop(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 && len(args) != 2 {
+		return errWrongArgs("spop"), true
+	}
+
+	count := 1
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.Atoi(args[1])
+		if err != nil || count < 0 {
+			return errors.New("ERR value is out of range, must be positive"), true
+		}
+	}
+
+	set, err := getTyped[*datastore.Set](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if set == nil {
+		if len(args) == 1 {
+			return custom_err.ErrorKeyNotExists, true
+		}
+		return []string{}, true
+	}
+
+	popped := set.RandomMembers(count, true)
+	set.Remove(popped...)
+	if len(popped) > 0 {
+		removeIfEmpty(store, args[0], set)
+	}
+
+	// Members are picked randomly so replicas can't replay SPOP as is,
+	// propagate the removal of the chosen members instead.
+	handler.preventPropagation()
+	if len(popped) > 0 {
+		handler.alsoPropagate(append([]string{"SREM", args[0]}, popped...)...)
+	}
+
+	if len(args) == 1 {
+		return popped[0], true
+	}
+	return popped, true
+}
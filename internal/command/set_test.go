@@ -0,0 +1,129 @@
+package command
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+)
+
+func TestSetStoreCommands(t *testing.T) {
+	handler, _, store := newTestHandler()
+	handler.SAdd([]string{"s1", "a", "b", "c"}, store)
+	handler.SAdd([]string{"s2", "b", "c", "d"}, store)
+	handler.SAdd([]string{"dst", "old"}, store)
+	store.Set("str", "v", nil)
+
+	tests := []struct {
+		name     string
+		run      func([]string) (any, bool)
+		args     []string
+		expected []string
+	}{
+		{name: "SINTERSTORE", run: func(args []string) (any, bool) { return handler.SInterStore(args, store) }, args: []string{"dst", "s1", "s2"}, expected: []string{"b", "c"}},
+		{name: "SUNIONSTORE", run: func(args []string) (any, bool) { return handler.SUnionStore(args, store) }, args: []string{"dst", "s1", "missing", "s2"}, expected: []string{"a", "b", "c", "d"}},
+		{name: "SDIFFSTORE", run: func(args []string) (any, bool) { return handler.SDiffStore(args, store) }, args: []string{"dst", "s1", "s2"}, expected: []string{"a"}},
+		// A destination that is also a source is read before being replaced
+		{name: "SDIFFSTORE in place", run: func(args []string) (any, bool) { return handler.SDiffStore(args, store) }, args: []string{"s1", "s1", "dst"}, expected: []string{"b", "c"}},
+	}
+
+	for _, tc := range tests {
+		reply, _ := tc.run(tc.args)
+		if reply != len(tc.expected) {
+			t.Errorf("%s: expected cardinality %d but got %v", tc.name, len(tc.expected), reply)
+		}
+		set, _ := getTyped[*datastore.Set](store, tc.args[0])
+		if set == nil {
+			t.Errorf("%s: expected %s to hold a set", tc.name, tc.args[0])
+			continue
+		}
+		members := set.Members()
+		slices.Sort(members)
+		if !slices.Equal(members, tc.expected) {
+			t.Errorf("%s: expected %v but got %v", tc.name, tc.expected, members)
+		}
+	}
+
+	// An empty result deletes the destination, whatever it held
+	if reply, _ := handler.SInterStore([]string{"str", "s1", "missing"}, store); reply != 0 {
+		t.Errorf("Expected an empty intersection but got %v", reply)
+	}
+	if store.Exists("str") {
+		t.Error("Expected the destination to be deleted by an empty result")
+	}
+
+	// Sources must be sets, and nothing is stored when one isn't
+	store.Set("str", "v", nil)
+	if reply, _ := handler.SUnionStore([]string{"dst", "s1", "str"}, store); !isError(reply) {
+		t.Errorf("Expected a WRONGTYPE error but got %v", reply)
+	}
+	if set, _ := getTyped[*datastore.Set](store, "dst"); set == nil || set.Len() != 1 {
+		t.Error("Expected the destination to be left untouched on error")
+	}
+}
+
+func TestSPopPropagatedAsSRem(t *testing.T) {
+	handler, _, store := newTestHandler()
+	handler.SAdd([]string{"s", "a", "b", "c"}, store)
+	handler.PendingPropagation()
+
+	reply, _ := handler.SPop([]string{"s", "2"}, store)
+	popped, ok := reply.([]string)
+	if !ok || len(popped) != 2 {
+		t.Fatalf("Expected 2 popped members but got %v", reply)
+	}
+
+	// Replicas must remove the same members, not pick their own
+	propagateCmd, propagation := handler.PendingPropagation()
+	if propagateCmd {
+		t.Error("Expected SPOP itself not to be propagated")
+	}
+	expected := "*4\r\n$4\r\nSREM\r\n$1\r\ns\r\n" +
+		"$1\r\n" + popped[0] + "\r\n$1\r\n" + popped[1] + "\r\n"
+	if string(propagation) != expected {
+		t.Errorf("Expected %q but got %q", expected, propagation)
+	}
+
+	// Popping the last member deletes the key
+	reply, _ = handler.SPop([]string{"s"}, store)
+	_, propagation = handler.PendingPropagation()
+	if !strings.HasSuffix(string(propagation), "$1\r\n"+reply.(string)+"\r\n") {
+		t.Errorf("Expected the last member to be propagated but got %q", propagation)
+	}
+	if store.Exists("s") {
+		t.Error("Expected the emptied set to be deleted")
+	}
+
+	// No SREM without members to remove
+	handler.SPop([]string{"s", "3"}, store)
+	if _, propagation := handler.PendingPropagation(); propagation != nil {
+		t.Errorf("Expected no SREM to be propagated but got %q", propagation)
+	}
+}
+
+func TestSAddCountsOneChange(t *testing.T) {
+	handler, _, store := newTestHandler()
+
+	handler.SAdd([]string{"s", "a", "b"}, store)
+	if dirty := store.Dirty(); dirty != 1 {
+		t.Errorf("Expected creating a set to count as 1 change but got %d", dirty)
+	}
+	handler.SAdd([]string{"s", "c"}, store)
+	if dirty := store.Dirty(); dirty != 2 {
+		t.Errorf("Expected adding to a set to count as 1 change but got %d", dirty)
+	}
+}
+
+// Writes that leave the set as it was don't count as changes
+func TestNoOpSetWritesNotCounted(t *testing.T) {
+	handler, _, store := newTestHandler()
+	handler.SAdd([]string{"s", "a", "b"}, store)
+
+	handler.SAdd([]string{"s", "a", "b"}, store)
+	handler.SPop([]string{"s", "0"}, store)
+	handler.SRem([]string{"s", "missing"}, store)
+	if dirty := store.Dirty(); dirty != 1 {
+		t.Errorf("Expected only creating the set to count as a change but got %d", dirty)
+	}
+}
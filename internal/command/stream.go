@@ -0,0 +1,1149 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+var (
+	errInvalidStreamID  = errors.New("ERR Invalid stream ID specified as stream command argument")
+	errStreamIDTooSmall = errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	errStreamIDZero     = errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	errStreamExhausted  = errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+	errBusyGroup        = errors.New("BUSYGROUP Consumer Group name already exists")
+	errXGroupNoKey      = errors.New("ERR The XGROUP subcommand requires the key to exist. " +
+		"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	errTrimLimit   = errors.New("ERR syntax error, LIMIT cannot be used without the special ~ option")
+	errEntriesRead = errors.New("ERR value for ENTRIESREAD must be positive or -1")
+)
+
+// Looks up a consumer group, the error mentions both the key and the group
+// since either of them might be missing.
+func getConsumerGroup(store *datastore.Datastore, key, groupName string) (*datastore.Stream, *datastore.ConsumerGroup, error) {
+	stream, err := getTyped[*datastore.Stream](store, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if stream != nil {
+		if group, exists := stream.Group(groupName); exists {
+			return stream, group, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s'", key, groupName)
+}
+
+func parseStreamID(arg string) (datastore.StreamID, error) {
+	id, err := datastore.ParseStreamID(arg, 0)
+	if err != nil {
+		return id, errInvalidStreamID
+	}
+	return id, nil
+}
+
+// Parses a bound of XRANGE like commands. "-" and "+" stand for the
+// smallest and greatest IDs, an incomplete ID gets missingSeq as sequence
+// and a "(" prefix excludes the ID itself. Returns false when an
+// exclusive bound leaves nothing to return.
+func parseRangeBound(arg string, missingSeq uint64, isStart bool) (datastore.StreamID, bool, error) {
+	switch arg {
+	case "-":
+		return datastore.MinStreamID, true, nil
+	case "+":
+		return datastore.MaxStreamID, true, nil
+	}
+
+	exclusive := strings.HasPrefix(arg, "(")
+	if exclusive {
+		arg = arg[1:]
+	}
+	id, err := datastore.ParseStreamID(arg, missingSeq)
+	if err != nil {
+		return id, false, errInvalidStreamID
+	}
+	if !exclusive {
+		return id, true, nil
+	}
+
+	if isStart {
+		id, ok := id.Incr()
+		return id, ok, nil
+	}
+	id, ok := id.Decr()
+	return id, ok, nil
+}
+
+// Parses an ID that defaults to the last ID of the stream when given as "$"
+func parseLastStreamID(arg string, stream *datastore.Stream) (datastore.StreamID, error) {
+	if arg == "$" {
+		if stream == nil {
+			return datastore.MinStreamID, nil
+		}
+		return stream.LastID, nil
+	}
+	return parseStreamID(arg)
+}
+
+func parseEntriesRead(arg string) (int64, error) {
+	entriesRead, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, custom_err.ErrorNotInteger
+	}
+	if entriesRead < -1 {
+		return 0, errEntriesRead
+	}
+	return entriesRead, nil
+}
+
+func streamEntryReply(entry datastore.StreamEntry) []any {
+	return []any{entry.ID.String(), entry.Fields}
+}
+
+func streamEntriesReply(entries []datastore.StreamEntry) []any {
+	reply := make([]any, len(entries))
+	for i, entry := range entries {
+		reply[i] = streamEntryReply(entry)
+	}
+	return reply
+}
+
+// Milliseconds elapsed since the entry was last delivered
+func idleTime(pending *datastore.PendingEntry, now time.Time) int64 {
+	return max(now.Sub(pending.DeliveryTime).Milliseconds(), 0)
+}
+
+// Trimming arguments shared by XADD and XTRIM:
+// MAXLEN|MINID [=|~] threshold [LIMIT count]
+type streamTrim struct {
+	strategy string
+	maxLen   int
+	minID    datastore.StreamID
+	// Trimming with "~" is always exact here, LIMIT caps evicted entries
+	approx bool
+	limit  int
+}
+
+// Parses the trimming arguments starting at args[i] and returns the index
+// right after them.
+func (trim *streamTrim) parse(args []string, i int) (int, error) {
+	if trim.strategy != "" {
+		return 0, custom_err.ErrorSyntax
+	}
+	trim.strategy = strings.ToUpper(args[i])
+	i++
+
+	if i < len(args) && (args[i] == "=" || args[i] == "~") {
+		trim.approx = args[i] == "~"
+		i++
+	}
+	if i >= len(args) {
+		return 0, custom_err.ErrorSyntax
+	}
+
+	if trim.strategy == "MAXLEN" {
+		maxLen, err := strconv.Atoi(args[i])
+		if err != nil {
+			return 0, custom_err.ErrorNotInteger
+		}
+		if maxLen < 0 {
+			return 0, errors.New("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.maxLen = maxLen
+	} else {
+		minID, err := parseStreamID(args[i])
+		if err != nil {
+			return 0, err
+		}
+		trim.minID = minID
+	}
+	i++
+
+	if i+1 < len(args) && strings.ToUpper(args[i]) == "LIMIT" {
+		limit, err := strconv.Atoi(args[i+1])
+		if err != nil || limit < 0 {
+			return 0, custom_err.ErrorNotInteger
+		}
+		if !trim.approx {
+			return 0, errTrimLimit
+		}
+		trim.limit = limit
+		i += 2
+	}
+
+	return i, nil
+}
+
+// Applies the trimming and returns the number of evicted entries
+func (trim *streamTrim) apply(stream *datastore.Stream) int {
+	switch trim.strategy {
+	case "MAXLEN":
+		return stream.TrimMaxLen(trim.maxLen, trim.limit)
+	case "MINID":
+		return stream.TrimMinID(trim.minID, trim.limit)
+	default:
+		return 0
+	}
+}
+
+// XADD Handler
+func (handler *Handler) XAdd(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 4 {
+		return errWrongArgs("xadd"), true
+	}
+
+	key := args[0]
+	var (
+		noMkStream bool
+		trim       streamTrim
+		err        error
+		i          = 1
+	)
+options:
+	for i < len(args) {
+		switch strings.ToUpper(args[i]) {
+		case "NOMKSTREAM":
+			noMkStream = true
+			i++
+		case "MAXLEN", "MINID":
+			i, err = trim.parse(args, i)
+			if err != nil {
+				return err, true
+			}
+		default:
+			break options
+		}
+	}
+
+	if i >= len(args) {
+		return errWrongArgs("xadd"), true
+	}
+	idArg := args[i]
+	fields := args[i+1:]
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return errWrongArgs("xadd"), true
+	}
+
+	stream, created, err := getOrCreateTyped(store, key, datastore.NewStream)
+	if err != nil {
+		return err, true
+	}
+	if created && noMkStream {
+		return custom_err.ErrorKeyNotExists, true
+	}
+
+	var (
+		id datastore.StreamID
+		ok = true
+	)
+	switch {
+	case idArg == "*":
+		id, ok = stream.NextID(time.Now())
+		if !ok {
+			return errStreamExhausted, true
+		}
+	case strings.HasSuffix(idArg, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(idArg, "-*"), 10, 64)
+		if err != nil {
+			return errInvalidStreamID, true
+		}
+		id, ok = stream.NextSeq(ms)
+	default:
+		id, err = parseStreamID(idArg)
+		if err != nil {
+			return err, true
+		}
+		if id == datastore.MinStreamID {
+			return errStreamIDZero, true
+		}
+		ok = id.Compare(stream.LastID) > 0
+	}
+	if !ok {
+		return errStreamIDTooSmall, true
+	}
+
+	stream.Add(id, slices.Clone(fields))
+	trim.apply(stream)
+	if err := saveTyped(store, key, stream, created); err != nil {
+		return err, true
+	}
+
+	// Replicas must end up with the same ID, not generate their own
+	if strings.HasSuffix(idArg, "*") {
+		propagated := slices.Clone(args)
+		propagated[i] = id.String()
+		handler.preventPropagation()
+		handler.alsoPropagate(append([]string{"XADD"}, propagated...)...)
+	}
+	handler.signalKeyAsReady(key)
+
+	return id.String(), true
+}
+
+// XRANGE XREVRANGE Handlers
+func (handler *Handler) XRange(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.xrange(args, store, "xrange", false)
+}
+
+func (handler *Handler) XRevRange(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.xrange(args, store, "xrevrange", true)
+}
+
+func (handler *Handler) xrange(args []string, store *datastore.Datastore, cmdName string, reverse bool) (any, bool) {
+	if len(args) != 3 && len(args) != 5 {
+		return errWrongArgs(cmdName), true
+	}
+
+	startArg, endArg := args[1], args[2]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, startOk, err := parseRangeBound(startArg, 0, true)
+	if err != nil {
+		return err, true
+	}
+	end, endOk, err := parseRangeBound(endArg, datastore.MaxStreamID.Seq, false)
+	if err != nil {
+		return err, true
+	}
+
+	count := -1
+	if len(args) == 5 {
+		if strings.ToUpper(args[3]) != "COUNT" {
+			return custom_err.ErrorSyntax, true
+		}
+		count, err = strconv.Atoi(args[4])
+		if err != nil {
+			return custom_err.ErrorNotInteger, true
+		}
+	}
+
+	stream, err := getTyped[*datastore.Stream](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if stream == nil || !startOk || !endOk || count == 0 {
+		return []any{}, true
+	}
+
+	return streamEntriesReply(stream.Range(start, end, max(count, 0), reverse)), true
+}
+
+// XLEN Handler
+func (handler *Handler) XLen(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("xlen"), true
+	}
+
+	stream, err := getTyped[*datastore.Stream](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if stream == nil {
+		return 0, true
+	}
+
+	return stream.Len(), true
+}
+
+// XDEL Handler
+func (handler *Handler) XDel(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs("xdel"), true
+	}
+
+	// Validate every ID before deleting anything
+	ids := make([]datastore.StreamID, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		id, err := parseStreamID(arg)
+		if err != nil {
+			return err, true
+		}
+		ids = append(ids, id)
+	}
+
+	stream, err := getTyped[*datastore.Stream](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if stream == nil {
+		return 0, true
+	}
+
+	deleted := stream.Delete(ids...)
+	if deleted > 0 {
+		store.Touch(args[0])
+	}
+
+	return deleted, true
+}
+
+// XTRIM Handler
+func (handler *Handler) XTrim(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 3 {
+		return errWrongArgs("xtrim"), true
+	}
+
+	strategy := strings.ToUpper(args[1])
+	if strategy != "MAXLEN" && strategy != "MINID" {
+		return custom_err.ErrorSyntax, true
+	}
+
+	var trim streamTrim
+	next, err := trim.parse(args, 1)
+	if err != nil {
+		return err, true
+	}
+	if next != len(args) {
+		return custom_err.ErrorSyntax, true
+	}
+
+	stream, err := getTyped[*datastore.Stream](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if stream == nil {
+		return 0, true
+	}
+
+	evicted := trim.apply(stream)
+	if evicted > 0 {
+		store.Touch(args[0])
+	}
+
+	return evicted, true
+}
+
+// Options shared by XREAD and XREADGROUP
+type xreadOptions struct {
+	count    int
+	block    bool
+	timeout  time.Duration
+	noAck    bool
+	group    string
+	consumer string
+	keys     []string
+	ids      []string
+}
+
+func parseXReadOptions(args []string, cmdName string, withGroup bool) (xreadOptions, error) {
+	var opts xreadOptions
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch {
+		case option == "STREAMS":
+			streams := args[i+1:]
+			if len(streams) == 0 || len(streams)%2 != 0 {
+				return opts, fmt.Errorf("ERR Unbalanced '%s' list of streams: for each stream key an ID or '$' must be specified.", cmdName)
+			}
+			opts.keys = streams[:len(streams)/2]
+			opts.ids = streams[len(streams)/2:]
+			if withGroup && opts.group == "" {
+				return opts, errors.New("ERR Missing GROUP option for XREADGROUP")
+			}
+			return opts, nil
+		case option == "COUNT" && i+1 < len(args):
+			count, err := strconv.Atoi(args[i+1])
+			if err != nil {
+				return opts, custom_err.ErrorNotInteger
+			}
+			opts.count = max(count, 0)
+			i++
+		case option == "BLOCK" && i+1 < len(args):
+			ms, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return opts, errors.New("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return opts, errors.New("ERR timeout is negative")
+			}
+			opts.block = true
+			opts.timeout = time.Duration(ms) * time.Millisecond
+			i++
+		case withGroup && option == "GROUP" && i+2 < len(args):
+			opts.group = args[i+1]
+			opts.consumer = args[i+2]
+			i += 2
+		case withGroup && option == "NOACK":
+			opts.noAck = true
+		default:
+			return opts, custom_err.ErrorSyntax
+		}
+	}
+
+	return opts, errWrongArgs(cmdName)
+}
+
+// XREAD Handler
+func (handler *Handler) XRead(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 3 {
+		return errWrongArgs("xread"), true
+	}
+
+	opts, err := parseXReadOptions(args, "xread", false)
+	if err != nil {
+		return err, true
+	}
+
+	// Resolve "$" right away, later entries are the ones to wait for
+	ids := make(map[string]datastore.StreamID, len(opts.keys))
+	for i, key := range opts.keys {
+		stream, err := getTyped[*datastore.Stream](store, key)
+		if err != nil {
+			return err, true
+		}
+		ids[key], err = parseLastStreamID(opts.ids[i], stream)
+		if err != nil {
+			return err, true
+		}
+	}
+
+	reply := make([]any, 0)
+	for _, key := range opts.keys {
+		stream, _ := getTyped[*datastore.Stream](store, key)
+		if stream == nil {
+			continue
+		}
+		if entries := stream.After(ids[key], opts.count); len(entries) > 0 {
+			reply = append(reply, []any{key, streamEntriesReply(entries)})
+		}
+	}
+	if len(reply) > 0 {
+		return reply, true
+	}
+	if !opts.block {
+		return custom_err.ErrorNullArray, true
+	}
+
+	return handler.blockClient(&blockedClient{
+		conn: handler.currClient,
+		keys: slices.Clone(opts.keys),
+		serve: func(key string, store *datastore.Datastore) (any, bool) {
+			stream, err := getTyped[*datastore.Stream](store, key)
+			if err != nil || stream == nil {
+				return nil, false
+			}
+			entries := stream.After(ids[key], opts.count)
+			if len(entries) == 0 {
+				return nil, false
+			}
+			return []any{[]any{key, streamEntriesReply(entries)}}, true
+		},
+	}, opts.timeout)
+}
+
+// XREADGROUP Handler
+func (handler *Handler) XReadGroup(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 6 {
+		return errWrongArgs("xreadgroup"), true
+	}
+	if info.Role == "slave" {
+		return custom_err.ErrorReadOnly, true
+	}
+
+	opts, err := parseXReadOptions(args, "xreadgroup", true)
+	if err != nil {
+		return err, true
+	}
+
+	// Every group must exist before anything gets delivered
+	for _, key := range opts.keys {
+		if _, _, err := getConsumerGroup(store, key, opts.group); err != nil {
+			if err != custom_err.ErrorWrongType {
+				err = fmt.Errorf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, opts.group)
+			}
+			return err, true
+		}
+	}
+
+	reply := make([]any, 0)
+	for i, key := range opts.keys {
+		stream, group, _ := getConsumerGroup(store, key, opts.group)
+		consumer := handler.streamConsumer(key, group, opts.consumer)
+
+		if opts.ids[i] == ">" {
+			if entries := handler.deliverNewEntries(store, key, stream, group, consumer, opts); len(entries) > 0 {
+				reply = append(reply, []any{key, entries})
+			}
+			continue
+		}
+
+		start, err := parseStreamID(opts.ids[i])
+		if err != nil {
+			return err, true
+		}
+		reply = append(reply, []any{key, pendingEntriesReply(stream, consumer, start, opts.count)})
+	}
+
+	if len(reply) > 0 {
+		return reply, true
+	}
+	if !opts.block {
+		return custom_err.ErrorNullArray, true
+	}
+
+	return handler.blockClient(&blockedClient{
+		conn: handler.currClient,
+		keys: slices.Clone(opts.keys),
+		serve: func(key string, store *datastore.Datastore) (any, bool) {
+			stream, group, err := getConsumerGroup(store, key, opts.group)
+			if err != nil {
+				return err, true
+			}
+			consumer := handler.streamConsumer(key, group, opts.consumer)
+			entries := handler.deliverNewEntries(store, key, stream, group, consumer, opts)
+			if len(entries) == 0 {
+				return nil, false
+			}
+			return []any{[]any{key, entries}}, true
+		},
+	}, opts.timeout)
+}
+
+// Returns the named consumer of the group, creating it if needed
+func (handler *Handler) streamConsumer(key string, group *datastore.ConsumerGroup, name string) *datastore.Consumer {
+	now := time.Now()
+	consumer, created := group.Consumer(name, now)
+	if created {
+		handler.alsoPropagate("XGROUP", "CREATECONSUMER", key, group.Name, name)
+	}
+	consumer.SeenTime = now
+	return consumer
+}
+
+// Delivers entries never delivered to the group yet. Replicas get the
+// effect as XCLAIM and XGROUP SETID commands.
+func (handler *Handler) deliverNewEntries(store *datastore.Datastore, key string, stream *datastore.Stream, group *datastore.ConsumerGroup, consumer *datastore.Consumer, opts xreadOptions) []any {
+	entries := stream.After(group.LastDeliveredID, opts.count)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		group.LastDeliveredID = entry.ID
+		if group.EntriesRead >= 0 {
+			group.EntriesRead++
+		}
+		if !opts.noAck {
+			pending := group.Deliver(entry.ID, consumer, now)
+			handler.propagateClaim(key, group, pending)
+		}
+	}
+	consumer.ActiveTime = now
+	handler.alsoPropagate("XGROUP", "SETID", key, group.Name, group.LastDeliveredID.String(),
+		"ENTRIESREAD", strconv.FormatInt(group.EntriesRead, 10))
+	store.Touch(key)
+
+	return streamEntriesReply(entries)
+}
+
+// Replies with entries of the consumer PEL greater than start. Entries
+// deleted from the stream in the meantime are returned with nil fields.
+func pendingEntriesReply(stream *datastore.Stream, consumer *datastore.Consumer, start datastore.StreamID, count int) []any {
+	reply := make([]any, 0)
+	now := time.Now()
+	for _, pending := range datastore.SortedPending(consumer.Pending) {
+		if count > 0 && len(reply) >= count {
+			break
+		}
+		if pending.ID.Compare(start) <= 0 {
+			continue
+		}
+
+		entry, exists := stream.Get(pending.ID)
+		if !exists {
+			reply = append(reply, []any{pending.ID.String(), custom_err.ErrorNullArray})
+			continue
+		}
+		pending.DeliveryTime = now
+		pending.DeliveryCount++
+		reply = append(reply, streamEntryReply(entry))
+	}
+
+	return reply
+}
+
+// Replicates ownership of a pending entry as an XCLAIM with absolute
+// values, so replicas don't depend on their own clock.
+func (handler *Handler) propagateClaim(key string, group *datastore.ConsumerGroup, pending *datastore.PendingEntry) {
+	handler.alsoPropagate("XCLAIM", key, group.Name, pending.Consumer, "0", pending.ID.String(),
+		"TIME", strconv.FormatInt(pending.DeliveryTime.UnixMilli(), 10),
+		"RETRYCOUNT", strconv.Itoa(pending.DeliveryCount),
+		"FORCE", "JUSTID", "LASTID", group.LastDeliveredID.String())
+}
+
+// XGROUP Handler
+func (handler *Handler) XGroup(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 1 {
+		return errWrongArgs("xgroup"), true
+	}
+
+	subcommand := strings.ToUpper(args[0])
+	arity := map[string][]int{
+		"CREATE":         {4, 7},
+		"SETID":          {4, 6},
+		"DESTROY":        {3, 3},
+		"CREATECONSUMER": {4, 4},
+		"DELCONSUMER":    {4, 4},
+	}
+	bounds, exists := arity[subcommand]
+	if !exists {
+		return fmt.Errorf("ERR unknown subcommand '%s'. Try XGROUP HELP.", args[0]), true
+	}
+	if len(args) < bounds[0] || len(args) > bounds[1] {
+		return fmt.Errorf("ERR wrong number of arguments for 'xgroup|%s' command", strings.ToLower(subcommand)), true
+	}
+
+	key, groupName := args[1], args[2]
+	stream, err := getTyped[*datastore.Stream](store, key)
+	if err != nil {
+		return err, true
+	}
+
+	if subcommand == "CREATE" {
+		return handler.xgroupCreate(args[1:], stream, store)
+	}
+	if stream == nil {
+		return errXGroupNoKey, true
+	}
+	group, exists := stream.Group(groupName)
+	if !exists && subcommand != "DESTROY" {
+		return fmt.Errorf("NOGROUP No such consumer group '%s' for key name '%s'", groupName, key), true
+	}
+
+	switch subcommand {
+	case "SETID":
+		id, err := parseLastStreamID(args[3], stream)
+		if err != nil {
+			return err, true
+		}
+		entriesRead := int64(-1)
+		if len(args) > 4 {
+			if len(args) != 6 || strings.ToUpper(args[4]) != "ENTRIESREAD" {
+				return custom_err.ErrorSyntax, true
+			}
+			if entriesRead, err = parseEntriesRead(args[5]); err != nil {
+				return err, true
+			}
+		}
+		group.LastDeliveredID = id
+		group.EntriesRead = entriesRead
+	case "DESTROY":
+		if !stream.DestroyGroup(groupName) {
+			return 0, true
+		}
+		store.Touch(key)
+		return 1, true
+	case "CREATECONSUMER":
+		if _, created := group.Consumer(args[3], time.Now()); !created {
+			return 0, true
+		}
+		store.Touch(key)
+		return 1, true
+	case "DELCONSUMER":
+		pending := group.DeleteConsumer(args[3])
+		if pending < 0 {
+			return 0, true
+		}
+		store.Touch(key)
+		return pending, true
+	}
+
+	store.Touch(key)
+	return proto.Status("OK"), true
+}
+
+// XGROUP CREATE key group id|$ [MKSTREAM] [ENTRIESREAD entries-read]
+func (handler *Handler) xgroupCreate(args []string, stream *datastore.Stream, store *datastore.Datastore) (any, bool) {
+	key, groupName := args[0], args[1]
+	mkStream := false
+	entriesRead := int64(-1)
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "MKSTREAM":
+			mkStream = true
+		case "ENTRIESREAD":
+			if i+1 >= len(args) {
+				return custom_err.ErrorSyntax, true
+			}
+			var err error
+			if entriesRead, err = parseEntriesRead(args[i+1]); err != nil {
+				return err, true
+			}
+			i++
+		default:
+			return custom_err.ErrorSyntax, true
+		}
+	}
+
+	id, err := parseLastStreamID(args[2], stream)
+	if err != nil {
+		return err, true
+	}
+
+	created := stream == nil
+	if created {
+		if !mkStream {
+			return errXGroupNoKey, true
+		}
+		stream = datastore.NewStream()
+	}
+
+	if _, added := stream.CreateGroup(groupName, id, entriesRead); !added {
+		return errBusyGroup, true
+	}
+	if err := saveTyped(store, key, stream, created); err != nil {
+		return err, true
+	}
+
+	return proto.Status("OK"), true
+}
+
+// XACK Handler
+func (handler *Handler) XAck(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 3 {
+		return errWrongArgs("xack"), true
+	}
+
+	ids := make([]datastore.StreamID, 0, len(args)-2)
+	for _, arg := range args[2:] {
+		id, err := parseStreamID(arg)
+		if err != nil {
+			return err, true
+		}
+		ids = append(ids, id)
+	}
+
+	stream, err := getTyped[*datastore.Stream](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if stream == nil {
+		return 0, true
+	}
+	group, exists := stream.Group(args[1])
+	if !exists {
+		return 0, true
+	}
+
+	acked := group.Ack(ids...)
+	if acked > 0 {
+		store.Touch(args[0])
+	}
+
+	return acked, true
+}
+
+// XPENDING Handler
+func (handler *Handler) XPending(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 && (len(args) < 5 || len(args) > 8) {
+		return errWrongArgs("xpending"), true
+	}
+
+	_, group, err := getConsumerGroup(store, args[0], args[1])
+	if err != nil {
+		return err, true
+	}
+
+	if len(args) == 2 {
+		return pendingSummary(group), true
+	}
+
+	// Extended form: [IDLE min-idle-time] start end count [consumer]
+	rest := args[2:]
+	minIdle := int64(0)
+	if strings.ToUpper(rest[0]) == "IDLE" {
+		if len(rest) < 4 {
+			return custom_err.ErrorSyntax, true
+		}
+		minIdle, err = strconv.ParseInt(rest[1], 10, 64)
+		if err != nil {
+			return custom_err.ErrorNotInteger, true
+		}
+		rest = rest[2:]
+	}
+	if len(rest) < 3 || len(rest) > 4 {
+		return custom_err.ErrorSyntax, true
+	}
+
+	start, startOk, err := parseRangeBound(rest[0], 0, true)
+	if err != nil {
+		return err, true
+	}
+	end, endOk, err := parseRangeBound(rest[1], datastore.MaxStreamID.Seq, false)
+	if err != nil {
+		return err, true
+	}
+	count, err := strconv.Atoi(rest[2])
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+
+	pel := group.Pending
+	if len(rest) == 4 {
+		consumer, exists := group.Consumers[rest[3]]
+		if !exists {
+			return []any{}, true
+		}
+		pel = consumer.Pending
+	}
+
+	reply := make([]any, 0)
+	if !startOk || !endOk {
+		return reply, true
+	}
+	now := time.Now()
+	for _, pending := range datastore.SortedPending(pel) {
+		if len(reply) >= count {
+			break
+		}
+		if pending.ID.Compare(start) < 0 || pending.ID.Compare(end) > 0 {
+			continue
+		}
+		idle := idleTime(pending, now)
+		if idle < minIdle {
+			continue
+		}
+		reply = append(reply, []any{pending.ID.String(), pending.Consumer, idle, pending.DeliveryCount})
+	}
+
+	return reply, true
+}
+
+// Summary form of XPENDING: count, smallest and greatest pending IDs and
+// the number of pending entries of every consumer having some.
+func pendingSummary(group *datastore.ConsumerGroup) []any {
+	pending := datastore.SortedPending(group.Pending)
+	if len(pending) == 0 {
+		return []any{0, custom_err.ErrorKeyNotExists, custom_err.ErrorKeyNotExists, custom_err.ErrorNullArray}
+	}
+
+	consumers := make([]any, 0)
+	for _, consumer := range group.SortedConsumers() {
+		if len(consumer.Pending) > 0 {
+			consumers = append(consumers, []string{consumer.Name, strconv.Itoa(len(consumer.Pending))})
+		}
+	}
+
+	return []any{len(pending), pending[0].ID.String(), pending[len(pending)-1].ID.String(), consumers}
+}
+
+// XCLAIM Handler
+func (handler *Handler) XClaim(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 5 {
+		return errWrongArgs("xclaim"), true
+	}
+
+	key, groupName, consumerName := args[0], args[1], args[2]
+	minIdle, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return errors.New("ERR Invalid min-idle-time argument for XCLAIM"), true
+	}
+
+	// IDs come first, the first argument that isn't one starts the options
+	ids := make([]datastore.StreamID, 0)
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := datastore.ParseStreamID(args[i], 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return errInvalidStreamID, true
+	}
+
+	now := time.Now()
+	var (
+		deliveryTime = now
+		retryCount   = -1
+		force        bool
+		justID       bool
+		lastID       *datastore.StreamID
+	)
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch {
+		case option == "FORCE":
+			force = true
+		case option == "JUSTID":
+			justID = true
+		case (option == "IDLE" || option == "TIME" || option == "RETRYCOUNT") && i+1 < len(args):
+			value, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil {
+				return custom_err.ErrorNotInteger, true
+			}
+			switch option {
+			case "IDLE":
+				deliveryTime = now.Add(-time.Duration(value) * time.Millisecond)
+			case "TIME":
+				deliveryTime = time.UnixMilli(value)
+			default:
+				retryCount = int(value)
+			}
+			i++
+		case option == "LASTID" && i+1 < len(args):
+			id, err := parseStreamID(args[i+1])
+			if err != nil {
+				return err, true
+			}
+			lastID = &id
+			i++
+		default:
+			return fmt.Errorf("ERR Unrecognized XCLAIM option '%s'", args[i]), true
+		}
+	}
+	// A delivery time in the future makes no sense, clamp it
+	if deliveryTime.After(now) {
+		deliveryTime = now
+	}
+
+	stream, group, err := getConsumerGroup(store, key, groupName)
+	if err != nil {
+		return err, true
+	}
+	if lastID != nil && lastID.Compare(group.LastDeliveredID) > 0 {
+		group.LastDeliveredID = *lastID
+	}
+
+	handler.preventPropagation()
+	consumer := handler.streamConsumer(key, group, consumerName)
+	reply := make([]any, 0)
+	for _, id := range ids {
+		pending, exists := group.Pending[id]
+		entry, inStream := stream.Get(id)
+		if !exists && !(force && inStream) {
+			continue
+		}
+		if exists && !inStream {
+			// Entry deleted in the meantime, no point keeping it pending
+			group.Ack(id)
+			handler.alsoPropagate("XACK", key, groupName, id.String())
+			continue
+		}
+		if exists && minIdle > 0 && idleTime(pending, now) < minIdle {
+			continue
+		}
+
+		pending = group.Claim(id, consumer)
+		pending.DeliveryTime = deliveryTime
+		if retryCount >= 0 {
+			pending.DeliveryCount = retryCount
+		} else if !justID {
+			pending.DeliveryCount++
+		}
+		consumer.ActiveTime = now
+		handler.propagateClaim(key, group, pending)
+
+		if justID {
+			reply = append(reply, id.String())
+		} else {
+			reply = append(reply, streamEntryReply(entry))
+		}
+	}
+	store.Touch(key)
+
+	return reply, true
+}
+
+// XAUTOCLAIM Handler
+func (handler *Handler) XAutoClaim(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 5 || len(args) > 8 {
+		return errWrongArgs("xautoclaim"), true
+	}
+
+	key, groupName, consumerName := args[0], args[1], args[2]
+	minIdle, err := strconv.ParseInt(args[3], 10, 64)
+	if err != nil {
+		return errors.New("ERR Invalid min-idle-time argument for XAUTOCLAIM"), true
+	}
+	start, _, err := parseRangeBound(args[4], 0, true)
+	if err != nil {
+		return err, true
+	}
+
+	count := 100
+	justID := false
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "JUSTID":
+			justID = true
+		case "COUNT":
+			if i+1 >= len(args) {
+				return custom_err.ErrorSyntax, true
+			}
+			count, err = strconv.Atoi(args[i+1])
+			if err != nil || count < 1 {
+				return errors.New("ERR COUNT must be > 0"), true
+			}
+			i++
+		default:
+			return custom_err.ErrorSyntax, true
+		}
+	}
+
+	stream, group, err := getConsumerGroup(store, key, groupName)
+	if err != nil {
+		return err, true
+	}
+
+	handler.preventPropagation()
+	consumer := handler.streamConsumer(key, group, consumerName)
+	now := time.Now()
+	var (
+		claimed = make([]any, 0)
+		deleted = make([]string, 0)
+		// Entries scanned are capped so a huge PEL doesn't stall the server
+		attempts = count * 10
+		cursor   = datastore.MinStreamID
+	)
+	for _, pending := range datastore.SortedPending(group.Pending) {
+		if pending.ID.Compare(start) < 0 {
+			continue
+		}
+		if attempts == 0 || len(claimed) == count {
+			cursor = pending.ID
+			break
+		}
+		attempts--
+
+		entry, inStream := stream.Get(pending.ID)
+		if !inStream {
+			group.Ack(pending.ID)
+			handler.alsoPropagate("XACK", key, groupName, pending.ID.String())
+			deleted = append(deleted, pending.ID.String())
+			continue
+		}
+		if idleTime(pending, now) < minIdle {
+			continue
+		}
+
+		pending = group.Claim(pending.ID, consumer)
+		pending.DeliveryTime = now
+		if !justID {
+			pending.DeliveryCount++
+		}
+		consumer.ActiveTime = now
+		handler.propagateClaim(key, group, pending)
+
+		if justID {
+			claimed = append(claimed, pending.ID.String())
+		} else {
+			claimed = append(claimed, streamEntryReply(entry))
+		}
+	}
+	store.Touch(key)
+
+	return []any{cursor.String(), claimed, deleted}, true
+}
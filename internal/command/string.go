@@ -0,0 +1,643 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+var (
+	errOffsetOutOfRange = errors.New("ERR offset is out of range")
+	errStringTooLong    = errors.New("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	errDecrOverflow     = errors.New("ERR decrement would overflow")
+	errLCSNotStrings    = errors.New("ERR The specified keys must contain string values")
+	errLCSLenAndIdx     = errors.New("ERR If you want both the length and indexes, please just use IDX.")
+	errLCSTooLong       = errors.New("ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+)
+
+// Returns the string stored at key, false if key doesn't exist
+func getString(store *datastore.Datastore, key string) (string, bool, error) {
+	data, exists := store.Get(key)
+	if !exists {
+		return "", false, nil
+	}
+
+	str, ok := datastore.StringValue(data)
+	if !ok {
+		return "", false, custom_err.ErrorWrongType
+	}
+	return str, true, nil
+}
+
+// Replies value, or nil if it doesn't exist
+func stringReply(value string, exists bool) any {
+	if !exists {
+		return custom_err.ErrorKeyNotExists
+	}
+	return value
+}
+
+// The datastore reports invalid expiries as coming from SET
+func expireTimeError(err error, cmdName string) error {
+	if err == custom_err.ErrorExpireTime {
+		return fmt.Errorf("ERR invalid expire time in '%s' command", cmdName)
+	}
+	return err
+}
+
+// Replicas get the expiry of what was set as a unix timestamp, so it
+// doesn't depend on when they apply it
+func (handler *Handler) propagateSet(store *datastore.Datastore, key, value string) {
+	if expireAt, hasExpiry := store.GetExpiry(key); hasExpiry {
+		handler.alsoPropagate("SET", key, value, "PXAT", strconv.FormatInt(expireAt.UnixMilli(), 10))
+		return
+	}
+	handler.alsoPropagate("SET", key, value)
+}
+
+// SET GET Handlers
+func (handler *Handler) Set(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs("set"), true
+	}
+
+	key, value := args[0], args[1]
+	var (
+		nx, xx, get   bool
+		expiryOptions []string
+	)
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GET":
+			get = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 == len(args) {
+				return custom_err.ErrorSyntax, true
+			}
+			expiryOptions = append(expiryOptions, option, args[i+1])
+			i++
+		default:
+			// KEEPTTL, the datastore rejects anything else
+			expiryOptions = append(expiryOptions, option)
+		}
+	}
+	if nx && xx {
+		return custom_err.ErrorSyntax, true
+	}
+	// Only propagated when the value was set
+	handler.preventPropagation()
+
+	// Unlike SET alone, GET fails against other types
+	var reply any = proto.Status("OK")
+	if get {
+		old, exists, err := getString(store, key)
+		if err != nil {
+			return err, true
+		}
+		reply = stringReply(old, exists)
+	}
+
+	exists := store.Exists(key)
+	if (nx && exists) || (xx && !exists) {
+		if get {
+			return reply, true
+		}
+		return custom_err.ErrorKeyNotExists, true
+	}
+
+	err := store.Set(key, value, expiryOptions)
+	if err != nil {
+		return err, true
+	}
+	handler.propagateSet(store, key, value)
+
+	return reply, true
+}
+
+func (handler *Handler) Get(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("get"), true
+	}
+
+	value, exists, err := getString(store, args[0])
+	if err != nil {
+		return err, true
+	}
+	return stringReply(value, exists), true
+}
+
+// SETNX SETEX PSETEX Handlers
+func (handler *Handler) SetNX(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("setnx"), true
+	}
+
+	if store.Exists(args[0]) {
+		return 0, true
+	}
+	store.Set(args[0], args[1], nil)
+	return 1, true
+}
+
+func (handler *Handler) SetEx(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.setExGeneric(args, store, "setex", "EX")
+}
+
+func (handler *Handler) PSetEx(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.setExGeneric(args, store, "psetex", "PX")
+}
+
+func (handler *Handler) setExGeneric(args []string, store *datastore.Datastore, cmdName, unit string) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs(cmdName), true
+	}
+	handler.preventPropagation()
+
+	key, value := args[0], args[2]
+	err := store.Set(key, value, []string{unit, args[1]})
+	if err != nil {
+		return expireTimeError(err, cmdName), true
+	}
+	handler.propagateSet(store, key, value)
+
+	return proto.Status("OK"), true
+}
+
+// GETSET GETDEL GETEX Handlers
+func (handler *Handler) GetSet(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("getset"), true
+	}
+
+	old, exists, err := getString(store, args[0])
+	if err != nil {
+		return err, true
+	}
+	store.Set(args[0], args[1], nil)
+
+	return stringReply(old, exists), true
+}
+
+func (handler *Handler) GetDel(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("getdel"), true
+	}
+	// Only propagated as DEL, and only when it deleted something
+	handler.preventPropagation()
+
+	value, exists, err := getString(store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if !exists {
+		return custom_err.ErrorKeyNotExists, true
+	}
+	store.Del(args[0])
+	handler.alsoPropagate("DEL", args[0])
+
+	return value, true
+}
+
+func (handler *Handler) GetEx(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 1 {
+		return errWrongArgs("getex"), true
+	}
+	// Propagated as the change of expiry it makes
+	handler.preventPropagation()
+
+	var (
+		persist  bool
+		expireAt time.Time
+	)
+	switch {
+	case len(args) == 1:
+	case len(args) == 2 && strings.ToUpper(args[1]) == "PERSIST":
+		persist = true
+	case len(args) == 3:
+		option := strings.ToUpper(args[1])
+		if option != "EX" && option != "PX" && option != "EXAT" && option != "PXAT" {
+			return custom_err.ErrorSyntax, true
+		}
+		var err error
+		expireAt, err = datastore.ParseExpiry(option, args[2])
+		if err != nil {
+			return expireTimeError(err, "getex"), true
+		}
+	default:
+		return custom_err.ErrorSyntax, true
+	}
+
+	key := args[0]
+	value, exists, err := getString(store, key)
+	if err != nil {
+		return err, true
+	}
+	if !exists {
+		return custom_err.ErrorKeyNotExists, true
+	}
+
+	switch {
+	case persist:
+		if store.Persist(key) {
+			handler.alsoPropagate("PERSIST", key)
+		}
+	case expireAt.IsZero():
+	case !expireAt.After(time.Now()):
+		store.Del(key)
+		handler.alsoPropagate("DEL", key)
+	default:
+		store.SetExpiry(key, expireAt)
+		handler.alsoPropagate("PEXPIREAT", key, strconv.FormatInt(expireAt.UnixMilli(), 10))
+	}
+
+	return value, true
+}
+
+// MSET MSETNX MGET Handlers
+func (handler *Handler) MSet(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return errWrongArgs("mset"), true
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		store.Set(args[i], args[i+1], nil)
+	}
+	return proto.Status("OK"), true
+}
+
+// Sets nothing unless none of the keys exist
+func (handler *Handler) MSetNX(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return errWrongArgs("msetnx"), true
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		if store.Exists(args[i]) {
+			return 0, true
+		}
+	}
+	for i := 0; i < len(args); i += 2 {
+		store.Set(args[i], args[i+1], nil)
+	}
+	return 1, true
+}
+
+func (handler *Handler) MGet(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) == 0 {
+		return errWrongArgs("mget"), true
+	}
+
+	// Missing keys and keys of other types are replied as nil
+	values := make([]any, 0, len(args))
+	for _, key := range args {
+		value, exists, err := getString(store, key)
+		if err != nil {
+			exists = false
+		}
+		values = append(values, stringReply(value, exists))
+	}
+	return values, true
+}
+
+// APPEND STRLEN Handlers
+func (handler *Handler) Append(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("append"), true
+	}
+
+	value, _, err := getString(store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if len(value)+len(args[1]) > proto.MaxBulkLength {
+		return errStringTooLong, true
+	}
+
+	value += args[1]
+	store.Set(args[0], value, []string{"KEEPTTL"})
+	return len(value), true
+}
+
+func (handler *Handler) StrLen(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("strlen"), true
+	}
+
+	value, _, err := getString(store, args[0])
+	if err != nil {
+		return err, true
+	}
+	return len(value), true
+}
+
+// GETRANGE SETRANGE Handlers
+func (handler *Handler) GetRange(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs("getrange"), true
+	}
+
+	start, err := strconv.Atoi(args[1])
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+	end, err := strconv.Atoi(args[2])
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+
+	value, _, err := getString(store, args[0])
+	if err != nil {
+		return err, true
+	}
+
+	// Negative offsets count from the end, both ends are inclusive
+	if start < 0 && end < 0 && start > end {
+		return "", true
+	}
+	if start < 0 {
+		start = max(len(value)+start, 0)
+	}
+	if end < 0 {
+		end = max(len(value)+end, 0)
+	}
+	end = min(end, len(value)-1)
+	if len(value) == 0 || start > end {
+		return "", true
+	}
+
+	return value[start : end+1], true
+}
+
+// Overwrites the string at key from offset on, padding it with zero bytes
+// if it's shorter than offset
+func (handler *Handler) SetRange(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs("setrange"), true
+	}
+
+	offset, err := strconv.Atoi(args[1])
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+	if offset < 0 {
+		return errOffsetOutOfRange, true
+	}
+
+	key, patch := args[0], args[2]
+	value, _, err := getString(store, key)
+	if err != nil {
+		return err, true
+	}
+	// Doesn't create the key
+	if len(patch) == 0 {
+		return len(value), true
+	}
+	if offset > proto.MaxBulkLength-len(patch) {
+		return errStringTooLong, true
+	}
+
+	buf := []byte(value)
+	if len(buf) < offset+len(patch) {
+		buf = append(buf, make([]byte, offset+len(patch)-len(buf))...)
+	}
+	copy(buf[offset:], patch)
+
+	store.Set(key, string(buf), []string{"KEEPTTL"})
+	return len(buf), true
+}
+
+// INCR DECR INCRBY DECRBY INCRBYFLOAT Handlers
+func (handler *Handler) Incr(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("incr"), true
+	}
+	return incrGeneric(store, args[0], 1)
+}
+
+func (handler *Handler) Decr(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("decr"), true
+	}
+	return incrGeneric(store, args[0], -1)
+}
+
+func (handler *Handler) IncrBy(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("incrby"), true
+	}
+
+	increment, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+	return incrGeneric(store, args[0], increment)
+}
+
+func (handler *Handler) DecrBy(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("decrby"), true
+	}
+
+	decrement, err := strconv.ParseInt(args[1], 10, 64)
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+	// Can't be negated
+	if decrement == math.MinInt64 {
+		return errDecrOverflow, true
+	}
+	return incrGeneric(store, args[0], -decrement)
+}
+
+func incrGeneric(store *datastore.Datastore, key string, delta int64) (any, bool) {
+	value, err := store.IncrBy(key, delta)
+	if err != nil {
+		return err, true
+	}
+	return value, true
+}
+
+func (handler *Handler) IncrByFloat(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("incrbyfloat"), true
+	}
+
+	increment, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || math.IsNaN(increment) || math.IsInf(increment, 0) {
+		return errNotFloat, true
+	}
+
+	key := args[0]
+	value, exists, err := getString(store, key)
+	if err != nil {
+		return err, true
+	}
+
+	var current float64
+	if exists {
+		current, err = strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return errNotFloat, true
+		}
+	}
+
+	current += increment
+	if math.IsNaN(current) || math.IsInf(current, 0) {
+		return errIncrNaNOrInf, true
+	}
+
+	value = strconv.FormatFloat(current, 'f', -1, 64)
+	store.Set(key, value, []string{"KEEPTTL"})
+
+	// Replicas could compute a slightly different float, send them the result
+	handler.preventPropagation()
+	handler.alsoPropagate("SET", key, value, "KEEPTTL")
+
+	return value, true
+}
+
+// LCS Handler
+func (handler *Handler) LCS(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs("lcs"), true
+	}
+
+	var (
+		getLen, getIdx, withMatchLen bool
+		minMatchLen                  int
+	)
+	for i := 2; i < len(args); i++ {
+		switch option := strings.ToUpper(args[i]); {
+		case option == "LEN":
+			getLen = true
+		case option == "IDX":
+			getIdx = true
+		case option == "WITHMATCHLEN":
+			withMatchLen = true
+		case option == "MINMATCHLEN" && i+1 < len(args):
+			var err error
+			minMatchLen, err = strconv.Atoi(args[i+1])
+			if err != nil {
+				return custom_err.ErrorNotInteger, true
+			}
+			minMatchLen = max(minMatchLen, 0)
+			i++
+		default:
+			return custom_err.ErrorSyntax, true
+		}
+	}
+	if getLen && getIdx {
+		return errLCSLenAndIdx, true
+	}
+
+	a, _, err := getString(store, args[0])
+	if err != nil {
+		return errLCSNotStrings, true
+	}
+	b, _, err := getString(store, args[1])
+	if err != nil {
+		return errLCSNotStrings, true
+	}
+
+	// The table of the lengths takes 4 bytes per pair of prefixes
+	if uint64(len(a)+1)*uint64(len(b)+1)*4 > proto.MaxBulkLength {
+		return errLCSTooLong, true
+	}
+	lengths := lcsLengths(a, b)
+	lcsLen := lengths(len(a), len(b))
+	if getLen {
+		return int(lcsLen), true
+	}
+
+	// Walks the table back from the end of the strings, collecting the
+	// common subsequence and the ranges matching in both
+	var (
+		lcs     = make([]byte, lcsLen)
+		matches = []any{}
+
+		// A range is being tracked while aStart isn't len(a)
+		aStart, aEnd = len(a), 0
+		bStart, bEnd = 0, 0
+	)
+	for i, j, k := len(a), len(b), int(lcsLen); i > 0 && j > 0; {
+		emitRange := false
+		if a[i-1] == b[j-1] {
+			lcs[k-1] = a[i-1]
+			switch {
+			case aStart == len(a):
+				aStart, aEnd = i-1, i-1
+				bStart, bEnd = j-1, j-1
+			case aStart == i && bStart == j:
+				// Contiguous, extend the range backward
+				aStart--
+				bStart--
+			default:
+				emitRange = true
+			}
+			// The walk ends at the start of either string
+			if aStart == 0 || bStart == 0 {
+				emitRange = true
+			}
+			i, j, k = i-1, j-1, k-1
+		} else {
+			// Head toward the longest subsequence
+			if lengths(i-1, j) > lengths(i, j-1) {
+				i--
+			} else {
+				j--
+			}
+			if aStart != len(a) {
+				emitRange = true
+			}
+		}
+
+		if emitRange {
+			matchLen := aEnd - aStart + 1
+			if minMatchLen == 0 || matchLen >= minMatchLen {
+				match := []any{[]any{aStart, aEnd}, []any{bStart, bEnd}}
+				if withMatchLen {
+					match = append(match, matchLen)
+				}
+				matches = append(matches, match)
+			}
+			aStart = len(a)
+		}
+	}
+
+	if getIdx {
+		return proto.Map{"matches", matches, "len", int(lcsLen)}, true
+	}
+	return string(lcs), true
+}
+
+// Computes the lengths of the longest common subsequences of every pair
+// of prefixes of a and b, returned by the length of the prefixes
+func lcsLengths(a, b string) func(i, j int) uint32 {
+	width := len(b) + 1
+	table := make([]uint32, (len(a)+1)*width)
+	at := func(i, j int) uint32 {
+		return table[i*width+j]
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			if a[i-1] == b[j-1] {
+				table[i*width+j] = at(i-1, j-1) + 1
+			} else {
+				table[i*width+j] = max(at(i-1, j), at(i, j-1))
+			}
+		}
+	}
+	return at
+}
@@ -0,0 +1,57 @@
+package command
+
+import (
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+)
+
+// Looks up the value of type T stored at key, like a *datastore.List.
+// Returns a nil value if the key doesn't exist and a WRONGTYPE error if it
+// holds something else.
+func getTyped[T any](store *datastore.Datastore, key string) (T, error) {
+	var value T
+	data, exists := store.Get(key)
+	if !exists {
+		return value, nil
+	}
+
+	value, ok := data.(T)
+	if !ok {
+		return value, custom_err.ErrorWrongType
+	}
+
+	return value, nil
+}
+
+// Same as getTyped but returns create() when key doesn't exist. The new
+// value isn't stored yet, saveTyped does it once filled, and created tells
+// which one it is.
+func getOrCreateTyped[T comparable](store *datastore.Datastore, key string, create func() T) (T, bool, error) {
+	value, err := getTyped[T](store, key)
+	var none T
+	if err != nil || value != none {
+		return value, false, err
+	}
+
+	return create(), true, nil
+}
+
+// Stores a value created by getOrCreateTyped, or notifies that an existing
+// one was modified in place, so either way the change counts once.
+func saveTyped[T any](store *datastore.Datastore, key string, value T, created bool) error {
+	if created {
+		return store.Set(key, value, nil)
+	}
+	store.Touch(key)
+	return nil
+}
+
+// Deletes key once its value has no element left, aggregates are never
+// kept empty in the keyspace. Otherwise notifies it was modified in place.
+func removeIfEmpty(store *datastore.Datastore, key string, value interface{ Len() int }) {
+	if value.Len() == 0 {
+		store.Del(key)
+	} else {
+		store.Touch(key)
+	}
+}
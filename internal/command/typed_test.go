@@ -0,0 +1,52 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+)
+
+// Commands creating their key store it once filled, so creating it counts
+// as a single change, and a creation that ends up empty stores nothing
+func TestCreatingKeyCountsOneChange(t *testing.T) {
+	tests := []struct {
+		name  string
+		run   func(handler *Handler, store *datastore.Datastore) (any, bool)
+		dirty int64
+	}{
+		{name: "RPUSH", run: func(handler *Handler, store *datastore.Datastore) (any, bool) {
+			return handler.RPush([]string{"k", "a", "b"}, store)
+		}, dirty: 1},
+		{name: "HSET", run: func(handler *Handler, store *datastore.Datastore) (any, bool) {
+			return handler.HSet([]string{"k", "f", "v"}, store)
+		}, dirty: 1},
+		{name: "SADD", run: func(handler *Handler, store *datastore.Datastore) (any, bool) {
+			return handler.SAdd([]string{"k", "a", "b"}, store)
+		}, dirty: 1},
+		{name: "ZADD", run: func(handler *Handler, store *datastore.Datastore) (any, bool) {
+			return handler.ZAdd([]string{"k", "1", "a", "2", "b"}, store)
+		}, dirty: 1},
+		{name: "ZADD XX", run: func(handler *Handler, store *datastore.Datastore) (any, bool) {
+			return handler.ZAdd([]string{"k", "XX", "1", "a"}, store)
+		}, dirty: 0},
+		{name: "XADD", run: func(handler *Handler, store *datastore.Datastore) (any, bool) {
+			return handler.XAdd([]string{"k", "1-1", "f", "v"}, store)
+		}, dirty: 1},
+		{name: "XGROUP CREATE MKSTREAM", run: func(handler *Handler, store *datastore.Datastore) (any, bool) {
+			return handler.XGroup([]string{"CREATE", "k", "g", "$", "MKSTREAM"}, store)
+		}, dirty: 1},
+	}
+
+	for _, tc := range tests {
+		handler, _, store := newTestHandler()
+		if reply, _ := tc.run(handler, store); isError(reply) {
+			t.Errorf("%s: unexpected error %v", tc.name, reply)
+		}
+		if dirty := store.Dirty(); dirty != tc.dirty {
+			t.Errorf("%s: expected %d changes, got %d", tc.name, tc.dirty, dirty)
+		}
+		if exists := store.Exists("k"); exists != (tc.dirty > 0) {
+			t.Errorf("%s: expected the key to exist %v, got %v", tc.name, tc.dirty > 0, exists)
+		}
+	}
+}
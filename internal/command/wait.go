@@ -2,9 +2,9 @@ package command
 
 import (
 	"context"
-	"fmt"
 	custom_err "github.com/Viet-ph/redis-go/internal/error"
 	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/logger"
 	"github.com/Viet-ph/redis-go/internal/proto"
 	"github.com/Viet-ph/redis-go/internal/connection"
 )
@@ -35,10 +35,10 @@ func GetRepOffsets(numReplicas int, offsTracker *OffsTracker, ctx context.Contex
 
 loop:
 	for {
-		fmt.Println("Getting acks...")
+		logger.Debug("Getting acks...")
 		select {
 		case offset := <-offsTracker.AckCh:
-			fmt.Printf("Rep offset: %d, server offset: %d\n", offset, info.ReplicationOffset)
+			logger.Debugf("Rep offset: %d, server offset: %d\n", offset, info.ReplicationOffset)
 			if offset >= offsTracker.CapturedOffs {
 				totalAck += 1
 			}
@@ -0,0 +1,777 @@
+package command
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+var (
+	errNotFloat       = errors.New("ERR value is not a valid float")
+	errScoreRange     = errors.New("ERR min or max is not a float")
+	errLexRange       = errors.New("ERR min or max not valid string range item")
+	errNaNScore       = errors.New("ERR resulting score is not a number (NaN)")
+	errWeightNotFloat = errors.New("ERR weight value is not a float")
+)
+
+// Parses a float the way Redis does, accepting inf/-inf but not NaN
+func parseFloat(arg string) (float64, error) {
+	value, err := strconv.ParseFloat(arg, 64)
+	if err != nil || math.IsNaN(value) {
+		return 0, errNotFloat
+	}
+	return value, nil
+}
+
+// Parses min and max of ZRANGEBYSCORE like commands, "(" excludes the value
+func parseScoreRange(min, max string) (datastore.ScoreRange, error) {
+	var r datastore.ScoreRange
+	parseBound := func(arg string) (float64, bool, error) {
+		exclusive := strings.HasPrefix(arg, "(")
+		if exclusive {
+			arg = arg[1:]
+		}
+		value, err := strconv.ParseFloat(arg, 64)
+		if err != nil || math.IsNaN(value) {
+			return 0, false, errScoreRange
+		}
+		return value, exclusive, nil
+	}
+
+	var err error
+	r.Min, r.MinExclusive, err = parseBound(min)
+	if err != nil {
+		return r, err
+	}
+	r.Max, r.MaxExclusive, err = parseBound(max)
+	if err != nil {
+		return r, err
+	}
+
+	return r, nil
+}
+
+// Parses min and max of ZRANGEBYLEX like commands. Each end is either "-",
+// "+", or a member prefixed with "[" (inclusive) or "(" (exclusive).
+func parseLexRange(min, max string) (datastore.LexRange, error) {
+	var r datastore.LexRange
+	parseBound := func(arg string) (value string, exclusive, unbounded bool, err error) {
+		switch {
+		case arg == "-" || arg == "+":
+			return "", false, true, nil
+		case strings.HasPrefix(arg, "["):
+			return arg[1:], false, false, nil
+		case strings.HasPrefix(arg, "("):
+			return arg[1:], true, false, nil
+		default:
+			return "", false, false, errLexRange
+		}
+	}
+
+	var err error
+	r.Min, r.MinExclusive, r.MinUnbounded, err = parseBound(min)
+	if err != nil {
+		return r, err
+	}
+	r.Max, r.MaxExclusive, r.MaxUnbounded, err = parseBound(max)
+	if err != nil {
+		return r, err
+	}
+
+	// "+" as min or "-" as max can't match anything, make it an empty range
+	if min == "+" || max == "-" {
+		r = datastore.LexRange{MinExclusive: true, MaxExclusive: true}
+	}
+
+	return r, nil
+}
+
+// Flattens members into [member, score, ...] when withScores, otherwise
+// into a plain list of members
+func zmembersReply(members []datastore.ZMember, withScores bool) []string {
+	size := len(members)
+	if withScores {
+		size *= 2
+	}
+
+	reply := make([]string, 0, size)
+	for _, m := range members {
+		reply = append(reply, m.Member)
+		if withScores {
+			reply = append(reply, proto.FormatDouble(m.Score))
+		}
+	}
+	return reply
+}
+
+// ZADD Handler
+func (handler *Handler) ZAdd(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 3 {
+		return errWrongArgs("zadd"), true
+	}
+
+	var nx, xx, gt, lt, ch, incr bool
+	i := 1
+flags:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		case "CH":
+			ch = true
+		case "INCR":
+			incr = true
+		default:
+			break flags
+		}
+	}
+
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return custom_err.ErrorSyntax, true
+	}
+	if nx && xx {
+		return errors.New("ERR XX and NX options at the same time are not compatible"), true
+	}
+	if (gt && lt) || (gt && nx) || (lt && nx) {
+		return errors.New("ERR GT, LT, and/or NX options at the same time are not compatible"), true
+	}
+	if incr && len(pairs) != 2 {
+		return errors.New("ERR INCR option supports a single increment-element pair"), true
+	}
+
+	// Parse every score before touching the sorted set so a bad score
+	// doesn't leave a partially applied command behind
+	scores := make([]float64, len(pairs)/2)
+	for j := range scores {
+		score, err := parseFloat(pairs[j*2])
+		if err != nil {
+			return err, true
+		}
+		scores[j] = score
+	}
+
+	zset, created, err := getOrCreateTyped(store, args[0], datastore.NewSortedSet)
+	if err != nil {
+		return err, true
+	}
+	if created && xx {
+		if incr {
+			return custom_err.ErrorKeyNotExists, true
+		}
+		return 0, true
+	}
+
+	added, changed := 0, 0
+	var incrResult any = custom_err.ErrorKeyNotExists
+	for j, score := range scores {
+		member := pairs[j*2+1]
+		oldScore, exists := zset.Score(member)
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+
+		newScore := score
+		if incr && exists {
+			newScore = oldScore + score
+			if math.IsNaN(newScore) {
+				return errNaNScore, true
+			}
+		}
+
+		if exists && ((gt && newScore <= oldScore) || (lt && newScore >= oldScore)) {
+			continue
+		}
+
+		if zset.Add(member, newScore) {
+			added++
+		} else if newScore != oldScore {
+			changed++
+		}
+		incrResult = proto.Double(newScore)
+	}
+
+	// A new sorted set always gets its members
+	if added+changed > 0 {
+		if err := saveTyped(store, args[0], zset, created); err != nil {
+			return err, true
+		}
+	}
+
+	if incr {
+		return incrResult, true
+	}
+	if ch {
+		return added + changed, true
+	}
+	return added, true
+}
+
+// ZINCRBY Handler
+func (handler *Handler) ZIncrBy(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs("zincrby"), true
+	}
+
+	return handler.ZAdd([]string{args[0], "INCR", args[1], args[2]}, store)
+}
+
+// ZREM Handler
+func (handler *Handler) ZRem(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 2 {
+		return errWrongArgs("zrem"), true
+	}
+
+	zset, err := getTyped[*datastore.SortedSet](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if zset == nil {
+		return 0, true
+	}
+
+	removed := 0
+	for _, member := range args[1:] {
+		if zset.Remove(member) {
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		removeIfEmpty(store, args[0], zset)
+	}
+
+	return removed, true
+}
+
+// ZCARD ZSCORE ZCOUNT Handlers
+func (handler *Handler) ZCard(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 1 {
+		return errWrongArgs("zcard"), true
+	}
+
+	zset, err := getTyped[*datastore.SortedSet](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if zset == nil {
+		return 0, true
+	}
+
+	return zset.Len(), true
+}
+
+func (handler *Handler) ZScore(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 2 {
+		return errWrongArgs("zscore"), true
+	}
+
+	zset, err := getTyped[*datastore.SortedSet](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if zset == nil {
+		return custom_err.ErrorKeyNotExists, true
+	}
+
+	score, exists := zset.Score(args[1])
+	if !exists {
+		return custom_err.ErrorKeyNotExists, true
+	}
+
+	return proto.Double(score), true
+}
+
+func (handler *Handler) ZCount(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 {
+		return errWrongArgs("zcount"), true
+	}
+
+	r, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return err, true
+	}
+
+	zset, err := getTyped[*datastore.SortedSet](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if zset == nil {
+		return 0, true
+	}
+
+	return zset.Count(r), true
+}
+
+// ZRANK ZREVRANK Handlers
+func (handler *Handler) ZRank(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.rank(args, store, "zrank", false)
+}
+
+func (handler *Handler) ZRevRank(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.rank(args, store, "zrevrank", true)
+}
+
+func (handler *Handler) rank(args []string, store *datastore.Datastore, cmdName string, reverse bool) (any, bool) {
+	if len(args) != 2 && len(args) != 3 {
+		return errWrongArgs(cmdName), true
+	}
+
+	withScore := false
+	if len(args) == 3 {
+		if strings.ToUpper(args[2]) != "WITHSCORE" {
+			return custom_err.ErrorSyntax, true
+		}
+		withScore = true
+	}
+
+	zset, err := getTyped[*datastore.SortedSet](store, args[0])
+	if err != nil {
+		return err, true
+	}
+
+	var nilReply error = custom_err.ErrorKeyNotExists
+	if withScore {
+		nilReply = custom_err.ErrorNullArray
+	}
+	if zset == nil {
+		return nilReply, true
+	}
+
+	rank, exists := zset.Rank(args[1], reverse)
+	if !exists {
+		return nilReply, true
+	}
+
+	if withScore {
+		score, _ := zset.Score(args[1])
+		return []any{rank, proto.Double(score)}, true
+	}
+	return rank, true
+}
+
+// ZRANGE and its legacy variants Handlers
+func (handler *Handler) ZRange(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) < 3 {
+		return errWrongArgs("zrange"), true
+	}
+
+	opts := zrangeOptions{byRank: true, count: -1}
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "BYSCORE":
+			opts.byScore, opts.byRank = true, false
+		case "BYLEX":
+			opts.byLex, opts.byRank = true, false
+		case "REV":
+			opts.reverse = true
+		case "WITHSCORES":
+			opts.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return custom_err.ErrorSyntax, true
+			}
+			if err := opts.parseLimit(args[i+1], args[i+2]); err != nil {
+				return err, true
+			}
+			i += 2
+		default:
+			return custom_err.ErrorSyntax, true
+		}
+	}
+
+	if opts.byScore && opts.byLex {
+		return custom_err.ErrorSyntax, true
+	}
+	if opts.hasLimit && opts.byRank {
+		return errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX"), true
+	}
+	if opts.withScores && opts.byLex {
+		return errors.New("ERR syntax error, WITHSCORES not supported in combination with BYLEX"), true
+	}
+
+	// With REV, the range is given from max to min
+	min, max := args[1], args[2]
+	if opts.reverse && !opts.byRank {
+		min, max = max, min
+	}
+
+	return handler.zrange(args[0], min, max, opts, store)
+}
+
+func (handler *Handler) ZRevRange(args []string, store *datastore.Datastore) (any, bool) {
+	if len(args) != 3 && len(args) != 4 {
+		return errWrongArgs("zrevrange"), true
+	}
+
+	opts := zrangeOptions{byRank: true, reverse: true, count: -1}
+	if len(args) == 4 {
+		if strings.ToUpper(args[3]) != "WITHSCORES" {
+			return custom_err.ErrorSyntax, true
+		}
+		opts.withScores = true
+	}
+
+	return handler.zrange(args[0], args[1], args[2], opts, store)
+}
+
+func (handler *Handler) ZRangeByScore(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.zrangeByScoreOrLex(args, store, "zrangebyscore", zrangeOptions{byScore: true, count: -1})
+}
+
+func (handler *Handler) ZRevRangeByScore(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.zrangeByScoreOrLex(args, store, "zrevrangebyscore", zrangeOptions{byScore: true, reverse: true, count: -1})
+}
+
+func (handler *Handler) ZRangeByLex(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.zrangeByScoreOrLex(args, store, "zrangebylex", zrangeOptions{byLex: true, count: -1})
+}
+
+func (handler *Handler) ZRevRangeByLex(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.zrangeByScoreOrLex(args, store, "zrevrangebylex", zrangeOptions{byLex: true, reverse: true, count: -1})
+}
+
+// Handles ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count] and
+// its REV/LEX siblings. Reverse variants take max before min.
+func (handler *Handler) zrangeByScoreOrLex(args []string, store *datastore.Datastore, cmdName string, opts zrangeOptions) (any, bool) {
+	if len(args) < 3 {
+		return errWrongArgs(cmdName), true
+	}
+
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WITHSCORES":
+			if opts.byLex {
+				return custom_err.ErrorSyntax, true
+			}
+			opts.withScores = true
+		case "LIMIT":
+			if i+2 >= len(args) {
+				return custom_err.ErrorSyntax, true
+			}
+			if err := opts.parseLimit(args[i+1], args[i+2]); err != nil {
+				return err, true
+			}
+			i += 2
+		default:
+			return custom_err.ErrorSyntax, true
+		}
+	}
+
+	min, max := args[1], args[2]
+	if opts.reverse {
+		min, max = max, min
+	}
+
+	return handler.zrange(args[0], min, max, opts, store)
+}
+
+type zrangeOptions struct {
+	byRank, byScore, byLex bool
+	reverse                bool
+	withScores             bool
+	hasLimit               bool
+	offset, count          int
+}
+
+func (opts *zrangeOptions) parseLimit(offset, count string) error {
+	var err error
+	opts.offset, err = strconv.Atoi(offset)
+	if err != nil {
+		return custom_err.ErrorNotInteger
+	}
+	opts.count, err = strconv.Atoi(count)
+	if err != nil {
+		return custom_err.ErrorNotInteger
+	}
+	opts.hasLimit = true
+	return nil
+}
+
+// Common implementation for the ZRANGE family. min and max are already
+// ordered, whatever the direction of the reply is.
+func (handler *Handler) zrange(key, min, max string, opts zrangeOptions, store *datastore.Datastore) (any, bool) {
+	var (
+		start, stop int
+		scoreRange  datastore.ScoreRange
+		lexRange    datastore.LexRange
+		err         error
+	)
+	switch {
+	case opts.byScore:
+		scoreRange, err = parseScoreRange(min, max)
+	case opts.byLex:
+		lexRange, err = parseLexRange(min, max)
+	default:
+		start, err = strconv.Atoi(min)
+		if err == nil {
+			stop, err = strconv.Atoi(max)
+		}
+		if err != nil {
+			err = custom_err.ErrorNotInteger
+		}
+	}
+	if err != nil {
+		return err, true
+	}
+
+	zset, err := getTyped[*datastore.SortedSet](store, key)
+	if err != nil {
+		return err, true
+	}
+	if zset == nil || opts.offset < 0 {
+		return []string{}, true
+	}
+
+	var members []datastore.ZMember
+	switch {
+	case opts.byScore:
+		members = zset.RangeByScore(scoreRange, opts.reverse, opts.offset, opts.count)
+	case opts.byLex:
+		members = zset.RangeByLex(lexRange, opts.reverse, opts.offset, opts.count)
+	default:
+		members = zset.RangeByRank(start, stop, opts.reverse)
+	}
+
+	return zmembersReply(members, opts.withScores), true
+}
+
+// ZPOPMIN ZPOPMAX Handlers
+func (handler *Handler) ZPopMin(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.zpop(args, store, "zpopmin", false)
+}
+
+func (handler *Handler) ZPopMax(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.zpop(args, store, "zpopmax", true)
+}
+
+func (handler *Handler) zpop(args []string, store *datastore.Datastore, cmdName string, fromMax bool) (any, bool) {
+	if len(args) != 1 && len(args) != 2 {
+		return errWrongArgs(cmdName), true
+	}
+
+	count := 1
+	if len(args) == 2 {
+		var err error
+		count, err = strconv.Atoi(args[1])
+		if err != nil || count < 0 {
+			return errors.New("ERR value is out of range, must be positive"), true
+		}
+	}
+
+	zset, err := getTyped[*datastore.SortedSet](store, args[0])
+	if err != nil {
+		return err, true
+	}
+	if zset == nil {
+		return []string{}, true
+	}
+
+	popped := zset.Pop(count, fromMax)
+	if len(popped) > 0 {
+		removeIfEmpty(store, args[0], zset)
+	}
+
+	return zmembersReply(popped, true), true
+}
+
+// ZUNIONSTORE ZINTERSTORE ZUNION ZINTER Handlers
+func (handler *Handler) ZUnionStore(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.zsetAlgebra(args, store, "zunionstore", true, true)
+}
+
+func (handler *Handler) ZInterStore(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.zsetAlgebra(args, store, "zinterstore", false, true)
+}
+
+func (handler *Handler) ZUnion(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.zsetAlgebra(args, store, "zunion", true, false)
+}
+
+func (handler *Handler) ZInter(args []string, store *datastore.Datastore) (any, bool) {
+	return handler.zsetAlgebra(args, store, "zinter", false, false)
+}
+
+// Loads the members of a sorted set or a plain set (every member scoring 1)
+// stored at key. Missing keys give an empty result.
+func getZSetInput(store *datastore.Datastore, key string) (map[string]float64, error) {
+	data, exists := store.Get(key)
+	if !exists {
+		return map[string]float64{}, nil
+	}
+
+	switch value := data.(type) {
+	case *datastore.SortedSet:
+		members := make(map[string]float64, value.Len())
+		for _, m := range value.Members() {
+			members[m.Member] = m.Score
+		}
+		return members, nil
+	case *datastore.Set:
+		members := make(map[string]float64, value.Len())
+		for _, m := range value.Members() {
+			members[m] = 1
+		}
+		return members, nil
+	default:
+		return nil, custom_err.ErrorWrongType
+	}
+}
+
+func aggregateScores(aggregate string, a, b float64) float64 {
+	switch aggregate {
+	case "MIN":
+		return math.Min(a, b)
+	case "MAX":
+		return math.Max(a, b)
+	default:
+		sum := a + b
+		// inf + -inf, Redis treats it as 0
+		if math.IsNaN(sum) {
+			return 0
+		}
+		return sum
+	}
+}
+
+// Handles [destination] numkeys key [key ...] [WEIGHTS weight [weight ...]]
+// [AGGREGATE SUM|MIN|MAX] for both union and intersection.
+func (handler *Handler) zsetAlgebra(args []string, store *datastore.Datastore, cmdName string, union, withStore bool) (any, bool) {
+	minArgs := 2
+	if withStore {
+		minArgs = 3
+	}
+	if len(args) < minArgs {
+		return errWrongArgs(cmdName), true
+	}
+
+	var destination string
+	if withStore {
+		destination, args = args[0], args[1:]
+	}
+
+	numKeys, err := strconv.Atoi(args[0])
+	if err != nil {
+		return custom_err.ErrorNotInteger, true
+	}
+	if numKeys < 1 {
+		return errors.New("ERR at least 1 input key is needed for '" + cmdName + "' command"), true
+	}
+	if numKeys > len(args)-1 {
+		return custom_err.ErrorSyntax, true
+	}
+	keys := args[1 : numKeys+1]
+
+	weights := make([]float64, numKeys)
+	for i := range weights {
+		weights[i] = 1
+	}
+	aggregate := "SUM"
+	withScores := false
+	for i := numKeys + 1; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "WEIGHTS":
+			if i+numKeys >= len(args) {
+				return custom_err.ErrorSyntax, true
+			}
+			for j := 0; j < numKeys; j++ {
+				weight, err := strconv.ParseFloat(args[i+1+j], 64)
+				if err != nil || math.IsNaN(weight) {
+					return errWeightNotFloat, true
+				}
+				weights[j] = weight
+			}
+			i += numKeys
+		case "AGGREGATE":
+			if i+1 >= len(args) {
+				return custom_err.ErrorSyntax, true
+			}
+			aggregate = strings.ToUpper(args[i+1])
+			if aggregate != "SUM" && aggregate != "MIN" && aggregate != "MAX" {
+				return custom_err.ErrorSyntax, true
+			}
+			i++
+		case "WITHSCORES":
+			if withStore {
+				return custom_err.ErrorSyntax, true
+			}
+			withScores = true
+		default:
+			return custom_err.ErrorSyntax, true
+		}
+	}
+
+	inputs := make([]map[string]float64, numKeys)
+	for i, key := range keys {
+		inputs[i], err = getZSetInput(store, key)
+		if err != nil {
+			return err, true
+		}
+	}
+
+	weighted := func(score, weight float64) float64 {
+		value := score * weight
+		// 0 * inf, Redis treats it as 0
+		if math.IsNaN(value) {
+			return 0
+		}
+		return value
+	}
+
+	scores := make(map[string]float64)
+	if union {
+		for i, input := range inputs {
+			for member, score := range input {
+				score = weighted(score, weights[i])
+				if current, exists := scores[member]; exists {
+					score = aggregateScores(aggregate, current, score)
+				}
+				scores[member] = score
+			}
+		}
+	} else {
+	members:
+		for member, score := range inputs[0] {
+			result := weighted(score, weights[0])
+			for i := 1; i < len(inputs); i++ {
+				other, exists := inputs[i][member]
+				if !exists {
+					continue members
+				}
+				result = aggregateScores(aggregate, result, weighted(other, weights[i]))
+			}
+			scores[member] = result
+		}
+	}
+
+	result := datastore.NewSortedSet()
+	for member, score := range scores {
+		result.Add(member, score)
+	}
+
+	if !withStore {
+		return zmembersReply(result.Members(), withScores), true
+	}
+
+	if result.Len() == 0 {
+		store.Del(destination)
+		return 0, true
+	}
+	err = store.Set(destination, result, nil)
+	if err != nil {
+		return err, true
+	}
+
+	return result.Len(), true
+}
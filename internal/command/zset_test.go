@@ -0,0 +1,41 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+func TestZRankWithScoreReply(t *testing.T) {
+	handler, _, store := newTestHandler()
+	handler.ZAdd([]string{"z", "1.5", "a", "2", "b"}, store)
+
+	tests := []struct {
+		protocol int
+		args     []string
+		reverse  bool
+		expected string
+	}{
+		{protocol: proto.Resp2, args: []string{"z", "b", "WITHSCORE"}, expected: "*2\r\n:1\r\n$1\r\n2\r\n"},
+		{protocol: proto.Resp3, args: []string{"z", "b", "WITHSCORE"}, expected: "*2\r\n:1\r\n,2\r\n"},
+		{protocol: proto.Resp3, args: []string{"z", "a", "WITHSCORE"}, reverse: true, expected: "*2\r\n:1\r\n,1.5\r\n"},
+		{protocol: proto.Resp2, args: []string{"z", "missing", "WITHSCORE"}, expected: "*-1\r\n"},
+		{protocol: proto.Resp2, args: []string{"z", "a"}, reverse: true, expected: ":1\r\n"},
+	}
+
+	for _, tc := range tests {
+		var reply any
+		if tc.reverse {
+			reply, _ = handler.ZRevRank(tc.args, store)
+		} else {
+			reply, _ = handler.ZRank(tc.args, store)
+		}
+
+		encoder := proto.NewEncoder()
+		encoder.SetProtocol(tc.protocol)
+		encoder.Encode(reply, false)
+		if encoded := string(encoder.GetBufValue()); encoded != tc.expected {
+			t.Errorf("RESP%d %v (reverse %v): expected %q but got %q", tc.protocol, tc.args, tc.reverse, tc.expected, encoded)
+		}
+	}
+}
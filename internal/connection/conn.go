@@ -4,20 +4,39 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/Viet-ph/redis-go/config"
 	custom_err "github.com/Viet-ph/redis-go/internal/error"
+	"github.com/Viet-ph/redis-go/internal/logger"
+	"github.com/Viet-ph/redis-go/internal/proto"
 	"golang.org/x/sys/unix"
 )
 
 var ConnectedClients map[int]*Conn = make(map[int]*Conn)
 
+// Id given to the last connection accepted
+var lastId int64
+
 type Conn struct {
 	Fd         int
 	writeQueue [][]byte
 	remoteIP   net.IP
 	remotePort int
 	IsClosed   bool
+
+	// Bytes received but not parsed yet, commands can span several reads
+	queryBuf bytes.Buffer
+
+	// Last time the client sent something, to close idle clients
+	LastInteraction time.Time
+
+	// Unique id of the connection and the name the client gave itself
+	Id   int64
+	Name string
+
+	// RESP version replies are encoded for, switched with HELLO
+	Protocol int
 }
 
 func NewConn(connFd int, sa unix.Sockaddr) (*Conn, error) {
@@ -35,14 +54,20 @@ func NewConn(connFd int, sa unix.Sockaddr) (*Conn, error) {
 	default:
 		return nil, fmt.Errorf("unknown address type")
 	}
+	lastId++
 	return &Conn{
-		Fd:         connFd,
-		remoteIP:   ip,
-		remotePort: port,
+		Fd:              connFd,
+		remoteIP:        ip,
+		remotePort:      port,
+		LastInteraction: time.Now(),
+		Id:              lastId,
+		Protocol:        proto.Resp2,
 	}, nil
 }
 
-func (conn *Conn) Read(buf *bytes.Buffer) (int, error) {
+// Read appends everything available on the socket to the query buffer,
+// after what's left of previous reads
+func (conn *Conn) Read() (int, error) {
 	temp := make([]byte, config.DefaultMessageSize)
 	totalLength := 0
 	//For loop to drain all the unknown size incomming message
@@ -61,19 +86,20 @@ func (conn *Conn) Read(buf *bytes.Buffer) (int, error) {
 			return -1, custom_err.ErrorClientDisconnected
 		}
 		if err != nil {
-			if err == unix.EAGAIN && buf.Len() > 0 {
-				//We drained all the massage and no available message left in kernel buffer
+			if err == unix.EAGAIN {
+				//We drained all the massage and no available message left in kernel buffer,
+				//or no data available yet, return to event loop
 				break
-			} else if err == unix.EAGAIN {
-				// No data available yet, return to event loop
-				return 0, nil
 			}
 			// Handle other errors
 			return -1, custom_err.ErrorReadingSocket
 		}
 
-		buf.Write(temp)
+		conn.queryBuf.Write(temp[:bytesRead])
 		totalLength += bytesRead
+		if int64(conn.queryBuf.Len()) > config.QueryBufferLimit {
+			return -1, custom_err.ErrorQueryBufferLimit
+		}
 
 		//If number of bytes read smaller than temp buffer size,
 		//we got all data in one go. Break here.
@@ -85,6 +111,12 @@ func (conn *Conn) Read(buf *bytes.Buffer) (int, error) {
 	return totalLength, nil
 }
 
+// QueryBuf returns the bytes received from the client that weren't parsed
+// into commands yet
+func (conn *Conn) QueryBuf() *bytes.Buffer {
+	return &conn.queryBuf
+}
+
 func (conn *Conn) DrainQueue() error {
 	for len(conn.writeQueue) > 0 {
 		data := conn.writeQueue[0]
@@ -103,7 +135,7 @@ func (conn *Conn) DrainQueue() error {
 		}
 
 		// Full write, remove the data from the queue
-		fmt.Println("Data sent: " + string(data))
+		logger.Debug("Data sent: " + string(data))
 		conn.writeQueue = conn.writeQueue[1:]
 	}
 
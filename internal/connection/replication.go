@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strconv"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	"github.com/Viet-ph/redis-go/config"
 	"github.com/Viet-ph/redis-go/internal/datastore"
 	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/logger"
 	"github.com/Viet-ph/redis-go/internal/proto"
 	"github.com/Viet-ph/redis-go/internal/rdb"
 	"github.com/google/uuid"
@@ -49,8 +51,12 @@ func (rep *Replica) SetOffset(offs int) {
 	rep.offset = offs
 }
 
+func (rep *Replica) GetOffset() int {
+	return rep.offset
+}
+
 func SetupMasterSlave() (net.Conn, *datastore.Datastore, error) {
-	fmt.Println("Setting master-slave...")
+	logger.Notice("Setting master-slave...")
 	info.ReplicationId = uuid.New()
 	info.ReplicationOffset = 0
 
@@ -64,7 +70,7 @@ func SetupMasterSlave() (net.Conn, *datastore.Datastore, error) {
 		info.MasterHost = masterSocket[0]
 		info.MasterPort, _ = strconv.Atoi(masterSocket[1])
 
-		fmt.Println("Pinging master ...")
+		logger.Notice("Pinging master ...")
 		conn, datastore, err := doHandShake()
 		if err != nil {
 			return nil, nil, err
@@ -78,7 +84,7 @@ func SetupMasterSlave() (net.Conn, *datastore.Datastore, error) {
 
 // Synchronous behavior, means write or read -> master will block the current goroutine
 func doHandShake() (net.Conn, *datastore.Datastore, error) {
-	address := fmt.Sprintf("%s:%d", info.MasterHost, info.MasterPort)
+	address := net.JoinHostPort(info.MasterHost, strconv.Itoa(info.MasterPort))
 	conn, err := net.Dial("tcp", address)
 	if err != nil {
 		return nil, nil, err
@@ -87,8 +93,8 @@ func doHandShake() (net.Conn, *datastore.Datastore, error) {
 	masterAddr := conn.RemoteAddr().String()
 	localAddr := conn.LocalAddr().String()
 
-	fmt.Println("Master addre: " + masterAddr)
-	fmt.Println("Local addre: " + localAddr)
+	logger.Debug("Master addre: " + masterAddr)
+	logger.Debug("Local addre: " + localAddr)
 
 	handShakeCommands := map[string]string{
 		"PING":       "*1\r\n$4\r\nPING\r\n",
@@ -97,26 +103,35 @@ func doHandShake() (net.Conn, *datastore.Datastore, error) {
 		"PSYNC":      "*3\r\n$5\r\nPSYNC\r\n$1\r\n?\r\n$2\r\n-1\r\n",
 	}
 
+	// Authenticate first, a master requiring a password replies to
+	// anything else with an error
+	if config.MasterAuth != "" {
+		authCmd := fmt.Sprintf("*2\r\n$4\r\nAUTH\r\n$%d\r\n%s\r\n", len(config.MasterAuth), config.MasterAuth)
+		if _, err := sendHandshake(conn, authCmd); err != nil {
+			return nil, nil, fmt.Errorf("error authenticating with master: %w", err)
+		}
+	}
+
 	//Ping
 	response, err := sendHandshake(conn, handShakeCommands["PING"])
 	if err != nil {
 		return nil, nil, err
 	}
-	fmt.Println("Ping response: " + response.(string))
+	logger.Debug("Ping response: " + response.(string))
 
 	//Rep config 1
 	response, err = sendHandshake(conn, handShakeCommands["REPLCONF 1"])
 	if err != nil {
 		return nil, nil, err
 	}
-	fmt.Println("Rep config 1 response: " + response.(string))
+	logger.Debug("Rep config 1 response: " + response.(string))
 
 	//Rep config 2
 	response, err = sendHandshake(conn, handShakeCommands["REPLCONF 2"])
 	if err != nil {
 		return nil, nil, err
 	}
-	fmt.Println("Rep config 2 response: " + response.(string))
+	logger.Debug("Rep config 2 response: " + response.(string))
 
 	//PSYNC
 	datastore, err := handleReSync([]byte(handShakeCommands["PSYNC"]), conn)
@@ -143,51 +158,76 @@ func sendHandshake(conn net.Conn, data string) (response any, err error) {
 	if err != nil {
 		return "", err
 	}
+	// The master replied with an error
+	if replyErr, ok := decodedResponse.(error); ok {
+		return "", replyErr
+	}
 
 	return decodedResponse, nil
 }
 
+// Reads the FULLRESYNC reply and the RDB payload following it, exactly
+// as many bytes as announced so the commands the master propagates next
+// are left to be read from conn.
 func handleReSync(syncCmd []byte, conn net.Conn) (*datastore.Datastore, error) {
 	_, err := conn.Write(syncCmd)
 	if err != nil {
 		return nil, err
 	}
 
-	container := make([]byte, config.DefaultMessageSize)
-	n, err := conn.Read(container)
+	syncResponse, err := readReplyLine(conn)
 	if err != nil {
 		return nil, err
 	}
-	crlf := bytes.Index(container, []byte{'\r', '\n'})
-	syncResponse := container[:crlf+2]
-	RdbContainer := container[len(syncResponse):n]
-
-	//In linux, 2 sequencial writes from server doesn't come in 1 package like darwin.
-	//Here read 1 more time to get the rdb
-	if len(RdbContainer) == 0 {
-		RdbContainer = make([]byte, config.DefaultMessageSize)
-		_, err := conn.Read(RdbContainer)
-		if err != nil {
-			return nil, err
-		}
+	if syncResponse[0] == proto.ErrorPrefix {
+		return nil, errors.New(syncResponse[1:])
 	}
+	logger.Debug("Psync response: " + syncResponse[1:])
 
-	decoder := proto.NewDecoder(bytes.NewBuffer([]byte(syncResponse)))
-	docodedResponse, err := decoder.Decode()
+	// The RDB is sent like a bulk string, without the trailing CRLF
+	rdbHeader, err := readReplyLine(conn)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println("Psync response: " + docodedResponse.(string))
+	if rdbHeader[0] != proto.BulkStringPrefix {
+		return nil, fmt.Errorf("expected RDB payload from master, got %q", rdbHeader)
+	}
+	rdbLength, err := strconv.Atoi(rdbHeader[1:])
+	if err != nil || rdbLength < 0 {
+		return nil, fmt.Errorf("invalid RDB payload length from master: %q", rdbHeader)
+	}
 
-	storage, expiry, err := rdb.RdbUnMarshall(RdbContainer)
+	rawRdb := make([]byte, rdbLength)
+	if _, err := io.ReadFull(conn, rawRdb); err != nil {
+		return nil, fmt.Errorf("error reading RDB payload from master: %w", err)
+	}
+
+	storage, expiry, err := rdb.RdbUnMarshall(rawRdb)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(storage)
+	logger.Debugf("Loaded %d keys from master\n", len(storage))
 
 	return datastore.NewDatastore(storage, expiry), nil
 }
 
+// Reads a line of a reply a byte at a time, so nothing past it is
+// consumed from conn. The CRLF isn't part of the returned line.
+func readReplyLine(conn net.Conn) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(line, []byte(proto.CRLF)) {
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return "", err
+		}
+		line = append(line, b[0])
+	}
+	if len(line) == len(proto.CRLF) {
+		return "", errors.New("empty reply line from master")
+	}
+	return string(line[:len(line)-len(proto.CRLF)]), nil
+}
+
 func getFileDescriptor(conn net.Conn) (int, error) {
 	// Type assert to *net.TCPConn
 	tcpConn, ok := conn.(*net.TCPConn)
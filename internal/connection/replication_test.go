@@ -0,0 +1,51 @@
+package connection
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/rdb"
+)
+
+// The RDB is read whole even when bigger than a single read, and the
+// commands the master sends after it are left on the connection
+func TestHandleReSync(t *testing.T) {
+	store := make(map[string]*datastore.Data)
+	for i := range 200 {
+		store["key:"+strconv.Itoa(i)] = datastore.NewData(strings.Repeat("v", 50))
+	}
+	rawRdb, err := rdb.RdbMarshall(datastore.NewDatastore(store, nil))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	propagated := "*1\r\n$4\r\nPING\r\n"
+
+	replica, master := net.Pipe()
+	defer replica.Close()
+	defer master.Close()
+	go func() {
+		syncCmd := make([]byte, 64)
+		master.Read(syncCmd)
+		fmt.Fprintf(master, "+FULLRESYNC id 0\r\n$%d\r\n", len(rawRdb))
+		master.Write(rawRdb)
+		master.Write([]byte(propagated))
+	}()
+
+	ds, err := handleReSync([]byte("*3\r\n$5\r\nPSYNC\r\n$1\r\n?\r\n$2\r\n-1\r\n"), replica)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ds.Size() != len(store) {
+		t.Errorf("Expected %d keys from the master, got %d", len(store), ds.Size())
+	}
+
+	next := make([]byte, len(propagated))
+	if _, err := io.ReadFull(replica, next); err != nil || string(next) != propagated {
+		t.Errorf("Expected the propagated command to follow the RDB, got %q, %v", next, err)
+	}
+}
@@ -2,6 +2,7 @@ package datastore
 
 type Data struct {
 	value any
+	epoch uint64 // Epoch of the store when the value was set or copied
 	//hasExpiry bool
 	//expiredAt time.Time
 	//createdAt time.Time
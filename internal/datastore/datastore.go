@@ -1,8 +1,6 @@
 package datastore
 
 import (
-	"errors"
-	"fmt"
 	"math"
 	"slices"
 	"strconv"
@@ -10,14 +8,42 @@ import (
 	"sync"
 	"time"
 
-	"github.com/Viet-ph/redis-go/internal/info"
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
 )
 
 type Datastore struct {
-	store        map[string]*Data
-	expiry       map[string]time.Time
-	KeyChangesCh chan struct{}
-	mu           *sync.RWMutex
+	store   map[string]*Data
+	expiry  map[string]time.Time
+	watched map[string]*watchedKey
+	mu      *sync.RWMutex
+
+	// Same keys as store, in the order SCAN walks them
+	keys *keyTable
+	// Same keys as expiry, for the active expire cycle to sample
+	expiryKeys *keyTable
+
+	// Number of changes since the last save
+	dirty int64
+
+	// Incremented by every snapshot, values stamped with an older epoch
+	// may be shared with a snapshot and are copied before being handed out
+	// for modification.
+	epoch     uint64
+	snapshots int
+	readOnly  bool
+	// Snapshots whose walk hasn't visited every key yet, the entries
+	// they are to visit are preserved for them before being modified
+	walking []*Snapshot
+
+	// On replicas keys are only deleted by the master, which propagates a
+	// DEL when they expire. Until then expired keys are hidden from
+	// clients, but not from the commands of the master.
+	replica    bool
+	fromMaster bool
+
+	// Keys expired since the last call to TakeExpired, their deletion has
+	// to be propagated
+	expired []string
 }
 
 func NewDatastore(store map[string]*Data, expiry map[string]time.Time) *Datastore {
@@ -29,81 +55,116 @@ func NewDatastore(store map[string]*Data, expiry map[string]time.Time) *Datastor
 		expiry = make(map[string]time.Time)
 	}
 	return &Datastore{
-		store:        store,
-		expiry:       expiry,
-		KeyChangesCh: make(chan struct{}),
-		mu:           &sync.RWMutex{},
+		store:      store,
+		expiry:     expiry,
+		watched:    make(map[string]*watchedKey),
+		mu:         &sync.RWMutex{},
+		keys:       newKeyTable(store),
+		expiryKeys: newKeyTable(expiry),
 	}
 }
 
+// Set stores value at key. Options are the expiry of SET: EX seconds,
+// PX milliseconds, EXAT or PXAT a unix timestamp, or KEEPTTL to keep the
+// current expiry of key. Strings holding an integer are stored as one.
 func (ds *Datastore) Set(key string, value any, options []string) error {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
-	ds.store[key] = NewData(value)
-	if len(options) > 0 {
-		err := ds.setOptions(key, options)
-		if err != nil {
-			delete(ds.store, key)
-			return err
+	expireAt, keepTTL, err := parseSetOptions(options)
+	if err != nil {
+		return err
+	}
+	if keepTTL {
+		if _, exists := ds.store[key]; exists && !ds.expireIfNeeded(key) {
+			expireAt = ds.expiry[key]
 		}
 	}
-
-	if info.Role == "master" {
-		ds.KeyChangesCh <- struct{}{}
+	if str, ok := value.(string); ok {
+		value = encodeString(str)
 	}
+
+	ds.setData(key, &Data{value: value, epoch: ds.epoch}, expireAt)
 	return nil
 }
 
-func (ds *Datastore) setOptions(key string, options []string) error {
-	availableOptions := []string{"PX", "EX"}
-	for i := 0; i < len(options); {
-		fmt.Println(i + 1)
-		fmt.Println(len(options))
-		if slices.Contains(availableOptions, strings.ToUpper(options[i])) && i+1 < len(options) {
-			err := ds.setDataExpiry(key, options[i+1], options[i] == "PX")
+// Stores data at key, replacing any value and expiry it had. A zero
+// expireAt means it doesn't expire.
+func (ds *Datastore) setData(key string, data *Data, expireAt time.Time) {
+	ds.preserve(key)
+	if _, exists := ds.store[key]; !exists {
+		ds.keys.add(key)
+	}
+	ds.store[key] = data
+	// A new value doesn't keep the expiry of the one it replaces
+	if expireAt.IsZero() {
+		ds.removeExpiry(key)
+	} else {
+		ds.setExpiry(key, expireAt)
+	}
+	ds.keyModified(key)
+}
+
+// Returns when the key expires according to the options, zero if it
+// doesn't, and whether it keeps its current expiry instead
+func parseSetOptions(options []string) (time.Time, bool, error) {
+	var (
+		expireAt time.Time
+		keepTTL  bool
+		given    bool
+	)
+	for i := 0; i < len(options); i++ {
+		option := strings.ToUpper(options[i])
+		switch {
+		case given:
+			// Only one of them can be given
+			return time.Time{}, false, custom_err.ErrorSyntax
+		case option == "KEEPTTL":
+			keepTTL = true
+		case slices.Contains([]string{"EX", "PX", "EXAT", "PXAT"}, option) && i+1 < len(options):
+			var err error
+			expireAt, err = ParseExpiry(option, options[i+1])
 			if err != nil {
-				return err
+				return time.Time{}, false, err
 			}
-			i += 2
-		} else {
-			return errors.New("syntax error")
+			i++
+		default:
+			return time.Time{}, false, custom_err.ErrorSyntax
 		}
+		given = true
 	}
 
-	return nil
+	return expireAt, keepTTL, nil
 }
 
-func (ds *Datastore) setDataExpiry(key, duration string, inMillisecond bool) error {
-	if _, exist := ds.expiry[key]; exist {
-		return errors.New("syntax error")
+// ParseExpiry converts the value of an EX, PX, EXAT or PXAT option to the
+// time it expires at
+func ParseExpiry(option, value string) (time.Time, error) {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, custom_err.ErrorNotInteger
+	}
+	if n <= 0 {
+		return time.Time{}, custom_err.ErrorExpireTime
 	}
 
-	var (
-		nanoseconds  int64
-		milliseconds int64
-		seconds      int64
-		err          error
-	)
-	if inMillisecond {
-		milliseconds, err = strconv.ParseInt(duration, 10, 64)
-		if err != nil { //|| milliseconds > int64(math.MaxInt64)/int64(time.Millisecond) {
-			fmt.Println(err)
-			return errors.New("value is not an integer or out of range")
+	// Everything is kept in milliseconds since the epoch
+	milliseconds := n
+	if option == "EX" || option == "EXAT" {
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, custom_err.ErrorExpireTime
 		}
-		nanoseconds = milliseconds * int64(time.Millisecond)
-	} else {
-		seconds, err = strconv.ParseInt(duration, 10, 64)
-		fmt.Println("duration time in seconds: " + strconv.Itoa(int(seconds)))
-		if err != nil || seconds > int64(math.MaxInt64)/int64(time.Second) {
-			return errors.New("value is not an integer or out of range")
+		milliseconds = n * 1000
+	}
+	if option == "EX" || option == "PX" {
+		now := time.Now().UnixMilli()
+		if milliseconds > math.MaxInt64-now {
+			return time.Time{}, custom_err.ErrorExpireTime
 		}
-		nanoseconds = seconds * int64(time.Second)
+		milliseconds += now
 	}
 
-	// data.hasExpiry = true
-	ds.expiry[key] = time.Now().UTC().Add(time.Duration(nanoseconds))
-	return nil
+	return time.UnixMilli(milliseconds).UTC(), nil
 }
 
 func (ds *Datastore) GetExpiry(key string) (time.Time, bool) {
@@ -125,19 +186,26 @@ func (ds *Datastore) IsExpired(key string) bool {
 }
 
 func (ds *Datastore) Get(key string) (value any, exists bool) {
-	ds.mu.RLock()
-	defer ds.mu.RUnlock()
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
 
 	data, exists := ds.store[key]
 	if !exists {
 		return nil, false
 	}
 
-	if ds.IsExpired(key) {
-		ds.Del(key)
+	if ds.expireIfNeeded(key) {
 		return nil, false
 	}
 
+	// The caller may modify the value in place, copy it first if a
+	// snapshot still refers to it
+	if !ds.readOnly && ds.snapshots > 0 && data.epoch != ds.epoch {
+		ds.preserve(key)
+		data = &Data{value: cloneValue(data.value), epoch: ds.epoch}
+		ds.store[key] = data
+	}
+
 	return data.value, true
 }
 
@@ -145,27 +213,38 @@ func (ds *Datastore) Del(key string) {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
-	if info.Role == "master" {
-		ds.KeyChangesCh <- struct{}{}
+	ds.del(key)
+}
+
+func (ds *Datastore) del(key string) {
+	if _, exists := ds.store[key]; exists {
+		ds.preserve(key)
+		ds.keys.remove(key)
 	}
 	delete(ds.store, key)
-	delete(ds.expiry, key)
+	ds.removeExpiry(key)
+	ds.keyModified(key)
 }
 
-func (ds *Datastore) DeepCopy() (map[string]*Data, map[string]time.Time) {
+// Touch notifies that the value stored at key was modified in place
+// (e.g. a list push) rather than replaced through Set.
+func (ds *Datastore) Touch(key string) {
 	ds.mu.Lock()
-	defer ds.mu.Unlock()
-
-	store := make(map[string]*Data, len(ds.store))
-	expiry := make(map[string]time.Time, len(ds.expiry))
-
-	for k, v := range ds.store {
-		store[k] = v
-	}
+	ds.keyModified(key)
+	ds.mu.Unlock()
+}
 
-	for k, v := range ds.expiry {
-		expiry[k] = v
-	}
+// Dirty returns the number of changes since the last save
+func (ds *Datastore) Dirty() int64 {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.dirty
+}
 
-	return store, expiry
+// ResetDirty forgets about the changes made so far, e.g. once the dataset
+// was loaded from disk
+func (ds *Datastore) ResetDirty() {
+	ds.mu.Lock()
+	ds.dirty = 0
+	ds.mu.Unlock()
 }
@@ -0,0 +1,175 @@
+package datastore
+
+import (
+	"time"
+
+	"github.com/Viet-ph/redis-go/internal/info"
+)
+
+// Keys sampled at a time by the active expire cycle, and the percentage of
+// them found expired under which sampling stops, like Redis with the
+// default active-expire-effort
+const (
+	activeExpireKeysPerLoop     = 20
+	activeExpireAcceptableStale = 10
+)
+
+// ExpireCycleResult tells what an active expire cycle went through
+type ExpireCycleResult struct {
+	Sampled int
+	Expired int
+
+	// Sampling was stopped because the time budget was spent
+	TimedOut bool
+}
+
+// ActiveExpireCycle deletes keys whose expiry passed without being
+// accessed, which lazy expiration alone would keep forever. Keys with an
+// expiry are sampled at random and sampling goes on while more than 10%
+// of a sample was expired, within timeBudget.
+func (ds *Datastore) ActiveExpireCycle(timeBudget time.Duration) ExpireCycleResult {
+	var result ExpireCycleResult
+	// Replicas wait for the master to delete their keys
+	if ds.replica {
+		return result
+	}
+
+	start := time.Now()
+	for {
+		sampled, expired := ds.expireSample(activeExpireKeysPerLoop)
+		result.Sampled += sampled
+		result.Expired += expired
+
+		// Not many expired keys left, not worth looking for more
+		if sampled == 0 || expired*100 <= sampled*activeExpireAcceptableStale {
+			return result
+		}
+		if time.Since(start) >= timeBudget {
+			result.TimedOut = true
+			return result
+		}
+	}
+}
+
+// Looks at up to count keys with an expiry picked at random and deletes
+// the expired ones.
+func (ds *Datastore) expireSample(count int) (sampled, expired int) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	now := time.Now().UTC()
+	// Deleting keys changes the table, they're only picked from it first
+	for _, key := range ds.expiryKeys.sample(count) {
+		sampled++
+		if ds.expiry[key].Before(now) {
+			ds.expire(key)
+			expired++
+		}
+	}
+	return sampled, expired
+}
+
+// Exists reports whether a value is stored at key, deleting it if its
+// expiry passed
+func (ds *Datastore) Exists(key string) bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if _, exists := ds.store[key]; !exists {
+		return false
+	}
+	return !ds.expireIfNeeded(key)
+}
+
+// SetExpiry makes key expire at expireAt. Returns false when the key
+// doesn't exist.
+func (ds *Datastore) SetExpiry(key string, expireAt time.Time) bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if _, exists := ds.store[key]; !exists {
+		return false
+	}
+	ds.preserve(key)
+	ds.setExpiry(key, expireAt.UTC())
+	ds.keyModified(key)
+	return true
+}
+
+// Persist removes the expiry of key, reporting whether it had one
+func (ds *Datastore) Persist(key string) bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if _, exists := ds.expiry[key]; !exists {
+		return false
+	}
+	ds.preserve(key)
+	ds.removeExpiry(key)
+	ds.keyModified(key)
+	return true
+}
+
+// Must be called with the lock held, like removeExpiry, so the table the
+// active expire cycle samples keeps the same keys as expiry
+func (ds *Datastore) setExpiry(key string, expireAt time.Time) {
+	if _, exists := ds.expiry[key]; !exists {
+		ds.expiryKeys.add(key)
+	}
+	ds.expiry[key] = expireAt
+}
+
+func (ds *Datastore) removeExpiry(key string) {
+	if _, exists := ds.expiry[key]; exists {
+		ds.expiryKeys.remove(key)
+		delete(ds.expiry, key)
+	}
+}
+
+// Reports whether key must be seen as missing because its expiry passed,
+// deleting it unless this is a replica
+func (ds *Datastore) expireIfNeeded(key string) bool {
+	if !ds.IsExpired(key) {
+		return false
+	}
+	if ds.replica {
+		return !ds.fromMaster
+	}
+
+	ds.expire(key)
+	return true
+}
+
+// Deletes a key whose expiry passed
+func (ds *Datastore) expire(key string) {
+	ds.del(key)
+	ds.expired = append(ds.expired, key)
+	info.ExpiredKeys++
+}
+
+// TakeExpired returns the keys expired since the last call, for the master
+// to propagate their deletion
+func (ds *Datastore) TakeExpired() []string {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	expired := ds.expired
+	ds.expired = nil
+	return expired
+}
+
+// SetReplica makes the datastore leave expired keys to be deleted by the
+// master
+func (ds *Datastore) SetReplica(replica bool) {
+	ds.mu.Lock()
+	ds.replica = replica
+	ds.mu.Unlock()
+}
+
+// SetFromMaster tells whether the commands executed next come from the
+// master, which still sees the keys that expired
+func (ds *Datastore) SetFromMaster(fromMaster bool) {
+	ds.mu.Lock()
+	ds.fromMaster = fromMaster
+	ds.mu.Unlock()
+}
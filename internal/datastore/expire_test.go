@@ -0,0 +1,178 @@
+package datastore
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+// Datastore with expired keys "expired:<n>" and keys expiring in an hour
+// "live:<n>"
+func newExpiringDatastore(expired, live int) *Datastore {
+	ds := NewDatastore(nil, nil)
+	now := time.Now().UTC()
+	for i := range expired {
+		key := "expired:" + strconv.Itoa(i)
+		ds.setData(key, &Data{value: "v"}, now.Add(-time.Second))
+	}
+	for i := range live {
+		key := "live:" + strconv.Itoa(i)
+		ds.setData(key, &Data{value: "v"}, now.Add(time.Hour))
+	}
+	return ds
+}
+
+func TestActiveExpireCycle(t *testing.T) {
+	ds := newExpiringDatastore(1000, 0)
+	ds.Set("persistent", "v", nil)
+
+	result := ds.ActiveExpireCycle(time.Second)
+	if result.Expired != 1000 || result.TimedOut {
+		t.Errorf("Expected the 1000 keys to expire without timing out, got %+v", result)
+	}
+	if len(ds.store) != 1 || len(ds.expiry) != 0 {
+		t.Errorf("Expected only the persistent key to be left, got %d keys and %d expiries", len(ds.store), len(ds.expiry))
+	}
+}
+
+func TestActiveExpireCycleKeepsLiveKeys(t *testing.T) {
+	ds := newExpiringDatastore(0, 100)
+
+	result := ds.ActiveExpireCycle(time.Second)
+	if result.Expired != 0 || result.Sampled != activeExpireKeysPerLoop {
+		t.Errorf("Expected a single sample without expired keys, got %+v", result)
+	}
+	if len(ds.store) != 100 {
+		t.Errorf("Expected 100 keys left, got %d", len(ds.store))
+	}
+}
+
+// Each loop samples other keys, so a few stale keys among many live ones
+// are all found over time
+func TestActiveExpireCycleSamplesAtRandom(t *testing.T) {
+	ds := newExpiringDatastore(0, 1000)
+	now := time.Now().UTC()
+	for i := range 10 {
+		ds.setData("expired:"+strconv.Itoa(i), &Data{value: "v"}, now.Add(-time.Second))
+	}
+
+	for range 2000 {
+		ds.ActiveExpireCycle(time.Second)
+	}
+	if len(ds.expiry) != 1000 || ds.expiryKeys.size != 1000 {
+		t.Errorf("Expected only the live keys to be left, got %d expiries and %d sampled keys", len(ds.expiry), ds.expiryKeys.size)
+	}
+}
+
+func TestKeyTableSample(t *testing.T) {
+	keys := make(map[string]bool)
+	for i := range 100 {
+		keys["k"+strconv.Itoa(i)] = true
+	}
+	table := newKeyTable(keys)
+
+	seen := make(map[string]bool)
+	for range 200 {
+		sample := table.sample(10)
+		if len(sample) != 10 {
+			t.Fatalf("Expected 10 keys, got %d", len(sample))
+		}
+		picked := make(map[string]bool)
+		for _, key := range sample {
+			if picked[key] || !keys[key] {
+				t.Fatalf("Expected distinct keys of the table, got %v", sample)
+			}
+			picked[key] = true
+			seen[key] = true
+		}
+	}
+	if len(seen) != len(keys) {
+		t.Errorf("Expected every key to be sampled at some point, got %d of %d", len(seen), len(keys))
+	}
+
+	if sample := newKeyTable[bool](nil).sample(10); len(sample) != 0 {
+		t.Errorf("Expected an empty sample of an empty table, got %v", sample)
+	}
+}
+
+func TestActiveExpireCycleTimeBudget(t *testing.T) {
+	ds := newExpiringDatastore(1000, 0)
+
+	result := ds.ActiveExpireCycle(0)
+	if !result.TimedOut || result.Expired != activeExpireKeysPerLoop {
+		t.Errorf("Expected the cycle to stop after a single sample, got %+v", result)
+	}
+}
+
+func TestSetExpiry(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+	expireAt := time.Now().Add(time.Hour)
+	if ds.SetExpiry("missing", expireAt) {
+		t.Errorf("Expected no expiry to be set on a missing key")
+	}
+
+	ds.Set("key", "v", nil)
+	if !ds.SetExpiry("key", expireAt) {
+		t.Fatalf("Expected expiry to be set")
+	}
+	if got, _ := ds.GetExpiry("key"); !got.Equal(expireAt) {
+		t.Errorf("Expected expiry %v but got %v", expireAt, got)
+	}
+
+	// A new value comes without the expiry of the previous one
+	ds.Set("key", "new", nil)
+	if _, hasExpiry := ds.GetExpiry("key"); hasExpiry {
+		t.Errorf("Expected SET to clear the expiry")
+	}
+
+	ds.Set("key", "v", []string{"EX", "100"})
+	if !ds.Persist("key") || ds.Persist("key") {
+		t.Errorf("Expected PERSIST to remove the expiry once")
+	}
+	if !ds.Exists("key") {
+		t.Errorf("Expected key to still exist")
+	}
+
+	ds.SetExpiry("key", time.Now().Add(-time.Second))
+	if ds.Exists("key") {
+		t.Errorf("Expected expired key not to exist")
+	}
+}
+
+func TestExpireOnReplica(t *testing.T) {
+	ds := newExpiringDatastore(100, 0)
+	ds.SetReplica(true)
+
+	if _, exists := ds.Get("expired:0"); exists {
+		t.Errorf("Expected expired key to be hidden from clients")
+	}
+	ds.SetFromMaster(true)
+	if _, exists := ds.Get("expired:0"); !exists {
+		t.Errorf("Expected expired key to be seen by the master")
+	}
+	ds.SetFromMaster(false)
+
+	if result := ds.ActiveExpireCycle(time.Second); result.Sampled != 0 {
+		t.Errorf("Expected replica not to sample keys, got %+v", result)
+	}
+	if len(ds.store) != 100 || len(ds.TakeExpired()) != 0 {
+		t.Errorf("Expected replica to keep its expired keys")
+	}
+}
+
+func TestTakeExpired(t *testing.T) {
+	ds := newExpiringDatastore(1, 0)
+	ds.Set("key", "v", []string{"PX", "1"})
+	time.Sleep(2 * time.Millisecond)
+
+	ds.Get("key")
+	ds.ActiveExpireCycle(time.Second)
+
+	expired := ds.TakeExpired()
+	if len(expired) != 2 || expired[0] != "key" || expired[1] != "expired:0" {
+		t.Errorf("Expected the lazily then actively expired keys, got %v", expired)
+	}
+	if len(ds.TakeExpired()) != 0 {
+		t.Errorf("Expected expired keys to be taken once")
+	}
+}
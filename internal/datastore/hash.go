@@ -0,0 +1,104 @@
+package datastore
+
+import (
+	"maps"
+	"math/rand/v2"
+	"slices"
+)
+
+// Hash maps fields to string values.
+type Hash struct {
+	fields map[string]string
+	// Fields by bucket, for HSCAN
+	keys *keyTable
+}
+
+func NewHash() *Hash {
+	return &Hash{
+		fields: make(map[string]string),
+		keys:   newKeyTable[string](nil),
+	}
+}
+
+func (hash *Hash) Len() int {
+	return len(hash.fields)
+}
+
+func (hash *Hash) clone() *Hash {
+	return &Hash{fields: maps.Clone(hash.fields), keys: newKeyTable(hash.fields)}
+}
+
+func (hash *Hash) Get(field string) (string, bool) {
+	value, exists := hash.fields[field]
+	return value, exists
+}
+
+// Set stores value at field and returns true if the field is new.
+func (hash *Hash) Set(field, value string) bool {
+	_, exists := hash.fields[field]
+	hash.fields[field] = value
+	if !exists {
+		hash.keys.add(field)
+	}
+	return !exists
+}
+
+// Delete removes fields and returns how many of them were present.
+func (hash *Hash) Delete(fields ...string) int {
+	deleted := 0
+	for _, field := range fields {
+		if _, exists := hash.fields[field]; exists {
+			delete(hash.fields, field)
+			hash.keys.remove(field)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Fields returns all field names in no particular order.
+func (hash *Hash) Fields() []string {
+	fields := make([]string, 0, len(hash.fields))
+	for field := range hash.fields {
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// SortedFields returns all field names in lexicographical order, giving
+// callers walking the hash in several steps a stable order.
+func (hash *Hash) SortedFields() []string {
+	fields := hash.Fields()
+	slices.Sort(fields)
+	return fields
+}
+
+// Scan returns the field names of about count buckets starting at cursor,
+// along with the cursor to continue from, 0 once all fields were
+// returned. Fields present during the whole walk are returned at least
+// once, whatever is added or deleted in between.
+func (hash *Hash) Scan(cursor uint64, count int) ([]string, uint64) {
+	return hash.keys.scan(cursor, count)
+}
+
+// RandomFields picks count field names. When unique is true the same field
+// is never returned twice, so at most Len() fields are returned.
+func (hash *Hash) RandomFields(count int, unique bool) []string {
+	fields := hash.Fields()
+	if len(fields) == 0 || count <= 0 {
+		return []string{}
+	}
+
+	if !unique {
+		picked := make([]string, count)
+		for i := range picked {
+			picked[i] = fields[rand.IntN(len(fields))]
+		}
+		return picked
+	}
+
+	rand.Shuffle(len(fields), func(i, j int) {
+		fields[i], fields[j] = fields[j], fields[i]
+	})
+	return fields[:min(count, len(fields))]
+}
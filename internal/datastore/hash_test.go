@@ -0,0 +1,84 @@
+package datastore
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Fields present during a whole HSCAN must be returned even though others
+// are set and deleted in between
+func TestHashScanCoversFieldsAcrossResize(t *testing.T) {
+	hash := NewHash()
+	for i := range 50 {
+		hash.Set("stable:"+strconv.Itoa(i), "v")
+		hash.Set("deleted:"+strconv.Itoa(i), "v")
+	}
+
+	seen := make(map[string]int)
+	var cursor uint64
+	for round := 0; ; round++ {
+		var fields []string
+		fields, cursor = hash.Scan(cursor, 3)
+		for _, field := range fields {
+			seen[field]++
+		}
+		if cursor == 0 {
+			break
+		}
+
+		switch {
+		case round < 5:
+			for i := range 50 {
+				hash.Set("added:"+strconv.Itoa(round)+":"+strconv.Itoa(i), "v")
+			}
+		case round < 10:
+			for i := range 50 {
+				hash.Delete("added:"+strconv.Itoa(round-5)+":"+strconv.Itoa(i), "deleted:"+strconv.Itoa(i))
+			}
+		}
+	}
+
+	for i := range 50 {
+		if field := "stable:" + strconv.Itoa(i); seen[field] == 0 {
+			t.Errorf("Expected %s to be returned by HSCAN", field)
+		}
+	}
+	if hash.keys.size != hash.Len() {
+		t.Errorf("Expected the field table to hold the %d fields, got %d", hash.Len(), hash.keys.size)
+	}
+}
+
+func TestHashScanUnchanged(t *testing.T) {
+	hash := NewHash()
+	for i := range 20 {
+		hash.Set("f"+strconv.Itoa(i), "v")
+	}
+	// Overwriting a field doesn't add it twice
+	hash.Set("f0", "w")
+
+	// Without changes in between, every field is returned exactly once
+	seen := make(map[string]int)
+	var cursor uint64
+	for {
+		var fields []string
+		fields, cursor = hash.Scan(cursor, 1)
+		for _, field := range fields {
+			seen[field]++
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	for i := range 20 {
+		if field := "f" + strconv.Itoa(i); seen[field] != 1 {
+			t.Errorf("Expected %s to be returned once, got %d times", field, seen[field])
+		}
+	}
+
+	// The clone has its own table
+	clone := hash.clone()
+	clone.Delete("f1")
+	if fields, _ := hash.Scan(0, 100); len(fields) != 20 {
+		t.Errorf("Expected deleting from the clone to leave the original alone, got %d fields", len(fields))
+	}
+}
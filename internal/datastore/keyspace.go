@@ -0,0 +1,149 @@
+package datastore
+
+import (
+	"time"
+
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+)
+
+// Name TYPE gives to the type of value
+func typeName(value any) string {
+	switch value.(type) {
+	case string, int64:
+		return "string"
+	case *List:
+		return "list"
+	case *Hash:
+		return "hash"
+	case *Set:
+		return "set"
+	case *SortedSet:
+		return "zset"
+	case *Stream:
+		return "stream"
+	}
+	return "none"
+}
+
+// Type returns the name of the type of the value stored at key, "none"
+// if it doesn't exist
+func (ds *Datastore) Type(key string) string {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	data, exists := ds.store[key]
+	if !exists || ds.expireIfNeeded(key) {
+		return "none"
+	}
+	return typeName(data.value)
+}
+
+// Keys returns the keys for which match returns true
+func (ds *Datastore) Keys(match func(key string) bool) []string {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	keys := []string{}
+	for key := range ds.store {
+		if match(key) && !ds.expireIfNeeded(key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// RandomKey returns a key picked at random, false when the store is empty
+func (ds *Datastore) RandomKey() (string, bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	// Map iteration starts at a random position
+	for key := range ds.store {
+		if !ds.expireIfNeeded(key) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Size returns the number of keys, including the expired ones which
+// weren't deleted yet
+func (ds *Datastore) Size() int {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return len(ds.store)
+}
+
+// Rename moves the value and the expiry of src to dst, replacing what dst
+// held unless nx is set. Returns false when nothing was moved because dst
+// exists with nx, and custom_err.ErrorNoSuchKey when src doesn't exist.
+func (ds *Datastore) Rename(src, dst string, nx bool) (bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	data, exists := ds.store[src]
+	if !exists || ds.expireIfNeeded(src) {
+		return false, custom_err.ErrorNoSuchKey
+	}
+	if _, exists := ds.store[dst]; exists && !ds.expireIfNeeded(dst) {
+		if nx {
+			return false, nil
+		}
+	}
+	if src == dst {
+		return true, nil
+	}
+
+	expireAt := ds.expiry[src]
+	ds.del(src)
+	ds.setData(dst, data, expireAt)
+	return true, nil
+}
+
+// Copy stores a copy of the value and the expiry of src at dst. Returns
+// false when src doesn't exist, or dst does and replace isn't set.
+func (ds *Datastore) Copy(src, dst string, replace bool) bool {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	data, exists := ds.store[src]
+	if !exists || ds.expireIfNeeded(src) {
+		return false
+	}
+	if _, exists := ds.store[dst]; exists && !ds.expireIfNeeded(dst) && !replace {
+		return false
+	}
+
+	ds.setData(dst, &Data{value: cloneValue(data.value), epoch: ds.epoch}, ds.expiry[src])
+	return true
+}
+
+// Flush deletes every key. A synchronous flush clears the maps of the
+// store in place, while an asynchronous one swaps them for empty maps so
+// the old ones are freed by the garbage collector, in the background,
+// without the caller walking over them.
+func (ds *Datastore) Flush(async bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	// Only watched keys need to know they were deleted, the rest of them
+	// just count as changes
+	for key, watched := range ds.watched {
+		if _, exists := ds.store[key]; exists {
+			watched.version++
+		}
+	}
+	ds.dirty += int64(len(ds.store))
+
+	// Snapshots still walking the store keep the old maps
+	if async || len(ds.walking) > 0 {
+		ds.detachSnapshots()
+		ds.store = make(map[string]*Data)
+		ds.expiry = make(map[string]time.Time)
+	} else {
+		clear(ds.store)
+		clear(ds.expiry)
+	}
+	ds.keys = newKeyTable[*Data](nil)
+	ds.expiryKeys = newKeyTable[time.Time](nil)
+}
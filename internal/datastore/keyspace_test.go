@@ -0,0 +1,138 @@
+package datastore
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Keys stored during a whole SCAN must be returned even though others are
+// added and deleted in between, growing and shrinking the key table
+func TestScanCoversKeysAcrossResize(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+	for i := range 100 {
+		ds.Set("stable:"+strconv.Itoa(i), "v", nil)
+		ds.Set("deleted:"+strconv.Itoa(i), "v", nil)
+	}
+
+	seen := make(map[string]bool)
+	var cursor uint64
+	for round := 0; ; round++ {
+		var keys []string
+		keys, cursor = ds.Scan(cursor, 5)
+		for _, key := range keys {
+			seen[key] = true
+		}
+		if cursor == 0 {
+			break
+		}
+
+		switch {
+		case round < 10:
+			// Grow the table
+			for i := range 100 {
+				ds.Set("added:"+strconv.Itoa(round)+":"+strconv.Itoa(i), "v", nil)
+			}
+		case round < 20:
+			// Shrink it again
+			for i := range 10 {
+				ds.Del("deleted:" + strconv.Itoa((round-10)*10+i))
+				for j := range 100 {
+					ds.Del("added:" + strconv.Itoa(round-10) + ":" + strconv.Itoa(j))
+				}
+			}
+		}
+	}
+
+	for i := range 100 {
+		if key := "stable:" + strconv.Itoa(i); !seen[key] {
+			t.Errorf("Expected %s to be returned by SCAN", key)
+		}
+	}
+	if ds.keys.size != len(ds.store) {
+		t.Errorf("Expected the key table to hold the %d keys, got %d", len(ds.store), ds.keys.size)
+	}
+}
+
+func TestScanEmpty(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+
+	keys, cursor := ds.Scan(0, 10)
+	if len(keys) != 0 || cursor != 0 {
+		t.Errorf("Expected nothing to scan, got %v and cursor %d", keys, cursor)
+	}
+}
+
+func TestRenameKeepsExpiry(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+	ds.Set("src", "v", []string{"EX", "100"})
+	ds.Set("dst", "old", nil)
+
+	renamed, err := ds.Rename("src", "dst", true)
+	if err != nil || renamed {
+		t.Fatalf("Expected RENAMENX onto an existing key to do nothing, got %v, %v", renamed, err)
+	}
+
+	renamed, err = ds.Rename("src", "dst", false)
+	if err != nil || !renamed {
+		t.Fatalf("Expected RENAME to succeed, got %v, %v", renamed, err)
+	}
+	if ds.Exists("src") {
+		t.Error("Expected src to be gone")
+	}
+	if value, _ := ds.Get("dst"); value != "v" {
+		t.Errorf("Expected dst to hold v, got %v", value)
+	}
+	if _, hasExpiry := ds.GetExpiry("dst"); !hasExpiry {
+		t.Error("Expected dst to keep the expiry of src")
+	}
+
+	if _, err := ds.Rename("missing", "dst", false); err == nil {
+		t.Error("Expected renaming a missing key to fail")
+	}
+}
+
+func TestCopyIsIndependent(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+	list := NewList()
+	list.RPush("a")
+	ds.Set("src", list, nil)
+
+	if !ds.Copy("src", "dst", false) {
+		t.Fatal("Expected the copy to succeed")
+	}
+	list.RPush("b")
+
+	value, _ := ds.Get("dst")
+	if length := value.(*List).Len(); length != 1 {
+		t.Errorf("Expected the copy to keep a single element, got %d", length)
+	}
+	if ds.Copy("src", "dst", false) {
+		t.Error("Expected copying onto an existing key without REPLACE to fail")
+	}
+}
+
+func TestFlush(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		ds := NewDatastore(nil, nil)
+		ds.Set("watched", "v", nil)
+		ds.Set("volatile", "v", []string{"EX", "100"})
+		version := ds.Watch("watched")
+		untouched := ds.Watch("missing")
+
+		ds.Flush(async)
+		if ds.Size() != 0 || len(ds.expiry) != 0 || ds.keys.size != 0 {
+			t.Errorf("Expected no keys left with async %v", async)
+		}
+		if ds.KeyVersion("watched") == version {
+			t.Errorf("Expected the watched key to be touched with async %v", async)
+		}
+		if ds.KeyVersion("missing") != untouched {
+			t.Errorf("Expected the missing watched key not to be touched with async %v", async)
+		}
+
+		ds.Set("new", "v", nil)
+		if keys, _ := ds.Scan(0, 10); len(keys) != 1 {
+			t.Errorf("Expected the key stored after the flush to be scanned with async %v, got %v", async, keys)
+		}
+	}
+}
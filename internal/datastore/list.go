@@ -0,0 +1,234 @@
+package datastore
+
+import "slices"
+
+const minListCapacity = 8
+
+// List is a double-ended queue of strings backed by a ring buffer, so pushes
+// and pops on both ends are O(1) and indexing does not need to walk nodes.
+type List struct {
+	buf  []string
+	head int
+	size int
+}
+
+func NewList() *List {
+	return &List{
+		buf: make([]string, minListCapacity),
+	}
+}
+
+func (list *List) Len() int {
+	return list.size
+}
+
+func (list *List) clone() *List {
+	return &List{
+		buf:  slices.Clone(list.buf),
+		head: list.head,
+		size: list.size,
+	}
+}
+
+// Maps a logical position (0 = head) to an index in the ring buffer
+func (list *List) at(i int) int {
+	return (list.head + i) % len(list.buf)
+}
+
+func (list *List) grow() {
+	newBuf := make([]string, max(len(list.buf)*2, minListCapacity))
+	for i := 0; i < list.size; i++ {
+		newBuf[i] = list.buf[list.at(i)]
+	}
+	list.buf = newBuf
+	list.head = 0
+}
+
+// LPush inserts values at the head one after another, so the last value
+// given ends up being the first element. Returns the new length.
+func (list *List) LPush(values ...string) int {
+	for _, value := range values {
+		if list.size == len(list.buf) {
+			list.grow()
+		}
+		list.head = (list.head - 1 + len(list.buf)) % len(list.buf)
+		list.buf[list.head] = value
+		list.size++
+	}
+	return list.size
+}
+
+// RPush appends values at the tail and returns the new length.
+func (list *List) RPush(values ...string) int {
+	for _, value := range values {
+		if list.size == len(list.buf) {
+			list.grow()
+		}
+		list.buf[list.at(list.size)] = value
+		list.size++
+	}
+	return list.size
+}
+
+func (list *List) LPop() (string, bool) {
+	if list.size == 0 {
+		return "", false
+	}
+	value := list.buf[list.head]
+	list.buf[list.head] = ""
+	list.head = (list.head + 1) % len(list.buf)
+	list.size--
+	return value, true
+}
+
+func (list *List) RPop() (string, bool) {
+	if list.size == 0 {
+		return "", false
+	}
+	idx := list.at(list.size - 1)
+	value := list.buf[idx]
+	list.buf[idx] = ""
+	list.size--
+	return value, true
+}
+
+// Converts a possibly negative index into an offset from head.
+// Returns false if the index is out of range.
+func (list *List) normalizeIndex(index int) (int, bool) {
+	if index < 0 {
+		index += list.size
+	}
+	if index < 0 || index >= list.size {
+		return 0, false
+	}
+	return index, true
+}
+
+func (list *List) Index(index int) (string, bool) {
+	i, ok := list.normalizeIndex(index)
+	if !ok {
+		return "", false
+	}
+	return list.buf[list.at(i)], true
+}
+
+func (list *List) Set(index int, value string) bool {
+	i, ok := list.normalizeIndex(index)
+	if !ok {
+		return false
+	}
+	list.buf[list.at(i)] = value
+	return true
+}
+
+// Converts start and stop (inclusive, possibly negative) the same way Redis
+// does for LRANGE and LTRIM. Returns false when the range is empty.
+func (list *List) normalizeRange(start, stop int) (int, int, bool) {
+	if start < 0 {
+		start += list.size
+	}
+	if stop < 0 {
+		stop += list.size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= list.size {
+		stop = list.size - 1
+	}
+	if start > stop || start >= list.size {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
+
+// Range returns elements between start and stop, both inclusive.
+func (list *List) Range(start, stop int) []string {
+	start, stop, ok := list.normalizeRange(start, stop)
+	if !ok {
+		return []string{}
+	}
+
+	values := make([]string, 0, stop-start+1)
+	for i := start; i <= stop; i++ {
+		values = append(values, list.buf[list.at(i)])
+	}
+	return values
+}
+
+// Values returns a copy of all elements from head to tail.
+func (list *List) Values() []string {
+	return list.Range(0, -1)
+}
+
+// Replaces the whole content of the list with the given values
+func (list *List) reset(values []string) {
+	list.buf = make([]string, max(len(values), minListCapacity))
+	copy(list.buf, values)
+	list.head = 0
+	list.size = len(values)
+}
+
+// Trim keeps only the elements between start and stop, both inclusive.
+func (list *List) Trim(start, stop int) {
+	start, stop, ok := list.normalizeRange(start, stop)
+	if !ok {
+		list.reset(nil)
+		return
+	}
+	list.reset(list.Range(start, stop))
+}
+
+// Rem removes elements equal to value. When count > 0 it removes at most
+// count elements from head to tail, when count < 0 from tail to head and
+// when count is 0 all of them. Returns the number of removed elements.
+func (list *List) Rem(count int, value string) int {
+	values := list.Values()
+	removed := 0
+	kept := make([]string, 0, len(values))
+
+	if count >= 0 {
+		for _, v := range values {
+			if v == value && (count == 0 || removed < count) {
+				removed++
+				continue
+			}
+			kept = append(kept, v)
+		}
+	} else {
+		for i := len(values) - 1; i >= 0; i-- {
+			if values[i] == value && removed < -count {
+				removed++
+				continue
+			}
+			kept = append(kept, values[i])
+		}
+		// Elements were collected in reverse order
+		for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+			kept[i], kept[j] = kept[j], kept[i]
+		}
+	}
+
+	if removed > 0 {
+		list.reset(kept)
+	}
+	return removed
+}
+
+// Insert puts value right before or after the first occurrence of pivot.
+// Returns the new length, or -1 when pivot is not found.
+func (list *List) Insert(pivot, value string, before bool) int {
+	values := list.Values()
+	for i, v := range values {
+		if v != pivot {
+			continue
+		}
+		if !before {
+			i++
+		}
+		values = append(values[:i], append([]string{value}, values[i:]...)...)
+		list.reset(values)
+		return list.size
+	}
+	return -1
+}
@@ -0,0 +1,86 @@
+package datastore
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestListPushPop(t *testing.T) {
+	list := NewList()
+
+	// Push enough elements on both ends to force the ring buffer to grow
+	for i := 0; i < 10; i++ {
+		list.RPush("r")
+		list.LPush("l")
+	}
+	if list.Len() != 20 {
+		t.Fatalf("Expected length 20 but got %d", list.Len())
+	}
+
+	for i := 0; i < 10; i++ {
+		if value, _ := list.LPop(); value != "l" {
+			t.Errorf("Expected %q from LPop but got %q", "l", value)
+		}
+		if value, _ := list.RPop(); value != "r" {
+			t.Errorf("Expected %q from RPop but got %q", "r", value)
+		}
+	}
+
+	if _, ok := list.LPop(); ok {
+		t.Errorf("Expected LPop on empty list to fail")
+	}
+}
+
+func TestListRangeAndTrim(t *testing.T) {
+	tests := []struct {
+		start, stop int
+		expected    []string
+	}{
+		{start: 0, stop: -1, expected: []string{"a", "b", "c", "d", "e"}},
+		{start: 1, stop: 2, expected: []string{"b", "c"}},
+		{start: -2, stop: -1, expected: []string{"d", "e"}},
+		{start: -100, stop: 100, expected: []string{"a", "b", "c", "d", "e"}},
+		{start: 3, stop: 1, expected: []string{}},
+		{start: 5, stop: 10, expected: []string{}},
+	}
+
+	for _, tc := range tests {
+		list := NewList()
+		list.RPush("a", "b", "c", "d", "e")
+
+		result := list.Range(tc.start, tc.stop)
+		if !slices.Equal(result, tc.expected) {
+			t.Errorf("Range(%d, %d): expected %v but got %v", tc.start, tc.stop, tc.expected, result)
+		}
+
+		list.Trim(tc.start, tc.stop)
+		if !slices.Equal(list.Values(), tc.expected) {
+			t.Errorf("Trim(%d, %d): expected %v but got %v", tc.start, tc.stop, tc.expected, list.Values())
+		}
+	}
+}
+
+func TestListRem(t *testing.T) {
+	tests := []struct {
+		count    int
+		removed  int
+		expected []string
+	}{
+		{count: 0, removed: 3, expected: []string{"b", "c"}},
+		{count: 2, removed: 2, expected: []string{"b", "c", "a"}},
+		{count: -2, removed: 2, expected: []string{"a", "b", "c"}},
+	}
+
+	for _, tc := range tests {
+		list := NewList()
+		list.RPush("a", "b", "a", "c", "a")
+
+		removed := list.Rem(tc.count, "a")
+		if removed != tc.removed {
+			t.Errorf("Rem(%d): expected %d removed but got %d", tc.count, tc.removed, removed)
+		}
+		if !slices.Equal(list.Values(), tc.expected) {
+			t.Errorf("Rem(%d): expected %v but got %v", tc.count, tc.expected, list.Values())
+		}
+	}
+}
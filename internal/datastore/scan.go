@@ -0,0 +1,155 @@
+package datastore
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+)
+
+// Smallest number of buckets of the key table
+const keyTableMinBuckets = 4
+
+// Keys of the store, or fields of a hash, spread over a power of two
+// number of buckets by hash, which SCAN and HSCAN walk with a cursor the
+// way Redis walks its dict. Unlike Go maps, the order of the buckets
+// doesn't change unless the table is resized, and resizing only splits or
+// merges buckets.
+type keyTable struct {
+	seed    maphash.Seed
+	buckets [][]string
+	size    int
+	// Number of walks which must not see the table shrink, as it makes
+	// them return keys twice
+	pauseShrink int
+}
+
+func newKeyTable[V any](keys map[string]V) *keyTable {
+	table := &keyTable{
+		seed:    maphash.MakeSeed(),
+		buckets: make([][]string, keyTableMinBuckets),
+	}
+	for key := range keys {
+		table.add(key)
+	}
+	return table
+}
+
+func (table *keyTable) bucket(key string) uint64 {
+	return maphash.String(table.seed, key) & uint64(len(table.buckets)-1)
+}
+
+// Must only be called for keys not in the table yet
+func (table *keyTable) add(key string) {
+	i := table.bucket(key)
+	table.buckets[i] = append(table.buckets[i], key)
+	table.size++
+	if table.size > len(table.buckets) {
+		table.resize(len(table.buckets) * 2)
+	}
+}
+
+func (table *keyTable) remove(key string) {
+	i := table.bucket(key)
+	index := slices.Index(table.buckets[i], key)
+	if index < 0 {
+		return
+	}
+	table.buckets[i] = slices.Delete(table.buckets[i], index, index+1)
+	table.size--
+	table.shrinkIfNeeded()
+}
+
+func (table *keyTable) shrinkIfNeeded() {
+	if table.pauseShrink > 0 {
+		return
+	}
+	buckets := len(table.buckets)
+	for buckets > keyTableMinBuckets && table.size*8 < buckets {
+		buckets /= 2
+	}
+	if buckets != len(table.buckets) {
+		table.resize(buckets)
+	}
+}
+
+func (table *keyTable) resize(buckets int) {
+	old := table.buckets
+	table.buckets = make([][]string, buckets)
+	for _, bucket := range old {
+		for _, key := range bucket {
+			i := table.bucket(key)
+			table.buckets[i] = append(table.buckets[i], key)
+		}
+	}
+}
+
+// Calls visit for the keys of the bucket at cursor and returns the cursor
+// of the next bucket, 0 once all were visited.
+//
+// Cursors are incremented from their most significant bit down, so that
+// the buckets a bucket is split into when the table grows, or the one it
+// is merged into when it shrinks, are all visited after it. A walk thus
+// returns every key stored during the whole walk, in spite of resizes,
+// though keys may be returned more than once if the table shrinks.
+func (table *keyTable) scanBucket(cursor uint64, visit func(key string)) uint64 {
+	mask := uint64(len(table.buckets) - 1)
+	for _, key := range table.buckets[cursor&mask] {
+		visit(key)
+	}
+
+	// Set the bits outside of the mask so the increment of the reversed
+	// cursor carries over them
+	cursor |= ^mask
+	cursor = bits.Reverse64(cursor)
+	cursor++
+	return bits.Reverse64(cursor)
+}
+
+// Returns up to count distinct keys, each one from a bucket picked at
+// random, like dictGetRandomKey in Redis. Fewer are returned when the table
+// doesn't hold that many or too many of the buckets picked are empty.
+func (table *keyTable) sample(count int) []string {
+	keys := make([]string, 0, count)
+	picked := make(map[string]struct{}, count)
+	for tries := count * 10; tries > 0 && len(keys) < min(count, table.size); tries-- {
+		bucket := table.buckets[rand.IntN(len(table.buckets))]
+		if len(bucket) == 0 {
+			continue
+		}
+		key := bucket[rand.IntN(len(bucket))]
+		if _, duplicate := picked[key]; duplicate {
+			continue
+		}
+		picked[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Returns the keys of about count buckets starting at cursor, or of more
+// if that's not count keys yet, along with the cursor to continue from, 0
+// once all keys were returned.
+func (table *keyTable) scan(cursor uint64, count int) ([]string, uint64) {
+	keys := make([]string, 0, count)
+	visit := func(key string) {
+		keys = append(keys, key)
+	}
+
+	// Don't walk over too many empty buckets at once
+	for visits := count * 10; ; visits-- {
+		cursor = table.scanBucket(cursor, visit)
+		if cursor == 0 || len(keys) >= count || visits <= 1 {
+			return keys, cursor
+		}
+	}
+}
+
+// Scan returns the keys of about count buckets starting at cursor, along
+// with the cursor to continue from, 0 once all keys were returned. Expired
+// keys are returned as well.
+func (ds *Datastore) Scan(cursor uint64, count int) ([]string, uint64) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+	return ds.keys.scan(cursor, count)
+}
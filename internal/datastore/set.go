@@ -0,0 +1,152 @@
+package datastore
+
+import (
+	"maps"
+	"math/rand/v2"
+)
+
+// Set is an unordered collection of unique strings.
+type Set struct {
+	members map[string]struct{}
+}
+
+func NewSet(members ...string) *Set {
+	set := &Set{
+		members: make(map[string]struct{}, len(members)),
+	}
+	set.Add(members...)
+	return set
+}
+
+func (set *Set) Len() int {
+	return len(set.members)
+}
+
+func (set *Set) clone() *Set {
+	return &Set{members: maps.Clone(set.members)}
+}
+
+// Add inserts members and returns how many of them were not already present.
+func (set *Set) Add(members ...string) int {
+	added := 0
+	for _, member := range members {
+		if _, exists := set.members[member]; !exists {
+			set.members[member] = struct{}{}
+			added++
+		}
+	}
+	return added
+}
+
+// Remove deletes members and returns how many of them were present.
+func (set *Set) Remove(members ...string) int {
+	removed := 0
+	for _, member := range members {
+		if _, exists := set.members[member]; exists {
+			delete(set.members, member)
+			removed++
+		}
+	}
+	return removed
+}
+
+func (set *Set) Contains(member string) bool {
+	_, exists := set.members[member]
+	return exists
+}
+
+// Members returns all members in no particular order.
+func (set *Set) Members() []string {
+	members := make([]string, 0, len(set.members))
+	for member := range set.members {
+		members = append(members, member)
+	}
+	return members
+}
+
+// RandomMembers picks count members. When unique is true the same member is
+// never returned twice, so at most Len() members are returned.
+func (set *Set) RandomMembers(count int, unique bool) []string {
+	members := set.Members()
+	if len(members) == 0 || count <= 0 {
+		return []string{}
+	}
+
+	if !unique {
+		picked := make([]string, count)
+		for i := range picked {
+			picked[i] = members[rand.IntN(len(members))]
+		}
+		return picked
+	}
+
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	return members[:min(count, len(members))]
+}
+
+// Intersect returns a new set with the members found in every given set.
+// A nil set is treated as empty.
+func Intersect(sets ...*Set) *Set {
+	result := NewSet()
+	if len(sets) == 0 {
+		return result
+	}
+
+	// Walk the smallest set to do as little lookups as possible
+	smallest := sets[0]
+	for _, set := range sets {
+		if set == nil {
+			return result
+		}
+		if set.Len() < smallest.Len() {
+			smallest = set
+		}
+	}
+
+outer:
+	for member := range smallest.members {
+		for _, set := range sets {
+			if !set.Contains(member) {
+				continue outer
+			}
+		}
+		result.members[member] = struct{}{}
+	}
+	return result
+}
+
+// Union returns a new set with the members of all given sets.
+func Union(sets ...*Set) *Set {
+	result := NewSet()
+	for _, set := range sets {
+		if set == nil {
+			continue
+		}
+		for member := range set.members {
+			result.members[member] = struct{}{}
+		}
+	}
+	return result
+}
+
+// Diff returns a new set with the members of the first set that are not
+// present in any of the others.
+func Diff(first *Set, others ...*Set) *Set {
+	result := NewSet()
+	if first == nil {
+		return result
+	}
+
+outer:
+	for member := range first.members {
+		for _, set := range others {
+			if set != nil && set.Contains(member) {
+				continue outer
+			}
+		}
+		result.members[member] = struct{}{}
+	}
+	return result
+}
@@ -0,0 +1,110 @@
+package datastore
+
+import (
+	"slices"
+	"testing"
+)
+
+func sortedMembers(set *Set) []string {
+	members := set.Members()
+	slices.Sort(members)
+	return members
+}
+
+func TestSetAddRemove(t *testing.T) {
+	set := NewSet("a", "b", "a")
+	if set.Len() != 2 {
+		t.Fatalf("Expected duplicates to be added once, got %d members", set.Len())
+	}
+
+	if added := set.Add("b", "c", "d", "c"); added != 2 {
+		t.Errorf("Expected 2 new members but got %d", added)
+	}
+	if removed := set.Remove("a", "missing", "a"); removed != 1 {
+		t.Errorf("Expected 1 removed member but got %d", removed)
+	}
+	if set.Contains("a") || !set.Contains("b") {
+		t.Error("Expected a to be removed and b to be kept")
+	}
+	if members := sortedMembers(set); !slices.Equal(members, []string{"b", "c", "d"}) {
+		t.Errorf("Expected [b c d] but got %v", members)
+	}
+
+	// A clone doesn't share its members with the original
+	clone := set.clone()
+	clone.Add("e")
+	if set.Contains("e") {
+		t.Error("Expected the original set not to see members added to its clone")
+	}
+}
+
+func TestSetRandomMembers(t *testing.T) {
+	set := NewSet("a", "b", "c")
+
+	tests := []struct {
+		count    int
+		unique   bool
+		expected int
+	}{
+		{count: 2, unique: true, expected: 2},
+		{count: 10, unique: true, expected: 3},
+		{count: 10, unique: false, expected: 10},
+		{count: 0, unique: true, expected: 0},
+	}
+
+	for _, tc := range tests {
+		picked := set.RandomMembers(tc.count, tc.unique)
+		if len(picked) != tc.expected {
+			t.Errorf("RandomMembers(%d, %v): expected %d members but got %d", tc.count, tc.unique, tc.expected, len(picked))
+		}
+		for _, member := range picked {
+			if !set.Contains(member) {
+				t.Errorf("RandomMembers(%d, %v): picked %q which isn't a member", tc.count, tc.unique, member)
+			}
+		}
+		if tc.unique {
+			slices.Sort(picked)
+			if len(slices.Compact(picked)) != len(picked) {
+				t.Errorf("RandomMembers(%d, %v): expected unique members but got %v", tc.count, tc.unique, picked)
+			}
+		}
+	}
+
+	if picked := NewSet().RandomMembers(5, false); len(picked) != 0 {
+		t.Errorf("Expected no members from an empty set but got %v", picked)
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	abc := NewSet("a", "b", "c")
+	bcd := NewSet("b", "c", "d")
+	cde := NewSet("c", "d", "e")
+
+	// nil sets stand for missing keys
+	tests := []struct {
+		name     string
+		result   *Set
+		expected []string
+	}{
+		{name: "Intersect", result: Intersect(abc, bcd, cde), expected: []string{"c"}},
+		{name: "Intersect single", result: Intersect(abc), expected: []string{"a", "b", "c"}},
+		{name: "Intersect with missing", result: Intersect(abc, nil), expected: []string{}},
+		{name: "Union", result: Union(abc, cde), expected: []string{"a", "b", "c", "d", "e"}},
+		{name: "Union with missing", result: Union(nil, bcd, nil), expected: []string{"b", "c", "d"}},
+		{name: "Diff", result: Diff(abc, bcd), expected: []string{"a"}},
+		{name: "Diff with missing", result: Diff(abc, nil, cde), expected: []string{"a", "b"}},
+		{name: "Diff of missing", result: Diff(nil, abc), expected: []string{}},
+	}
+
+	for _, tc := range tests {
+		if members := sortedMembers(tc.result); !slices.Equal(members, tc.expected) {
+			t.Errorf("%s: expected %v but got %v", tc.name, tc.expected, members)
+		}
+	}
+
+	// Results are new sets, the operands are left untouched
+	Union(abc, cde).Add("z")
+	if abc.Contains("z") || abc.Len() != 3 {
+		t.Errorf("Expected the operands to be left untouched but got %v", sortedMembers(abc))
+	}
+}
@@ -0,0 +1,233 @@
+package datastore
+
+import (
+	"math/bits"
+	"time"
+)
+
+// Keys a snapshot walk reads from the store each time it takes the lock
+const snapshotBatchSize = 128
+
+// Snapshot is a point in time view of the store that stays consistent
+// while writes go on, so it can be serialized in the background. Nothing
+// is copied when it's taken: the walk goes over the live store bucket by
+// bucket, and the store keeps the entry a key had when the snapshot was
+// taken the first time the key is modified, unless the walk already went
+// past its bucket. Values are shared as well until the first time they
+// are fetched for modification, when the store copies them instead.
+type Snapshot struct {
+	ds    *Datastore
+	dirty int64
+
+	// Number of keys and expiries when the snapshot was taken
+	size       int
+	expirySize int
+
+	// What the walk goes over, the maps of the store unless they were
+	// swapped by a flush since
+	store  map[string]*Data
+	expiry map[string]time.Time
+	keys   *keyTable
+	// Next bucket to walk, 0 before the walk starts and once it's over
+	cursor uint64
+	done   bool
+	// Set while the store preserves entries for the snapshot
+	live bool
+
+	// Entries as they were when the snapshot was taken of the keys
+	// modified since then, in buckets the walk didn't reach yet
+	preserved map[string]snapshotEntry
+}
+
+// An entry of the store, a nil data means the key didn't exist
+type snapshotEntry struct {
+	data     *Data
+	expireAt time.Time
+}
+
+// Snapshot returns a view of the current content of the store, which
+// must be released once done with it.
+func (ds *Datastore) Snapshot() *Snapshot {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.epoch++
+	ds.snapshots++
+	snapshot := &Snapshot{
+		ds:         ds,
+		dirty:      ds.dirty,
+		size:       len(ds.store),
+		expirySize: len(ds.expiry),
+		store:      ds.store,
+		expiry:     ds.expiry,
+		keys:       ds.keys,
+		live:       true,
+		preserved:  make(map[string]snapshotEntry),
+	}
+	// A shrinking table would make the walk return keys twice
+	ds.keys.pauseShrink++
+	ds.walking = append(ds.walking, snapshot)
+	return snapshot
+}
+
+// Size returns the number of keys and the number of expiries when the
+// snapshot was taken, including keys already expired
+func (snapshot *Snapshot) Size() (int, int) {
+	return snapshot.size, snapshot.expirySize
+}
+
+// ForEach calls visit for every key of the snapshot, with its value and
+// when it expires, zero if it doesn't. It stops at the first error visit
+// returns. The walk takes the lock of the store for a few keys at a time
+// only, visit is called without holding it.
+func (snapshot *Snapshot) ForEach(visit func(key string, value any, expireAt time.Time) error) error {
+	type entry struct {
+		key string
+		snapshotEntry
+	}
+	var entries []entry
+
+	for {
+		entries = entries[:0]
+		snapshot.ds.mu.Lock()
+		for !snapshot.done && len(entries) < snapshotBatchSize {
+			snapshot.cursor = snapshot.keys.scanBucket(snapshot.cursor, func(key string) {
+				old, preserved := snapshot.preserved[key]
+				if !preserved {
+					old = snapshotEntry{data: snapshot.store[key], expireAt: snapshot.expiry[key]}
+				}
+				// Keys of visited buckets aren't preserved anymore
+				delete(snapshot.preserved, key)
+				if old.data != nil {
+					entries = append(entries, entry{key, old})
+				}
+			})
+			if snapshot.cursor == 0 {
+				snapshot.done = true
+				snapshot.stopPreserving()
+			}
+		}
+		done := snapshot.done
+		snapshot.ds.mu.Unlock()
+
+		for _, e := range entries {
+			if err := visit(e.key, e.data.value, e.expireAt); err != nil {
+				return err
+			}
+		}
+		if done {
+			break
+		}
+	}
+
+	// What's left are keys deleted before the walk reached them
+	for key, old := range snapshot.preserved {
+		if old.data == nil {
+			continue
+		}
+		if err := visit(key, old.data.value, old.expireAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Must be called with the lock held. Once the walk is over, the snapshot
+// released or the store flushed, the store doesn't preserve entries for
+// the snapshot anymore.
+func (snapshot *Snapshot) stopPreserving() {
+	if !snapshot.live {
+		return
+	}
+	snapshot.live = false
+
+	ds := snapshot.ds
+	for i, walking := range ds.walking {
+		if walking == snapshot {
+			ds.walking = append(ds.walking[:i], ds.walking[i+1:]...)
+			break
+		}
+	}
+	snapshot.keys.pauseShrink--
+	// A flush replaced the table, the old one is left as it is to the
+	// snapshot
+	if snapshot.keys == ds.keys {
+		ds.keys.shrinkIfNeeded()
+	}
+}
+
+// Must be called with the lock held. Reports whether the walk went past
+// the bucket of key.
+func (snapshot *Snapshot) visited(key string) bool {
+	if snapshot.cursor == 0 {
+		return false
+	}
+	// Buckets are walked in the order of their reversed index
+	return bits.Reverse64(snapshot.keys.bucket(key)) < bits.Reverse64(snapshot.cursor)
+}
+
+// Must be called with the lock held, before the entry of key is modified,
+// so snapshots still to visit it see it as it was when they were taken.
+func (ds *Datastore) preserve(key string) {
+	for _, snapshot := range ds.walking {
+		if _, preserved := snapshot.preserved[key]; preserved || snapshot.visited(key) {
+			continue
+		}
+		var old snapshotEntry
+		if data, exists := ds.store[key]; exists {
+			old = snapshotEntry{data: data, expireAt: ds.expiry[key]}
+		}
+		snapshot.preserved[key] = old
+	}
+}
+
+// Must be called with the lock held, before the maps of the store are
+// swapped for new ones. Snapshots still walking keep the old ones to
+// themselves, which nothing modifies anymore.
+func (ds *Datastore) detachSnapshots() {
+	for len(ds.walking) > 0 {
+		ds.walking[0].stopPreserving()
+	}
+}
+
+// Release tells the store the snapshot is no longer used, values aren't
+// copied on modification anymore once all snapshots are released.
+func (snapshot *Snapshot) Release() {
+	snapshot.ds.mu.Lock()
+	snapshot.stopPreserving()
+	snapshot.ds.snapshots--
+	snapshot.ds.mu.Unlock()
+}
+
+// Saved tells the store the snapshot was saved, the changes made before
+// it was taken don't count as dirty anymore.
+func (snapshot *Snapshot) Saved() {
+	snapshot.ds.mu.Lock()
+	snapshot.ds.dirty -= snapshot.dirty
+	snapshot.ds.mu.Unlock()
+}
+
+// SetReadOnly tells the store values fetched until it's reset won't be
+// modified, so they don't need to be copied while a snapshot is taken.
+func (ds *Datastore) SetReadOnly(readOnly bool) {
+	ds.mu.Lock()
+	ds.readOnly = readOnly
+	ds.mu.Unlock()
+}
+
+func cloneValue(value any) any {
+	switch v := value.(type) {
+	case *List:
+		return v.clone()
+	case *Hash:
+		return v.clone()
+	case *Set:
+		return v.clone()
+	case *SortedSet:
+		return v.clone()
+	case *Stream:
+		return v.clone()
+	}
+	// Strings are immutable
+	return value
+}
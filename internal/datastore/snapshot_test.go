@@ -0,0 +1,277 @@
+package datastore
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type snapshotValue struct {
+	value    any
+	expireAt time.Time
+}
+
+// Walks the snapshot, failing on keys returned more than once. modify is
+// called after each key, like writes going on while the snapshot is saved.
+func snapshotContent(t *testing.T, snapshot *Snapshot, modify func(visited int)) map[string]snapshotValue {
+	t.Helper()
+	content := make(map[string]snapshotValue)
+	err := snapshot.ForEach(func(key string, value any, expireAt time.Time) error {
+		if _, seen := content[key]; seen {
+			t.Errorf("Expected %s to be returned once", key)
+		}
+		content[key] = snapshotValue{value, expireAt}
+		if modify != nil {
+			modify(len(content))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return content
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+	list := NewList()
+	list.RPush("a", "b")
+	hash := NewHash()
+	hash.Set("f", "v")
+	zset := NewSortedSet()
+	zset.Add("m", 1)
+	stream := NewStream()
+	stream.Add(StreamID{Ms: 1}, []string{"f", "v"})
+	group, _ := stream.CreateGroup("g", StreamID{}, 0)
+	consumer, _ := group.Consumer("c", time.Now())
+	group.Deliver(StreamID{Ms: 1}, consumer, time.Now())
+	for key, value := range map[string]any{"list": list, "hash": hash, "set": NewSet("a"), "zset": zset, "stream": stream} {
+		ds.Set(key, value, nil)
+	}
+	ds.Set("string", "v", nil)
+
+	snapshot := ds.Snapshot()
+
+	value, _ := ds.Get("list")
+	value.(*List).RPush("c")
+	value, _ = ds.Get("hash")
+	value.(*Hash).Set("f", "changed")
+	value, _ = ds.Get("set")
+	value.(*Set).Add("b")
+	value, _ = ds.Get("zset")
+	value.(*SortedSet).Add("n", 2)
+	value, _ = ds.Get("stream")
+	liveGroup, _ := value.(*Stream).Group("g")
+	liveGroup.Ack(StreamID{Ms: 1})
+	value.(*Stream).Add(StreamID{Ms: 2}, []string{"f", "v"})
+	ds.Set("string", "changed", nil)
+	ds.Del("hash")
+
+	content := snapshotContent(t, snapshot, nil)
+	if values := content["list"].value.(*List).Values(); !reflect.DeepEqual(values, []string{"a", "b"}) {
+		t.Errorf("Expected the snapshot list to be [a b] but got %v", values)
+	}
+	if v, _ := content["hash"].value.(*Hash).Get("f"); v != "v" {
+		t.Errorf("Expected the snapshot hash field to be v but got %s", v)
+	}
+	if n := content["set"].value.(*Set).Len(); n != 1 {
+		t.Errorf("Expected 1 member in the snapshot set but got %d", n)
+	}
+	if members := content["zset"].value.(*SortedSet).Members(); len(members) != 1 {
+		t.Errorf("Expected 1 member in the snapshot sorted set but got %v", members)
+	}
+	snapshotStream := content["stream"].value.(*Stream)
+	if snapshotStream.Len() != 1 {
+		t.Errorf("Expected 1 entry in the snapshot stream but got %d", snapshotStream.Len())
+	}
+	snapshotGroup, _ := snapshotStream.Group("g")
+	if len(snapshotGroup.Pending) != 1 || len(snapshotGroup.Consumers["c"].Pending) != 1 {
+		t.Errorf("Expected the snapshot stream to keep its pending entry")
+	}
+	if v := content["string"].value; v != "v" {
+		t.Errorf("Expected the snapshot string to be v but got %v", v)
+	}
+
+	// Copies are shared between the group and its consumers like the originals
+	if liveGroup.Consumers["c"].Pending[StreamID{Ms: 1}] != nil {
+		t.Errorf("Expected the ack to remove the entry from the consumer too")
+	}
+
+	// Modified once per snapshot
+	value, _ = ds.Get("list")
+	again, _ := ds.Get("list")
+	if value != again {
+		t.Errorf("Expected the list to be copied only once")
+	}
+	snapshot.Release()
+}
+
+func TestSnapshotCopies(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+	ds.Set("list", NewList(), nil)
+	original, _ := ds.Get("list")
+
+	// No snapshot, nothing to copy
+	if value, _ := ds.Get("list"); value != original {
+		t.Errorf("Expected no copy without a snapshot")
+	}
+
+	snapshot := ds.Snapshot()
+	ds.SetReadOnly(true)
+	if value, _ := ds.Get("list"); value != original {
+		t.Errorf("Expected no copy for a read only access")
+	}
+	ds.SetReadOnly(false)
+	snapshot.Release()
+
+	// Released snapshots don't hold on values
+	if value, _ := ds.Get("list"); value != original {
+		t.Errorf("Expected no copy once the snapshot is released")
+	}
+}
+
+func TestSnapshotSaved(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+	ds.Set("k", "v", nil)
+	ds.Set("list", NewList(), nil)
+	ds.Touch("list")
+	ds.Del("k")
+
+	snapshot := ds.Snapshot()
+	ds.Set("k", "v", nil)
+	if ds.Dirty() != 5 {
+		t.Errorf("Expected 5 changes but got %d", ds.Dirty())
+	}
+
+	// Changes made while saving are still to be saved
+	snapshot.Saved()
+	snapshot.Release()
+	if ds.Dirty() != 1 {
+		t.Errorf("Expected 1 change left after the save but got %d", ds.Dirty())
+	}
+}
+
+// Keys written while the snapshot is walked must be returned as they were
+// when it was taken, whether the walk already went past them or not
+func TestSnapshotKeySetIsolation(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	expected := make(map[string]snapshotValue)
+	for i := range 1000 {
+		key := "k" + strconv.Itoa(i)
+		ds.Set(key, "v"+strconv.Itoa(i), nil)
+		expected[key] = snapshotValue{value: "v" + strconv.Itoa(i)}
+		if i%3 == 0 {
+			ds.SetExpiry(key, expireAt)
+			expected[key] = snapshotValue{"v" + strconv.Itoa(i), expireAt.UTC()}
+		}
+	}
+
+	snapshot := ds.Snapshot()
+	defer snapshot.Release()
+	if storeSize, expirySize := snapshot.Size(); storeSize != 1000 || expirySize != 334 {
+		t.Errorf("Expected 1000 keys and 334 expiries but got %d and %d", storeSize, expirySize)
+	}
+
+	// Modified before the walk starts
+	ds.Del("k1")
+	ds.Set("k2", "changed", nil)
+	ds.Set("new", "v", nil)
+
+	content := snapshotContent(t, snapshot, func(visited int) {
+		if visited%10 != 0 {
+			return
+		}
+		// Deletes, replaces and changes the expiry of keys already walked
+		// or not, and adds enough keys to grow the table
+		i := strconv.Itoa(visited)
+		ds.Del("k" + strconv.Itoa(visited*7%1000))
+		ds.Set("k"+strconv.Itoa(visited*3%1000), "changed", []string{"EX", "10"})
+		ds.Persist("k" + strconv.Itoa(visited*11%1000))
+		ds.SetExpiry("k"+strconv.Itoa(visited*13%1000), time.Now().Add(time.Minute))
+		value, _ := ds.Get("list")
+		if value == nil {
+			ds.Set("list", NewList(), nil)
+		} else {
+			value.(*List).RPush(i)
+		}
+		for j := range 20 {
+			ds.Set("added:"+i+":"+strconv.Itoa(j), "v", nil)
+		}
+	})
+
+	if len(content) != len(expected) {
+		t.Errorf("Expected %d keys but got %d", len(expected), len(content))
+	}
+	for key, value := range expected {
+		if got, exists := content[key]; !exists || got.value != value.value || !got.expireAt.Equal(value.expireAt) {
+			t.Errorf("Expected %s to be %v but got %v (exists %v)", key, value, got, exists)
+		}
+	}
+	if len(ds.walking) != 0 {
+		t.Errorf("Expected the store to stop preserving entries once the walk is over")
+	}
+}
+
+func TestSnapshotFlushDuringWalk(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		ds := NewDatastore(nil, nil)
+		for i := range 500 {
+			ds.Set("k"+strconv.Itoa(i), "v", nil)
+		}
+
+		snapshot := ds.Snapshot()
+		ds.Set("k0", "changed", nil)
+		content := snapshotContent(t, snapshot, func(visited int) {
+			if visited == 100 {
+				ds.Flush(async)
+				ds.Set("k1", "new", nil)
+				ds.Set("new", "v", nil)
+			}
+		})
+		snapshot.Release()
+
+		if len(content) != 500 {
+			t.Errorf("Flush async %v: expected 500 keys but got %d", async, len(content))
+		}
+		for key, value := range content {
+			if value.value != "v" {
+				t.Errorf("Flush async %v: expected %s to be v but got %v", async, key, value.value)
+			}
+		}
+		if ds.Size() != 2 {
+			t.Errorf("Flush async %v: expected 2 keys left in the store but got %d", async, ds.Size())
+		}
+	}
+}
+
+// Deleting most keys during the walk must not shrink the table under it,
+// it shrinks once the walk is over
+func TestSnapshotPausesShrink(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+	for i := range 1000 {
+		ds.Set("k"+strconv.Itoa(i), "v", nil)
+	}
+	buckets := len(ds.keys.buckets)
+
+	snapshot := ds.Snapshot()
+	content := snapshotContent(t, snapshot, func(visited int) {
+		if visited == 1 {
+			for i := range 990 {
+				ds.Del("k" + strconv.Itoa(i))
+			}
+			if len(ds.keys.buckets) != buckets {
+				t.Errorf("Expected the table to keep its %d buckets during the walk, got %d", buckets, len(ds.keys.buckets))
+			}
+		}
+	})
+	snapshot.Release()
+
+	if len(content) != 1000 {
+		t.Errorf("Expected 1000 keys but got %d", len(content))
+	}
+	if len(ds.keys.buckets) >= buckets {
+		t.Errorf("Expected the table to shrink after the walk, still %d buckets", len(ds.keys.buckets))
+	}
+}
@@ -0,0 +1,458 @@
+package datastore
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errInvalidStreamID = errors.New("invalid stream ID")
+
+// StreamID identifies a stream entry, ordered by milliseconds then sequence.
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	MinStreamID = StreamID{Ms: 0, Seq: 0}
+	MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+)
+
+// ParseStreamID parses "<ms>-<seq>". When the sequence part is missing,
+// missingSeq is used instead.
+func ParseStreamID(s string, missingSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, errInvalidStreamID
+	}
+	if !hasSeq {
+		return StreamID{Ms: ms, Seq: missingSeq}, nil
+	}
+
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, errInvalidStreamID
+	}
+	return StreamID{Ms: ms, Seq: seq}, nil
+}
+
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+// Compare returns -1, 0 or 1 when id is smaller, equal or greater than other.
+func (id StreamID) Compare(other StreamID) int {
+	switch {
+	case id.Ms < other.Ms:
+		return -1
+	case id.Ms > other.Ms:
+		return 1
+	case id.Seq < other.Seq:
+		return -1
+	case id.Seq > other.Seq:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Incr returns the smallest ID greater than id. Returns false on overflow.
+func (id StreamID) Incr() (StreamID, bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1, Seq: 0}, true
+	default:
+		return id, false
+	}
+}
+
+// Decr returns the greatest ID smaller than id. Returns false on underflow.
+func (id StreamID) Decr() (StreamID, bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	default:
+		return id, false
+	}
+}
+
+type StreamEntry struct {
+	ID StreamID
+	// Field value pairs, flattened
+	Fields []string
+}
+
+// PendingEntry is an entry delivered to a consumer but not acknowledged yet.
+type PendingEntry struct {
+	ID            StreamID
+	Consumer      string
+	DeliveryTime  time.Time
+	DeliveryCount int
+}
+
+type Consumer struct {
+	Name string
+	// Last time the consumer attempted an interaction, and last time
+	// it actually read or claimed something
+	SeenTime   time.Time
+	ActiveTime time.Time
+	Pending    map[StreamID]*PendingEntry
+}
+
+type ConsumerGroup struct {
+	Name            string
+	LastDeliveredID StreamID
+	// Number of entries read by the group, -1 when it can't be known
+	EntriesRead int64
+	// Pending entries list (PEL) of the whole group
+	Pending   map[StreamID]*PendingEntry
+	Consumers map[string]*Consumer
+}
+
+// Stream is an append only log of entries kept sorted by ID, so ranges
+// are found by binary search.
+type Stream struct {
+	entries      []StreamEntry
+	LastID       StreamID
+	MaxDeletedID StreamID
+	// Number of entries ever added, including deleted ones
+	EntriesAdded uint64
+	groups       map[string]*ConsumerGroup
+}
+
+func NewStream() *Stream {
+	return &Stream{
+		entries: make([]StreamEntry, 0),
+		groups:  make(map[string]*ConsumerGroup),
+	}
+}
+
+func (stream *Stream) Len() int {
+	return len(stream.entries)
+}
+
+// Entries are never modified once added so they can be shared, but
+// consumer groups are copied as a whole since consumers and the group
+// share the same pending entries.
+func (stream *Stream) clone() *Stream {
+	clone := *stream
+	clone.entries = slices.Clone(stream.entries)
+	clone.groups = make(map[string]*ConsumerGroup, len(stream.groups))
+	for name, group := range stream.groups {
+		groupClone := *group
+		groupClone.Pending = make(map[StreamID]*PendingEntry, len(group.Pending))
+		for id, pending := range group.Pending {
+			pendingClone := *pending
+			groupClone.Pending[id] = &pendingClone
+		}
+		groupClone.Consumers = make(map[string]*Consumer, len(group.Consumers))
+		for name, consumer := range group.Consumers {
+			consumerClone := *consumer
+			consumerClone.Pending = make(map[StreamID]*PendingEntry, len(consumer.Pending))
+			for id := range consumer.Pending {
+				consumerClone.Pending[id] = groupClone.Pending[id]
+			}
+			groupClone.Consumers[name] = &consumerClone
+		}
+		clone.groups[name] = &groupClone
+	}
+	return &clone
+}
+
+// FirstID returns the ID of the oldest entry, or false if the stream is empty.
+func (stream *Stream) FirstID() (StreamID, bool) {
+	if len(stream.entries) == 0 {
+		return StreamID{}, false
+	}
+	return stream.entries[0].ID, true
+}
+
+// NextID returns the ID XADD * would generate at the given time.
+func (stream *Stream) NextID(now time.Time) (StreamID, bool) {
+	ms := uint64(now.UnixMilli())
+	if ms > stream.LastID.Ms {
+		return StreamID{Ms: ms, Seq: 0}, true
+	}
+	return stream.LastID.Incr()
+}
+
+// NextSeq returns the ID XADD <ms>-* would generate, or false if there is
+// no valid sequence left for ms.
+func (stream *Stream) NextSeq(ms uint64) (StreamID, bool) {
+	switch {
+	case ms > stream.LastID.Ms:
+		return StreamID{Ms: ms, Seq: 0}, true
+	case ms == stream.LastID.Ms && stream.LastID.Seq < math.MaxUint64:
+		return StreamID{Ms: ms, Seq: stream.LastID.Seq + 1}, true
+	default:
+		return StreamID{}, false
+	}
+}
+
+// Add appends an entry. The caller must make sure id is greater than LastID.
+func (stream *Stream) Add(id StreamID, fields []string) {
+	stream.entries = append(stream.entries, StreamEntry{ID: id, Fields: fields})
+	stream.LastID = id
+	stream.EntriesAdded++
+}
+
+// Index of the first entry with an ID greater or equal to id
+func (stream *Stream) search(id StreamID) int {
+	return sort.Search(len(stream.entries), func(i int) bool {
+		return stream.entries[i].ID.Compare(id) >= 0
+	})
+}
+
+func (stream *Stream) Get(id StreamID) (StreamEntry, bool) {
+	i := stream.search(id)
+	if i < len(stream.entries) && stream.entries[i].ID == id {
+		return stream.entries[i], true
+	}
+	return StreamEntry{}, false
+}
+
+// Range returns entries with IDs between start and end, both inclusive,
+// at most count of them (count <= 0 means no limit). With reverse the
+// newest entries come first.
+func (stream *Stream) Range(start, end StreamID, count int, reverse bool) []StreamEntry {
+	result := make([]StreamEntry, 0)
+	if start.Compare(end) > 0 {
+		return result
+	}
+
+	from := stream.search(start)
+	to := stream.search(end)
+	if to < len(stream.entries) && stream.entries[to].ID == end {
+		to++
+	}
+
+	if reverse {
+		for i := to - 1; i >= from && (count <= 0 || len(result) < count); i-- {
+			result = append(result, stream.entries[i])
+		}
+	} else {
+		for i := from; i < to && (count <= 0 || len(result) < count); i++ {
+			result = append(result, stream.entries[i])
+		}
+	}
+
+	return result
+}
+
+// After returns up to count entries (count <= 0 means no limit) with an
+// ID strictly greater than id.
+func (stream *Stream) After(id StreamID, count int) []StreamEntry {
+	next, ok := id.Incr()
+	if !ok {
+		return []StreamEntry{}
+	}
+	return stream.Range(next, MaxStreamID, count, false)
+}
+
+// Delete removes the entries with the given IDs and returns how many existed.
+func (stream *Stream) Delete(ids ...StreamID) int {
+	deleted := 0
+	for _, id := range ids {
+		i := stream.search(id)
+		if i < len(stream.entries) && stream.entries[i].ID == id {
+			stream.entries = slices.Delete(stream.entries, i, i+1)
+			if id.Compare(stream.MaxDeletedID) > 0 {
+				stream.MaxDeletedID = id
+			}
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Evicts the n oldest entries
+func (stream *Stream) evict(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	n = min(n, len(stream.entries))
+	lastEvicted := stream.entries[n-1].ID
+	if lastEvicted.Compare(stream.MaxDeletedID) > 0 {
+		stream.MaxDeletedID = lastEvicted
+	}
+	stream.entries = slices.Delete(stream.entries, 0, n)
+	return n
+}
+
+// TrimMaxLen evicts the oldest entries until at most maxLen are left,
+// evicting no more than limit entries (limit <= 0 means no limit).
+// Returns the number of evicted entries.
+func (stream *Stream) TrimMaxLen(maxLen int, limit int) int {
+	n := len(stream.entries) - maxLen
+	if limit > 0 {
+		n = min(n, limit)
+	}
+	return stream.evict(n)
+}
+
+// TrimMinID evicts entries with an ID lower than minID, no more than
+// limit of them (limit <= 0 means no limit).
+// Returns the number of evicted entries.
+func (stream *Stream) TrimMinID(minID StreamID, limit int) int {
+	n := stream.search(minID)
+	if limit > 0 {
+		n = min(n, limit)
+	}
+	return stream.evict(n)
+}
+
+// Entries returns all entries, oldest first. The slice must not be modified.
+func (stream *Stream) Entries() []StreamEntry {
+	return stream.entries
+}
+
+func (stream *Stream) Group(name string) (*ConsumerGroup, bool) {
+	group, exists := stream.groups[name]
+	return group, exists
+}
+
+// CreateGroup returns false if a group with the same name already exists.
+func (stream *Stream) CreateGroup(name string, lastID StreamID, entriesRead int64) (*ConsumerGroup, bool) {
+	if _, exists := stream.groups[name]; exists {
+		return nil, false
+	}
+
+	group := &ConsumerGroup{
+		Name:            name,
+		LastDeliveredID: lastID,
+		EntriesRead:     entriesRead,
+		Pending:         make(map[StreamID]*PendingEntry),
+		Consumers:       make(map[string]*Consumer),
+	}
+	stream.groups[name] = group
+	return group, true
+}
+
+func (stream *Stream) DestroyGroup(name string) bool {
+	if _, exists := stream.groups[name]; !exists {
+		return false
+	}
+	delete(stream.groups, name)
+	return true
+}
+
+// Groups returns all consumer groups sorted by name.
+func (stream *Stream) Groups() []*ConsumerGroup {
+	groups := make([]*ConsumerGroup, 0, len(stream.groups))
+	for _, group := range stream.groups {
+		groups = append(groups, group)
+	}
+	slices.SortFunc(groups, func(a, b *ConsumerGroup) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return groups
+}
+
+// Consumer returns the named consumer, creating it if needed. The second
+// return value reports whether it was created.
+func (group *ConsumerGroup) Consumer(name string, now time.Time) (*Consumer, bool) {
+	if consumer, exists := group.Consumers[name]; exists {
+		return consumer, false
+	}
+
+	consumer := &Consumer{
+		Name:       name,
+		SeenTime:   now,
+		ActiveTime: time.Time{},
+		Pending:    make(map[StreamID]*PendingEntry),
+	}
+	group.Consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer removes a consumer and its pending entries. Returns the
+// number of pending entries it had, or -1 if it doesn't exist.
+func (group *ConsumerGroup) DeleteConsumer(name string) int {
+	consumer, exists := group.Consumers[name]
+	if !exists {
+		return -1
+	}
+
+	for id := range consumer.Pending {
+		delete(group.Pending, id)
+	}
+	delete(group.Consumers, name)
+	return len(consumer.Pending)
+}
+
+// Claim hands the pending entry id over to consumer, adding it to the PEL
+// if needed. Delivery time and counter are left for the caller to update.
+func (group *ConsumerGroup) Claim(id StreamID, consumer *Consumer) *PendingEntry {
+	pending, exists := group.Pending[id]
+	if !exists {
+		pending = &PendingEntry{ID: id}
+		group.Pending[id] = pending
+	} else if previous, ok := group.Consumers[pending.Consumer]; ok {
+		delete(previous.Pending, id)
+	}
+
+	pending.Consumer = consumer.Name
+	consumer.Pending[id] = pending
+	return pending
+}
+
+// Deliver records id as delivered to consumer. An entry already pending is
+// moved to the new consumer and its delivery counter increased.
+func (group *ConsumerGroup) Deliver(id StreamID, consumer *Consumer, now time.Time) *PendingEntry {
+	pending := group.Claim(id, consumer)
+	pending.DeliveryTime = now
+	pending.DeliveryCount++
+	return pending
+}
+
+// Ack removes the entries from the PEL and returns how many were pending.
+func (group *ConsumerGroup) Ack(ids ...StreamID) int {
+	acked := 0
+	for _, id := range ids {
+		pending, exists := group.Pending[id]
+		if !exists {
+			continue
+		}
+		if consumer, ok := group.Consumers[pending.Consumer]; ok {
+			delete(consumer.Pending, id)
+		}
+		delete(group.Pending, id)
+		acked++
+	}
+	return acked
+}
+
+// SortedPending returns the entries of a group or consumer PEL ordered by ID.
+func SortedPending(pel map[StreamID]*PendingEntry) []*PendingEntry {
+	entries := make([]*PendingEntry, 0, len(pel))
+	for _, pending := range pel {
+		entries = append(entries, pending)
+	}
+	slices.SortFunc(entries, func(a, b *PendingEntry) int {
+		return a.ID.Compare(b.ID)
+	})
+	return entries
+}
+
+// SortedConsumers returns the consumers of the group ordered by name.
+func (group *ConsumerGroup) SortedConsumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(group.Consumers))
+	for _, consumer := range group.Consumers {
+		consumers = append(consumers, consumer)
+	}
+	slices.SortFunc(consumers, func(a, b *Consumer) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return consumers
+}
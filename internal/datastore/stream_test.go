@@ -0,0 +1,139 @@
+package datastore
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func idsOf(entries []StreamEntry) []string {
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID.String()
+	}
+	return ids
+}
+
+func TestStreamIDs(t *testing.T) {
+	tests := []struct {
+		input       string
+		missingSeq  uint64
+		expected    StreamID
+		shouldError bool
+	}{
+		{input: "5-3", expected: StreamID{Ms: 5, Seq: 3}},
+		{input: "5", missingSeq: 7, expected: StreamID{Ms: 5, Seq: 7}},
+		{input: "18446744073709551615-18446744073709551615", expected: MaxStreamID},
+		{input: "5-", shouldError: true},
+		{input: "abc", shouldError: true},
+		{input: "-1", shouldError: true},
+	}
+
+	for _, tc := range tests {
+		id, err := ParseStreamID(tc.input, tc.missingSeq)
+		if tc.shouldError {
+			if err == nil {
+				t.Errorf("ParseStreamID(%q): expected an error", tc.input)
+			}
+			continue
+		}
+		if err != nil || id != tc.expected {
+			t.Errorf("ParseStreamID(%q): expected %v but got %v (err %v)", tc.input, tc.expected, id, err)
+		}
+	}
+
+	if _, ok := MaxStreamID.Incr(); ok {
+		t.Errorf("Expected incrementing the max ID to overflow")
+	}
+	if next, _ := (StreamID{Ms: 1, Seq: MaxStreamID.Seq}).Incr(); next != (StreamID{Ms: 2}) {
+		t.Errorf("Expected sequence overflow to carry into ms but got %v", next)
+	}
+
+	stream := NewStream()
+	now := time.UnixMilli(1000)
+	stream.Add(StreamID{Ms: 2000, Seq: 0}, []string{"f", "v"})
+	// Clock behind the last ID, the sequence is incremented instead
+	if id, _ := stream.NextID(now); id != (StreamID{Ms: 2000, Seq: 1}) {
+		t.Errorf("Expected 2000-1 but got %v", id)
+	}
+	if _, ok := stream.NextSeq(1999); ok {
+		t.Errorf("Expected no sequence to be available for an older ms")
+	}
+}
+
+func TestStreamRangeAndTrim(t *testing.T) {
+	stream := NewStream()
+	for i := uint64(1); i <= 10; i++ {
+		stream.Add(StreamID{Ms: i}, []string{"n", "v"})
+	}
+
+	tests := []struct {
+		name     string
+		result   []StreamEntry
+		expected []string
+	}{
+		{name: "all", result: stream.Range(MinStreamID, MaxStreamID, 0, false), expected: idsOf(stream.Entries())},
+		{name: "bounded", result: stream.Range(StreamID{Ms: 3}, StreamID{Ms: 5}, 0, false), expected: []string{"3-0", "4-0", "5-0"}},
+		{name: "count", result: stream.Range(StreamID{Ms: 3}, MaxStreamID, 2, false), expected: []string{"3-0", "4-0"}},
+		{name: "reverse", result: stream.Range(StreamID{Ms: 3}, StreamID{Ms: 5}, 2, true), expected: []string{"5-0", "4-0"}},
+		{name: "empty", result: stream.Range(StreamID{Ms: 5}, StreamID{Ms: 3}, 0, false), expected: []string{}},
+		{name: "after", result: stream.After(StreamID{Ms: 8}, 0), expected: []string{"9-0", "10-0"}},
+	}
+
+	for _, tc := range tests {
+		if !slices.Equal(idsOf(tc.result), tc.expected) {
+			t.Errorf("%s: expected %v but got %v", tc.name, tc.expected, idsOf(tc.result))
+		}
+	}
+
+	if deleted := stream.Delete(StreamID{Ms: 2}, StreamID{Ms: 2}, StreamID{Ms: 42}); deleted != 1 {
+		t.Errorf("Expected 1 deleted entry but got %d", deleted)
+	}
+	if evicted := stream.TrimMinID(StreamID{Ms: 5}, 0); evicted != 3 {
+		t.Errorf("Expected MINID to evict 3 entries but got %d", evicted)
+	}
+	if evicted := stream.TrimMaxLen(2, 1); evicted != 1 {
+		t.Errorf("Expected LIMIT to cap eviction to 1 entry but got %d", evicted)
+	}
+	if first, _ := stream.FirstID(); first != (StreamID{Ms: 6}) || stream.Len() != 5 {
+		t.Errorf("Expected 5 entries starting at 6-0 but got %d starting at %v", stream.Len(), first)
+	}
+	if stream.MaxDeletedID != (StreamID{Ms: 5}) || stream.EntriesAdded != 10 {
+		t.Errorf("Unexpected max deleted ID %v or entries added %d", stream.MaxDeletedID, stream.EntriesAdded)
+	}
+}
+
+func TestConsumerGroupPendingEntries(t *testing.T) {
+	stream := NewStream()
+	group, _ := stream.CreateGroup("g", MinStreamID, 0)
+	if _, created := stream.CreateGroup("g", MinStreamID, 0); created {
+		t.Fatalf("Expected creating the same group twice to fail")
+	}
+
+	now := time.Now()
+	alice, _ := group.Consumer("alice", now)
+	bob, _ := group.Consumer("bob", now)
+	for i := uint64(1); i <= 3; i++ {
+		group.Deliver(StreamID{Ms: i}, alice, now)
+	}
+
+	// Delivering again to another consumer moves ownership
+	pending := group.Deliver(StreamID{Ms: 2}, bob, now)
+	if pending.DeliveryCount != 2 || len(alice.Pending) != 2 || len(bob.Pending) != 1 {
+		t.Errorf("Unexpected PEL after redelivery: count %d, alice %d, bob %d", pending.DeliveryCount, len(alice.Pending), len(bob.Pending))
+	}
+
+	if acked := group.Ack(StreamID{Ms: 1}, StreamID{Ms: 1}, StreamID{Ms: 9}); acked != 1 {
+		t.Errorf("Expected 1 acknowledged entry but got %d", acked)
+	}
+	if ids := SortedPending(group.Pending); len(ids) != 2 || ids[0].ID != (StreamID{Ms: 2}) {
+		t.Errorf("Unexpected group PEL %v", ids)
+	}
+
+	if pendingCount := group.DeleteConsumer("bob"); pendingCount != 1 || len(group.Pending) != 1 {
+		t.Errorf("Expected bob to be deleted with 1 pending entry, got %d and group PEL of %d", pendingCount, len(group.Pending))
+	}
+	if group.DeleteConsumer("bob") != -1 {
+		t.Errorf("Expected deleting a missing consumer to return -1")
+	}
+}
@@ -0,0 +1,71 @@
+package datastore
+
+import (
+	"errors"
+	"math"
+	"strconv"
+
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+)
+
+var errIncrOverflow = errors.New("ERR increment or decrement would overflow")
+
+// Strings holding the canonical decimal form of a 64 bits integer are
+// stored as an int64, like Redis does with its int encoding, so INCR and
+// the like don't parse them every time. Everything else reading strings
+// must go through StringValue.
+func encodeString(value string) any {
+	// Longer strings can't fit, don't bother parsing them
+	if len(value) > 20 {
+		return value
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != value {
+		return value
+	}
+	return n
+}
+
+// StringValue returns the string held by value, false if it doesn't hold
+// a string
+func StringValue(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	}
+	return "", false
+}
+
+// IncrBy adds delta to the integer stored at key, set to 0 first when key
+// doesn't exist. The expiry of key is kept.
+func (ds *Datastore) IncrBy(key string, delta int64) (int64, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	var current int64
+	if data, exists := ds.store[key]; exists && !ds.expireIfNeeded(key) {
+		switch v := data.value.(type) {
+		case int64:
+			current = v
+		case string:
+			var err error
+			current, err = strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return 0, custom_err.ErrorNotInteger
+			}
+		default:
+			return 0, custom_err.ErrorWrongType
+		}
+	}
+
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return 0, errIncrOverflow
+	}
+	current += delta
+
+	// Values are never modified in place, a snapshot may refer to them
+	ds.setData(key, &Data{value: current, epoch: ds.epoch}, ds.expiry[key])
+	return current, nil
+}
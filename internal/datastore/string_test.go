@@ -0,0 +1,110 @@
+package datastore
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	custom_err "github.com/Viet-ph/redis-go/internal/error"
+)
+
+func TestSetIntegerEncoding(t *testing.T) {
+	tests := []struct {
+		value   string
+		encoded any
+	}{
+		{"123", int64(123)},
+		{"-9223372036854775808", int64(math.MinInt64)},
+		{"0", int64(0)},
+		{"0123", "0123"},
+		{"+1", "+1"},
+		{"-0", "-0"},
+		{"1.5", "1.5"},
+		{"9223372036854775808", "9223372036854775808"},
+		{"abc", "abc"},
+	}
+
+	ds := NewDatastore(nil, nil)
+	for _, tt := range tests {
+		ds.Set("k", tt.value, nil)
+		value, _ := ds.Get("k")
+		if value != tt.encoded {
+			t.Errorf("Expected %q to be stored as %#v, got %#v", tt.value, tt.encoded, value)
+		}
+		if str, ok := StringValue(value); !ok || str != tt.value {
+			t.Errorf("Expected %q back, got %q", tt.value, str)
+		}
+	}
+}
+
+func TestIncrBy(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+	ds.Set("text", "10", []string{"EX", "100"})
+	ds.store["text"].value = "10" // As loaded from an RDB file
+
+	for i := range 3 {
+		value, err := ds.IncrBy("text", 5)
+		if err != nil || value != int64(15+5*i) {
+			t.Fatalf("Expected %d, got %d, %v", 15+5*i, value, err)
+		}
+	}
+	if _, hasExpiry := ds.GetExpiry("text"); !hasExpiry {
+		t.Error("Expected INCRBY to keep the expiry")
+	}
+
+	if value, err := ds.IncrBy("missing", -1); err != nil || value != -1 {
+		t.Errorf("Expected a missing key to start at 0, got %d, %v", value, err)
+	}
+
+	ds.Set("max", strconv.FormatInt(math.MaxInt64, 10), nil)
+	if _, err := ds.IncrBy("max", 1); err == nil {
+		t.Error("Expected an overflow error")
+	}
+
+	ds.Set("float", "1.5", nil)
+	if _, err := ds.IncrBy("float", 1); err != custom_err.ErrorNotInteger {
+		t.Errorf("Expected %v, got %v", custom_err.ErrorNotInteger, err)
+	}
+
+	ds.Set("list", NewList(), nil)
+	if _, err := ds.IncrBy("list", 1); err != custom_err.ErrorWrongType {
+		t.Errorf("Expected %v, got %v", custom_err.ErrorWrongType, err)
+	}
+}
+
+func TestSetExpiryOptions(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	if err := ds.Set("k", "v", []string{"EXAT", strconv.FormatInt(at.Unix(), 10)}); err != nil {
+		t.Fatal(err)
+	}
+	if expireAt, _ := ds.GetExpiry("k"); !expireAt.Equal(at) {
+		t.Errorf("Expected the key to expire at %v, got %v", at, expireAt)
+	}
+
+	ds.Set("k", "w", []string{"KEEPTTL"})
+	if expireAt, _ := ds.GetExpiry("k"); !expireAt.Equal(at) {
+		t.Errorf("Expected KEEPTTL to keep the expiry at %v, got %v", at, expireAt)
+	}
+
+	ds.Set("k", "x", nil)
+	if _, hasExpiry := ds.GetExpiry("k"); hasExpiry {
+		t.Error("Expected SET without options to remove the expiry")
+	}
+
+	invalid := map[string][]string{
+		"EX and PX": {"EX", "10", "PX", "100"},
+		"KEEPTTL":   {"EX", "10", "KEEPTTL"},
+		"zero":      {"EX", "0"},
+		"negative":  {"PXAT", "-1"},
+		"overflow":  {"EX", strconv.FormatInt(math.MaxInt64/100, 10)},
+		"no value":  {"PX"},
+	}
+	for name, options := range invalid {
+		if err := ds.Set("k", "v", options); err == nil {
+			t.Errorf("Expected %s to be rejected", name)
+		}
+	}
+}
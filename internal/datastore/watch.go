@@ -0,0 +1,59 @@
+package datastore
+
+// A key watched by one or more clients (WATCH). Its version is bumped on
+// every modification so EXEC can tell whether the key changed since WATCH.
+type watchedKey struct {
+	watchers int
+	version  uint64
+}
+
+// Watch starts tracking modifications of key and returns its current version.
+func (ds *Datastore) Watch(key string) uint64 {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	watched, exists := ds.watched[key]
+	if !exists {
+		watched = &watchedKey{}
+		ds.watched[key] = watched
+	}
+	watched.watchers++
+
+	return watched.version
+}
+
+// Unwatch releases one watcher of key, the key stops being tracked once
+// nobody watches it anymore.
+func (ds *Datastore) Unwatch(key string) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	watched, exists := ds.watched[key]
+	if !exists {
+		return
+	}
+
+	watched.watchers--
+	if watched.watchers <= 0 {
+		delete(ds.watched, key)
+	}
+}
+
+// KeyVersion returns the version of a watched key.
+func (ds *Datastore) KeyVersion(key string) uint64 {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	if watched, exists := ds.watched[key]; exists {
+		return watched.version
+	}
+	return 0
+}
+
+// Must be called with the lock held whenever the value at key changes
+func (ds *Datastore) keyModified(key string) {
+	ds.dirty++
+	if watched, exists := ds.watched[key]; exists {
+		watched.version++
+	}
+}
@@ -0,0 +1,34 @@
+package datastore
+
+import "testing"
+
+func TestWatchedKeyVersions(t *testing.T) {
+	ds := NewDatastore(nil, nil)
+
+	version := ds.Watch("k")
+	ds.Watch("k")
+	if err := ds.Set("k", "v", nil); err != nil {
+		t.Fatal(err)
+	}
+	if ds.KeyVersion("k") == version {
+		t.Errorf("Expected SET to bump the version of a watched key")
+	}
+
+	version = ds.KeyVersion("k")
+	ds.Set("other", "v", nil)
+	if ds.KeyVersion("k") != version {
+		t.Errorf("Expected modifying another key to leave the version untouched")
+	}
+
+	// Still watched by the second watcher
+	ds.Unwatch("k")
+	ds.Del("k")
+	if ds.KeyVersion("k") == version {
+		t.Errorf("Expected DEL to bump the version of a watched key")
+	}
+
+	ds.Unwatch("k")
+	if _, watched := ds.watched["k"]; watched {
+		t.Errorf("Expected the key to stop being tracked once nobody watches it")
+	}
+}
@@ -0,0 +1,271 @@
+package datastore
+
+import "maps"
+
+// ZMember is a member of a sorted set along with its score.
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+// ScoreRange is an interval of scores, each end can be excluded.
+// Infinite ends are expressed with math.Inf.
+type ScoreRange struct {
+	Min, Max                   float64
+	MinExclusive, MaxExclusive bool
+}
+
+func (r ScoreRange) aboveMin(score float64) bool {
+	if r.MinExclusive {
+		return score > r.Min
+	}
+	return score >= r.Min
+}
+
+func (r ScoreRange) belowMax(score float64) bool {
+	if r.MaxExclusive {
+		return score < r.Max
+	}
+	return score <= r.Max
+}
+
+func (r ScoreRange) isEmpty() bool {
+	return r.Min > r.Max || (r.Min == r.Max && (r.MinExclusive || r.MaxExclusive))
+}
+
+// LexRange is an interval of members compared byte by byte, only
+// meaningful when all members share the same score. Unbounded ends stand
+// for the "-" and "+" special values.
+type LexRange struct {
+	Min, Max                   string
+	MinExclusive, MaxExclusive bool
+	MinUnbounded, MaxUnbounded bool
+}
+
+func (r LexRange) aboveMin(member string) bool {
+	switch {
+	case r.MinUnbounded:
+		return true
+	case r.MinExclusive:
+		return member > r.Min
+	default:
+		return member >= r.Min
+	}
+}
+
+func (r LexRange) belowMax(member string) bool {
+	switch {
+	case r.MaxUnbounded:
+		return true
+	case r.MaxExclusive:
+		return member < r.Max
+	default:
+		return member <= r.Max
+	}
+}
+
+// SortedSet keeps unique members ordered by score. The dictionary gives
+// O(1) score lookups while the skiplist keeps the order and ranks.
+type SortedSet struct {
+	dict map[string]float64
+	zsl  *skiplist
+}
+
+func NewSortedSet() *SortedSet {
+	return &SortedSet{
+		dict: make(map[string]float64),
+		zsl:  newSkiplist(),
+	}
+}
+
+func (zset *SortedSet) Len() int {
+	return len(zset.dict)
+}
+
+func (zset *SortedSet) clone() *SortedSet {
+	clone := &SortedSet{
+		dict: maps.Clone(zset.dict),
+		zsl:  newSkiplist(),
+	}
+	for node := zset.zsl.header.levels[0].forward; node != nil; node = node.levels[0].forward {
+		clone.zsl.insert(node.score, node.member)
+	}
+	return clone
+}
+
+func (zset *SortedSet) Score(member string) (float64, bool) {
+	score, exists := zset.dict[member]
+	return score, exists
+}
+
+// Add sets the score of member, inserting it if needed.
+// Returns true if the member was newly added.
+func (zset *SortedSet) Add(member string, score float64) bool {
+	oldScore, exists := zset.dict[member]
+	if exists {
+		if oldScore != score {
+			zset.zsl.delete(oldScore, member)
+			zset.zsl.insert(score, member)
+			zset.dict[member] = score
+		}
+		return false
+	}
+
+	zset.zsl.insert(score, member)
+	zset.dict[member] = score
+	return true
+}
+
+// Remove deletes member and reports whether it was present.
+func (zset *SortedSet) Remove(member string) bool {
+	score, exists := zset.dict[member]
+	if !exists {
+		return false
+	}
+
+	zset.zsl.delete(score, member)
+	delete(zset.dict, member)
+	return true
+}
+
+// Rank returns the 0-based position of member, counted from the highest
+// score when reverse is true.
+func (zset *SortedSet) Rank(member string, reverse bool) (int, bool) {
+	score, exists := zset.dict[member]
+	if !exists {
+		return 0, false
+	}
+
+	rank := zset.zsl.rank(score, member)
+	if reverse {
+		return zset.Len() - rank, true
+	}
+	return rank - 1, true
+}
+
+// RangeByRank returns members between start and stop (inclusive, negative
+// values count from the end), ordered from the highest score when reverse.
+func (zset *SortedSet) RangeByRank(start, stop int, reverse bool) []ZMember {
+	length := zset.Len()
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= length {
+		stop = length - 1
+	}
+	if start > stop || start >= length {
+		return []ZMember{}
+	}
+
+	result := make([]ZMember, 0, stop-start+1)
+	var node *skiplistNode
+	if reverse {
+		node = zset.zsl.byRank(length - start)
+	} else {
+		node = zset.zsl.byRank(start + 1)
+	}
+
+	for i := start; i <= stop && node != nil; i++ {
+		result = append(result, ZMember{Member: node.member, Score: node.score})
+		if reverse {
+			node = node.backward
+		} else {
+			node = node.levels[0].forward
+		}
+	}
+
+	return result
+}
+
+// Walks nodes from first in the given direction while inRange holds,
+// skipping offset matches and returning at most count of them (count < 0
+// means no limit).
+func collectNodes(first *skiplistNode, reverse bool, inRange func(*skiplistNode) bool, offset, count int) []ZMember {
+	result := make([]ZMember, 0)
+	for node := first; node != nil && inRange(node) && count != 0; {
+		if offset > 0 {
+			offset--
+		} else {
+			result = append(result, ZMember{Member: node.member, Score: node.score})
+			count--
+		}
+
+		if reverse {
+			node = node.backward
+		} else {
+			node = node.levels[0].forward
+		}
+	}
+
+	return result
+}
+
+// RangeByScore returns members with a score within r, ordered from the
+// highest score when reverse.
+func (zset *SortedSet) RangeByScore(r ScoreRange, reverse bool, offset, count int) []ZMember {
+	if r.isEmpty() {
+		return []ZMember{}
+	}
+
+	if reverse {
+		last := zset.zsl.lastMatching(func(n *skiplistNode) bool { return r.belowMax(n.score) })
+		return collectNodes(last, true, func(n *skiplistNode) bool { return r.aboveMin(n.score) }, offset, count)
+	}
+
+	first := zset.zsl.firstMatching(func(n *skiplistNode) bool { return r.aboveMin(n.score) })
+	return collectNodes(first, false, func(n *skiplistNode) bool { return r.belowMax(n.score) }, offset, count)
+}
+
+// RangeByLex returns members within r, ordered backwards when reverse.
+func (zset *SortedSet) RangeByLex(r LexRange, reverse bool, offset, count int) []ZMember {
+	if reverse {
+		last := zset.zsl.lastMatching(func(n *skiplistNode) bool { return r.belowMax(n.member) })
+		return collectNodes(last, true, func(n *skiplistNode) bool { return r.aboveMin(n.member) }, offset, count)
+	}
+
+	first := zset.zsl.firstMatching(func(n *skiplistNode) bool { return r.aboveMin(n.member) })
+	return collectNodes(first, false, func(n *skiplistNode) bool { return r.belowMax(n.member) }, offset, count)
+}
+
+// Count returns the number of members with a score within r.
+func (zset *SortedSet) Count(r ScoreRange) int {
+	if r.isEmpty() {
+		return 0
+	}
+
+	first := zset.zsl.firstMatching(func(n *skiplistNode) bool { return r.aboveMin(n.score) })
+	if first == nil || !r.belowMax(first.score) {
+		return 0
+	}
+	last := zset.zsl.lastMatching(func(n *skiplistNode) bool { return r.belowMax(n.score) })
+
+	return zset.zsl.rank(last.score, last.member) - zset.zsl.rank(first.score, first.member) + 1
+}
+
+// Pop removes and returns up to count members with the lowest scores,
+// or with the highest scores when fromMax is true.
+func (zset *SortedSet) Pop(count int, fromMax bool) []ZMember {
+	popped := make([]ZMember, 0, min(count, zset.Len()))
+	for i := 0; i < count && zset.Len() > 0; i++ {
+		node := zset.zsl.header.levels[0].forward
+		if fromMax {
+			node = zset.zsl.tail
+		}
+
+		popped = append(popped, ZMember{Member: node.member, Score: node.score})
+		zset.Remove(node.member)
+	}
+
+	return popped
+}
+
+// Members returns every member ordered by score.
+func (zset *SortedSet) Members() []ZMember {
+	return zset.RangeByRank(0, -1, false)
+}
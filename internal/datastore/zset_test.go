@@ -0,0 +1,122 @@
+package datastore
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func membersOf(zmembers []ZMember) []string {
+	members := make([]string, len(zmembers))
+	for i, m := range zmembers {
+		members[i] = m.Member
+	}
+	return members
+}
+
+func TestSortedSetOrderingAndRank(t *testing.T) {
+	zset := NewSortedSet()
+	// Insert in reverse to make sure ordering doesn't depend on insertion order
+	for i := 100; i > 0; i-- {
+		zset.Add("m"+strconv.Itoa(i), float64(i))
+	}
+	// Same score members are ordered by member
+	zset.Add("b", 50)
+	zset.Add("a", 50)
+
+	if zset.Len() != 102 {
+		t.Fatalf("Expected 102 members but got %d", zset.Len())
+	}
+
+	tests := []struct {
+		member       string
+		rank         int
+		reverseRank  int
+		shouldExists bool
+	}{
+		{member: "m1", rank: 0, reverseRank: 101, shouldExists: true},
+		{member: "a", rank: 49, reverseRank: 52, shouldExists: true},
+		{member: "b", rank: 50, reverseRank: 51, shouldExists: true},
+		{member: "m50", rank: 51, reverseRank: 50, shouldExists: true},
+		{member: "m100", rank: 101, reverseRank: 0, shouldExists: true},
+		{member: "missing"},
+	}
+
+	for _, tc := range tests {
+		rank, exists := zset.Rank(tc.member, false)
+		if exists != tc.shouldExists || rank != tc.rank {
+			t.Errorf("Rank(%q): expected %d (exists %v) but got %d (exists %v)", tc.member, tc.rank, tc.shouldExists, rank, exists)
+		}
+		reverseRank, _ := zset.Rank(tc.member, true)
+		if tc.shouldExists && reverseRank != tc.reverseRank {
+			t.Errorf("Reverse Rank(%q): expected %d but got %d", tc.member, tc.reverseRank, reverseRank)
+		}
+	}
+
+	// Updating a score moves the member
+	zset.Add("m1", 1000)
+	if rank, _ := zset.Rank("m1", false); rank != 101 {
+		t.Errorf("Expected m1 to be ranked last after update but got rank %d", rank)
+	}
+	if !zset.Remove("m1") || zset.Remove("m1") {
+		t.Errorf("Expected m1 to be removed exactly once")
+	}
+}
+
+func TestSortedSetRanges(t *testing.T) {
+	zset := NewSortedSet()
+	for i, member := range []string{"a", "b", "c", "d", "e"} {
+		zset.Add(member, float64(i+1))
+	}
+
+	tests := []struct {
+		name     string
+		result   []ZMember
+		expected []string
+	}{
+		{name: "rank all", result: zset.RangeByRank(0, -1, false), expected: []string{"a", "b", "c", "d", "e"}},
+		{name: "rank rev", result: zset.RangeByRank(0, 1, true), expected: []string{"e", "d"}},
+		{name: "rank out of range", result: zset.RangeByRank(10, 20, false), expected: []string{}},
+		{
+			name:     "score inclusive",
+			result:   zset.RangeByScore(ScoreRange{Min: 2, Max: 4}, false, 0, -1),
+			expected: []string{"b", "c", "d"},
+		},
+		{
+			name:     "score exclusive",
+			result:   zset.RangeByScore(ScoreRange{Min: 2, Max: 4, MinExclusive: true, MaxExclusive: true}, false, 0, -1),
+			expected: []string{"c"},
+		},
+		{
+			name:     "score rev with limit",
+			result:   zset.RangeByScore(ScoreRange{Min: math.Inf(-1), Max: math.Inf(1)}, true, 1, 2),
+			expected: []string{"d", "c"},
+		},
+		{
+			name:     "lex",
+			result:   zset.RangeByLex(LexRange{Min: "b", Max: "d", MaxExclusive: true}, false, 0, -1),
+			expected: []string{"b", "c"},
+		},
+		{
+			name:     "lex unbounded rev",
+			result:   zset.RangeByLex(LexRange{MinUnbounded: true, MaxUnbounded: true}, true, 0, -1),
+			expected: []string{"e", "d", "c", "b", "a"},
+		},
+	}
+
+	for _, tc := range tests {
+		if !slices.Equal(membersOf(tc.result), tc.expected) {
+			t.Errorf("%s: expected %v but got %v", tc.name, tc.expected, membersOf(tc.result))
+		}
+	}
+
+	if count := zset.Count(ScoreRange{Min: 2, Max: 10}); count != 4 {
+		t.Errorf("Expected count 4 but got %d", count)
+	}
+
+	popped := zset.Pop(2, true)
+	if !slices.Equal(membersOf(popped), []string{"e", "d"}) || zset.Len() != 3 {
+		t.Errorf("Expected to pop [e d] but got %v", membersOf(popped))
+	}
+}
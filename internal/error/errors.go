@@ -8,6 +8,16 @@ var (
 	ErrorNotFullyWritten    = errors.New("data not fully written to socket")
 	ErrorClientDisconnected = errors.New("client disconnected")
 	ErrorReadingSocket      = errors.New("failed to copy data from kernal space to user space")
+	ErrorQueryBufferLimit   = errors.New("client query buffer exceeds the limit")
+
+	ErrorWrongType  = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrorNotInteger = errors.New("ERR value is not an integer or out of range")
+	ErrorSyntax     = errors.New("ERR syntax error")
+	ErrorExpireTime = errors.New("ERR invalid expire time in 'set' command")
+	ErrorNoSuchKey  = errors.New("ERR no such key")
+	ErrorNullArray  = errors.New("target array doesn't exist")
+	ErrorReadOnly   = errors.New("READONLY You can't write against a read only replica.")
+	ErrorNoAuth     = errors.New("NOAUTH Authentication required.")
 
 	ErrorRequeueTask               = errors.New("task executed with failure, needs to be requeued")
 	ErrorWrongCallBackArgumentType = errors.New("callback argument(s) underlying type not correct")
@@ -0,0 +1,33 @@
+package info
+
+import "time"
+
+// Counters reported by INFO stats, reset by CONFIG RESETSTAT
+var (
+	TotalConnectionsReceived int
+	TotalCommandsProcessed   int
+	RejectedConnections      int
+
+	// Keys deleted once their expiry passed, lazily or by the active
+	// expire cycle
+	ExpiredKeys int
+
+	// Running average of the percentage of expired keys among the ones
+	// sampled by the active expire cycle
+	ExpiredStalePerc float64
+
+	// Active expire cycles stopped by their time budget, and the time
+	// spent in them
+	ExpiredTimeCapReachedCount int
+	ExpireCycleTime            time.Duration
+)
+
+func ResetStats() {
+	TotalConnectionsReceived = 0
+	TotalCommandsProcessed = 0
+	RejectedConnections = 0
+	ExpiredKeys = 0
+	ExpiredStalePerc = 0
+	ExpiredTimeCapReachedCount = 0
+	ExpireCycleTime = 0
+}
@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Levels from the most verbose, same as Redis' loglevel
+var levels = []string{"debug", "verbose", "notice", "warning", "nothing"}
+
+const (
+	levelDebug = iota
+	levelVerbose
+	levelNotice
+	levelWarning
+)
+
+var minLevel atomic.Int32
+
+func init() {
+	minLevel.Store(levelNotice)
+}
+
+// SetLevel only lets messages of level or above through
+func SetLevel(level string) error {
+	for i, name := range levels {
+		if strings.EqualFold(level, name) {
+			minLevel.Store(int32(i))
+			return nil
+		}
+	}
+	return errors.New("argument must be one of " + strings.Join(levels, ", "))
+}
+
+// Level returns the current log level
+func Level() string {
+	return levels[minLevel.Load()]
+}
+
+func log(level int32, message string) {
+	if level < minLevel.Load() {
+		return
+	}
+	if !strings.HasSuffix(message, "\n") {
+		message += "\n"
+	}
+	fmt.Print(message)
+}
+
+// Debug logs like fmt.Println, only with loglevel debug
+func Debug(args ...any) { log(levelDebug, fmt.Sprintln(args...)) }
+
+func Debugf(format string, args ...any) { log(levelDebug, fmt.Sprintf(format, args...)) }
+
+func Verbose(args ...any) { log(levelVerbose, fmt.Sprintln(args...)) }
+
+func Verbosef(format string, args ...any) { log(levelVerbose, fmt.Sprintf(format, args...)) }
+
+func Notice(args ...any) { log(levelNotice, fmt.Sprintln(args...)) }
+
+func Noticef(format string, args ...any) { log(levelNotice, fmt.Sprintf(format, args...)) }
+
+func Warning(args ...any) { log(levelWarning, fmt.Sprintln(args...)) }
+
+func Warningf(format string, args ...any) { log(levelWarning, fmt.Sprintf(format, args...)) }
@@ -94,9 +94,8 @@ func (kq *Kqueue) Poll(timeout time.Duration) ([]event, error) {
 	if timeout == -1 {
 		numEvents, err = unix.Kevent(kq.fd, nil, kq.kqEvents, nil)
 	} else {
-		numEvents, err = unix.Kevent(kq.fd, nil, kq.kqEvents, &unix.Timespec{
-			Nsec: int64(timeout * 1000),
-		})
+		timespec := unix.NsecToTimespec(int64(timeout))
+		numEvents, err = unix.Kevent(kq.fd, nil, kq.kqEvents, &timespec)
 	}
 
 	if err != nil {
@@ -0,0 +1,99 @@
+package proto
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SplitArgs splits a line into arguments separated by spaces, the same way
+// Redis reads inline commands and its config file. Arguments can be double quoted, with escapes
+// like \n or \x41, or single quoted, where only \' is escaped.
+func SplitArgs(line string) ([]string, error) {
+	var (
+		args []string
+		i    int
+	)
+	for {
+		for i < len(line) && unicode.IsSpace(rune(line[i])) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+
+		var (
+			arg     strings.Builder
+			quote   byte
+			closing bool
+		)
+		if line[i] == '"' || line[i] == '\'' {
+			quote = line[i]
+			i++
+		}
+		for ; i < len(line); i++ {
+			c := line[i]
+			if quote == 0 {
+				if unicode.IsSpace(rune(c)) {
+					break
+				}
+				arg.WriteByte(c)
+				continue
+			}
+
+			if c == quote {
+				closing = true
+				i++
+				break
+			}
+			if c == '\\' && i+1 < len(line) {
+				next := line[i+1]
+				switch {
+				case quote == '\'' && next == '\'':
+					c = '\''
+				case quote == '\'':
+					arg.WriteByte(c)
+					continue
+				case next == 'x' && i+3 < len(line) && isHex(line[i+2]) && isHex(line[i+3]):
+					n, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					c = byte(n)
+					i += 2
+				default:
+					c = unescape(next)
+				}
+				i++
+			}
+			arg.WriteByte(c)
+		}
+
+		if quote != 0 {
+			// A closing quote must end the argument
+			if !closing || (i < len(line) && !unicode.IsSpace(rune(line[i]))) {
+				return nil, errors.New("unbalanced quotes")
+			}
+		}
+		args = append(args, arg.String())
+	}
+}
+
+func isHex(c byte) bool {
+	return strings.IndexByte("0123456789abcdefABCDEF", c) >= 0
+}
+
+func unescape(c byte) byte {
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'a':
+		return '\a'
+	default:
+		return c
+	}
+}
@@ -0,0 +1,31 @@
+package proto
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{"save 900 1", []string{"save", "900", "1"}},
+		{`  requirepass   "pass word"  `, []string{"requirepass", "pass word"}},
+		{`save ""`, []string{"save", ""}},
+		{`a "\x41\n\"b"`, []string{"a", "A\n\"b"}},
+		{`a 'it\'s \n'`, []string{"a", `it's \n`}},
+	}
+	for _, tt := range tests {
+		args, err := SplitArgs(tt.line)
+		if err != nil || !reflect.DeepEqual(args, tt.expected) {
+			t.Errorf("Expected %q for %s but got %q, %v", tt.expected, tt.line, args, err)
+		}
+	}
+
+	for _, line := range []string{`a "b`, `a "b"c`, `a 'b`} {
+		if _, err := SplitArgs(line); err == nil {
+			t.Errorf("Expected an error for %s", line)
+		}
+	}
+}
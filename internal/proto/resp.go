@@ -2,7 +2,9 @@ package proto
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
 
 	custom_err "github.com/Viet-ph/redis-go/internal/error"
@@ -18,6 +20,20 @@ const (
 	CRLF               = "\r\n"
 )
 
+// Limits on declared lengths, so a malformed or hostile message can't make
+// the decoder allocate huge arrays or wait forever for a bulk string
+const (
+	MaxArrayLength      = 1024 * 1024
+	MaxBulkLength       = 512 * 1024 * 1024
+	MaxInlineLineLength = 64 * 1024
+)
+
+var ErrProtocol = errors.New("Protocol error")
+
+func protocolError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrProtocol, fmt.Sprintf(format, args...))
+}
+
 type Decoder struct {
 	buf *bytes.Buffer
 }
@@ -28,17 +44,20 @@ func NewDecoder(buf *bytes.Buffer) *Decoder {
 	}
 }
 
+// Decode decodes the next message. Error replies are returned as a value
+// of type error, null bulk strings as an empty string and null arrays as a
+// nil []any. io.EOF means the buffer ends before the message does.
 func (decoder *Decoder) Decode() (any, error) {
-	prefix, _, err := decoder.buf.ReadRune()
+	prefix, err := decoder.buf.ReadByte()
 	if err != nil {
 		return nil, err
 	}
 
 	switch prefix {
 	case SimpleStringPrefix:
-		return decoder.decodeSimpleString()
-	// case ErrorPrefix:
-	// 	return decodeError()
+		return decoder.readLine()
+	case ErrorPrefix:
+		return decoder.decodeError()
 	case IntegerPrefix:
 		return decoder.decodeInteger()
 	case BulkStringPrefix:
@@ -46,33 +65,130 @@ func (decoder *Decoder) Decode() (any, error) {
 	case ArrayPrefix:
 		return decoder.decodeArray()
 	default:
-		return nil, fmt.Errorf("unknown prefix: %v", prefix)
+		return nil, protocolError("unknown prefix '%c'", prefix)
+	}
+}
+
+// DecodeNext decodes the first command of buf and consumes it, returning
+// the raw bytes of the command along with its value. Commands not starting
+// with an array prefix are inline commands, a line of space separated
+// arguments as typed in telnet. If the command isn't fully received yet
+// custom_err.ErrorIncompleteRESP is returned and buf is left untouched,
+// so the rest can be appended to it and decoding tried again. Empty and
+// null arrays are skipped, like empty inline lines.
+func DecodeNext(buf *bytes.Buffer) (any, []byte, error) {
+	// Decode from a reader over the same bytes, buf is only consumed once
+	// the whole command is there
+	reader := bytes.NewBuffer(buf.Bytes())
+	var (
+		value   any
+		err     error
+		skipped int
+	)
+	for {
+		skipped = buf.Len() - reader.Len()
+		if reader.Len() > 0 && reader.Bytes()[0] != ArrayPrefix {
+			value, err = decodeInline(reader)
+		} else {
+			value, err = NewDecoder(reader).Decode()
+		}
+		if err != nil {
+			break
+		}
+		if arr, ok := value.([]any); !ok || len(arr) > 0 {
+			break
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		return nil, nil, custom_err.ErrorIncompleteRESP
+	}
+	if err != nil {
+		return nil, nil, err
 	}
+
+	buf.Next(skipped)
+	raw := bytes.Clone(buf.Next(buf.Len() - reader.Len()))
+	return value, raw, nil
 }
 
-func (decoder *Decoder) decodeSimpleString() (string, error) {
+// Inline commands end with a newline, optionally preceded by a carriage
+// return, and their arguments can be quoted like in the config file. Empty
+// lines are skipped.
+func decodeInline(reader *bytes.Buffer) ([]any, error) {
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			if len(line) > MaxInlineLineLength {
+				return nil, protocolError("too big inline request")
+			}
+			return nil, err
+		}
+
+		args, err := SplitArgs(string(bytes.TrimSuffix(line[:len(line)-1], []byte{'\r'})))
+		if err != nil {
+			return nil, protocolError("unbalanced quotes in request")
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		elements := make([]any, len(args))
+		for i, arg := range args {
+			elements[i] = arg
+		}
+		return elements, nil
+	}
+}
+
+// Reads up to the next CRLF, which isn't part of the returned line
+func (decoder *Decoder) readLine() (string, error) {
 	line, err := decoder.buf.ReadString('\n')
 	if err != nil {
 		return "", err
 	}
-	return line[:len(line)-2], nil // Remove CRLF
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", protocolError("expected CRLF")
+	}
+	return line[:len(line)-2], nil
 }
 
-func (decoder *Decoder) decodeInteger() (int64, error) {
-	line, err := decoder.buf.ReadString('\n')
+// Reads the length of a bulk string or an array, -1 meaning null
+func (decoder *Decoder) readLength(max int) (int, error) {
+	line, err := decoder.readLine()
 	if err != nil {
 		return 0, err
 	}
-	return strconv.ParseInt(line[:len(line)-2], 10, 64) // Remove CRLF
+	length, err := strconv.Atoi(line)
+	if err != nil || length < -1 || length > max {
+		return 0, protocolError("invalid length '%s'", line)
+	}
+	return length, nil
 }
 
-func (decoder *Decoder) decodeBulkString() (string, error) {
-	line, err := decoder.buf.ReadString('\n')
+func (decoder *Decoder) decodeError() (error, error) {
+	line, err := decoder.readLine()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	return errors.New(line), nil
+}
+
+func (decoder *Decoder) decodeInteger() (int64, error) {
+	line, err := decoder.readLine()
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseInt(line, 10, 64)
+	if err != nil {
+		return 0, protocolError("invalid integer '%s'", line)
 	}
+	return n, nil
+}
 
-	length, err := strconv.Atoi(line[:len(line)-2]) // Remove CRLF
+// Bulk strings are read by their declared length, they can hold any byte
+// including CR and LF
+func (decoder *Decoder) decodeBulkString() (string, error) {
+	length, err := decoder.readLength(MaxBulkLength)
 	if err != nil {
 		return "", err
 	}
@@ -80,25 +196,23 @@ func (decoder *Decoder) decodeBulkString() (string, error) {
 		return "", nil // Null bulk string
 	}
 
-	data, err := decoder.buf.ReadBytes('\n')
-	if err != nil {
-		return "", err
+	if decoder.buf.Len() < length+len(CRLF) {
+		return "", io.EOF
+	}
+	data := decoder.buf.Next(length + len(CRLF))
+	if !bytes.HasSuffix(data, []byte(CRLF)) {
+		return "", protocolError("expected CRLF after bulk string")
 	}
-
-	//fmt.Println("Decoded string: " + string(data[:length]))
 	return string(data[:length]), nil
 }
 
 func (decoder *Decoder) decodeArray() ([]any, error) {
-	line, err := decoder.buf.ReadString('\n')
-	firstByte := line[0]
+	arrLength, err := decoder.readLength(MaxArrayLength)
 	if err != nil {
 		return nil, err
 	}
-
-	arrLength, err := strconv.Atoi(string(firstByte))
-	if err != nil {
-		return nil, err
+	if arrLength == -1 {
+		return nil, nil // Null array
 	}
 
 	elements := make([]any, arrLength)
@@ -111,26 +225,43 @@ func (decoder *Decoder) decodeArray() ([]any, error) {
 	}
 
 	return elements, nil
-
 }
 
+// Status is a status reply like OK or QUEUED, sent as a simple string.
+// Other strings are values, which can hold any bytes, and are sent as
+// bulk strings.
+type Status string
+
 // Encoder is responsible for encoding RESP messages to an io.Writer.
 type Encoder struct {
 	buf *bytes.Buffer
+
+	// RESP3 types are only sent to connections which asked for them
+	protocol int
 }
 
-// NewEncoder creates a new Encoder.
+// NewEncoder creates a new Encoder, encoding RESP2 until told otherwise.
 func NewEncoder() *Encoder {
 	return &Encoder{
-		buf: bytes.NewBuffer(make([]byte, 0)),
+		buf:      bytes.NewBuffer(make([]byte, 0)),
+		protocol: Resp2,
 	}
 }
 
+// SetProtocol sets the protocol version replies are encoded for
+func (encoder *Encoder) SetProtocol(protocol int) {
+	encoder.protocol = protocol
+}
+
 // Encode takes a Go value and encodes it as a RESP message.
 func (encoder *Encoder) Encode(data any, isSimple bool) error {
 	switch v := data.(type) {
+	case nil:
+		return encoder.encodeNull(BulkStringPrefix)
 	case string:
 		return encoder.encodeString(v, isSimple)
+	case Status:
+		return encoder.encodeString(string(v), true)
 	case error:
 		return encoder.encodeError(v)
 	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
@@ -141,19 +272,38 @@ func (encoder *Encoder) Encode(data any, isSimple bool) error {
 		return nil
 	case []string:
 		return encoder.encodeArray(v)
+	case []any:
+		return encoder.encodeNestedArray(v)
+	case Map:
+		return encoder.encodeMap(v)
+	case Set:
+		return encoder.encodeArrayLike(SetPrefix, v)
+	case Push:
+		return encoder.encodeArrayLike(PushPrefix, v)
+	case Double:
+		return encoder.encodeDouble(v)
+	case Boolean:
+		return encoder.encodeBoolean(v)
+	case BigNumber:
+		return encoder.encodeBigNumber(v)
+	case VerbatimString:
+		return encoder.encodeVerbatimString(v)
+	case Attribute:
+		return encoder.encodeAttribute(v)
 	default:
 		return fmt.Errorf("unsupported type: %T", v)
 	}
 }
 
 func (encoder *Encoder) encodeError(err error) error {
-	var writeData string
-	if err == custom_err.ErrorKeyNotExists {
-		writeData = fmt.Sprintf("%c%d%s", BulkStringPrefix, -1, CRLF)
-	} else {
-		writeData = fmt.Sprintf("%c%s%s", ErrorPrefix, err.Error(), CRLF)
+	switch err {
+	case custom_err.ErrorKeyNotExists:
+		return encoder.encodeNull(BulkStringPrefix)
+	case custom_err.ErrorNullArray:
+		return encoder.encodeNull(ArrayPrefix)
 	}
-	_, err = encoder.buf.WriteString(writeData)
+
+	_, err = encoder.buf.WriteString(fmt.Sprintf("%c%s%s", ErrorPrefix, err.Error(), CRLF))
 	if err != nil {
 		return err
 	}
@@ -191,6 +341,24 @@ func (encoder *Encoder) encodeArray(datas []string) error {
 	return nil
 }
 
+// Encodes an array whose elements can be of any supported type, including
+// other arrays. Strings are encoded as bulk strings.
+func (encoder *Encoder) encodeNestedArray(datas []any) error {
+	_, err := encoder.buf.WriteString(fmt.Sprintf("%c%d%s", ArrayPrefix, len(datas), CRLF))
+	if err != nil {
+		return err
+	}
+
+	for _, data := range datas {
+		err := encoder.Encode(data, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (encoder *Encoder) GetBufValue() []byte {
 	return encoder.buf.Bytes()
 }
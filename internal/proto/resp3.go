@@ -0,0 +1,195 @@
+package proto
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Prefixes of the types added by RESP3
+const (
+	NullPrefix           = '_'
+	DoublePrefix         = ','
+	BooleanPrefix        = '#'
+	BigNumberPrefix      = '('
+	VerbatimStringPrefix = '='
+	MapPrefix            = '%'
+	SetPrefix            = '~'
+	AttributePrefix      = '|'
+	PushPrefix           = '>'
+)
+
+// Protocol versions a connection can speak, negotiated with HELLO
+const (
+	Resp2 = 2
+	Resp3 = 3
+)
+
+// Replies with a RESP3 type of their own. Encoded for a RESP2 connection
+// they fall back to the closest RESP2 type, the way Redis does.
+type (
+	// Keys and values in turn, a flat array in RESP2
+	Map []any
+
+	// An array in RESP2
+	Set []any
+
+	// Out of band data like pub/sub messages, an array in RESP2
+	Push []any
+
+	// A bulk string in RESP2
+	Double float64
+
+	// 1 or 0 in RESP2
+	Boolean bool
+
+	// Decimal digits of an integer too big for 64 bits, a bulk string in
+	// RESP2
+	BigNumber string
+
+	// Text along with its three letters format, txt or mkd. Only the text
+	// is sent in RESP2, as a bulk string.
+	VerbatimString struct {
+		Format string
+		Text   string
+	}
+
+	// Value with extra information about it. Attributes are dropped in
+	// RESP2.
+	Attribute struct {
+		Attributes Map
+		Value      any
+	}
+)
+
+// Strings converts strings to the elements of a Map, Set or Push
+func Strings(values []string) []any {
+	elements := make([]any, len(values))
+	for i, value := range values {
+		elements[i] = value
+	}
+	return elements
+}
+
+// FormatDouble formats a float using the shortest representation that round
+// trips. Like Redis, exponents are only used for very large or very small
+// values.
+func FormatDouble(value float64) string {
+	abs := math.Abs(value)
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	case abs >= 1e17 || (abs != 0 && abs < 1e-4):
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	default:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+}
+
+func (encoder *Encoder) encodeNull(resp2Prefix byte) error {
+	if encoder.protocol == Resp3 {
+		_, err := encoder.buf.WriteString(fmt.Sprintf("%c%s", NullPrefix, CRLF))
+		return err
+	}
+	_, err := encoder.buf.WriteString(fmt.Sprintf("%c%d%s", resp2Prefix, -1, CRLF))
+	return err
+}
+
+// Writes the header of an aggregate type and its elements
+func (encoder *Encoder) encodeAggregate(prefix byte, length int, elements []any) error {
+	_, err := encoder.buf.WriteString(fmt.Sprintf("%c%d%s", prefix, length, CRLF))
+	if err != nil {
+		return err
+	}
+
+	for _, element := range elements {
+		err := encoder.Encode(element, false)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (encoder *Encoder) encodeMap(m Map) error {
+	if len(m)%2 != 0 {
+		return fmt.Errorf("map with a key and no value")
+	}
+	if encoder.protocol == Resp3 {
+		return encoder.encodeAggregate(MapPrefix, len(m)/2, m)
+	}
+	return encoder.encodeAggregate(ArrayPrefix, len(m), m)
+}
+
+// Sets and pushes are arrays with another prefix
+func (encoder *Encoder) encodeArrayLike(prefix byte, elements []any) error {
+	if encoder.protocol != Resp3 {
+		prefix = ArrayPrefix
+	}
+	return encoder.encodeAggregate(prefix, len(elements), elements)
+}
+
+func (encoder *Encoder) encodeDouble(value Double) error {
+	formatted := FormatDouble(float64(value))
+	if encoder.protocol != Resp3 {
+		return encoder.encodeString(formatted, false)
+	}
+	_, err := encoder.buf.WriteString(fmt.Sprintf("%c%s%s", DoublePrefix, formatted, CRLF))
+	return err
+}
+
+func (encoder *Encoder) encodeBoolean(value Boolean) error {
+	if encoder.protocol != Resp3 {
+		if value {
+			return encoder.Encode(1, false)
+		}
+		return encoder.Encode(0, false)
+	}
+
+	b := 'f'
+	if value {
+		b = 't'
+	}
+	_, err := encoder.buf.WriteString(fmt.Sprintf("%c%c%s", BooleanPrefix, b, CRLF))
+	return err
+}
+
+func (encoder *Encoder) encodeBigNumber(value BigNumber) error {
+	if encoder.protocol != Resp3 {
+		return encoder.encodeString(string(value), false)
+	}
+	_, err := encoder.buf.WriteString(fmt.Sprintf("%c%s%s", BigNumberPrefix, value, CRLF))
+	return err
+}
+
+func (encoder *Encoder) encodeVerbatimString(value VerbatimString) error {
+	if encoder.protocol != Resp3 {
+		return encoder.encodeString(value.Text, false)
+	}
+	if len(value.Format) != 3 {
+		return fmt.Errorf("verbatim string format must be three letters: %q", value.Format)
+	}
+
+	data := value.Format + ":" + value.Text
+	_, err := encoder.buf.WriteString(fmt.Sprintf("%c%d%s%s%s", VerbatimStringPrefix, len(data), CRLF, data, CRLF))
+	return err
+}
+
+// The attributes come first, followed by the value they describe
+func (encoder *Encoder) encodeAttribute(value Attribute) error {
+	if encoder.protocol == Resp3 {
+		if len(value.Attributes)%2 != 0 {
+			return fmt.Errorf("map with a key and no value")
+		}
+		err := encoder.encodeAggregate(AttributePrefix, len(value.Attributes)/2, value.Attributes)
+		if err != nil {
+			return err
+		}
+	}
+	return encoder.Encode(value.Value, false)
+}
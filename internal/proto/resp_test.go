@@ -2,6 +2,10 @@ package proto_test
 
 import (
 	"bytes"
+	"errors"
+	"math"
+	"slices"
+	"strings"
 	"testing"
 
 	custom_err "github.com/Viet-ph/redis-go/internal/error"
@@ -98,6 +102,200 @@ func TestDecodeArray(t *testing.T) {
 	}
 }
 
+func TestDecodeLongArray(t *testing.T) {
+	// Lengths with more than one digit
+	args := make([]string, 12)
+	for i := range args {
+		args[i] = strings.Repeat("x", i+5)
+	}
+	encoder := proto.NewEncoder()
+	if err := encoder.Encode(args, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	decoder := proto.NewDecoder(bytes.NewBuffer(encoder.GetBufValue()))
+	result, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	elements := result.([]any)
+	if len(elements) != len(args) {
+		t.Fatalf("Expected array length %d but got %d", len(args), len(elements))
+	}
+	for i, arg := range args {
+		if elements[i] != arg {
+			t.Errorf("Expected array element %d to be %q but got %q", i, arg, elements[i])
+		}
+	}
+}
+
+func TestDecodeBinaryBulkString(t *testing.T) {
+	// The value holds CRLF and a NUL byte
+	encodedData := []byte("$7\r\na\r\nb\nc\x00\r\n")
+	decoder := proto.NewDecoder(bytes.NewBuffer(encodedData))
+
+	result, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "a\r\nb\nc\x00"
+	if result != expected {
+		t.Errorf("Expected %q but got %q", expected, result)
+	}
+}
+
+func TestDecodeNullArray(t *testing.T) {
+	decoder := proto.NewDecoder(bytes.NewBufferString("*-1\r\n"))
+
+	result, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.([]any) != nil {
+		t.Errorf("Expected nil array but got %v", result)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	decoder := proto.NewDecoder(bytes.NewBufferString("-ERR unknown command\r\n"))
+
+	result, err := decoder.Decode()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	replyErr, ok := result.(error)
+	if !ok || replyErr.Error() != "ERR unknown command" {
+		t.Errorf("Expected error reply %q but got %v", "ERR unknown command", result)
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := []string{
+		"?foo\r\n",
+		"*x\r\n",
+		"*-2\r\n",
+		"$3\r\nfoobar\r\n",
+		"$-5\r\n",
+		":12a\r\n",
+		"+OK\n",
+	}
+
+	for _, test := range tests {
+		decoder := proto.NewDecoder(bytes.NewBufferString(test))
+		_, err := decoder.Decode()
+		if !errors.Is(err, proto.ErrProtocol) {
+			t.Errorf("Expected protocol error decoding %q but got %v", test, err)
+		}
+	}
+}
+
+func TestDecodeNextInline(t *testing.T) {
+	buf := bytes.NewBufferString("\r\nSET  key \"hello world\"\r\nPING\n")
+
+	expected := [][]any{{"SET", "key", "hello world"}, {"PING"}}
+	for _, command := range expected {
+		result, _, err := proto.DecodeNext(buf)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !slices.Equal(result.([]any), command) {
+			t.Errorf("Expected %q but got %q", command, result)
+		}
+	}
+
+	// Not terminated yet
+	buf.WriteString("GET key")
+	if _, _, err := proto.DecodeNext(buf); err != custom_err.ErrorIncompleteRESP {
+		t.Errorf("Expected incomplete error but got %v", err)
+	}
+
+	buf.Reset()
+	buf.WriteString("GET \"key\n")
+	if _, _, err := proto.DecodeNext(buf); !errors.Is(err, proto.ErrProtocol) {
+		t.Errorf("Expected protocol error but got %v", err)
+	}
+}
+
+func TestDecodeNextPipelined(t *testing.T) {
+	// Two commands received in a single read
+	first := "*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n"
+	second := "*1\r\n$4\r\nPING\r\n"
+	buf := bytes.NewBufferString(first + second)
+
+	for _, expected := range []string{first, second} {
+		_, raw, err := proto.DecodeNext(buf)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(raw) != expected {
+			t.Errorf("Expected raw message %q but got %q", expected, raw)
+		}
+	}
+
+	if buf.Len() != 0 {
+		t.Errorf("Expected buffer to be consumed but %d bytes are left", buf.Len())
+	}
+}
+
+func TestDecodeNextEmptyArrays(t *testing.T) {
+	command := "*1\r\n$4\r\nPING\r\n"
+	buf := bytes.NewBufferString("*0\r\n*-1\r\n" + command + "*0\r\n")
+
+	result, raw, err := proto.DecodeNext(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !slices.Equal(result.([]any), []any{"PING"}) || string(raw) != command {
+		t.Errorf("Expected the empty arrays to be skipped but got %q", raw)
+	}
+
+	// Skipped once the next command is there
+	if _, _, err := proto.DecodeNext(buf); err != custom_err.ErrorIncompleteRESP {
+		t.Errorf("Expected incomplete error but got %v", err)
+	}
+	buf.WriteString(command)
+	if _, raw, err := proto.DecodeNext(buf); err != nil || string(raw) != command {
+		t.Errorf("Expected %q but got %q, %v", command, raw, err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected buffer to be consumed but %d bytes are left", buf.Len())
+	}
+}
+
+func TestDecodeNextPartial(t *testing.T) {
+	encodedData := "*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n"
+
+	// Feed the message a byte at a time, like split over many reads
+	buf := new(bytes.Buffer)
+	for i := 0; i < len(encodedData)-1; i++ {
+		buf.WriteByte(encodedData[i])
+		_, _, err := proto.DecodeNext(buf)
+		if err != custom_err.ErrorIncompleteRESP {
+			t.Fatalf("Expected incomplete error after %d bytes but got %v", i+1, err)
+		}
+		if buf.Len() != i+1 {
+			t.Fatalf("Expected incomplete message to be left in the buffer")
+		}
+	}
+
+	buf.WriteByte(encodedData[len(encodedData)-1])
+	result, _, err := proto.DecodeNext(buf)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []any{"GET", "foo"}
+	for i, val := range expected {
+		if result.([]any)[i] != val {
+			t.Errorf("Expected array element %d to be %q but got %q", i, val, result.([]any)[i])
+		}
+	}
+}
+
 func TestEncodeSimpleString(t *testing.T) {
 	encoder := proto.NewEncoder()
 
@@ -143,6 +341,22 @@ func TestEncodeBulkString(t *testing.T) {
 	}
 }
 
+func TestEncodeStatus(t *testing.T) {
+	encoder := proto.NewEncoder()
+
+	// Only statuses are simple strings, values can hold CRLF
+	err := encoder.Encode([]any{proto.Status("OK"), "a\r\n:1\r\nb"}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "*2\r\n+OK\r\n$8\r\na\r\n:1\r\nb\r\n"
+	result := string(encoder.GetBufValue())
+	if result != expected {
+		t.Errorf("Expected %q but got %q", expected, result)
+	}
+}
+
 func TestEncodeArray(t *testing.T) {
 	encoder := proto.NewEncoder()
 
@@ -158,6 +372,21 @@ func TestEncodeArray(t *testing.T) {
 	}
 }
 
+func TestEncodeNestedArray(t *testing.T) {
+	encoder := proto.NewEncoder()
+
+	err := encoder.Encode([]any{"1-1", []string{"field", "value"}, 3, custom_err.ErrorNullArray}, false)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "*4\r\n$3\r\n1-1\r\n*2\r\n$5\r\nfield\r\n$5\r\nvalue\r\n:3\r\n*-1\r\n"
+	result := string(encoder.GetBufValue())
+	if result != expected {
+		t.Errorf("Expected %q but got %q", expected, result)
+	}
+}
+
 func TestEncodeError(t *testing.T) {
 	encoder := proto.NewEncoder()
 
@@ -173,3 +402,137 @@ func TestEncodeError(t *testing.T) {
 		t.Errorf("Expected %q but got %q", expected, result)
 	}
 }
+
+func FuzzDecodeNext(f *testing.F) {
+	seeds := []string{
+		"*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n",
+		"*1\r\n$4\r\nPING\r\n*1\r\n$4\r\nPI",
+		"*12\r\n",
+		"*-1\r\n",
+		"*0\r\n*1\r\n$4\r\nPING\r\n",
+		"*3\r\n:1\r\n+OK\r\n-ERR\r\n",
+		"$-1\r\n",
+		"SET key \"value\"\r\n",
+		"\r\n\r\n",
+	}
+	for _, seed := range seeds {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		buf := bytes.NewBuffer(bytes.Clone(data))
+		_, raw, err := proto.DecodeNext(buf)
+		switch {
+		case err == custom_err.ErrorIncompleteRESP:
+			if !bytes.Equal(buf.Bytes(), data) {
+				t.Fatalf("Buffer changed on incomplete message %q", data)
+			}
+		case err != nil:
+		case raw[0] == proto.ArrayPrefix:
+			// The message is what was consumed, after the skipped empty
+			// arrays
+			consumed := data[:len(data)-buf.Len()]
+			if !bytes.Equal(consumed[len(consumed)-len(raw):], raw) || !bytes.HasSuffix(data, buf.Bytes()) {
+				t.Fatalf("Raw message %q isn't what was consumed of %q", raw, data)
+			}
+		}
+	})
+}
+
+func FuzzBulkStringRoundTrip(f *testing.F) {
+	f.Add("hello", "world")
+	f.Add("a\r\nb", "")
+	f.Add("\x00\xff", "$3\r\n")
+
+	f.Fuzz(func(t *testing.T, first, second string) {
+		encoder := proto.NewEncoder()
+		if err := encoder.Encode([]string{first, second}, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		result, _, err := proto.DecodeNext(bytes.NewBuffer(encoder.GetBufValue()))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !slices.Equal(result.([]any), []any{first, second}) {
+			t.Errorf("Expected %q but got %q", []string{first, second}, result)
+		}
+	})
+}
+
+func TestEncodeResp3(t *testing.T) {
+	tests := []struct {
+		data  any
+		resp2 string
+		resp3 string
+	}{
+		{
+			proto.Map{"field", "value", "count", 2},
+			"*4\r\n$5\r\nfield\r\n$5\r\nvalue\r\n$5\r\ncount\r\n:2\r\n",
+			"%2\r\n$5\r\nfield\r\n$5\r\nvalue\r\n$5\r\ncount\r\n:2\r\n",
+		},
+		{
+			proto.Set{"a", "b"},
+			"*2\r\n$1\r\na\r\n$1\r\nb\r\n",
+			"~2\r\n$1\r\na\r\n$1\r\nb\r\n",
+		},
+		{
+			proto.Push{"message", "channel", "hello"},
+			"*3\r\n$7\r\nmessage\r\n$7\r\nchannel\r\n$5\r\nhello\r\n",
+			">3\r\n$7\r\nmessage\r\n$7\r\nchannel\r\n$5\r\nhello\r\n",
+		},
+		{proto.Double(1.5), "$3\r\n1.5\r\n", ",1.5\r\n"},
+		{proto.Double(math.Inf(-1)), "$4\r\n-inf\r\n", ",-inf\r\n"},
+		{proto.Boolean(true), ":1\r\n", "#t\r\n"},
+		{proto.Boolean(false), ":0\r\n", "#f\r\n"},
+		{
+			proto.BigNumber("3492890328409238509324850943850943825024385"),
+			"$43\r\n3492890328409238509324850943850943825024385\r\n",
+			"(3492890328409238509324850943850943825024385\r\n",
+		},
+		{
+			proto.VerbatimString{Format: "txt", Text: "Some string"},
+			"$11\r\nSome string\r\n",
+			"=15\r\ntxt:Some string\r\n",
+		},
+		{
+			proto.Attribute{Attributes: proto.Map{"ttl", 100}, Value: "value"},
+			"$5\r\nvalue\r\n",
+			"|1\r\n$3\r\nttl\r\n:100\r\n$5\r\nvalue\r\n",
+		},
+		{nil, "$-1\r\n", "_\r\n"},
+		{custom_err.ErrorKeyNotExists, "$-1\r\n", "_\r\n"},
+		{custom_err.ErrorNullArray, "*-1\r\n", "_\r\n"},
+		{[]any{proto.Map{}, proto.Set{}}, "*2\r\n*0\r\n*0\r\n", "*2\r\n%0\r\n~0\r\n"},
+	}
+
+	for _, test := range tests {
+		for _, protocol := range []int{proto.Resp2, proto.Resp3} {
+			encoder := proto.NewEncoder()
+			encoder.SetProtocol(protocol)
+			err := encoder.Encode(test.data, false)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			expected := test.resp2
+			if protocol == proto.Resp3 {
+				expected = test.resp3
+			}
+			result := string(encoder.GetBufValue())
+			if result != expected {
+				t.Errorf("Expected %v to encode as %q in RESP%d but got %q", test.data, expected, protocol, result)
+			}
+		}
+	}
+}
+
+func TestEncodeMapMissingValue(t *testing.T) {
+	encoder := proto.NewEncoder()
+	encoder.SetProtocol(proto.Resp3)
+
+	err := encoder.Encode(proto.Map{"key"}, false)
+	if err == nil {
+		t.Errorf("Expected error encoding a map without value")
+	}
+}
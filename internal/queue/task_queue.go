@@ -1,11 +1,11 @@
 package queue
 
 import (
-	"fmt"
 	"reflect"
 	"sync"
 
 	custom_err "github.com/Viet-ph/redis-go/internal/error"
+	"github.com/Viet-ph/redis-go/internal/logger"
 )
 
 // import "github.com/Viet-ph/redis-go/internal/connection"
@@ -76,15 +76,15 @@ func (tq *TaskQueue) DrainQueue() {
 	}
 
 	for len(tq.tasks) > 0 {
-		fmt.Printf("Number of tasks: %d\n", len(tq.tasks))
+		logger.Debugf("Number of tasks: %d\n", len(tq.tasks))
 		task := tq.tasks[0]
 		err := task.Execute()
 		if err != nil {
-			fmt.Println("Error while executing task: " + err.Error())
+			logger.Warning("Error while executing task: " + err.Error())
 			if err == custom_err.ErrorRequeueTask {
 				tq.tasks = append(tq.tasks, task)
 			} else {
-				fmt.Println("Task executed with failure.")
+				logger.Warning("Task executed with failure.")
 				continue
 			}
 		}
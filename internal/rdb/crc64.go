@@ -0,0 +1,32 @@
+package rdb
+
+// CRC64 with the Jones polynomial, the checksum Redis appends to RDB files.
+// Bits are reflected and there's no initial or final xor, which rules out
+// hash/crc64 since it always inverts the CRC.
+const crc64JonesPoly = 0x95AC9329AC4BC9B5 // 0xAD93D23594C935A9 reflected
+
+var crc64JonesTable = makeCrc64Table(crc64JonesPoly)
+
+func makeCrc64Table(poly uint64) *[256]uint64 {
+	table := new([256]uint64)
+	for i := range table {
+		crc := uint64(i)
+		for j := 0; j < 8; j++ {
+			if crc&1 == 1 {
+				crc = (crc >> 1) ^ poly
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+// Updates crc with data, start with 0 for a new checksum
+func crc64Jones(crc uint64, data []byte) uint64 {
+	for _, b := range data {
+		crc = crc64JonesTable[byte(crc)^b] ^ (crc >> 8)
+	}
+	return crc
+}
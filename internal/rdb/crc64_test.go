@@ -0,0 +1,66 @@
+package rdb
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Viet-ph/redis-go/config"
+	"github.com/Viet-ph/redis-go/internal/datastore"
+)
+
+func TestCrc64Jones(t *testing.T) {
+	// Test vector from the Redis sources
+	if crc := crc64Jones(0, []byte("123456789")); crc != 0xe9c6d914c4b8d9ca {
+		t.Errorf("Expected checksum e9c6d914c4b8d9ca but got %016x", crc)
+	}
+
+	// Updating in chunks is the same as all at once
+	if crc := crc64Jones(crc64Jones(0, []byte("1234")), []byte("56789")); crc != 0xe9c6d914c4b8d9ca {
+		t.Errorf("Expected checksum e9c6d914c4b8d9ca but got %016x", crc)
+	}
+}
+
+func TestRdbChecksum(t *testing.T) {
+	ds := datastore.NewDatastore(
+		map[string]*datastore.Data{"key": datastore.NewData("value")},
+		nil,
+	)
+	rdb, err := RdbMarshall(ds)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Flip a bit of the value, the file still parses but the checksum fails
+	valuePos := strings.Index(string(rdb), "value")
+	corrupted := append([]byte(nil), rdb...)
+	corrupted[valuePos] ^= 0x01
+	_, _, err = RdbUnMarshall(corrupted)
+	if err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Expected a checksum error but got %v", err)
+	}
+
+	// Truncated files are rejected
+	for _, n := range []int{1, 8, 9, len(rdb) / 2} {
+		if _, _, err := RdbUnMarshall(rdb[:len(rdb)-n]); err == nil {
+			t.Errorf("Expected an error for a file truncated by %d bytes", n)
+		}
+	}
+
+	// A zero checksum means the file was saved without one
+	unchecked := append([]byte(nil), rdb[:len(rdb)-8]...)
+	unchecked = append(unchecked, make([]byte, 8)...)
+	if _, _, err := RdbUnMarshall(unchecked); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Verification can be turned off
+	config.RdbChecksum = false
+	defer func() { config.RdbChecksum = true }()
+	store, _, err := RdbUnMarshall(corrupted)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if store["key"].GetValue() != "walue" {
+		t.Errorf("Expected corrupted value walue but got %v", store["key"].GetValue())
+	}
+}
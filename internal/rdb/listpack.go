@@ -0,0 +1,234 @@
+package rdb
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strconv"
+)
+
+// Listpack is the compact serialization Redis uses for stream nodes and
+// small aggregates: a 6 bytes header (total bytes and number of elements),
+// the elements each followed by its own length encoded backwards, then a
+// single 0xFF byte.
+const (
+	listpackHeaderSize = 6
+	listpackEnd        = 0xFF
+
+	// Element encodings, small ones keep part of the value in the first byte
+	listpack7BitUint = 0x00
+	listpack6BitStr  = 0x80
+	listpack13BitInt = 0xC0
+	listpack12BitStr = 0xE0
+	listpack32BitStr = 0xF0
+	listpack16BitInt = 0xF1
+	listpack24BitInt = 0xF2
+	listpack32BitInt = 0xF3
+	listpack64BitInt = 0xF4
+)
+
+var errInvalidListpack = errors.New("invalid listpack encoding")
+
+// Reports whether s is the canonical representation of an int64, only
+// those can be stored as integers without changing the value read back.
+func listpackInt(s string) (int64, bool) {
+	value, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || strconv.FormatInt(value, 10) != s {
+		return 0, false
+	}
+	return value, true
+}
+
+func appendListpackElement(buf []byte, element string) []byte {
+	start := len(buf)
+	if value, ok := listpackInt(element); ok {
+		switch {
+		case value >= 0 && value <= 127:
+			buf = append(buf, byte(value))
+		case value >= -4096 && value <= 4095:
+			uvalue := uint64(value) & 0x1FFF
+			buf = append(buf, listpack13BitInt|byte(uvalue>>8), byte(uvalue))
+		case value >= math.MinInt16 && value <= math.MaxInt16:
+			buf = append(buf, listpack16BitInt)
+			buf = GlobalEndian.AppendUint16(buf, uint16(value))
+		case value >= -(1<<23) && value < 1<<23:
+			buf = append(buf, listpack24BitInt, byte(value), byte(value>>8), byte(value>>16))
+		case value >= math.MinInt32 && value <= math.MaxInt32:
+			buf = append(buf, listpack32BitInt)
+			buf = GlobalEndian.AppendUint32(buf, uint32(value))
+		default:
+			buf = append(buf, listpack64BitInt)
+			buf = GlobalEndian.AppendUint64(buf, uint64(value))
+		}
+	} else {
+		length := len(element)
+		switch {
+		case length < 64:
+			buf = append(buf, listpack6BitStr|byte(length))
+		case length < 4096:
+			buf = append(buf, listpack12BitStr|byte(length>>8), byte(length))
+		default:
+			buf = append(buf, listpack32BitStr)
+			buf = GlobalEndian.AppendUint32(buf, uint32(length))
+		}
+		buf = append(buf, element...)
+	}
+
+	return appendListpackBacklen(buf, len(buf)-start)
+}
+
+// The element length is stored after it 7 bits at a time, most significant
+// group first, so the listpack can also be walked from its end.
+func appendListpackBacklen(buf []byte, length int) []byte {
+	size := listpackBacklenSize(length)
+	for i := size - 1; i >= 0; i-- {
+		group := byte(length>>(7*i)) & 0x7F
+		// Every byte but the first one read backwards flags a continuation
+		if i != size-1 {
+			group |= 0x80
+		}
+		buf = append(buf, group)
+	}
+	return buf
+}
+
+// Same thresholds as Redis, which doesn't use the full range of each size
+func listpackBacklenSize(length int) int {
+	switch {
+	case length <= 127:
+		return 1
+	case length < 16383:
+		return 2
+	case length < 2097151:
+		return 3
+	case length < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+func marshallListpack(elements []string) []byte {
+	buf := make([]byte, listpackHeaderSize)
+	for _, element := range elements {
+		buf = appendListpackElement(buf, element)
+	}
+	buf = append(buf, listpackEnd)
+
+	GlobalEndian.PutUint32(buf[0:4], uint32(len(buf)))
+	// The count saturates, readers then have to walk the whole listpack
+	GlobalEndian.PutUint16(buf[4:6], uint16(min(len(elements), math.MaxUint16)))
+	return buf
+}
+
+func unmarshallListpack(data []byte) ([]string, error) {
+	if len(data) < listpackHeaderSize+1 || int(GlobalEndian.Uint32(data[0:4])) != len(data) {
+		return nil, errInvalidListpack
+	}
+
+	elements := make([]string, 0, GlobalEndian.Uint16(data[4:6]))
+	reader := bytes.NewReader(data[listpackHeaderSize:])
+	for {
+		encoding, err := reader.ReadByte()
+		if err != nil {
+			return nil, errInvalidListpack
+		}
+		if encoding == listpackEnd {
+			return elements, nil
+		}
+
+		element, size, err := readListpackElement(reader, encoding)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, element)
+
+		// Skip the backlen, it's only useful when walking backwards
+		if _, err := reader.Seek(int64(listpackBacklenSize(size)), 1); err != nil {
+			return nil, errInvalidListpack
+		}
+	}
+}
+
+// Reads the element whose first byte is encoding. Returns the element and
+// the size of its encoding and data.
+func readListpackElement(reader *bytes.Reader, encoding byte) (string, int, error) {
+	readN := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		if read, _ := reader.Read(b); read != n {
+			return nil, errInvalidListpack
+		}
+		return b, nil
+	}
+	readString := func(length, headerSize int) (string, int, error) {
+		b, err := readN(length)
+		if err != nil {
+			return "", 0, err
+		}
+		return string(b), headerSize + length, nil
+	}
+	formatInt := func(value int64, size int) (string, int, error) {
+		return strconv.FormatInt(value, 10), size, nil
+	}
+
+	switch {
+	case encoding&0x80 == listpack7BitUint:
+		return formatInt(int64(encoding&0x7F), 1)
+	case encoding&0xC0 == listpack6BitStr:
+		return readString(int(encoding&0x3F), 1)
+	case encoding&0xE0 == listpack13BitInt:
+		b, err := readN(1)
+		if err != nil {
+			return "", 0, err
+		}
+		uvalue := int64(encoding&0x1F)<<8 | int64(b[0])
+		// Sign extend the 13 bits
+		if uvalue >= 1<<12 {
+			uvalue -= 1 << 13
+		}
+		return formatInt(uvalue, 2)
+	case encoding&0xF0 == listpack12BitStr:
+		b, err := readN(1)
+		if err != nil {
+			return "", 0, err
+		}
+		return readString(int(encoding&0x0F)<<8|int(b[0]), 2)
+	}
+
+	switch encoding {
+	case listpack16BitInt:
+		b, err := readN(2)
+		if err != nil {
+			return "", 0, err
+		}
+		return formatInt(int64(int16(GlobalEndian.Uint16(b))), 3)
+	case listpack24BitInt:
+		b, err := readN(3)
+		if err != nil {
+			return "", 0, err
+		}
+		// Shift up to the top of an int32 then back down to sign extend
+		value := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return formatInt(int64(value), 4)
+	case listpack32BitInt:
+		b, err := readN(4)
+		if err != nil {
+			return "", 0, err
+		}
+		return formatInt(int64(int32(GlobalEndian.Uint32(b))), 5)
+	case listpack64BitInt:
+		b, err := readN(8)
+		if err != nil {
+			return "", 0, err
+		}
+		return formatInt(int64(GlobalEndian.Uint64(b)), 9)
+	case listpack32BitStr:
+		b, err := readN(4)
+		if err != nil {
+			return "", 0, err
+		}
+		return readString(int(GlobalEndian.Uint32(b)), 5)
+	default:
+		return "", 0, errInvalidListpack
+	}
+}
@@ -0,0 +1,45 @@
+package rdb
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMarshallListpack(t *testing.T) {
+	result := marshallListpack([]string{"hello", "123", "-1", "0123"})
+	expected := []byte{
+		0x19, 0x00, 0x00, 0x00, 0x04, 0x00, // total bytes, number of elements
+		0x85, 'h', 'e', 'l', 'l', 'o', 0x06, // 6 bits string
+		0x7B, 0x01, // 7 bits unsigned int
+		0xDF, 0xFF, 0x02, // 13 bits signed int
+		0x84, '0', '1', '2', '3', 0x05, // not a canonical integer, kept as string
+		0xFF,
+	}
+
+	if !bytes.Equal(result, expected) {
+		t.Errorf("Expected %x but got %x", expected, result)
+	}
+}
+
+func TestListpackRoundTrip(t *testing.T) {
+	elements := []string{
+		"", "0", "127", "128", "-4096", "4095", "-32768", "32767", "-8388608",
+		"8388607", "-2147483648", "2147483647", "-9223372036854775808",
+		"9223372036854775807", "18446744073709551615", "+1", "1.5",
+		strings.Repeat("a", 63), strings.Repeat("b", 64), strings.Repeat("c", 4095), strings.Repeat("d", 20000),
+	}
+
+	result, err := unmarshallListpack(marshallListpack(elements))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !slices.Equal(result, elements) {
+		t.Errorf("Expected %v but got %v", elements, result)
+	}
+
+	if _, err := unmarshallListpack([]byte{0x07, 0x00, 0x00, 0x00, 0x01, 0x00, 0xFF, 0xFF}); err == nil {
+		t.Errorf("Expected an error for a listpack with a wrong total size")
+	}
+}
@@ -0,0 +1,58 @@
+package rdb
+
+import "errors"
+
+var errInvalidLzf = errors.New("invalid LZF compressed string")
+
+// Decompresses LZF data, which Redis uses for long strings when
+// rdbcompression is enabled. The data is a sequence of either literal runs
+// or back references into what has been decompressed so far.
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, outLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		// Literal run of ctrl+1 bytes
+		if ctrl < 1<<5 {
+			end := i + ctrl + 1
+			if end > len(in) || len(out)+ctrl+1 > outLen {
+				return nil, errInvalidLzf
+			}
+			out = append(out, in[i:end]...)
+			i = end
+			continue
+		}
+
+		// Back reference, the 3 most significant bits hold the length minus
+		// 2, or 7 when the length continues in the next byte
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errInvalidLzf
+			}
+			length += int(in[i])
+			i++
+		}
+		length += 2
+
+		if i >= len(in) {
+			return nil, errInvalidLzf
+		}
+		ref := len(out) - (ctrl&0x1F)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 || len(out)+length > outLen {
+			return nil, errInvalidLzf
+		}
+
+		// The reference may overlap with what's being copied, byte by byte
+		for j := 0; j < length; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+
+	if len(out) != outLen {
+		return nil, errInvalidLzf
+	}
+	return out, nil
+}
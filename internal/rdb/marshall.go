@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"math"
+	"slices"
 	"strconv"
+	"time"
 
 	"github.com/Viet-ph/redis-go/config"
 	"github.com/Viet-ph/redis-go/internal/datastore"
@@ -15,6 +18,7 @@ type auxiliary struct {
 	redisBits string
 	ctime     string
 	usedMem   string
+	aofBase   string
 }
 
 func marshallHeader() []byte {
@@ -22,77 +26,92 @@ func marshallHeader() []byte {
 	return []byte(header)
 }
 
-func marshallFooter() []byte {
-	return []byte{EOF} //EOF
+// EOF followed by the checksum of the file, 0 meaning it wasn't computed
+// The EOF op code followed by the CRC64 of everything before the checksum,
+// or 0 when checksums are disabled
+func marshallFooter(rdb []byte) []byte {
+	footer := []byte{EOF}
+	var checksum uint64
+	if config.RdbChecksum {
+		checksum = crc64Jones(crc64Jones(0, rdb), footer)
+	}
+	return binary.LittleEndian.AppendUint64(footer, checksum)
 }
 
+// Each auxiliary field is written as its own AUX op code followed by
+// the field name and value, like Redis does
 func marshallAuxi(auxi auxiliary) ([]byte, error) {
-	marshalldAuxi := []byte{AUX}
-	redisVer, err := marshallString(auxi.redisVer, LengthPrefixed)
-	if err != nil {
-		return nil, err
-	}
-	redisBits, err := marshallString(auxi.redisBits, Int8)
-	if err != nil {
-		return nil, err
+	var marshalldAuxi []byte
+	fields := [][2]string{
+		{"redis-ver", auxi.redisVer},
+		{"redis-bits", auxi.redisBits},
+		{"ctime", auxi.ctime},
+		{"used-mem", auxi.usedMem},
+		{"aof-base", auxi.aofBase},
 	}
-	ctime, err := marshallString(auxi.ctime, LengthPrefixed)
-	if err != nil {
-		return nil, err
-	}
-	usedMem, err := marshallString(auxi.usedMem, Int32)
-	if err != nil {
-		return nil, err
+	for _, field := range fields {
+		key, err := marshallString(field[0], LengthPrefixed)
+		if err != nil {
+			return nil, err
+		}
+		value, err := marshallString(field[1], getStringFormat(field[1]))
+		if err != nil {
+			return nil, err
+		}
+		marshalldAuxi = append(marshalldAuxi, AUX)
+		marshalldAuxi = append(marshalldAuxi, key...)
+		marshalldAuxi = append(marshalldAuxi, value...)
 	}
-	marshalldAuxi = append(marshalldAuxi, redisVer...)
-	marshalldAuxi = append(marshalldAuxi, redisBits...)
-	marshalldAuxi = append(marshalldAuxi, ctime...)
-	marshalldAuxi = append(marshalldAuxi, usedMem...)
 
 	return marshalldAuxi, nil
 }
 
-func marshallDb(ds *datastore.Datastore) ([]byte, error) {
+func marshallDb(snapshot *datastore.Snapshot) ([]byte, error) {
 	var buf bytes.Buffer
-	store, expiry := ds.DeepCopy()
+	storeSize, expirySize := snapshot.Size()
+	now := time.Now().UTC()
 
 	// Indicates the start of a database subsection.
 	buf.Write([]byte{SELECTDB, 0x00})
 
 	// Indicates that key-value hash table size information follows.
 	buf.WriteByte(RESIZEDB)
-	encodedStoreSize, err := getLenghEncoding(uint32(len(store)), LengthPrefixed)
+	encodedStoreSize, err := getLenghEncoding(uint32(storeSize), LengthPrefixed)
 	if err != nil {
 		return nil, err
 	}
 	buf.Write(encodedStoreSize)
 
 	// Indicates that expiry hash table table size information follows.
-	encodedExpirySize, err := getLenghEncoding(uint32(len(expiry)), LengthPrefixed)
+	encodedExpirySize, err := getLenghEncoding(uint32(expirySize), LengthPrefixed)
 	if err != nil {
 		return nil, err
 	}
 	buf.Write(encodedExpirySize)
 
 	// Key-Value pair starts
-	for key, data := range store {
+	err = snapshot.ForEach(func(key string, value any, expireAt time.Time) error {
 		// "expiry time in ms", followed by 8 byte unsigned long
-		if expireAt, hasExpiry := expiry[key]; hasExpiry {
+		if !expireAt.IsZero() {
 			//If data is already expired, skip it
-			if ds.IsExpired(key) {
-				continue
+			if expireAt.Before(now) {
+				return nil
 			}
 			buf.WriteByte(EXPIRETIMEMS)
-			timestamp := expireAt.Unix()
-			binary.Write(&buf, GlobalEndian, timestamp)
+			timestamp := expireAt.UnixMilli()
+			binary.Write(&buf, binary.LittleEndian, timestamp)
 		}
 
-		kvMarshalled, err := marshallKeyValue(key, data.GetValue())
+		kvMarshalled, err := marshallKeyValue(key, value)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		buf.Write(kvMarshalled)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return buf.Bytes(), nil
@@ -117,10 +136,41 @@ func marshallKeyValue(key string, value any) ([]byte, error) {
 	}
 
 	switch v := value.(type) {
-	case string:
-		buf.WriteByte(0x00) // 1 Byte flag indicate string encoding
-		stringfm = getStringFormat(v)
-		valueMarshalled, err = marshallString(value.(string), stringfm)
+	case string, int64:
+		buf.WriteByte(StringType) // 1 Byte flag indicate string encoding
+		str, _ := datastore.StringValue(v)
+		stringfm = getStringFormat(str)
+		valueMarshalled, err = marshallString(str, stringfm)
+		if err != nil {
+			return nil, err
+		}
+	case *datastore.List:
+		buf.WriteByte(ListQuicklist2Type)
+		valueMarshalled, err = marshallList(v)
+		if err != nil {
+			return nil, err
+		}
+	case *datastore.Set:
+		buf.WriteByte(SetType)
+		valueMarshalled, err = marshallStrings(v.Members())
+		if err != nil {
+			return nil, err
+		}
+	case *datastore.Hash:
+		buf.WriteByte(HashType)
+		valueMarshalled, err = marshallHash(v)
+		if err != nil {
+			return nil, err
+		}
+	case *datastore.SortedSet:
+		buf.WriteByte(ZSet2Type)
+		valueMarshalled, err = marshallZSet(v)
+		if err != nil {
+			return nil, err
+		}
+	case *datastore.Stream:
+		buf.WriteByte(StreamListpacks3Type)
+		valueMarshalled, err = marshallStream(v)
 		if err != nil {
 			return nil, err
 		}
@@ -176,6 +226,302 @@ func marshallString(data string, stringfm StringFormat) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// Marshall a sequence of strings as its length followed by each string
+func marshallStrings(datas []string) ([]byte, error) {
+	var buf bytes.Buffer
+	lengthMarshalled, err := getLenghEncoding(uint32(len(datas)), LengthPrefixed)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(lengthMarshalled)
+
+	for _, data := range datas {
+		dataMarshalled, err := marshallString(data, getStringFormat(data))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(dataMarshalled)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Elements per listpack node of a list. Redis bounds nodes by size instead
+// (list-max-listpack-size), any split is fine for readers.
+const listNodeMaxEntries = 128
+
+// Listpack nodes are flagged as packed, a plain node holds one raw element
+const (
+	quicklistNodePlain  = 1
+	quicklistNodePacked = 2
+)
+
+// Marshall a list as a quicklist: the number of nodes followed by each
+// node container type and its listpack
+func marshallList(list *datastore.List) ([]byte, error) {
+	var buf bytes.Buffer
+	values := list.Values()
+	nodes := (len(values) + listNodeMaxEntries - 1) / listNodeMaxEntries
+	lengthMarshalled, err := getLenghEncoding(uint32(nodes), LengthPrefixed)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(lengthMarshalled)
+
+	for start := 0; start < len(values); start += listNodeMaxEntries {
+		node := values[start:min(start+listNodeMaxEntries, len(values))]
+		containerMarshalled, err := getLenghEncoding(quicklistNodePacked, LengthPrefixed)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(containerMarshalled)
+
+		listpackMarshalled, err := marshallString(string(marshallListpack(node)), LengthPrefixed)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(listpackMarshalled)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Marshall a hash as its number of fields followed by each field and value
+func marshallHash(hash *datastore.Hash) ([]byte, error) {
+	var buf bytes.Buffer
+	lengthMarshalled, err := getLenghEncoding(uint32(hash.Len()), LengthPrefixed)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(lengthMarshalled)
+
+	for _, field := range hash.Fields() {
+		value, _ := hash.Get(field)
+		for _, data := range []string{field, value} {
+			dataMarshalled, err := marshallString(data, getStringFormat(data))
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(dataMarshalled)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Marshall a sorted set as its length followed by each member
+// and its score as a 8 bytes little endian double
+func marshallZSet(zset *datastore.SortedSet) ([]byte, error) {
+	var buf bytes.Buffer
+	members := zset.Members()
+	lengthMarshalled, err := getLenghEncoding(uint32(len(members)), LengthPrefixed)
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(lengthMarshalled)
+
+	for _, m := range members {
+		memberMarshalled, err := marshallString(m.Member, getStringFormat(m.Member))
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(memberMarshalled)
+		binary.Write(&buf, GlobalEndian, m.Score)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Entries per listpack node of a stream, Redis default stream-node-max-entries
+const streamNodeMaxEntries = 100
+
+// Flags of each stream entry inside a listpack node
+const (
+	streamItemFlagNone       = 0
+	streamItemFlagDeleted    = 1
+	streamItemFlagSameFields = 2
+)
+
+// Marshall a stream the way Redis does: entries are split in listpack nodes
+// keyed by the ID of their first entry, followed by the stream metadata and
+// consumer groups along with their pending entries lists.
+func marshallStream(stream *datastore.Stream) ([]byte, error) {
+	var buf bytes.Buffer
+	writeLength := func(length uint64) error {
+		lengthMarshalled, err := getLength64Encoding(length)
+		if err != nil {
+			return err
+		}
+		buf.Write(lengthMarshalled)
+		return nil
+	}
+	writeString := func(data string) error {
+		dataMarshalled, err := marshallString(data, getStringFormat(data))
+		if err != nil {
+			return err
+		}
+		buf.Write(dataMarshalled)
+		return nil
+	}
+	writeID := func(id datastore.StreamID) error {
+		if err := writeLength(id.Ms); err != nil {
+			return err
+		}
+		return writeLength(id.Seq)
+	}
+
+	entries := stream.Entries()
+	nodes := (len(entries) + streamNodeMaxEntries - 1) / streamNodeMaxEntries
+	if err := writeLength(uint64(nodes)); err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(entries); start += streamNodeMaxEntries {
+		node := entries[start:min(start+streamNodeMaxEntries, len(entries))]
+		for _, data := range [][]byte{rawStreamID(node[0].ID), marshallListpack(streamNodeElements(node))} {
+			dataMarshalled, err := marshallString(string(data), LengthPrefixed)
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(dataMarshalled)
+		}
+	}
+
+	firstID, _ := stream.FirstID()
+	if err := writeLength(uint64(len(entries))); err != nil {
+		return nil, err
+	}
+	for _, id := range []datastore.StreamID{stream.LastID, firstID, stream.MaxDeletedID} {
+		if err := writeID(id); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeLength(stream.EntriesAdded); err != nil {
+		return nil, err
+	}
+
+	groups := stream.Groups()
+	if err := writeLength(uint64(len(groups))); err != nil {
+		return nil, err
+	}
+	for _, group := range groups {
+		if err := writeString(group.Name); err != nil {
+			return nil, err
+		}
+		if err := writeID(group.LastDeliveredID); err != nil {
+			return nil, err
+		}
+		// -1 (unknown) is stored as the largest 64 bits length
+		if err := writeLength(uint64(group.EntriesRead)); err != nil {
+			return nil, err
+		}
+
+		pending := datastore.SortedPending(group.Pending)
+		if err := writeLength(uint64(len(pending))); err != nil {
+			return nil, err
+		}
+		for _, entry := range pending {
+			buf.Write(rawStreamID(entry.ID))
+			binary.Write(&buf, GlobalEndian, entry.DeliveryTime.UnixMilli())
+			if err := writeLength(uint64(entry.DeliveryCount)); err != nil {
+				return nil, err
+			}
+		}
+
+		consumers := group.SortedConsumers()
+		if err := writeLength(uint64(len(consumers))); err != nil {
+			return nil, err
+		}
+		for _, consumer := range consumers {
+			if err := writeString(consumer.Name); err != nil {
+				return nil, err
+			}
+			binary.Write(&buf, GlobalEndian, consumer.SeenTime.UnixMilli())
+			binary.Write(&buf, GlobalEndian, millisecondsOrUnset(consumer.ActiveTime))
+
+			// Only IDs here, the entries themselves are in the group PEL
+			consumerPending := datastore.SortedPending(consumer.Pending)
+			if err := writeLength(uint64(len(consumerPending))); err != nil {
+				return nil, err
+			}
+			for _, entry := range consumerPending {
+				buf.Write(rawStreamID(entry.ID))
+			}
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Stream IDs used as node keys and in PELs are 16 bytes big endian, so they
+// sort the same way byte by byte
+func rawStreamID(id datastore.StreamID) []byte {
+	raw := make([]byte, 16)
+	binary.BigEndian.PutUint64(raw[:8], id.Ms)
+	binary.BigEndian.PutUint64(raw[8:], id.Seq)
+	return raw
+}
+
+// Zero times (never happened) are stored as -1
+func millisecondsOrUnset(t time.Time) int64 {
+	if t.IsZero() {
+		return -1
+	}
+	return t.UnixMilli()
+}
+
+// Lays out a stream node as its listpack elements. A master entry holding
+// the fields of the first entry comes first, entries with the same fields
+// then only store their values. IDs are stored relative to the first one.
+func streamNodeElements(node []datastore.StreamEntry) []string {
+	itoa := func(v int64) string { return strconv.FormatInt(v, 10) }
+	fieldNames := func(entry datastore.StreamEntry) []string {
+		names := make([]string, 0, len(entry.Fields)/2)
+		for i := 0; i < len(entry.Fields); i += 2 {
+			names = append(names, entry.Fields[i])
+		}
+		return names
+	}
+
+	master := node[0]
+	masterFields := fieldNames(master)
+	// count, deleted, number of master fields, master fields, terminator
+	elements := []string{itoa(int64(len(node))), "0", itoa(int64(len(masterFields)))}
+	elements = append(elements, masterFields...)
+	elements = append(elements, "0")
+
+	for _, entry := range node {
+		msDiff := itoa(int64(entry.ID.Ms - master.ID.Ms))
+		seqDiff := itoa(int64(entry.ID.Seq - master.ID.Seq))
+
+		// Every entry ends with the number of elements before it, so the
+		// listpack can be walked backwards
+		if slices.Equal(fieldNames(entry), masterFields) {
+			elements = append(elements, itoa(streamItemFlagSameFields), msDiff, seqDiff)
+			for i := 1; i < len(entry.Fields); i += 2 {
+				elements = append(elements, entry.Fields[i])
+			}
+			elements = append(elements, itoa(int64(3+len(masterFields))))
+		} else {
+			elements = append(elements, itoa(streamItemFlagNone), msDiff, seqDiff, itoa(int64(len(entry.Fields)/2)))
+			elements = append(elements, entry.Fields...)
+			elements = append(elements, itoa(int64(4+len(entry.Fields))))
+		}
+	}
+
+	return elements
+}
+
+// Same as getLenghEncoding with LengthPrefixed but also handles lengths
+// that don't fit in 32 bits, like stream IDs
+func getLength64Encoding(length uint64) ([]byte, error) {
+	if length <= math.MaxUint32 {
+		return getLenghEncoding(uint32(length), LengthPrefixed)
+	}
+
+	// First byte 0x81, followed by 8 bytes of length in big endian
+	return binary.BigEndian.AppendUint64([]byte{0x81}, length), nil
+}
+
 func getLenghEncoding(length uint32, stringType StringFormat) ([]byte, error) {
 	var buf bytes.Buffer
 	if stringType == LengthPrefixed {
@@ -203,7 +549,7 @@ func getLenghEncoding(length uint32, stringType StringFormat) ([]byte, error) {
 
 			// Write the next 4 bytes for the 32-bit length
 			lengthBytes := make([]byte, 4)
-			GlobalEndian.PutUint32(lengthBytes, length) // Use the specified endianness to write the 32-bit length
+			binary.BigEndian.PutUint32(lengthBytes, length) // Unlike integer encoded strings, lengths are big endian
 			buf.Write(lengthBytes)
 		}
 	} else {
@@ -220,9 +566,10 @@ func getLenghEncoding(length uint32, stringType StringFormat) ([]byte, error) {
 
 // Function to check if a string can be parsed as an integer
 func isInteger(s string) (int64, bool) {
-	// Try to parse the string as an integer
+	// Try to parse the string as an integer, only strings it formats back
+	// to can be encoded as one: "007" or "+1" would come back as "7" and "1"
 	val, err := strconv.ParseInt(s, 10, 64)
-	if err != nil {
+	if err != nil || strconv.FormatInt(val, 10) != s {
 		return 0, false
 	}
 	return val, true
@@ -28,7 +28,7 @@ func TestGetLengthEncoding(t *testing.T) {
 		{
 			length:     70000,
 			stringType: LengthPrefixed,
-			expected:   []byte{0x80, 0x70, 0x11, 0x01, 0x00}, // 0x80 + little-endian encoding of 70000 (0x00011170)
+			expected:   []byte{0x80, 0x00, 0x01, 0x11, 0x70}, // 0x80 + big-endian encoding of 70000 (0x00011170)
 		},
 		// Special encoding (11) for stringType other than LengthPrefixed
 		{
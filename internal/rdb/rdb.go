@@ -12,10 +12,14 @@ import (
 	"os"
 	"runtime"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Viet-ph/redis-go/config"
 	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/logger"
+	"github.com/Viet-ph/redis-go/internal/queue"
 	"golang.org/x/sys/unix"
 )
 
@@ -24,14 +28,51 @@ const EmptyRdbHexString = "524544495330303131fa0972656469732d76657205372e322e30f
 // Endianess
 var GlobalEndian = binary.LittleEndian
 
+// Newest RDB format version that can be loaded
+const MaxRdbVer = 12
+
 // Op codes
 const (
-	EOF      byte = 0xFF
-	SELECTDB byte = 0xFE
-	//EXPIRETIME   byte = 0xFD
-	EXPIRETIMEMS byte = 0xFC
-	RESIZEDB     byte = 0xFB
-	AUX          byte = 0xFA
+	EOF           byte = 0xFF
+	SELECTDB      byte = 0xFE
+	EXPIRETIME    byte = 0xFD
+	EXPIRETIMEMS  byte = 0xFC
+	RESIZEDB      byte = 0xFB
+	AUX           byte = 0xFA
+	FREQ          byte = 0xF9
+	IDLE          byte = 0xF8
+	MODULEAUX     byte = 0xF7
+	FUNCTIONPREGA byte = 0xF6
+	FUNCTION2     byte = 0xF5
+	SLOTINFO      byte = 0xF4
+)
+
+// Value types
+const (
+	StringType  byte = 0x00
+	ListType    byte = 0x01
+	SetType     byte = 0x02
+	ZSetType    byte = 0x03 // Sorted set with scores stored as strings
+	HashType    byte = 0x04
+	ZSet2Type   byte = 0x05 // Sorted set with scores stored as binary doubles
+	ModuleType  byte = 0x06
+	Module2Type byte = 0x07
+
+	// Compact encodings of small aggregates
+	HashZipmapType      byte = 0x09
+	ListZiplistType     byte = 0x0A
+	SetIntsetType       byte = 0x0B
+	ZSetZiplistType     byte = 0x0C
+	HashZiplistType     byte = 0x0D
+	ListQuicklistType   byte = 0x0E // List split in ziplist nodes
+	StreamListpacksType byte = 0x0F
+	HashListpackType    byte = 0x10
+	ZSetListpackType    byte = 0x11
+
+	ListQuicklist2Type   byte = 0x12 // List split in listpack nodes
+	StreamListpacks2Type byte = 0x13 // Stream with entries added and max deleted ID
+	SetListpackType      byte = 0x14
+	StreamListpacks3Type byte = 0x15 // Stream with consumer groups metadata
 )
 
 // String format
@@ -42,6 +83,7 @@ const (
 	Int8           StringFormat = 0x00
 	Int16          StringFormat = 0x01
 	Int32          StringFormat = 0x02
+	LZF            StringFormat = 0x03
 )
 
 // ^uint(0): flips all bits to 1
@@ -50,6 +92,22 @@ const (
 const BitsPerWord = 32 << (^uint(0) >> 63)
 
 func RdbMarshall(ds *datastore.Datastore) ([]byte, error) {
+	snapshot := ds.Snapshot()
+	defer snapshot.Release()
+	return MarshallSnapshot(snapshot, false)
+}
+
+// AofBaseMarshall marshalls the datastore into a base for the append only
+// file, flagged as such through the aof-base auxiliary field
+func AofBaseMarshall(ds *datastore.Datastore) ([]byte, error) {
+	snapshot := ds.Snapshot()
+	defer snapshot.Release()
+	return MarshallSnapshot(snapshot, true)
+}
+
+// MarshallSnapshot marshalls a snapshot of the datastore, it can run in
+// another goroutine while the datastore keeps being modified
+func MarshallSnapshot(snapshot *datastore.Snapshot, aofBase bool) ([]byte, error) {
 	var buf bytes.Buffer
 
 	// Marshall header
@@ -59,11 +117,16 @@ func RdbMarshall(ds *datastore.Datastore) ([]byte, error) {
 	// Marshall auxiliary
 	var m runtime.MemStats
 	runtime.ReadMemStats(&m)
+	aofBaseFlag := "0"
+	if aofBase {
+		aofBaseFlag = "1"
+	}
 	auxiliary, err := marshallAuxi(auxiliary{
 		redisVer:  config.RedisVer,
 		redisBits: strconv.Itoa(BitsPerWord),
-		ctime:     time.Now().UTC().String(),
-		usedMem:   strconv.Itoa(int(m.Alloc / 1024 / 1024)),
+		ctime:     strconv.FormatInt(time.Now().Unix(), 10),
+		usedMem:   strconv.FormatUint(m.Alloc, 10),
+		aofBase:   aofBaseFlag,
 	})
 	if err != nil {
 		return nil, err
@@ -71,17 +134,17 @@ func RdbMarshall(ds *datastore.Datastore) ([]byte, error) {
 	buf.Write(auxiliary)
 
 	// Marshall database
-	dbMarshalled, err := marshallDb(ds)
+	dbMarshalled, err := marshallDb(snapshot)
 	if err != nil {
 		return nil, err
 	}
 	buf.Write(dbMarshalled)
 
 	// Marshall footer
-	footer := marshallFooter()
+	footer := marshallFooter(buf.Bytes())
 	buf.Write(footer)
 
-	fmt.Printf("RDB len: %d\n", len(buf.Bytes()))
+	logger.Debugf("RDB len: %d\n", len(buf.Bytes()))
 
 	return buf.Bytes(), nil
 }
@@ -90,39 +153,29 @@ func RdbUnMarshall(rdb []byte) (map[string]*datastore.Data, map[string]time.Time
 	buf := bytes.NewReader(rdb)
 
 	// Unmarshal header
-	header, err := unmarshalHeader(buf)
+	version, err := unmarshalHeader(buf)
 	if err != nil {
 		return nil, nil, err
 	}
-	fmt.Println("Unmarshal RDB header: " + string(header))
+	logger.Debugf("Unmarshal RDB version: %d\n", version)
 
-	// Unmarshal auxiliary data
-	auxi, err := unmarshalAuxi(buf)
-	if err != nil {
-		return nil, nil, err
-	}
-	fmt.Printf(
-		`
-Unmarshal RDB auxiliary:
-redisVer: %s 
-redisBits: %s
-ctime: %s
-memUsed: %s
-
-`,
-		auxi.redisVer, auxi.redisBits, auxi.ctime, auxi.usedMem)
-
-	// Unmarshal database
+	// Unmarshal auxiliary fields and databases, up to the EOF op code
 	store, expiry, err := unmarshalDb(buf)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Unmarshal footer
-	err = unmarshalFooter(buf)
+	// Unmarshal footer, the checksum covers everything up to the EOF op code
+	dataLen := len(rdb) - buf.Len()
+	checksum, err := unmarshalFooter(buf, version)
 	if err != nil {
 		return nil, nil, err
 	}
+	if config.RdbChecksum && checksum != 0 {
+		if expected := crc64Jones(0, rdb[:dataLen]); checksum != expected {
+			return nil, nil, fmt.Errorf("wrong RDB checksum, expected %016x got %016x", expected, checksum)
+		}
+	}
 
 	return store, expiry, nil
 }
@@ -136,41 +189,58 @@ func rdbExist() bool {
 	return true
 }
 
-func WriteRdbFile(rdbMarshalled []byte) error {
-	rdbFilePath := config.RdbDir + "/" + config.RdbFileName + ".rdb"
-	file, err := os.OpenFile(rdbFilePath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
-	if err != nil {
-		fmt.Println("Error opening file:", err)
-		return err
+// WriteRdbFile replaces the RDB file fileName in dir with rdbMarshalled.
+// The content goes to a temp file first which is renamed over the RDB file
+// once on disk, so a crash or a full disk in the middle of a save never
+// destroys the previous snapshot. Processes reading the file either see
+// the old or the new one, no need for a lock.
+func WriteRdbFile(dir, fileName string, rdbMarshalled []byte) error {
+	rdbFilePath := dir + "/" + fileName + ".rdb"
+
+	// The new file keeps the permissions of the one it replaces
+	mode := os.FileMode(0644)
+	if stat, err := os.Stat(rdbFilePath); err == nil {
+		mode = stat.Mode().Perm()
 	}
-	defer file.Close()
 
-	// Advisory lock here in case multiple redis processes using 1 rdb file.
-	// Advisory locking is not an enforced locking scheme. It will work only if the
-	// participating processes are cooperating by explicitly acquiring locks.
-	// Otherwise, advisory locks will be ignored if a process is not aware of locks at all.
-
-	// An example may help to understand the cooperative locking scheme easier.
-	// Let’s take our rdb file as an example.
-	// -- First, we assume that the file dump.rdb still contains the key-value of [mykey]myvalue.
-	// -- Process A acquires an exclusive lock on the dump.rdb file, then opens and reads the file to get the current value: [mykey]myvalue.
-	// We must understand that the advisory lock was not set by the operating system or file system.
-	// Therefore, even if process A locks the file, process B is still free to read, write, or even delete the file via system calls.
-	// If process B executes file operations without trying to acquire a lock, we say process B is not cooperating with process A.
-	if err := unix.Flock(int(file.Fd()), unix.LOCK_EX); err != nil {
-		return err
+	// Unique name, background saves may overlap with a SAVE
+	file, err := os.CreateTemp(dir, "temp-*.rdb")
+	if err != nil {
+		return fmt.Errorf("failed opening the temp RDB file: %w", err)
 	}
-	// Unlock here may redundant since file.close would unblock it.
-	defer unix.Flock(int(file.Fd()), unix.LOCK_UN)
+	tempPath := file.Name()
 
-	// Write content to the file
 	_, err = file.Write(rdbMarshalled)
+	if err == nil {
+		err = file.Chmod(mode)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed writing the temp RDB file: %w", err)
+	}
+
+	if err := os.Rename(tempPath, rdbFilePath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed moving the temp RDB file on the final destination: %w", err)
+	}
+
+	// Make the rename itself durable
+	dirFile, err := os.Open(dir)
 	if err != nil {
-		fmt.Println("Error writing to file:", err)
-		return err
+		return fmt.Errorf("failed opening the RDB directory: %w", err)
+	}
+	defer dirFile.Close()
+	if err := dirFile.Sync(); err != nil {
+		return fmt.Errorf("failed syncing the RDB directory: %w", err)
 	}
 
-	fmt.Println("RDB wrote sucessfullly.")
+	logger.Notice("RDB wrote sucessfullly.")
 
 	return nil
 }
@@ -231,33 +301,127 @@ func ReadRdbFile() ([]byte, error) {
 	}
 }
 
-// Spawn a goroutine to track total number of key changes
-// and marshall -> write rdb the data
-func PersistData(ds *datastore.Datastore) {
-	numKeyChanges := 0
-	ticker := time.NewTicker(time.Duration(config.Interval) * time.Second)
+// Outcome of the last save, reported by INFO and LASTSAVE
+type SaveInfo struct {
+	// Time of the last successful save, or of the server start
+	LastSave time.Time
+	// Error of the last save attempt, nil if it succeeded
+	LastStatus error
+	// Time and duration of the last save attempt
+	LastAttempt  time.Time
+	LastDuration time.Duration
+}
+
+var (
+	saveInfo   = SaveInfo{LastSave: time.Now()}
+	saveInfoMu sync.Mutex
+)
+
+// LastSaveInfo returns the outcome of the last save
+func LastSaveInfo() SaveInfo {
+	saveInfoMu.Lock()
+	defer saveInfoMu.Unlock()
+	return saveInfo
+}
+
+var ErrBgSaveInProgress = errors.New("ERR Background save already in progress")
+
+var bgSaveInProgress atomic.Bool
+
+// SaveRdb marshalls the datastore and writes it to the RDB file, recording
+// the outcome for LastSaveInfo
+func SaveRdb(ds *datastore.Datastore) error {
+	snapshot := ds.Snapshot()
+	defer snapshot.Release()
+	return saveSnapshot(snapshot, config.RdbDir, config.RdbFileName)
+}
+
+// BgSave saves a snapshot of the datastore to the RDB file in the background.
+// Only one background save runs at a time. It must be called from the event
+// loop so the snapshot isn't taken in the middle of a command.
+func BgSave(ds *datastore.Datastore) error {
+	if !bgSaveInProgress.CompareAndSwap(false, true) {
+		return ErrBgSaveInProgress
+	}
+
+	snapshot := ds.Snapshot()
+	// CONFIG SET can change them from the event loop while saving
+	dir, fileName := config.RdbDir, config.RdbFileName
+	go func() {
+		defer bgSaveInProgress.Store(false)
+		defer snapshot.Release()
+
+		logger.Notice("Background saving started")
+		if err := saveSnapshot(snapshot, dir, fileName); err != nil {
+			logger.Warning("Background saving error: " + err.Error())
+			return
+		}
+		logger.Notice("Background saving terminated with success")
+	}()
+	return nil
+}
+
+// BgSaveInProgress reports whether a background save is running
+func BgSaveInProgress() bool {
+	return bgSaveInProgress.Load()
+}
+
+func saveSnapshot(snapshot *datastore.Snapshot, dir, fileName string) error {
+	start := time.Now()
+	rdbMarshalled, err := MarshallSnapshot(snapshot, false)
+	if err == nil {
+		err = WriteRdbFile(dir, fileName, rdbMarshalled)
+	}
+
+	saveInfoMu.Lock()
+	defer saveInfoMu.Unlock()
+	saveInfo.LastStatus = err
+	saveInfo.LastDuration = time.Since(start)
+	saveInfo.LastAttempt = time.Now()
+	if err == nil {
+		saveInfo.LastSave = saveInfo.LastAttempt
+		snapshot.Saved()
+	}
+	return err
+}
+
+// Same delay as Redis before retrying a background save that failed
+const bgSaveRetryDelay = 5 * time.Second
+
+// Spawn a goroutine checking every second whether the datastore changed,
+// in which case the save points are checked by the event loop
+func PersistData(ds *datastore.Datastore, taskQueue *queue.TaskQueue) {
+	ticker := time.NewTicker(time.Second)
 	go func() {
-		for {
-			select {
-			case <-ds.KeyChangesCh:
-				numKeyChanges++
-			case <-ticker.C:
-				if numKeyChanges >= config.NumKeyChanges {
-					fmt.Println("Saving RDB...")
-					rdbMarshalled, err := RdbMarshall(ds)
-					if err != nil {
-						fmt.Println(err.Error())
-					}
-					err = WriteRdbFile(rdbMarshalled)
-					if err != nil {
-						fmt.Println(err.Error())
-					}
-				}
+		for range ticker.C {
+			if ds.Dirty() > 0 && !BgSaveInProgress() {
+				taskQueue.Add(*queue.NewTask(saveIfNeeded, ds))
 			}
 		}
 	}()
 }
 
+// Starts a background save if any of the save points is reached
+func saveIfNeeded(ds *datastore.Datastore) error {
+	info := LastSaveInfo()
+	if info.LastStatus != nil && time.Since(info.LastAttempt) < bgSaveRetryDelay {
+		return nil
+	}
+
+	dirty := ds.Dirty()
+	for _, savePoint := range config.SavePoints {
+		if dirty >= int64(savePoint.Changes) && time.Since(info.LastSave) >= time.Duration(savePoint.Seconds)*time.Second {
+			logger.Noticef("%d changes in %d seconds. Saving...\n", savePoint.Changes, savePoint.Seconds)
+			// A save already running is as good
+			if err := BgSave(ds); err != ErrBgSaveInProgress {
+				return err
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
 func EmptyRdb() []byte {
 	content, _ := hex.DecodeString(EmptyRdbHexString)
 	// if err != nil {
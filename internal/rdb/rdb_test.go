@@ -0,0 +1,136 @@
+package rdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Viet-ph/redis-go/config"
+	"github.com/Viet-ph/redis-go/internal/datastore"
+)
+
+func TestSaveRdb(t *testing.T) {
+	defer func(dir, name string) {
+		config.RdbDir, config.RdbFileName = dir, name
+	}(config.RdbDir, config.RdbFileName)
+	config.RdbDir, config.RdbFileName = t.TempDir(), "dump"
+
+	ds := datastore.NewDatastore(
+		map[string]*datastore.Data{"key": datastore.NewData("value")},
+		nil,
+	)
+	if err := SaveRdb(ds); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	saved := LastSaveInfo()
+	if saved.LastStatus != nil {
+		t.Errorf("Expected a successful save but got %v", saved.LastStatus)
+	}
+
+	// Only the RDB file is left, no temp file
+	entries, _ := os.ReadDir(config.RdbDir)
+	if len(entries) != 1 || entries[0].Name() != "dump.rdb" {
+		t.Errorf("Expected only dump.rdb but got %v", entries)
+	}
+	rawRdb, err := ReadRdbFile()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if store, _, err := RdbUnMarshall(rawRdb); err != nil || store["key"].GetValue() != "value" {
+		t.Errorf("Expected the saved dataset back but got %v, %v", store, err)
+	}
+
+	// A failed save keeps the previous snapshot and is reported
+	config.RdbDir = filepath.Join(config.RdbDir, "missing")
+	if err := SaveRdb(ds); err == nil {
+		t.Fatalf("Expected an error saving to a missing directory")
+	}
+	failed := LastSaveInfo()
+	if failed.LastStatus == nil || !failed.LastSave.Equal(saved.LastSave) {
+		t.Errorf("Expected an error and the last save time untouched but got %+v", failed)
+	}
+
+	// Saving again keeps the permissions of the file
+	config.RdbDir = filepath.Dir(config.RdbDir)
+	rdbFilePath := filepath.Join(config.RdbDir, "dump.rdb")
+	if err := os.Chmod(rdbFilePath, 0640); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := SaveRdb(ds); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	stat, err := os.Stat(rdbFilePath)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if mode := stat.Mode().Perm(); mode != 0640 {
+		t.Errorf("Expected the RDB file to keep mode 0640 but got %v", mode)
+	}
+}
+
+func TestSaveIfNeeded(t *testing.T) {
+	defer func(dir, name string, savePoints []config.SavePoint) {
+		config.RdbDir, config.RdbFileName, config.SavePoints = dir, name, savePoints
+	}(config.RdbDir, config.RdbFileName, config.SavePoints)
+	config.RdbDir, config.RdbFileName = t.TempDir(), "dump"
+	config.SavePoints = []config.SavePoint{{Seconds: 3600, Changes: 1}, {Seconds: 1, Changes: 2}}
+
+	saveInfoMu.Lock()
+	saveInfo = SaveInfo{LastSave: time.Now().Add(-time.Second)}
+	saveInfoMu.Unlock()
+
+	ds := datastore.NewDatastore(nil, nil)
+	ds.Set("k", "v", nil)
+	if saveIfNeeded(ds); BgSaveInProgress() || ds.Dirty() != 1 {
+		t.Fatalf("Expected no save before a save point is reached")
+	}
+
+	ds.Set("k", "v", nil)
+	if err := saveIfNeeded(ds); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for BgSaveInProgress() {
+		time.Sleep(time.Millisecond)
+	}
+	if ds.Dirty() != 0 {
+		t.Errorf("Expected the changes to be saved but got %d left", ds.Dirty())
+	}
+	if _, err := os.Stat(filepath.Join(config.RdbDir, "dump.rdb")); err != nil {
+		t.Errorf("Expected the RDB file to be written: %v", err)
+	}
+
+	// No save points, no automatic saves
+	config.SavePoints = nil
+	ds.Set("k", "v", nil)
+	saveInfoMu.Lock()
+	saveInfo.LastSave = time.Now().Add(-time.Hour)
+	saveInfoMu.Unlock()
+	if saveIfNeeded(ds); BgSaveInProgress() || ds.Dirty() != 1 {
+		t.Errorf("Expected no save with saving disabled")
+	}
+}
+
+// The paths are the ones configured when BGSAVE was called, even if they
+// are changed while saving
+func TestBgSavePaths(t *testing.T) {
+	defer func(dir, name string) {
+		config.RdbDir, config.RdbFileName = dir, name
+	}(config.RdbDir, config.RdbFileName)
+	dir := t.TempDir()
+	config.RdbDir, config.RdbFileName = dir, "dump"
+
+	ds := datastore.NewDatastore(nil, nil)
+	ds.Set("k", "v", nil)
+	if err := BgSave(ds); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	config.RdbDir, config.RdbFileName = t.TempDir(), "other"
+	for BgSaveInProgress() {
+		time.Sleep(time.Millisecond)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "dump.rdb")); err != nil {
+		t.Errorf("Expected the RDB file in the directory configured at BGSAVE: %v", err)
+	}
+}
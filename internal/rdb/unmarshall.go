@@ -4,181 +4,308 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/logger"
 )
 
-func unmarshalHeader(buf *bytes.Reader) (string, error) {
+// Reads the magic string and returns the RDB format version
+func unmarshalHeader(buf *bytes.Reader) (int, error) {
 	header := make([]byte, 9) // "REDIS0011" (9 bytes)
-	_, err := buf.Read(header)
+	_, err := io.ReadFull(buf, header)
 	if err != nil {
-		return "", err
+		return 0, err
 	}
 
 	if string(header[:5]) != "REDIS" {
-		return "", errors.New("invalid RDB header")
+		return 0, errors.New("invalid RDB header")
 	}
 
-	version := string(header[5:])
-	return version, nil
-}
-
-func unmarshalFooter(buf *bytes.Reader) error {
-	eof, err := buf.ReadByte()
-	if err != nil {
-		return err
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil || version < 1 {
+		return 0, errors.New("invalid RDB version")
 	}
-	if eof != EOF {
-		return errors.New("invalid EOF marker")
+	if version > MaxRdbVer {
+		return 0, fmt.Errorf("can't handle RDB format version %d", version)
 	}
-	return nil
-}
 
-func unmarshalAuxi(buf *bytes.Reader) (auxiliary, error) {
-	var auxi auxiliary
+	return version, nil
+}
 
-	// Verify that the next byte indicates the AUX section
-	auxOpCode, err := buf.ReadByte()
-	if err != nil || auxOpCode != AUX {
-		return auxi, errors.New("invalid AUX marker")
+// Reads the CRC64 checksum following the EOF op code, written since RDB
+// version 5. A file saved without checksum has a zero one instead, a file
+// ending right after EOF was cut off.
+func unmarshalFooter(buf *bytes.Reader, version int) (uint64, error) {
+	if version < 5 {
+		return 0, nil
 	}
 
-	// Unmarshal auxiliary fields
-	auxi.redisVer, err = unmarshallString(buf)
+	var checksum uint64
+	err := binary.Read(buf, binary.LittleEndian, &checksum)
 	if err != nil {
-		return auxi, err
+		return 0, errors.New("truncated RDB checksum")
 	}
-	//fmt.Println("Redis-ver: " + auxi.redisVer)
+	return checksum, nil
+}
 
-	auxi.redisBits, err = unmarshallString(buf)
+// Reads an auxiliary field, its AUX op code already consumed
+func unmarshalAuxi(buf *bytes.Reader) (string, string, error) {
+	key, err := unmarshallString(buf)
 	if err != nil {
-		return auxi, err
+		return "", "", err
 	}
-	//fmt.Println("Redis-bits: " + auxi.redisBits)
-
-	auxi.ctime, err = unmarshallString(buf)
+	value, err := unmarshallString(buf)
 	if err != nil {
-		return auxi, err
+		return "", "", err
 	}
-	//fmt.Println("ctime: " + auxi.ctime)
 
-	auxi.usedMem, err = unmarshallString(buf)
+	return key, value, nil
+}
+
+// Skips the data a module saved on its own, its MODULEAUX op code already
+// consumed. Module values are a sequence of typed values ending with an EOF
+// value, see rdbLoadCheckModuleValue in Redis.
+func skipModuleAux(buf *bytes.Reader) error {
+	const (
+		moduleOpcodeEOF = iota
+		moduleOpcodeSInt
+		moduleOpcodeUInt
+		moduleOpcodeFloat
+		moduleOpcodeDouble
+		moduleOpcodeString
+	)
+
+	// Module ID, then when it has to be loaded as an UINT value
+	if _, err := unmarshalLength64(buf); err != nil {
+		return err
+	}
+	whenOpcode, err := unmarshalLength64(buf)
 	if err != nil {
-		return auxi, err
+		return err
+	}
+	if whenOpcode != moduleOpcodeUInt {
+		return errors.New("invalid module aux data")
+	}
+	if _, err := unmarshalLength64(buf); err != nil {
+		return err
 	}
-	//fmt.Println("Used Memory: " + auxi.usedMem)
 
-	return auxi, nil
+	for {
+		opcode, err := unmarshalLength64(buf)
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case moduleOpcodeEOF:
+			return nil
+		case moduleOpcodeSInt, moduleOpcodeUInt:
+			_, err = unmarshalLength64(buf)
+		case moduleOpcodeFloat:
+			_, err = buf.Seek(4, io.SeekCurrent)
+		case moduleOpcodeDouble:
+			_, err = buf.Seek(8, io.SeekCurrent)
+		case moduleOpcodeString:
+			_, err = unmarshallString(buf)
+		default:
+			return errors.New("invalid module aux data")
+		}
+		if err != nil {
+			return err
+		}
+	}
 }
 
-func unmarshalKeyValue(buf *bytes.Reader) (string, string, error) {
+func unmarshalKeyValue(buf *bytes.Reader) (string, any, error) {
 	// Unmarshall KV follow this order:
 	// 1. value-type
 	// 2. string-encoded key
 	// 3. encoded-value
 	valueType, err := buf.ReadByte()
 	if err != nil {
-		return "", "", err
+		return "", nil, err
 	}
 
 	key, err := unmarshallString(buf)
 	if err != nil {
-		return "", "", err
+		return "", nil, err
 	}
 
-	var value string
-	switch valueType {
-	case 0x00: // String encoding
-		value, err = unmarshallString(buf)
-		if err != nil {
-			return "", "", err
-		}
-	default:
-		return "", "", errors.New("unknown value type")
+	value, err := unmarshalValue(buf, valueType)
+	if err != nil {
+		return "", nil, err
 	}
 
 	return key, value, nil
 }
 
-func unmarshalDb(buf *bytes.Reader) (map[string]*datastore.Data, map[string]time.Time, error) {
-	var (
-		store  map[string]*datastore.Data
-		expiry map[string]time.Time
-	)
-	// Read SELECTDB flag and database index
-	selectDbOpCode, err := buf.ReadByte()
-	if err != nil || selectDbOpCode != SELECTDB {
-		return nil, nil, errors.New("invalid SELECTDB marker")
+func unmarshalValue(buf *bytes.Reader, valueType byte) (any, error) {
+	switch valueType {
+	case StringType:
+		return unmarshallString(buf)
+	case ListType:
+		values, err := unmarshallStrings(buf)
+		if err != nil {
+			return nil, err
+		}
+		return newList(values), nil
+	case ListQuicklistType, ListQuicklist2Type:
+		return unmarshallList(buf, valueType)
+	case SetType:
+		members, err := unmarshallStrings(buf)
+		if err != nil {
+			return nil, err
+		}
+		return datastore.NewSet(members...), nil
+	case ZSetType, ZSet2Type:
+		return unmarshallZSet(buf, valueType)
+	case HashType:
+		return unmarshallHash(buf)
+	case StreamListpacksType, StreamListpacks2Type, StreamListpacks3Type:
+		return unmarshallStream(buf, valueType)
+	case ModuleType, Module2Type:
+		return nil, errors.New("module values are not supported")
 	}
 
-	// Read and discard the DB index (in this example, it's 0x00)
-	_, err = buf.ReadByte()
+	// Everything else is a compact encoding of an aggregate stored as a
+	// single string
+	data, err := unmarshallString(buf)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	// Read RESIZEDB flag and hash table sizes (store size and expiry size)
-	resizeDbFlag, err := buf.ReadByte()
-	if err != nil || resizeDbFlag != RESIZEDB {
-		return nil, nil, errors.New("invalid RESIZEDB marker")
+	var elements []string
+	switch valueType {
+	case HashZipmapType:
+		elements, err = unmarshallZipmap([]byte(data))
+	case ListZiplistType, ZSetZiplistType, HashZiplistType:
+		elements, err = unmarshallZiplist([]byte(data))
+	case SetIntsetType:
+		elements, err = unmarshallIntset([]byte(data))
+	case HashListpackType, ZSetListpackType, SetListpackType:
+		elements, err = unmarshallListpack([]byte(data))
+	default:
+		return nil, errors.New("unknown value type")
 	}
-
-	// Read key-value store size and initialize hash table
-	storeSize, _, err := unmarshalLength(buf)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	store = make(map[string]*datastore.Data, storeSize)
 
-	// Read expiry hash table size and initialize hash table
-	expirySize, _, err := unmarshalLength(buf)
-	if err != nil {
-		return nil, nil, err
+	switch valueType {
+	case ListZiplistType:
+		return newList(elements), nil
+	case SetIntsetType, SetListpackType:
+		return datastore.NewSet(elements...), nil
+	case ZSetZiplistType, ZSetListpackType:
+		return newZSetFromPairs(elements)
+	default:
+		return newHashFromPairs(elements)
 	}
-	expiry = make(map[string]time.Time, expirySize)
+}
+
+// Unmarshal the databases and auxiliary fields following the header, up to
+// and including the EOF op code. redis-go has a single keyspace, the keys
+// of every database are loaded into it. A key found in several databases
+// keeps the value of the first one, the others are reported.
+func unmarshalDb(buf *bytes.Reader) (map[string]*datastore.Data, map[string]time.Time, error) {
+	var (
+		store  = make(map[string]*datastore.Data)
+		expiry = make(map[string]time.Time)
+
+		db int
+		// Expiry of the key coming next, if any
+		expireAt time.Time
+		// Keys already loaded from a previous database, with the database
+		// whose value was dropped
+		collisions []string
+	)
 
-	// Now read key-value pairs
-	for i := 0; i < storeSize; i++ {
-		var (
-			expireAt  time.Time
-			isExpired bool
-			hasExpiry bool
-		)
-		// Check if entry has expiry
-		expireTimeOpCode, err := buf.ReadByte()
+	for {
+		opCode, err := buf.ReadByte()
 		if err != nil {
 			return nil, nil, err
 		}
-		if expireTimeOpCode == EXPIRETIMEMS {
-			var timestamp int64
-			binary.Read(buf, GlobalEndian, &timestamp)
-			expireAt = time.Unix(timestamp, 0)
-			isExpired = expireAt.Before(time.Now().UTC())
-		} else {
-			// Must unread here to set buf offset to previous position
+
+		switch opCode {
+		case EOF:
+			if len(collisions) > 0 {
+				logger.Warningf("%d keys found in several databases, kept their first value and dropped: %s\n",
+					len(collisions), strings.Join(collisions[:min(len(collisions), 10)], ", "))
+			}
+			return store, expiry, nil
+		case AUX:
+			key, value, err := unmarshalAuxi(buf)
+			if err != nil {
+				return nil, nil, err
+			}
+			logger.Debugf("Unmarshal RDB auxiliary %s: %s\n", key, value)
+		case SELECTDB:
+			db, _, err = unmarshalLength(buf)
+		case RESIZEDB:
+			// Store and expiry hash tables sizes, only hints
+			if _, _, err = unmarshalLength(buf); err == nil {
+				_, _, err = unmarshalLength(buf)
+			}
+		case SLOTINFO:
+			// Slot ID and its hash tables sizes, for cluster mode only
+			for i := 0; i < 3 && err == nil; i++ {
+				_, _, err = unmarshalLength(buf)
+			}
+		case EXPIRETIME:
+			var seconds int32
+			err = binary.Read(buf, binary.LittleEndian, &seconds)
+			expireAt = time.Unix(int64(seconds), 0)
+		case EXPIRETIMEMS:
+			var milliseconds int64
+			err = binary.Read(buf, binary.LittleEndian, &milliseconds)
+			expireAt = time.UnixMilli(milliseconds)
+		case FREQ:
+			// LFU and LRU eviction data of the next key, not used
+			_, err = buf.ReadByte()
+		case IDLE:
+			_, err = unmarshalLength64(buf)
+		case MODULEAUX:
+			err = skipModuleAux(buf)
+		case FUNCTION2:
+			// Functions libraries aren't supported, skip their code
+			_, err = unmarshallString(buf)
+		case FUNCTIONPREGA:
+			err = errors.New("functions saved by a pre GA Redis are not supported")
+		default:
+			// Must unread here, the op code is the type of the value
 			_ = buf.UnreadByte()
+			key, value, err := unmarshalKeyValue(buf)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			hasExpiry := !expireAt.IsZero()
+			isExpired := hasExpiry && expireAt.Before(time.Now().UTC())
+			_, loaded := store[key]
+			switch {
+			// Discard storage entry if it's already expired
+			case isExpired:
+			case loaded:
+				collisions = append(collisions, fmt.Sprintf("%s (db %d)", key, db))
+			default:
+				// Add entry into key-value has table and expiry hash table
+				store[key] = datastore.NewData(value)
+				if hasExpiry {
+					expiry[key] = expireAt
+				}
+			}
+			expireAt = time.Time{}
 		}
-
-		key, value, err := unmarshalKeyValue(buf)
 		if err != nil {
 			return nil, nil, err
 		}
-
-		// Discard storage entry if it's already expired
-		if isExpired {
-			continue
-		}
-
-		// Add entry into key-value has table and expiry hash table
-		store[key] = datastore.NewData(value)
-		if hasExpiry {
-			expiry[key] = expireAt
-		}
 	}
-
-	return store, expiry, nil
 }
 
 func unmarshallString(buf *bytes.Reader) (string, error) {
@@ -189,14 +316,14 @@ func unmarshallString(buf *bytes.Reader) (string, error) {
 
 	switch stringFormat {
 	case LengthPrefixed:
+		if length > buf.Len() {
+			return "", errors.New("string actual length not match encoded length")
+		}
 		stringData := make([]byte, length)
-		n, err := buf.Read(stringData)
+		_, err := io.ReadFull(buf, stringData)
 		if err != nil {
 			return "", err
 		}
-		if n < length {
-			return "", errors.New("string actual length not match encoded length")
-		}
 		return string(stringData), nil
 	case Int8:
 		int8Val, err := buf.ReadByte()
@@ -204,7 +331,7 @@ func unmarshallString(buf *bytes.Reader) (string, error) {
 			return "", err
 		}
 		//fmt.Printf("Is Int8: %d\n", int(int8Val))
-		return strconv.Itoa(int(int8Val)), nil
+		return strconv.Itoa(int(int8(int8Val))), nil
 	case Int16:
 		var int16Val int16
 		err := binary.Read(buf, GlobalEndian, &int16Val)
@@ -221,12 +348,517 @@ func unmarshallString(buf *bytes.Reader) (string, error) {
 		}
 		//fmt.Printf("Is Int32: %d\n", int(int32Val))
 		return strconv.Itoa(int(int32Val)), nil
+	case LZF:
+		// Compressed length, uncompressed length then compressed data
+		compressedLen, _, err := unmarshalLength(buf)
+		if err != nil {
+			return "", err
+		}
+		uncompressedLen, _, err := unmarshalLength(buf)
+		if err != nil {
+			return "", err
+		}
+		if compressedLen > buf.Len() {
+			return "", errInvalidLzf
+		}
+		compressed := make([]byte, compressedLen)
+		if _, err := io.ReadFull(buf, compressed); err != nil {
+			return "", err
+		}
+		data, err := lzfDecompress(compressed, uncompressedLen)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
 	default:
 		return "", errors.New("unknown string format")
 	}
 }
 
+// Unmarshall a length followed by that many strings
+func unmarshallStrings(buf *bytes.Reader) ([]string, error) {
+	length, _, err := unmarshalLength(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every string takes at least a byte, don't trust a corrupted length
+	datas := make([]string, 0, min(length, buf.Len()))
+	for i := 0; i < length; i++ {
+		data, err := unmarshallString(buf)
+		if err != nil {
+			return nil, err
+		}
+		datas = append(datas, data)
+	}
+
+	return datas, nil
+}
+
+// Unmarshall a quicklist: a number of nodes each holding a ziplist, or
+// since quicklist 2 a listpack, preceded by its container type. Plain
+// nodes hold a single element.
+func unmarshallList(buf *bytes.Reader, valueType byte) (*datastore.List, error) {
+	nodes, _, err := unmarshalLength(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	list := datastore.NewList()
+	for i := 0; i < nodes; i++ {
+		container := quicklistNodePacked
+		if valueType == ListQuicklist2Type {
+			container, _, err = unmarshalLength(buf)
+			if err != nil {
+				return nil, err
+			}
+		}
+		data, err := unmarshallString(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		var values []string
+		switch {
+		case container == quicklistNodePlain:
+			values = []string{data}
+		case container != quicklistNodePacked:
+			return nil, errors.New("invalid quicklist node container")
+		case valueType == ListQuicklistType:
+			values, err = unmarshallZiplist([]byte(data))
+		default:
+			values, err = unmarshallListpack([]byte(data))
+		}
+		if err != nil {
+			return nil, err
+		}
+		list.RPush(values...)
+	}
+
+	return list, nil
+}
+
+func newList(values []string) *datastore.List {
+	list := datastore.NewList()
+	list.RPush(values...)
+	return list
+}
+
+// Builds a hash out of alternating fields and values
+func newHashFromPairs(elements []string) (*datastore.Hash, error) {
+	if len(elements)%2 != 0 {
+		return nil, errors.New("invalid hash encoding")
+	}
+
+	hash := datastore.NewHash()
+	for i := 0; i < len(elements); i += 2 {
+		hash.Set(elements[i], elements[i+1])
+	}
+	return hash, nil
+}
+
+// Builds a sorted set out of alternating members and scores
+func newZSetFromPairs(elements []string) (*datastore.SortedSet, error) {
+	if len(elements)%2 != 0 {
+		return nil, errors.New("invalid sorted set encoding")
+	}
+
+	zset := datastore.NewSortedSet()
+	for i := 0; i < len(elements); i += 2 {
+		score, err := strconv.ParseFloat(elements[i+1], 64)
+		if err != nil {
+			return nil, errors.New("invalid sorted set score")
+		}
+		zset.Add(elements[i], score)
+	}
+	return zset, nil
+}
+
+// Unmarshall a length followed by that many field and value pairs
+func unmarshallHash(buf *bytes.Reader) (*datastore.Hash, error) {
+	length, _, err := unmarshalLength(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := datastore.NewHash()
+	for i := 0; i < length; i++ {
+		field, err := unmarshallString(buf)
+		if err != nil {
+			return nil, err
+		}
+		value, err := unmarshallString(buf)
+		if err != nil {
+			return nil, err
+		}
+		hash.Set(field, value)
+	}
+
+	return hash, nil
+}
+
+// Unmarshall a length followed by that many member and score pairs. Scores
+// are 8 bytes little endian doubles, or strings in the older ZSetType.
+func unmarshallZSet(buf *bytes.Reader, valueType byte) (*datastore.SortedSet, error) {
+	length, _, err := unmarshalLength(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	zset := datastore.NewSortedSet()
+	for i := 0; i < length; i++ {
+		member, err := unmarshallString(buf)
+		if err != nil {
+			return nil, err
+		}
+
+		var score float64
+		if valueType == ZSetType {
+			score, err = unmarshallStringScore(buf)
+		} else {
+			err = binary.Read(buf, GlobalEndian, &score)
+		}
+		if err != nil {
+			return nil, err
+		}
+		zset.Add(member, score)
+	}
+
+	return zset, nil
+}
+
+// Scores of ZSetType are stored as a 1 byte length followed by the score
+// formatted as a string. Lengths 253 to 255 stand for nan, inf and -inf.
+func unmarshallStringScore(buf *bytes.Reader) (float64, error) {
+	length, err := buf.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch length {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+
+	score := make([]byte, length)
+	if _, err := io.ReadFull(buf, score); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(score), 64)
+}
+
+// Unmarshall a stream in any of the listpacks layouts. The first version
+// lacks the entries added and deleted entries metadata, the second one
+// the consumers active time.
+func unmarshallStream(buf *bytes.Reader, valueType byte) (*datastore.Stream, error) {
+	var err error
+	readID := func() (datastore.StreamID, error) {
+		var id datastore.StreamID
+		if id.Ms, err = unmarshalLength64(buf); err != nil {
+			return id, err
+		}
+		id.Seq, err = unmarshalLength64(buf)
+		return id, err
+	}
+	readRawID := func() (datastore.StreamID, error) {
+		raw := make([]byte, 16)
+		if _, err := io.ReadFull(buf, raw); err != nil {
+			return datastore.StreamID{}, err
+		}
+		return datastore.StreamID{Ms: binary.BigEndian.Uint64(raw[:8]), Seq: binary.BigEndian.Uint64(raw[8:])}, nil
+	}
+	readTime := func() (time.Time, error) {
+		var ms int64
+		if err := binary.Read(buf, GlobalEndian, &ms); err != nil {
+			return time.Time{}, err
+		}
+		if ms == -1 {
+			return time.Time{}, nil
+		}
+		return time.UnixMilli(ms), nil
+	}
+
+	stream := datastore.NewStream()
+	nodes, err := unmarshalLength64(buf)
+	if err != nil {
+		return nil, err
+	}
+	for range nodes {
+		rawMaster, err := unmarshallString(buf)
+		if err != nil {
+			return nil, err
+		}
+		if len(rawMaster) != 16 {
+			return nil, errors.New("invalid stream node key")
+		}
+		masterID := datastore.StreamID{
+			Ms:  binary.BigEndian.Uint64([]byte(rawMaster[:8])),
+			Seq: binary.BigEndian.Uint64([]byte(rawMaster[8:])),
+		}
+
+		rawListpack, err := unmarshallString(buf)
+		if err != nil {
+			return nil, err
+		}
+		elements, err := unmarshallListpack([]byte(rawListpack))
+		if err != nil {
+			return nil, err
+		}
+		if err := addStreamNodeEntries(stream, masterID, elements); err != nil {
+			return nil, err
+		}
+	}
+
+	// Entries count is implied by the nodes
+	if _, err := unmarshalLength64(buf); err != nil {
+		return nil, err
+	}
+	if stream.LastID, err = readID(); err != nil {
+		return nil, err
+	}
+	// Without the metadata, entries added defaults to the entries loaded
+	if valueType != StreamListpacksType {
+		// First ID is implied by the nodes as well
+		if _, err := readID(); err != nil {
+			return nil, err
+		}
+		if stream.MaxDeletedID, err = readID(); err != nil {
+			return nil, err
+		}
+		if stream.EntriesAdded, err = unmarshalLength64(buf); err != nil {
+			return nil, err
+		}
+	}
+
+	groupsCount, err := unmarshalLength64(buf)
+	if err != nil {
+		return nil, err
+	}
+	for range groupsCount {
+		name, err := unmarshallString(buf)
+		if err != nil {
+			return nil, err
+		}
+		lastID, err := readID()
+		if err != nil {
+			return nil, err
+		}
+		// Unknown unless saved along with the group
+		entriesRead := int64(-1)
+		if valueType != StreamListpacksType {
+			read, err := unmarshalLength64(buf)
+			if err != nil {
+				return nil, err
+			}
+			entriesRead = int64(read)
+		}
+		group, created := stream.CreateGroup(name, lastID, entriesRead)
+		if !created {
+			return nil, errors.New("duplicated stream consumer group")
+		}
+
+		pendingCount, err := unmarshalLength64(buf)
+		if err != nil {
+			return nil, err
+		}
+		for range pendingCount {
+			id, err := readRawID()
+			if err != nil {
+				return nil, err
+			}
+			deliveryTime, err := readTime()
+			if err != nil {
+				return nil, err
+			}
+			deliveryCount, err := unmarshalLength64(buf)
+			if err != nil {
+				return nil, err
+			}
+			group.Pending[id] = &datastore.PendingEntry{ID: id, DeliveryTime: deliveryTime, DeliveryCount: int(deliveryCount)}
+		}
+
+		consumersCount, err := unmarshalLength64(buf)
+		if err != nil {
+			return nil, err
+		}
+		for range consumersCount {
+			name, err := unmarshallString(buf)
+			if err != nil {
+				return nil, err
+			}
+			seenTime, err := readTime()
+			if err != nil {
+				return nil, err
+			}
+			consumer, _ := group.Consumer(name, seenTime)
+			// Seen time is the best estimate older layouts give
+			consumer.ActiveTime = seenTime
+			if valueType == StreamListpacks3Type {
+				if consumer.ActiveTime, err = readTime(); err != nil {
+					return nil, err
+				}
+			}
+
+			consumerPending, err := unmarshalLength64(buf)
+			if err != nil {
+				return nil, err
+			}
+			for range consumerPending {
+				id, err := readRawID()
+				if err != nil {
+					return nil, err
+				}
+				// Consumer PELs reference entries of the group PEL
+				if _, exists := group.Pending[id]; !exists {
+					return nil, errors.New("stream consumer pending entry missing from group")
+				}
+				group.Claim(id, consumer)
+			}
+		}
+	}
+
+	return stream, nil
+}
+
+// Adds the entries of a stream listpack node, skipping deleted ones
+func addStreamNodeEntries(stream *datastore.Stream, masterID datastore.StreamID, elements []string) error {
+	errInvalidNode := errors.New("invalid stream listpack node")
+	pos := 0
+	next := func() (string, error) {
+		if pos >= len(elements) {
+			return "", errInvalidNode
+		}
+		pos++
+		return elements[pos-1], nil
+	}
+	nextInt := func() (int64, error) {
+		element, err := next()
+		if err != nil {
+			return 0, err
+		}
+		value, err := strconv.ParseInt(element, 10, 64)
+		if err != nil {
+			return 0, errInvalidNode
+		}
+		return value, nil
+	}
+	// Counts can't exceed the elements left, guards allocations on corrupted nodes
+	nextCount := func() (int64, error) {
+		value, err := nextInt()
+		if err != nil {
+			return 0, err
+		}
+		if value < 0 || value > int64(len(elements)-pos) {
+			return 0, errInvalidNode
+		}
+		return value, nil
+	}
+
+	// Master entry: count, deleted, master fields, terminator
+	count, err := nextInt()
+	if err != nil {
+		return err
+	}
+	deleted, err := nextInt()
+	if err != nil {
+		return err
+	}
+	masterFieldsCount, err := nextCount()
+	if err != nil {
+		return err
+	}
+	masterFields := make([]string, masterFieldsCount)
+	for i := range masterFields {
+		if masterFields[i], err = next(); err != nil {
+			return err
+		}
+	}
+	if _, err := next(); err != nil {
+		return err
+	}
+
+	for range count + deleted {
+		flags, err := nextInt()
+		if err != nil {
+			return err
+		}
+		msDiff, err := nextInt()
+		if err != nil {
+			return err
+		}
+		seqDiff, err := nextInt()
+		if err != nil {
+			return err
+		}
+
+		var fields []string
+		if flags&streamItemFlagSameFields != 0 {
+			fields = make([]string, 0, len(masterFields)*2)
+			for _, field := range masterFields {
+				value, err := next()
+				if err != nil {
+					return err
+				}
+				fields = append(fields, field, value)
+			}
+		} else {
+			fieldsCount, err := nextCount()
+			if err != nil {
+				return err
+			}
+			fields = make([]string, fieldsCount*2)
+			for i := range fields {
+				if fields[i], err = next(); err != nil {
+					return err
+				}
+			}
+		}
+		// Number of elements of the entry, only needed to walk backwards
+		if _, err := next(); err != nil {
+			return err
+		}
+
+		if flags&streamItemFlagDeleted != 0 {
+			continue
+		}
+		id := datastore.StreamID{Ms: masterID.Ms + uint64(msDiff), Seq: masterID.Seq + uint64(seqDiff)}
+		if id.Compare(stream.LastID) <= 0 && stream.Len() > 0 {
+			return errors.New("stream entries out of order")
+		}
+		stream.Add(id, fields)
+	}
+
+	return nil
+}
+
+// Unmarshall a length that may not fit in 32 bits, like stream IDs
+func unmarshalLength64(buf *bytes.Reader) (uint64, error) {
+	length, stringFormat, err := readLength(buf)
+	if err != nil {
+		return 0, err
+	}
+	if stringFormat != LengthPrefixed {
+		return 0, errors.New("invalid length encoding")
+	}
+	return length, nil
+}
+
 func unmarshalLength(buf *bytes.Reader) (int, StringFormat, error) {
+	length, stringFormat, err := readLength(buf)
+	if err != nil {
+		return 0, LengthPrefixed, err
+	}
+	if length > math.MaxInt {
+		return 0, LengthPrefixed, errors.New("length too large")
+	}
+	return int(length), stringFormat, nil
+}
+
+func readLength(buf *bytes.Reader) (uint64, StringFormat, error) {
 	firstByte, err := buf.ReadByte()
 	if err != nil {
 		return 0, LengthPrefixed, err
@@ -238,23 +870,33 @@ func unmarshalLength(buf *bytes.Reader) (int, StringFormat, error) {
 	switch sizeEncodingBits {
 	case 0x00:
 		// Case 1: Length fits in 6 bits (0-63)
-		return int(firstByte & 0x3F), LengthPrefixed, nil
+		return uint64(firstByte & 0x3F), LengthPrefixed, nil
 	case 0x01:
 		// Case 2: Length fits in 14 bits (64-16383)
 		secondByte, err := buf.ReadByte()
 		if err != nil {
 			return 0, LengthPrefixed, err
 		}
-		length := ((int(firstByte & 0x3F)) << 8) | int(secondByte)
+		length := ((uint64(firstByte & 0x3F)) << 8) | uint64(secondByte)
 		return length, LengthPrefixed, nil
 	case 0x02:
-		// Case 3: Length fits in 32 bits (16384 or larger)
-		var length uint32
-		err := binary.Read(buf, GlobalEndian, &length)
-		if err != nil {
-			return 0, LengthPrefixed, err
+		// Case 3: Length in the next 4 bytes (0x80) or 8 bytes (0x81), big endian
+		switch firstByte {
+		case 0x80:
+			var length uint32
+			err := binary.Read(buf, binary.BigEndian, &length)
+			if err != nil {
+				return 0, LengthPrefixed, err
+			}
+			return uint64(length), LengthPrefixed, nil
+		case 0x81:
+			var length uint64
+			err := binary.Read(buf, binary.BigEndian, &length)
+			if err != nil {
+				return 0, LengthPrefixed, err
+			}
+			return length, LengthPrefixed, nil
 		}
-		return int(length), LengthPrefixed, nil
 	case 0x03:
 		// Special encoding (11)
 		format := firstByte & 0x3F
@@ -265,6 +907,8 @@ func unmarshalLength(buf *bytes.Reader) (int, StringFormat, error) {
 			return 2, Int16, nil
 		case 2:
 			return 4, Int32, nil
+		case 3:
+			return 0, LZF, nil
 		}
 	default:
 	}
@@ -2,7 +2,19 @@ package rdb
 
 import (
 	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
 )
 
 func TestUnmarshalKeyValue(t *testing.T) {
@@ -140,3 +152,445 @@ func TestUnmarshalLength_EdgeCases(t *testing.T) {
 		}
 	}
 }
+
+func TestStreamRoundTrip(t *testing.T) {
+	stream := datastore.NewStream()
+	// More entries than a node holds, with both the master fields layout
+	// and entries carrying their own fields
+	for i := uint64(1); i <= 150; i++ {
+		fields := []string{"temp", strconv.FormatUint(i, 10)}
+		if i%7 == 0 {
+			fields = []string{"other", "field", "temp", "-1"}
+		}
+		stream.Add(datastore.StreamID{Ms: 1000 + i/3, Seq: i % 3}, fields)
+	}
+	stream.Delete(datastore.StreamID{Ms: 1001, Seq: 0})
+
+	now := time.UnixMilli(time.Now().UnixMilli())
+	group, _ := stream.CreateGroup("group", datastore.StreamID{Ms: 1002, Seq: 1}, -1)
+	alice, _ := group.Consumer("alice", now)
+	group.Consumer("idle", now)
+	group.Deliver(datastore.StreamID{Ms: 1000, Seq: 1}, alice, now)
+	group.Deliver(datastore.StreamID{Ms: 1000, Seq: 2}, alice, now)
+	alice.ActiveTime = now
+	stream.CreateGroup("empty", datastore.MinStreamID, 0)
+
+	marshalled, err := marshallKeyValue("stream", stream)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_, value, err := unmarshalKeyValue(bytes.NewReader(marshalled))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	result, ok := value.(*datastore.Stream)
+	if !ok {
+		t.Fatalf("Expected a stream but got %T", value)
+	}
+
+	if !reflect.DeepEqual(result.Entries(), stream.Entries()) {
+		t.Errorf("Entries differ after round trip")
+	}
+	if result.LastID != stream.LastID || result.MaxDeletedID != stream.MaxDeletedID || result.EntriesAdded != stream.EntriesAdded {
+		t.Errorf("Metadata differs: got %v %v %d", result.LastID, result.MaxDeletedID, result.EntriesAdded)
+	}
+
+	resultGroup, exists := result.Group("group")
+	if !exists || resultGroup.LastDeliveredID != group.LastDeliveredID || resultGroup.EntriesRead != -1 {
+		t.Fatalf("Group not restored: %+v", resultGroup)
+	}
+	if !reflect.DeepEqual(resultGroup.Pending, group.Pending) || !reflect.DeepEqual(resultGroup.Consumers, group.Consumers) {
+		t.Errorf("Group PEL or consumers differ after round trip")
+	}
+	if _, exists := result.Group("empty"); !exists {
+		t.Errorf("Expected the empty group to be restored")
+	}
+}
+
+func TestAggregatesRoundTrip(t *testing.T) {
+	list := datastore.NewList()
+	for i := 0; i < 300; i++ {
+		list.RPush(strconv.Itoa(i), "element")
+	}
+	hash := datastore.NewHash()
+	hash.Set("field", "value")
+	hash.Set("counter", "-42")
+	zset := datastore.NewSortedSet()
+	zset.Add("a", 1.5)
+	zset.Add("b", -3)
+
+	tests := []struct {
+		name  string
+		value any
+		equal func(any) bool
+	}{
+		{
+			name:  "list",
+			value: list,
+			equal: func(v any) bool {
+				result, ok := v.(*datastore.List)
+				return ok && reflect.DeepEqual(result.Values(), list.Values())
+			},
+		},
+		{
+			name:  "hash",
+			value: hash,
+			equal: func(v any) bool {
+				result, ok := v.(*datastore.Hash)
+				return ok && reflect.DeepEqual(result.SortedFields(), hash.SortedFields()) &&
+					reflect.DeepEqual(fieldValues(result), fieldValues(hash))
+			},
+		},
+		{
+			name:  "set",
+			value: datastore.NewSet("x", "y", "100"),
+			equal: func(v any) bool {
+				result, ok := v.(*datastore.Set)
+				return ok && result.Len() == 3 && result.Contains("x") && result.Contains("100")
+			},
+		},
+		{
+			name:  "zset",
+			value: zset,
+			equal: func(v any) bool {
+				result, ok := v.(*datastore.SortedSet)
+				return ok && reflect.DeepEqual(result.Members(), zset.Members())
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		marshalled, err := marshallKeyValue(tc.name, tc.value)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		key, value, err := unmarshalKeyValue(bytes.NewReader(marshalled))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+		if key != tc.name || !tc.equal(value) {
+			t.Errorf("%s: value differs after round trip", tc.name)
+		}
+	}
+}
+
+// Integers stored as int64 come back as their string, and strings which
+// only look like integers keep their form
+func TestStringsRoundTrip(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{int64(7), "7"},
+		{int64(-70000), "-70000"},
+		{int64(12345678901), "12345678901"},
+		{"007", "007"},
+		{"+1", "+1"},
+		{"-0", "-0"},
+	}
+
+	for _, tc := range tests {
+		marshalled, err := marshallKeyValue("k", tc.value)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.value, err)
+		}
+		_, value, err := unmarshalKeyValue(bytes.NewReader(marshalled))
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", tc.value, err)
+		}
+		if value != tc.expected {
+			t.Errorf("Expected %q after round trip, got %v", tc.expected, value)
+		}
+	}
+}
+
+func TestUnmarshalPlainList(t *testing.T) {
+	encoded := []byte{ListType, 0x01, 'l', 0x02, 0x01, 'a', 0xC0, 0x07}
+	_, value, err := unmarshalKeyValue(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	list, ok := value.(*datastore.List)
+	if !ok || !reflect.DeepEqual(list.Values(), []string{"a", "7"}) {
+		t.Errorf("Unexpected list %v", value)
+	}
+}
+
+func fieldValues(hash *datastore.Hash) []string {
+	values := make([]string, 0, hash.Len())
+	for _, field := range hash.SortedFields() {
+		value, _ := hash.Get(field)
+		values = append(values, value)
+	}
+	return values
+}
+
+func sortedMembers(set *datastore.Set) []string {
+	members := set.Members()
+	slices.Sort(members)
+	return members
+}
+
+func TestUnmarshallEmptyRdb(t *testing.T) {
+	rdb, _ := hex.DecodeString(EmptyRdbHexString)
+	store, expiry, err := RdbUnMarshall(rdb)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(store) != 0 || len(expiry) != 0 {
+		t.Errorf("Expected an empty dataset but got %d keys", len(store))
+	}
+}
+
+func TestUnmarshallRedisDump(t *testing.T) {
+	expireAt := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+
+	rdb := []byte("REDIS0009")
+	rdb = append(rdb, AUX, 0x09)
+	rdb = append(rdb, "redis-ver"...)
+	rdb = append(rdb, 0x05)
+	rdb = append(rdb, "5.0.7"...)
+	rdb = append(rdb, AUX, 0x0A)
+	rdb = append(rdb, "redis-bits"...)
+	rdb = append(rdb, 0xC0, 0x40)
+	// Module aux data: 64 bits module ID, when, then a string value and EOF
+	rdb = append(rdb, MODULEAUX, 0x81, 0, 0, 0, 0, 0, 0, 0, 0x2A, 0x02, 0x02, 0x05, 0x01, 'x', 0x00)
+	rdb = append(rdb, FUNCTION2, 0x03, 'l', 'i', 'b')
+	rdb = append(rdb, SELECTDB, 0x00, RESIZEDB, 0x08, 0x02)
+
+	// String with an expiry in milliseconds and eviction metadata
+	rdb = append(rdb, EXPIRETIMEMS)
+	rdb = binary.LittleEndian.AppendUint64(rdb, uint64(expireAt.UnixMilli()))
+	rdb = append(rdb, IDLE, 0x05, StringType, 0x01, 's', 0x01, 'v')
+	// Expired long ago, with an expiry in seconds
+	rdb = append(rdb, EXPIRETIME)
+	rdb = binary.LittleEndian.AppendUint32(rdb, 1000)
+	rdb = append(rdb, StringType, 0x01, 'e', 0x01, 'v')
+	// LZF compressed "aaaaaaaaaa": a literal then a back reference
+	rdb = append(rdb, FREQ, 0x03, StringType, 0x01, 'z', 0xC3, 0x05, 0x0A, 0x00, 'a', 0xE0, 0x00, 0x00)
+	// Ziplist with a string, an immediate, int16, int24 and another string
+	rdb = append(rdb, ListZiplistType, 0x01, 'l', 0x20,
+		0x20, 0, 0, 0, 0x18, 0, 0, 0, 0x05, 0,
+		0x00, 0x01, 'a',
+		0x03, 0xFD,
+		0x02, 0xC0, 0xD4, 0xFE,
+		0x04, 0xF0, 0x70, 0x11, 0x01,
+		0x05, 0x05, 'h', 'e', 'l', 'l', 'o',
+		0xFF)
+	// Intset of 16 bits integers
+	rdb = append(rdb, SetIntsetType, 0x01, 'i', 0x0E, 0x02, 0, 0, 0, 0x03, 0, 0, 0, 0x01, 0x00, 0xFE, 0xFF, 0x2C, 0x01)
+	// Zipmap, the second value has 2 free bytes after it
+	rdb = append(rdb, HashZipmapType, 0x01, 'h', 0x12, 0x02, 0x03, 'f', 'o', 'o', 0x03, 0x00, 'b', 'a', 'r', 0x01, 'x', 0x01, 0x02, 'y', 0, 0, 0xFF)
+	// Sorted set with string scores
+	rdb = append(rdb, ZSetType, 0x01, 'o', 0x02, 0x01, 'm', 0x03, '1', '.', '5', 0x01, 'n', 0xFE)
+	rdb = append(rdb, EOF, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	store, expiry, err := RdbUnMarshall(rdb)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(store) != 6 {
+		t.Errorf("Expected 6 keys but got %d", len(store))
+	}
+	if !expiry["s"].Equal(expireAt) || len(expiry) != 1 {
+		t.Errorf("Expected s to expire at %v but got %v", expireAt, expiry)
+	}
+	if value := store["z"].GetValue(); value != "aaaaaaaaaa" {
+		t.Errorf("Unexpected LZF decompressed value %q", value)
+	}
+	if list, ok := store["l"].GetValue().(*datastore.List); !ok || !reflect.DeepEqual(list.Values(), []string{"a", "12", "-300", "70000", "hello"}) {
+		t.Errorf("Unexpected ziplist value %v", store["l"].GetValue())
+	}
+	if set, ok := store["i"].GetValue().(*datastore.Set); !ok || set.Len() != 3 || !set.Contains("-2") || !set.Contains("300") {
+		t.Errorf("Unexpected intset value %v", store["i"].GetValue())
+	}
+	if hash, ok := store["h"].GetValue().(*datastore.Hash); !ok || !reflect.DeepEqual(fieldValues(hash), []string{"bar", "y"}) {
+		t.Errorf("Unexpected zipmap value %v", store["h"].GetValue())
+	}
+	if zset, ok := store["o"].GetValue().(*datastore.SortedSet); !ok || zset.Len() != 2 {
+		t.Errorf("Unexpected sorted set value %v", store["o"].GetValue())
+	} else if score, _ := zset.Score("n"); !math.IsInf(score, 1) {
+		t.Errorf("Expected n to have an infinite score but got %v", score)
+	}
+}
+
+// redis-go has a single keyspace, the keys of all databases are merged in
+// it, the first database a key is found in wins
+func TestUnmarshallMultipleDatabases(t *testing.T) {
+	expireAt := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+
+	rdb := []byte("REDIS0011")
+	rdb = append(rdb, SELECTDB, 0x00, RESIZEDB, 0x02, 0x00)
+	rdb = append(rdb, StringType, 0x01, 'a', 0x02, '0', 'a')
+	rdb = append(rdb, StringType, 0x01, 'b', 0x02, '0', 'b')
+	// Expired, the key is free for the next databases
+	rdb = append(rdb, EXPIRETIME)
+	rdb = binary.LittleEndian.AppendUint32(rdb, 1000)
+	rdb = append(rdb, StringType, 0x01, 'e', 0x02, '0', 'e')
+
+	rdb = append(rdb, SELECTDB, 0x01, RESIZEDB, 0x03, 0x01)
+	rdb = append(rdb, StringType, 0x01, 'a', 0x02, '1', 'a')
+	rdb = append(rdb, EXPIRETIMEMS)
+	rdb = binary.LittleEndian.AppendUint64(rdb, uint64(expireAt.UnixMilli()))
+	rdb = append(rdb, StringType, 0x01, 'c', 0x02, '1', 'c')
+	rdb = append(rdb, StringType, 0x01, 'e', 0x02, '1', 'e')
+
+	// Database numbers above 63 take two bytes
+	rdb = append(rdb, SELECTDB, 0x40, 0x64)
+	rdb = append(rdb, EXPIRETIMEMS)
+	rdb = binary.LittleEndian.AppendUint64(rdb, uint64(expireAt.UnixMilli()))
+	rdb = append(rdb, StringType, 0x01, 'b', 0x04, '1', '0', '0', 'b')
+	rdb = append(rdb, SetType, 0x01, 's', 0x01, 0x01, 'm')
+	rdb = append(rdb, EOF, 0, 0, 0, 0, 0, 0, 0, 0)
+
+	store, expiry, err := RdbUnMarshall(rdb)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]string{"a": "0a", "b": "0b", "c": "1c", "e": "1e"}
+	for key, value := range expected {
+		if data, exists := store[key]; !exists || data.GetValue() != value {
+			t.Errorf("Expected %s to hold %q but got %v", key, value, store[key])
+		}
+	}
+	if set, ok := store["s"].GetValue().(*datastore.Set); !ok || !set.Contains("m") {
+		t.Errorf("Expected s to be loaded from database 100 but got %v", store["s"])
+	}
+	if len(store) != 5 {
+		t.Errorf("Expected 5 keys but got %d", len(store))
+	}
+	// The expiry of a dropped value isn't kept either
+	if !expiry["c"].Equal(expireAt) || len(expiry) != 1 {
+		t.Errorf("Expected only c to expire, at %v, but got %v", expireAt, expiry)
+	}
+}
+
+// Dumps saved by real Redis servers, see testdata/README.md
+func TestUnmarshallRedisFixtures(t *testing.T) {
+	type dataset = map[string]*datastore.Data
+	tests := []struct {
+		file  string
+		keys  int
+		check func(t *testing.T, store dataset, expiry map[string]time.Time)
+	}{
+		{file: "multiple_databases.rdb", keys: 2, check: func(t *testing.T, store dataset, expiry map[string]time.Time) {
+			if store["key_in_zeroth_database"].GetValue() != "zero" || store["key_in_second_database"].GetValue() != "second" {
+				t.Errorf("Unexpected values %v", store)
+			}
+		}},
+		{file: "rdb_version_5_with_checksum.rdb", keys: 6, check: func(t *testing.T, store dataset, expiry map[string]time.Time) {
+			if value := store["longerstring"].GetValue(); value != "thisisalongerstring.idontknowwhatitmeans" {
+				t.Errorf("Unexpected value %q", value)
+			}
+		}},
+		{file: "rdb_v7_list_quicklist.rdb", keys: 1, check: func(t *testing.T, store dataset, expiry map[string]time.Time) {
+			if list, ok := store["foo"].GetValue().(*datastore.List); !ok || !reflect.DeepEqual(list.Values(), []string{"bar", "baz", "boo"}) {
+				t.Errorf("Unexpected quicklist value %v", store["foo"].GetValue())
+			}
+		}},
+		{file: "intset_16.rdb", keys: 1, check: func(t *testing.T, store dataset, expiry map[string]time.Time) {
+			if set, ok := store["intset_16"].GetValue().(*datastore.Set); !ok || !reflect.DeepEqual(sortedMembers(set), []string{"32764", "32765", "32766"}) {
+				t.Errorf("Unexpected intset value %v", store["intset_16"].GetValue())
+			}
+		}},
+		{file: "intset_64.rdb", keys: 1, check: func(t *testing.T, store dataset, expiry map[string]time.Time) {
+			expected := []string{"9223090557583032316", "9223090557583032317", "9223090557583032318"}
+			if set, ok := store["intset_64"].GetValue().(*datastore.Set); !ok || !reflect.DeepEqual(sortedMembers(set), expected) {
+				t.Errorf("Unexpected intset value %v", store["intset_64"].GetValue())
+			}
+		}},
+		{file: "easily_compressible_string_key.rdb", keys: 1, check: func(t *testing.T, store dataset, expiry map[string]time.Time) {
+			if value := store[strings.Repeat("a", 200)].GetValue(); value != "Key that redis should compress easily" {
+				t.Errorf("Unexpected LZF compressed key value %v", value)
+			}
+		}},
+		{file: "hash_as_ziplist.rdb", keys: 1, check: func(t *testing.T, store dataset, expiry map[string]time.Time) {
+			hash, ok := store["zipmap_compresses_easily"].GetValue().(*datastore.Hash)
+			if !ok || !reflect.DeepEqual(hash.SortedFields(), []string{"a", "aa", "aaaaa"}) || !reflect.DeepEqual(fieldValues(hash), []string{"aa", "aaaa", "aaaaaaaaaaaaaa"}) {
+				t.Errorf("Unexpected ziplist hash value %v", store["zipmap_compresses_easily"].GetValue())
+			}
+		}},
+		{file: "sorted_set_as_ziplist.rdb", keys: 1, check: func(t *testing.T, store dataset, expiry map[string]time.Time) {
+			zset, ok := store["sorted_set_as_ziplist"].GetValue().(*datastore.SortedSet)
+			if !ok || zset.Len() != 3 {
+				t.Fatalf("Unexpected ziplist sorted set value %v", store["sorted_set_as_ziplist"].GetValue())
+			}
+			scores := map[string]float64{
+				"8b6ba6718a786daefa69438148361901": 1,
+				"cb7a24bb7528f934b841b34c3a73e0c7": 2.37,
+				"523af537946b79c4f8369ed39ba78605": 3.423,
+			}
+			for member, expected := range scores {
+				if score, _ := zset.Score(member); score != expected {
+					t.Errorf("Expected %s to score %v but got %v", member, expected, score)
+				}
+			}
+		}},
+		{file: "keys_with_mixed_expiry.rdb", keys: 4, check: func(t *testing.T, store dataset, expiry map[string]time.Time) {
+			_, expires01 := expiry["key01"]
+			_, expires04 := expiry["key04"]
+			if !expires01 || !expires04 || len(expiry) != 2 {
+				t.Errorf("Expected key01 and key04 to expire but got %v", expiry)
+			}
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.file, func(t *testing.T) {
+			rdb, err := os.ReadFile(filepath.Join("testdata", tc.file))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			store, expiry, err := RdbUnMarshall(rdb)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(store) != tc.keys {
+				t.Errorf("Expected %d keys but got %d", tc.keys, len(store))
+			}
+			tc.check(t, store, expiry)
+		})
+	}
+}
+
+// The checksum of a real dump is verified, not only read past
+func TestUnmarshallRedisFixtureCorrupted(t *testing.T) {
+	rdb, err := os.ReadFile(filepath.Join("testdata", "rdb_v7_list_quicklist.rdb"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Flips a byte of the "boo" list element
+	rdb[len(rdb)-12] ^= 0x20
+	if _, _, err := RdbUnMarshall(rdb); err == nil {
+		t.Error("Expected a checksum error for the corrupted dump")
+	}
+}
+
+func TestRdbRoundTrip(t *testing.T) {
+	expireAt := time.UnixMilli(time.Now().Add(time.Hour).UnixMilli())
+	ds := datastore.NewDatastore(
+		map[string]*datastore.Data{
+			"string":  datastore.NewData("value"),
+			"integer": datastore.NewData("-70000"),
+			"hash":    datastore.NewData(datastore.NewHash()),
+		},
+		map[string]time.Time{"string": expireAt},
+	)
+
+	rdb, err := RdbMarshall(ds)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	store, expiry, err := RdbUnMarshall(rdb)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(store) != 3 || store["integer"].GetValue() != "-70000" {
+		t.Errorf("Unexpected store after round trip: %v", store)
+	}
+	if !expiry["string"].Equal(expireAt) {
+		t.Errorf("Expected expiry %v but got %v", expireAt, expiry["string"])
+	}
+}
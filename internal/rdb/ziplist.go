@@ -0,0 +1,244 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// Ziplists, intsets and zipmaps are the compact encodings written by older
+// Redis versions for small aggregates. Only decoding is supported, redis-go
+// writes listpacks instead.
+const (
+	ziplistHeaderSize = 10
+	ziplistEnd        = 0xFF
+
+	// Entries whose previous entry is longer than 253 bytes store its
+	// length in the 4 bytes after this marker
+	ziplistBigPrevLen = 0xFE
+
+	// Integer encodings
+	ziplistInt16 = 0xC0
+	ziplistInt32 = 0xD0
+	ziplistInt64 = 0xE0
+	ziplistInt24 = 0xF0
+	ziplistInt8  = 0xFE
+)
+
+var (
+	errInvalidZiplist = errors.New("invalid ziplist encoding")
+	errInvalidIntset  = errors.New("invalid intset encoding")
+	errInvalidZipmap  = errors.New("invalid zipmap encoding")
+)
+
+func unmarshallZiplist(data []byte) ([]string, error) {
+	if len(data) < ziplistHeaderSize+1 || int(binary.LittleEndian.Uint32(data[0:4])) != len(data) {
+		return nil, errInvalidZiplist
+	}
+
+	elements := make([]string, 0, binary.LittleEndian.Uint16(data[8:10]))
+	pos := ziplistHeaderSize
+	readN := func(n int) ([]byte, error) {
+		if pos+n > len(data) {
+			return nil, errInvalidZiplist
+		}
+		pos += n
+		return data[pos-n : pos], nil
+	}
+
+	for {
+		if pos >= len(data) {
+			return nil, errInvalidZiplist
+		}
+		if data[pos] == ziplistEnd {
+			return elements, nil
+		}
+
+		// Length of the previous entry, only useful when walking backwards
+		prevLenSize := 1
+		if data[pos] == ziplistBigPrevLen {
+			prevLenSize = 5
+		}
+		encoding, err := readN(prevLenSize + 1)
+		if err != nil {
+			return nil, err
+		}
+		enc := encoding[prevLenSize]
+
+		var element string
+		switch enc >> 6 {
+		case 0x00:
+			b, err := readN(int(enc & 0x3F))
+			if err != nil {
+				return nil, err
+			}
+			element = string(b)
+		case 0x01:
+			b, err := readN(1)
+			if err != nil {
+				return nil, err
+			}
+			b, err = readN(int(enc&0x3F)<<8 | int(b[0]))
+			if err != nil {
+				return nil, err
+			}
+			element = string(b)
+		case 0x02:
+			b, err := readN(4)
+			if err != nil {
+				return nil, err
+			}
+			b, err = readN(int(binary.BigEndian.Uint32(b)))
+			if err != nil {
+				return nil, err
+			}
+			element = string(b)
+		default:
+			value, err := readZiplistInt(enc, readN)
+			if err != nil {
+				return nil, err
+			}
+			element = strconv.FormatInt(value, 10)
+		}
+		elements = append(elements, element)
+	}
+}
+
+func readZiplistInt(enc byte, readN func(int) ([]byte, error)) (int64, error) {
+	// 4 bits immediate between 0 and 12, stored plus one
+	if enc >= 0xF1 && enc <= 0xFD {
+		return int64(enc&0x0F) - 1, nil
+	}
+
+	var size int
+	switch enc {
+	case ziplistInt8:
+		size = 1
+	case ziplistInt16:
+		size = 2
+	case ziplistInt24:
+		size = 3
+	case ziplistInt32:
+		size = 4
+	case ziplistInt64:
+		size = 8
+	default:
+		return 0, errInvalidZiplist
+	}
+
+	b, err := readN(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return int64(int8(b[0])), nil
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b))), nil
+	case 3:
+		// Shift up to the top of an int32 then back down to sign extend
+		return int64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8), nil
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(b))), nil
+	default:
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	}
+}
+
+// An intset is a sorted array of integers all stored with the same width:
+// the width in bytes and the number of integers, then the integers.
+func unmarshallIntset(data []byte) ([]string, error) {
+	if len(data) < 8 {
+		return nil, errInvalidIntset
+	}
+	width := int(binary.LittleEndian.Uint32(data[0:4]))
+	length := int(binary.LittleEndian.Uint32(data[4:8]))
+	if (width != 2 && width != 4 && width != 8) || len(data) != 8+width*length {
+		return nil, errInvalidIntset
+	}
+
+	members := make([]string, 0, length)
+	for i := 0; i < length; i++ {
+		b := data[8+i*width : 8+(i+1)*width]
+		var value int64
+		switch width {
+		case 2:
+			value = int64(int16(binary.LittleEndian.Uint16(b)))
+		case 4:
+			value = int64(int32(binary.LittleEndian.Uint32(b)))
+		default:
+			value = int64(binary.LittleEndian.Uint64(b))
+		}
+		members = append(members, strconv.FormatInt(value, 10))
+	}
+
+	return members, nil
+}
+
+// A zipmap holds alternating fields and values, each prefixed by its
+// length. Values are followed by a number of unused bytes to skip.
+func unmarshallZipmap(data []byte) ([]string, error) {
+	if len(data) < 2 {
+		return nil, errInvalidZipmap
+	}
+
+	var elements []string
+	pos := 1 // Skip the number of entries, it saturates anyway
+	readLength := func() (int, error) {
+		if pos >= len(data) {
+			return 0, errInvalidZipmap
+		}
+		length := int(data[pos])
+		pos++
+		if length < 254 {
+			return length, nil
+		}
+		if length == 255 || pos+4 > len(data) {
+			return 0, errInvalidZipmap
+		}
+		pos += 4
+		return int(binary.LittleEndian.Uint32(data[pos-4 : pos])), nil
+	}
+	readString := func(length, skip int) (string, error) {
+		if pos+length+skip > len(data) {
+			return "", errInvalidZipmap
+		}
+		s := string(data[pos : pos+length])
+		pos += length + skip
+		return s, nil
+	}
+
+	for {
+		if pos >= len(data) {
+			return nil, errInvalidZipmap
+		}
+		if data[pos] == ziplistEnd {
+			return elements, nil
+		}
+
+		length, err := readLength()
+		if err != nil {
+			return nil, err
+		}
+		field, err := readString(length, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		length, err = readLength()
+		if err != nil {
+			return nil, err
+		}
+		if pos >= len(data) {
+			return nil, errInvalidZipmap
+		}
+		free := int(data[pos])
+		pos++
+		value, err := readString(length, free)
+		if err != nil {
+			return nil, err
+		}
+
+		elements = append(elements, field, value)
+	}
+}
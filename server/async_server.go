@@ -1,7 +1,6 @@
 package server
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"net"
@@ -11,9 +10,11 @@ import (
 	"time"
 
 	"github.com/Viet-ph/redis-go/config"
+	"github.com/Viet-ph/redis-go/internal/aof"
 	"github.com/Viet-ph/redis-go/internal/command"
 	custom_err "github.com/Viet-ph/redis-go/internal/error"
 	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/logger"
 	"github.com/Viet-ph/redis-go/internal/proto"
 	"github.com/Viet-ph/redis-go/internal/rdb"
 
@@ -31,6 +32,14 @@ type AsyncServer struct {
 	master        *connection.Conn
 	taskQueue     *queue.TaskQueue
 	cmdHandler    *command.Handler
+	aof           *aof.Aof
+
+	// Last time idle clients were looked for and expired keys deleted
+	lastClientsCron time.Time
+	lastExpireCycle time.Time
+
+	// Blocked clients with commands left in their query buffer
+	pendingClients map[*connection.Conn]struct{}
 }
 
 func NewAsyncServer(masterConn *connection.Conn, masterDatastore *datastore.Datastore) (*AsyncServer, error) {
@@ -62,32 +71,24 @@ func NewAsyncServer(masterConn *connection.Conn, masterDatastore *datastore.Data
 	handler := command.NewCmdHandler(taskQueue)
 	command.SetupCommands(handler)
 
-	// Master instance should read and unmarshall RDB file if has any
+	// Master instance should load the AOF if enabled, or read and
+	// unmarshall RDB file if has any
 	var (
-		expiry  map[string]time.Time
-		storage map[string]*datastore.Data
-		ds      *datastore.Datastore
+		ds         *datastore.Datastore
+		appendOnly *aof.Aof
 	)
 	if masterConn == nil && masterDatastore == nil {
-		rawRdb, err := rdb.ReadRdbFile()
+		if config.AppendOnly {
+			ds, appendOnly, err = openAppendOnlyFile(handler, taskQueue)
+		} else {
+			ds, err = loadRdbFile(taskQueue)
+		}
 		if err != nil {
 			return nil, err
 		}
-
-		if len(rawRdb) != 0 {
-			storage, expiry, err = rdb.RdbUnMarshall(rawRdb)
-			if err != nil {
-				return nil, err
-			}
-			fmt.Println(storage)
-		} else {
-			storage = make(map[string]*datastore.Data)
-			expiry = make(map[string]time.Time)
-		}
-		ds = datastore.NewDatastore(storage, expiry)
-		rdb.PersistData(ds)
 	} else {
 		ds = masterDatastore
+		ds.SetReplica(true)
 	}
 
 	server := &AsyncServer{
@@ -96,6 +97,9 @@ func NewAsyncServer(masterConn *connection.Conn, masterDatastore *datastore.Data
 		master:     masterConn,
 		taskQueue:  taskQueue,
 		cmdHandler: handler,
+		aof:        appendOnly,
+
+		pendingClients: make(map[*connection.Conn]struct{}),
 	}
 
 	return server, nil
@@ -107,24 +111,24 @@ func (server *AsyncServer) Start() {
 	// Start listening
 	err := unix.Listen(server.fd, config.MaximumClients)
 	if err != nil {
-		fmt.Println("error while listening", err)
+		logger.Warning("error while listening", err)
 		os.Exit(1)
 	}
 
 	//Start of IO multiplexing
-	fmt.Println("ready to accept connections")
+	logger.Notice("ready to accept connections")
 
 	// Create an epoll instance
 	server.iomultiplexer, err = mul.New(config.MaximumClients)
 	if err != nil {
-		fmt.Println("Error creating epoll instance", err)
+		logger.Warning("Error creating epoll instance", err)
 		os.Exit(1)
 	}
 
 	// Add listener socket to epoll
 	err = server.iomultiplexer.AddWatchFd(server.fd, mul.OpRead)
 	if err != nil {
-		fmt.Println("Error adding listener to epoll:", err)
+		logger.Warning("Error adding listener to epoll:", err)
 		os.Exit(1)
 	}
 
@@ -135,10 +139,15 @@ func (server *AsyncServer) Start() {
 	for {
 		//Check task queue for any tasks that available
 		server.taskQueue.DrainQueue()
+		server.processPendingClients()
+		server.clientsCron()
+		server.activeExpireCron()
 
-		events, err := server.iomultiplexer.Poll(1000)
+		// Keep the poll timeout short so tasks queued from other goroutines
+		// (e.g. blocking command timeouts) don't wait for the next I/O event
+		events, err := server.iomultiplexer.Poll(100 * time.Millisecond)
 		if len(events) > 0 {
-			fmt.Println("polled " + strconv.Itoa(len(events)) + " events")
+			logger.Debug("polled " + strconv.Itoa(len(events)) + " events")
 		}
 		if err != nil {
 			// Many system calls will report the EINTR error code if a signal occurred
@@ -152,7 +161,7 @@ func (server *AsyncServer) Start() {
 
 			// Interupted system call error after timeout is given in Darwin.
 			// Print here just to examine the error, not to block the event loop.
-			fmt.Printf("Error during epoll wait: %v\n", err)
+			logger.Warningf("Error during epoll wait: %v\n", err)
 			continue
 		}
 
@@ -161,7 +170,7 @@ func (server *AsyncServer) Start() {
 			if fd == server.fd {
 				err = server.acceptNewConnection()
 				if err != nil {
-					fmt.Println("Error connecting to client: ", err)
+					logger.Warning("Error connecting to client: ", err)
 					continue
 				}
 
@@ -171,7 +180,7 @@ func (server *AsyncServer) Start() {
 						err := server.handleReadableEvent(conn)
 						//Close connection on data copy from kernel space -> user space/command parsing errors
 						if err != nil {
-							fmt.Println("Error occured while serving client: " + err.Error())
+							logger.Warning("Error occured while serving client: " + err.Error())
 							server.CloseConnecttion(conn)
 							continue
 						}
@@ -194,29 +203,34 @@ func (server *AsyncServer) Start() {
 func (server *AsyncServer) acceptNewConnection() error {
 	connFD, sa, err := unix.Accept(server.fd)
 	if err != nil {
-		fmt.Println("Error accepting connection:", err)
+		logger.Warning("Error accepting connection:", err)
 		return err
 	}
+	info.TotalConnectionsReceived++
+	if len(connection.ConnectedClients) >= config.MaximumClients {
+		rejectConnection(connFD)
+		return nil
+	}
 
 	//Set new client socket fd as non-block so it wont block
 	//the current thread while waiting for NIC doing its job
 	err = unix.SetNonblock(connFD, true)
 	if err != nil {
-		fmt.Printf("Error setting file descriptor %d as non-block: %v\n", connFD, err)
+		logger.Warningf("Error setting file descriptor %d as non-block: %v\n", connFD, err)
 		return err
 	}
 
 	//Add new client socket fd to epoll interesting list
 	err = server.iomultiplexer.AddWatchFd(connFD, mul.OpRead)
 	if err != nil {
-		fmt.Println("Error subscribing client file descriptor to epoll:", err)
+		logger.Warning("Error subscribing client file descriptor to epoll:", err)
 		return err
 	}
 
 	//Add new client into connected clients map
 	conn, err := connection.NewConn(connFD, sa)
 	if err != nil {
-		fmt.Println("Error create new connection: ", err)
+		logger.Warning("Error create new connection: ", err)
 		return err
 	}
 	connection.ConnectedClients[int(connFD)] = conn
@@ -224,65 +238,127 @@ func (server *AsyncServer) acceptNewConnection() error {
 
 	//Print out client's ip and port
 	ip, port := connection.ConnectedClients[int(connFD)].GetRemoteAddress()
-	fmt.Printf("Client connected: IP = %s, Port = %d\n", ip.String(), port)
+	logger.Verbosef("Client connected: IP = %s, Port = %d\n", ip.String(), port)
 
 	return nil
 }
 
 func (server *AsyncServer) handleReadableEvent(conn *connection.Conn) error {
-	//Read message sent from client
-	underlyBuf := make([]byte, 0, config.DefaultMessageSize)
-	buffer := bytes.NewBuffer(underlyBuf)
-	bytesRead, err := conn.Read(buffer)
+	//Read message sent from client, appended to what's left of the previous reads
+	_, err := conn.Read()
 	if err != nil {
 		return err
 	}
+	conn.LastInteraction = time.Now()
 
-	var rawCommand []byte
-	if info.Role == "master" {
-		// Make a seperate byte slice of the received command to propagate to replicas
-		rawCommand = make([]byte, bytesRead)
-		copy(rawCommand, underlyBuf[:bytesRead])
+	return server.processQueryBuffer(conn)
+}
+
+// Executes every complete command in the query buffer of conn, in order.
+// An incomplete command is left in the buffer until the rest is read.
+func (server *AsyncServer) processQueryBuffer(conn *connection.Conn) error {
+	for conn.QueryBuf().Len() > 0 && !conn.IsClosed {
+		// Commands sent after a blocking command wait for it to be served
+		if server.cmdHandler.IsBlocked(conn) {
+			server.pendingClients[conn] = struct{}{}
+			return nil
+		}
+
+		//If it's a command, parse it into command object
+		cmd, rawCommand, err := command.Parse(conn.QueryBuf())
+		if errors.Is(err, custom_err.ErrorIncompleteRESP) {
+			return nil
+		}
+		if err != nil {
+			// Tell the client what's wrong before closing it
+			if errors.Is(err, proto.ErrProtocol) {
+				server.respond(conn, command.Command{}, fmt.Errorf("ERR %w", err))
+			}
+			return fmt.Errorf("error parsing command: %w", err)
+		}
+		logger.Debug(cmd)
+
+		err = server.processCommand(conn, cmd, rawCommand)
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	//If it's a command, parse it into command object
-	cmd, err := command.Parse(buffer)
-	if err != nil {
-		return fmt.Errorf("error parsing command")
+// Resumes clients that stopped processing their query buffer while
+// blocked, once they are served or timed out
+func (server *AsyncServer) processPendingClients() {
+	for conn := range server.pendingClients {
+		if server.cmdHandler.IsBlocked(conn) && !conn.IsClosed {
+			continue
+		}
+
+		delete(server.pendingClients, conn)
+		err := server.processQueryBuffer(conn)
+		if err != nil {
+			logger.Warning("Error occured while serving client: " + err.Error())
+			server.CloseConnecttion(conn)
+		}
 	}
-	fmt.Println(cmd)
+}
 
+func (server *AsyncServer) processCommand(conn *connection.Conn, cmd command.Command, rawCommand []byte) error {
 	// Keep track of latest client and replica serving
-	err = server.cmdHandler.SetCurrentConn(conn)
+	err := server.cmdHandler.SetCurrentConn(conn)
 	if err != nil {
 		return err
 	}
 
-	//Execute command
-	result, readyToRespond := command.ExecuteCmd(cmd, server.store)
-
-	//Send result as response back to client and handle any possible errors
-	if readyToRespond {
-		server.respond(conn, cmd, result)
+	// Clients must authenticate first when a password is set, except the
+	// master of a replica. HELLO can authenticate too.
+	if conn != server.master && !server.cmdHandler.Authenticated(conn) && cmd.Cmd != "AUTH" && cmd.Cmd != "HELLO" {
+		server.respond(conn, cmd, custom_err.ErrorNoAuth)
+		return nil
 	}
 
-	//Propagate command to slaves if has any
-	if info.Role == "master" && command.IsWriteCommand(cmd) {
-		server.propagateCmd(rawCommand)
-		tracker := command.OffsTracking[conn]
-		tracker.CapturedOffs += bytesRead
+	//Execute command. On replicas, the commands of the master still see
+	//the keys that expired
+	server.store.SetFromMaster(conn == server.master)
+	result, readyToRespond := server.cmdHandler.ExecuteCmd(cmd, server.store)
+	server.store.SetFromMaster(false)
+	info.TotalCommandsProcessed++
+
+	// The command may have pushed elements to keys other clients are blocked on
+	server.cmdHandler.ServeBlockedClients(server.store)
+
+	//Propagate command to slaves if has any, preceded by the deletion of the
+	//keys it found expired and followed by any commands the handlers asked
+	//to propagate on top of it
+	propagateCmd, propagated := server.cmdHandler.PendingPropagation()
+	if info.Role == "master" {
+		if propagateCmd && command.IsWriteCommand(cmd) {
+			propagated = append(rawCommand, propagated...)
+		}
+		propagated = append(expiredKeysPropagation(server.store), propagated...)
+		if len(propagated) > 0 {
+			server.propagate(propagated)
+			if tracker, exists := command.OffsTracking[conn]; exists {
+				tracker.CapturedOffs += len(propagated)
+			}
+		}
+	} else if command.IsWriteCommand(cmd) {
+		// Replicas must keep track of the offset
+		info.ReplicationOffset += len(rawCommand)
 	}
 
-	if command.IsWriteCommand(cmd) {
-		// Master and replicas must keep track of the offset
-		info.ReplicationOffset += bytesRead
+	//Send result as response back to client and handle any possible errors.
+	//Done last so with appendfsync always the write is on disk before the reply
+	if readyToRespond {
+		server.respond(conn, cmd, result)
 	}
 	return nil
 }
 
 func (server *AsyncServer) respond(conn *connection.Conn, cmd command.Command, result any) {
 	encoder := proto.NewEncoder()
-	err := encoder.Encode(result, true)
+	encoder.SetProtocol(conn.Protocol)
+	err := encoder.Encode(result, false)
 	if err != nil {
 		encoder.Reset()
 		result = errors.New("error encoding resp")
@@ -293,12 +369,19 @@ func (server *AsyncServer) respond(conn *connection.Conn, cmd command.Command, r
 
 	//Queue datas to write and write immediately after
 	if strings.Contains(cmd.Cmd, "PSYNC") {
-		rawRdb, _ := rdb.ReadRdbFile()
-		if len(rawRdb) == 0 {
-			rawRdb, _ = rdb.RdbMarshall(server.store)
+		// The replica loads the dataset as it is now, sent like a bulk
+		// string without the trailing CRLF. Commands propagated from now
+		// on follow it.
+		var rawRdb []byte
+		rawRdb, err = rdb.RdbMarshall(server.store)
+		if err != nil {
+			logger.Warning("Error marshalling RDB for replica: " + err.Error())
+			server.CloseConnecttion(conn)
+			return
 		}
-		err = conn.QueueDatas(byteSliceResult, rawRdb)
-		fmt.Printf("Accepted replication fd %d\n", conn.Fd)
+		rdbHeader := []byte(fmt.Sprintf("%c%d%s", proto.BulkStringPrefix, len(rawRdb), proto.CRLF))
+		err = conn.QueueDatas(byteSliceResult, rdbHeader, rawRdb)
+		logger.Noticef("Accepted replication fd %d\n", conn.Fd)
 		server.promoteToSlave(conn)
 	} else {
 		err = conn.QueueDatas(byteSliceResult)
@@ -309,7 +392,7 @@ func (server *AsyncServer) respond(conn *connection.Conn, cmd command.Command, r
 }
 
 func (server *AsyncServer) handleWritableEvent(conn *connection.Conn) {
-	fmt.Println("Seding response...")
+	logger.Debug("Seding response...")
 	err := conn.DrainQueue()
 	if err != nil {
 		server.handleWritingError(err, conn)
@@ -324,12 +407,12 @@ func (server *AsyncServer) handleWritableEvent(conn *connection.Conn) {
 func (server *AsyncServer) handleWritingError(err error, conn *connection.Conn) {
 	if err == custom_err.ErrorNotFullyWritten {
 		//Data not fully written, resubscribe with write event and return to wait for write event
-		fmt.Printf("Got write error: %v\n", err.Error())
+		logger.Warningf("Got write error: %v\n", err.Error())
 		server.iomultiplexer.ModifyWatchingFd(conn.Fd, mul.OpWrite)
 		return
 	}
 	// Handle other errors (e.g., client disconnected)	 	 ``
-	fmt.Printf("Got unexpected write error: %v\n", err.Error())
+	logger.Warningf("Got unexpected write error: %v\n", err.Error())
 	server.CloseConnecttion(conn)
 }
 
@@ -338,10 +421,11 @@ func (server *AsyncServer) CloseConnecttion(client *connection.Conn) {
 	// Close the socket, cleanup resources
 	// Remove FD from epoll interest list
 	server.iomultiplexer.RemoveWatchFd(client.Fd)
+	server.cmdHandler.ReleaseClient(client, server.store)
 	client.Close()
 
 	ip, port := client.GetRemoteAddress()
-	fmt.Printf("Client disconnected. IP = %s, Port = %d\n", ip.String(), port)
+	logger.Verbosef("Client disconnected. IP = %s, Port = %d\n", ip.String(), port)
 }
 
 func (server *AsyncServer) close() {
@@ -349,6 +433,15 @@ func (server *AsyncServer) close() {
 	unix.Close(server.fd)
 }
 
+// Sends commands to the replicas and appends them to the append only file
+func (server *AsyncServer) propagate(cmds []byte) {
+	server.feedAppendOnlyFile(cmds)
+	server.propagateCmd(cmds)
+
+	// Master must keep track of the offset
+	info.ReplicationOffset += len(cmds)
+}
+
 func (server *AsyncServer) propagateCmd(rawCmd []byte) {
 	if len(connection.ConnectedReplicas) == 0 {
 		return
@@ -357,12 +450,36 @@ func (server *AsyncServer) propagateCmd(rawCmd []byte) {
 	for _, replica := range connection.ConnectedReplicas {
 		err := replica.Propagate(rawCmd)
 		if err != nil {
-			fmt.Println("Error propergate command to slave: " + err.Error())
+			logger.Warning("Error propergate command to slave: " + err.Error())
 			continue
 		}
 	}
 }
 
+func (server *AsyncServer) feedAppendOnlyFile(cmds []byte) {
+	if server.aof == nil {
+		return
+	}
+
+	err := server.aof.Write(cmds)
+	if err != nil {
+		logger.Warning("Error writing to the append only file: " + err.Error())
+		if config.AppendFsync == aof.FsyncAlways {
+			// Replies promise the write is on disk, can't keep serving without it
+			os.Exit(1)
+		}
+		return
+	}
+
+	if server.aof.RewriteNeeded() {
+		logger.Notice("Starting automatic rewriting of AOF")
+		err = server.cmdHandler.RewriteAppendOnlyFile(server.store)
+		if err != nil {
+			logger.Warning("Error rewriting the append only file: " + err.Error())
+		}
+	}
+}
+
 func (server *AsyncServer) promoteToSlave(conn *connection.Conn) {
 	connection.ConnectedReplicas[conn.Fd] = connection.NewReplica(conn)
 	delete(connection.ConnectedClients, conn.Fd)
@@ -382,7 +499,7 @@ func (server *AsyncServer) setupMaster() error {
 	//the current thread while waiting for NIC doing its job
 	err := unix.SetNonblock(fd, true)
 	if err != nil {
-		fmt.Printf("Error setting file descriptor %d as non-block: %v\n", fd, err)
+		logger.Warningf("Error setting file descriptor %d as non-block: %v\n", fd, err)
 		return err
 	}
 
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"time"
+
+	"github.com/Viet-ph/redis-go/config"
+	"github.com/Viet-ph/redis-go/internal/connection"
+	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/logger"
+	"golang.org/x/sys/unix"
+)
+
+const errMaxClients = "-ERR max number of clients reached\r\n"
+
+// Tells a client accepted over maxclients why it's closed right away
+func rejectConnection(fd int) {
+	info.RejectedConnections++
+	unix.Write(fd, []byte(errMaxClients))
+	unix.Close(fd)
+	logger.Verbose("Rejected connection, max number of clients reached")
+}
+
+// Closes clients idle for longer than the timeout, once per second. The
+// master, replicas and blocked clients are never closed.
+func (server *AsyncServer) clientsCron() {
+	now := time.Now()
+	if config.Timeout == 0 || now.Sub(server.lastClientsCron) < time.Second {
+		return
+	}
+	server.lastClientsCron = now
+
+	timeout := time.Duration(config.Timeout) * time.Second
+	for _, conn := range connection.ConnectedClients {
+		if conn == server.master || connection.IsReplica(conn) || server.cmdHandler.IsBlocked(conn) {
+			continue
+		}
+		if now.Sub(conn.LastInteraction) > timeout {
+			logger.Verbose("Closing idle client")
+			server.CloseConnecttion(conn)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"time"
+
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/info"
+	"github.com/Viet-ph/redis-go/internal/proto"
+)
+
+// Like Redis, the active expire cycle runs 10 times per second and each
+// run takes at most a quarter of the time in between
+const (
+	activeExpirePeriod = 100 * time.Millisecond
+	activeExpireBudget = activeExpirePeriod / 4
+)
+
+// Deletes expired keys nobody accesses anymore, from the event loop so it
+// doesn't race with commands
+func (server *AsyncServer) activeExpireCron() {
+	start := time.Now()
+	if start.Sub(server.lastExpireCycle) < activeExpirePeriod {
+		return
+	}
+	server.lastExpireCycle = start
+
+	result := server.store.ActiveExpireCycle(activeExpireBudget)
+	if dels := expiredKeysPropagation(server.store); len(dels) > 0 {
+		server.propagate(dels)
+	}
+	info.ExpireCycleTime += time.Since(start)
+	if result.TimedOut {
+		info.ExpiredTimeCapReachedCount++
+	}
+	if result.Sampled > 0 {
+		current := float64(result.Expired) * 100 / float64(result.Sampled)
+		info.ExpiredStalePerc = current*0.05 + info.ExpiredStalePerc*0.95
+	}
+}
+
+// DEL commands for the keys the master expired, so the replicas and the
+// append only file delete them too
+func expiredKeysPropagation(store *datastore.Datastore) []byte {
+	expired := store.TakeExpired()
+	if len(expired) == 0 {
+		return nil
+	}
+
+	encoder := proto.NewEncoder()
+	for _, key := range expired {
+		encoder.Encode([]string{"DEL", key}, false)
+	}
+	return encoder.GetBufValue()
+}
@@ -0,0 +1,133 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/Viet-ph/redis-go/config"
+	"github.com/Viet-ph/redis-go/internal/aof"
+	"github.com/Viet-ph/redis-go/internal/command"
+	"github.com/Viet-ph/redis-go/internal/connection"
+	"github.com/Viet-ph/redis-go/internal/datastore"
+	"github.com/Viet-ph/redis-go/internal/logger"
+	"github.com/Viet-ph/redis-go/internal/queue"
+	"github.com/Viet-ph/redis-go/internal/rdb"
+)
+
+// Loads the dataset from the RDB file, if has any
+func loadRdbFile(taskQueue *queue.TaskQueue) (*datastore.Datastore, error) {
+	rawRdb, err := rdb.ReadRdbFile()
+	if err != nil {
+		return nil, err
+	}
+
+	return loadRdb(rawRdb, taskQueue)
+}
+
+func loadRdb(rawRdb []byte, taskQueue *queue.TaskQueue) (*datastore.Datastore, error) {
+	var ds *datastore.Datastore
+	if len(rawRdb) != 0 {
+		storage, expiry, err := rdb.RdbUnMarshall(rawRdb)
+		if err != nil {
+			return nil, err
+		}
+		logger.Debug(storage)
+		ds = datastore.NewDatastore(storage, expiry)
+	} else {
+		ds = datastore.NewDatastore(nil, nil)
+	}
+
+	rdb.PersistData(ds, taskQueue)
+	return ds, nil
+}
+
+// Loads the dataset from the append only file and opens it for writing.
+// The first time the AOF is enabled, the dataset comes from the RDB file
+// and becomes the base of the new AOF.
+func openAppendOnlyFile(handler *command.Handler, taskQueue *queue.TaskQueue) (*datastore.Datastore, *aof.Aof, error) {
+	dir := filepath.Join(config.RdbDir, config.AppendDirname)
+
+	// Append only files used to be a single file next to the RDB file
+	err := aof.UpgradeLegacyFile(filepath.Join(config.RdbDir, config.AppendFilename), dir, config.AppendFilename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var ds *datastore.Datastore
+	if aof.Exists(dir, config.AppendFilename) {
+		ds, err = loadAppendOnlyFile(dir, handler, taskQueue)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		ds, err = loadRdbFile(taskQueue)
+		if err != nil {
+			return nil, nil, err
+		}
+		logger.Notice("Creating AOF base file on server start")
+		snapshot, err := rdb.AofBaseMarshall(ds)
+		if err != nil {
+			return nil, nil, err
+		}
+		err = aof.CreateBase(dir, config.AppendFilename, snapshot)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	appendOnly, err := aof.Open(dir, config.AppendFilename, config.AppendFsync)
+	if err != nil {
+		return nil, nil, err
+	}
+	handler.SetAppendOnlyFile(appendOnly)
+
+	return ds, appendOnly, nil
+}
+
+// Loads the base of the append only file in dir and replays the commands
+// after it. Commands run through the handler on behalf of a fake client
+// which never gets any reply, so transactions in the file are executed
+// like they were originally.
+func loadAppendOnlyFile(dir string, handler *command.Handler, taskQueue *queue.TaskQueue) (*datastore.Datastore, error) {
+	var ds *datastore.Datastore
+	loadBase := func(rawRdb []byte) error {
+		var err error
+		ds, err = loadRdb(rawRdb, taskQueue)
+		return err
+	}
+
+	loader := &connection.Conn{Fd: -1}
+	replay := func(args []string) error {
+		cmd := command.Command{
+			Cmd:  strings.ToUpper(args[0]),
+			Args: args[1:],
+		}
+		if _, ok := command.GetCmdMetadata(cmd.Cmd); !ok {
+			return fmt.Errorf("unknown command '%s'", args[0])
+		}
+
+		err := handler.SetCurrentConn(loader)
+		if err != nil {
+			return err
+		}
+		handler.ExecuteCmd(cmd, ds)
+
+		// Nothing to propagate, replicas sync from the loaded dataset
+		handler.PendingPropagation()
+		return nil
+	}
+
+	loaded, err := aof.Load(dir, config.AppendFilename, config.AofLoadTruncated, loadBase, replay)
+	if err != nil {
+		return nil, err
+	}
+	handler.ReleaseClient(loader, ds)
+	// Replayed commands were saved already, along with the deletion of
+	// the keys that expired meanwhile
+	ds.ResetDirty()
+	ds.TakeExpired()
+
+	logger.Noticef("Loaded %d commands from the append only file\n", loaded)
+	return ds, nil
+}